@@ -4,13 +4,13 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
-	"errors"
 	"net"
 
-	"decred.org/dcrwallet/ticketbuyer"
 	w "decred.org/dcrwallet/wallet"
 	"github.com/decred/dcrd/chaincfg/v3"
 	"github.com/decred/dcrd/dcrutil/v3"
+	"github.com/decred/dcrd/wire"
+	"github.com/decred/go-socks/socks"
 	"github.com/planetdecred/dcrlibwallet/internal/certs"
 )
 
@@ -27,7 +27,7 @@ func (mw *MultiWallet) AddAccountMixerNotificationListener(accountMixerNotificat
 	defer mw.notificationListenersMu.Unlock()
 
 	if _, ok := mw.accountMixerNotificationListener[uniqueIdentifier]; ok {
-		return errors.New(ErrListenerAlreadyExist)
+		return newError(ErrListenerAlreadyExist)
 	}
 
 	mw.accountMixerNotificationListener[uniqueIdentifier] = accountMixerNotificationListener
@@ -47,28 +47,28 @@ func (mw *MultiWallet) RemoveAccountMixerNotificationListener(uniqueIdentifier s
 func (wallet *Wallet) CreateMixerAccounts(mixedAccount, unmixedAccount, privPass string) error {
 	accountMixerConfigSet := wallet.ReadBoolConfigValueForKey(AccountMixerConfigSet, false)
 	if accountMixerConfigSet {
-		return errors.New(ErrInvalid)
+		return walletError(wallet.ID, "CreateMixerAccounts", newError(ErrInvalid))
 	}
 
 	if wallet.HasAccount(mixedAccount) || wallet.HasAccount(unmixedAccount) {
-		return errors.New(ErrExist)
+		return walletError(wallet.ID, "CreateMixerAccounts", newError(ErrExist))
 	}
 
 	err := wallet.UnlockWallet([]byte(privPass))
 	if err != nil {
-		return err
+		return walletError(wallet.ID, "CreateMixerAccounts", err)
 	}
 
 	defer wallet.LockWallet()
 
 	mixedAccountNumber, err := wallet.NextAccount(mixedAccount)
 	if err != nil {
-		return err
+		return walletError(wallet.ID, "CreateMixerAccounts", err)
 	}
 
 	unmixedAccountNumber, err := wallet.NextAccount(unmixedAccount)
 	if err != nil {
-		return err
+		return walletError(wallet.ID, "CreateMixerAccounts", err)
 	}
 
 	wallet.SetInt32ConfigValueForKey(AccountMixerMixedAccount, mixedAccountNumber)
@@ -83,23 +83,23 @@ func (wallet *Wallet) CreateMixerAccounts(mixedAccount, unmixedAccount, privPass
 func (wallet *Wallet) SetAccountMixerConfig(mixedAccount, unmixedAccount int32, privPass string) error {
 
 	if mixedAccount == unmixedAccount {
-		return errors.New(ErrInvalid)
+		return walletError(wallet.ID, "SetAccountMixerConfig", newError(ErrInvalid))
 	}
 
 	// Verify that account numbers are correct
 	_, err := wallet.GetAccount(mixedAccount)
 	if err != nil {
-		return errors.New(ErrNotExist)
+		return walletError(wallet.ID, "SetAccountMixerConfig", newError(ErrNotExist))
 	}
 
 	_, err = wallet.GetAccount(unmixedAccount)
 	if err != nil {
-		return errors.New(ErrNotExist)
+		return walletError(wallet.ID, "SetAccountMixerConfig", newError(ErrNotExist))
 	}
 
 	err = wallet.UnlockWallet([]byte(privPass))
 	if err != nil {
-		return err
+		return walletError(wallet.ID, "SetAccountMixerConfig", err)
 	}
 	wallet.LockWallet()
 
@@ -135,14 +135,14 @@ func (wallet *Wallet) ClearMixerConfig() {
 func (mw *MultiWallet) ReadyToMix(walletID int) (bool, error) {
 	wallet := mw.WalletWithID(walletID)
 	if wallet == nil {
-		return false, errors.New(ErrNotExist)
+		return false, walletError(walletID, "ReadyToMix", newError(ErrNotExist))
 	}
 
 	unmixedAccount := wallet.ReadInt32ConfigValueForKey(AccountMixerUnmixedAccount, -1)
 
 	hasMixableOutput, err := wallet.accountHasMixableOutput(unmixedAccount)
 	if err != nil {
-		return false, translateError(err)
+		return false, walletError(walletID, "ReadyToMix", err)
 	}
 
 	return hasMixableOutput, nil
@@ -152,85 +152,154 @@ func (mw *MultiWallet) ReadyToMix(walletID int) (bool, error) {
 func (mw *MultiWallet) StartAccountMixer(walletID int, walletPassphrase string) error {
 
 	if !mw.IsConnectedToDecredNetwork() {
-		return errors.New(ErrNotConnected)
+		return walletError(walletID, "StartAccountMixer", newError(ErrNotConnected))
 	}
 
 	wallet := mw.WalletWithID(walletID)
 	if wallet == nil {
-		return errors.New(ErrNotExist)
+		return walletError(walletID, "StartAccountMixer", newError(ErrNotExist))
 	}
 
-	tb := ticketbuyer.New(wallet.internal)
-
 	mixedAccount := wallet.ReadInt32ConfigValueForKey(AccountMixerMixedAccount, -1)
 	unmixedAccount := wallet.ReadInt32ConfigValueForKey(AccountMixerUnmixedAccount, -1)
 
 	hasMixableOutput, err := wallet.accountHasMixableOutput(unmixedAccount)
 	if err != nil {
-		return translateError(err)
+		return walletError(walletID, "StartAccountMixer", err)
 	} else if !hasMixableOutput {
-		return errors.New(ErrNoMixableOutput)
+		return walletError(walletID, "StartAccountMixer", newError(ErrNoMixableOutput))
 	}
 
-	var shufflePort = TestnetShufflePort
-	var dialCSPPServer func(ctx context.Context, network, addr string) (net.Conn, error)
-	if mw.chainParams.Net == chaincfg.MainNetParams().Net {
-		shufflePort = MainnetShufflePort
+	csppServer, dialCSPPServer, err := mw.csppDialer()
+	if err != nil {
+		return walletError(walletID, "StartAccountMixer", err)
+	}
 
-		pool := x509.NewCertPool()
-		pool.AppendCertsFromPEM([]byte(certs.CSPP))
+	mixer := &accountMixer{
+		mw:             mw,
+		wallet:         wallet,
+		csppServer:     csppServer,
+		dialCSPPServer: dialCSPPServer,
+		mixedAccount:   uint32(mixedAccount),
+		unmixedAccount: uint32(unmixedAccount),
+		mixing:         make(map[wire.OutPoint]bool),
+	}
 
-		csppTLSConfig := new(tls.Config)
-		csppTLSConfig.ServerName = ShuffleServer
-		csppTLSConfig.RootCAs = pool
+	// the mixer only locks the wallet again if it unlocked it, a wallet
+	// unlocked by the user for something else is left unlocked.
+	mixer.ownsUnlock = wallet.IsLocked()
+	err = wallet.UnlockWallet([]byte(walletPassphrase))
+	if err != nil {
+		return walletError(walletID, "StartAccountMixer", err)
+	}
 
-		dailer := new(net.Dialer)
-		dialCSPPServer = func(ctx context.Context, network, addr string) (net.Conn, error) {
-			conn, err := dailer.DialContext(context.Background(), network, addr)
-			if err != nil {
-				return nil, err
-			}
+	mixer.sessionID, err = wallet.startMixerSession()
+	if err != nil {
+		log.Errorf("[%d] Error saving mixer session: %v", walletID, err)
+	}
+
+	mw.runAccountMixer(mixer)
+	return nil
+}
 
-			conn = tls.Client(conn, csppTLSConfig)
-			return conn, nil
+// SetCSPPServer configures the CoinShuffle++ server used by the account mixer
+// on the current network, e.g. a private coordinator or a local server for
+// testing. certificate is the PEM encoded TLS certificate of the server and
+// may be empty if the server certificate is signed by a trusted CA. proxy is
+// the optional address of a SOCKS5 proxy used to connect to the server. It
+// takes effect the next time the account mixer is started.
+func (mw *MultiWallet) SetCSPPServer(server, certificate, proxy string) error {
+	if _, err := NormalizeAddress(server, mw.defaultShufflePort()); err != nil {
+		return newError(ErrInvalidAddress)
+	}
+	if certificate != "" {
+		if err := validatePinnedCertificate([]byte(certificate)); err != nil {
+			return err
+		}
+	}
+	if proxy != "" {
+		if _, _, err := net.SplitHostPort(proxy); err != nil {
+			return newError(ErrInvalidAddress)
 		}
 	}
 
-	tb.AccessConfig(func(c *ticketbuyer.Config) {
-		c.MixedAccountBranch = MixedAccountBranch
-		c.MixedAccount = uint32(mixedAccount)
-		c.ChangeAccount = uint32(unmixedAccount)
-		c.CSPPServer = ShuffleServer + ":" + shufflePort
-		c.DialCSPPServer = dialCSPPServer
-		c.BuyTickets = false
-		c.MixChange = true
-	})
+	mw.SaveUserConfigValue(CSPPServerConfigKey, server)
+	mw.SaveUserConfigValue(CSPPCertConfigKey, certificate)
+	mw.SaveUserConfigValue(CSPPProxyConfigKey, proxy)
+	return nil
+}
 
-	err = wallet.UnlockWallet([]byte(walletPassphrase))
+// ClearCSPPServer restores the default CoinShuffle++ server of the current
+// network.
+func (mw *MultiWallet) ClearCSPPServer() {
+	mw.DeleteUserConfigValueForKey(CSPPServerConfigKey)
+	mw.DeleteUserConfigValueForKey(CSPPCertConfigKey)
+	mw.DeleteUserConfigValueForKey(CSPPProxyConfigKey)
+}
+
+// CSPPServer returns the address of the CoinShuffle++ server used by the
+// account mixer.
+func (mw *MultiWallet) CSPPServer() string {
+	server := mw.ReadStringConfigValueForKey(CSPPServerConfigKey)
+	if server == "" {
+		server = ShuffleServer
+	}
+
+	address, err := NormalizeAddress(server, mw.defaultShufflePort())
 	if err != nil {
-		return translateError(err)
+		return server
 	}
+	return address
+}
 
-	go func() {
-		log.Info("Running account mixer")
-		if mw.accountMixerNotificationListener != nil {
-			mw.publishAccountMixerStarted(walletID)
-		}
+func (mw *MultiWallet) defaultShufflePort() string {
+	if mw.chainParams.Net == chaincfg.MainNetParams().Net {
+		return MainnetShufflePort
+	}
+	return TestnetShufflePort
+}
 
-		ctx, cancel := mw.contextWithShutdownCancel()
-		wallet.cancelAccountMixer = cancel
-		err = tb.Run(ctx, []byte(walletPassphrase))
-		if err != nil {
-			log.Errorf("AccountMixer instance errored: %v", err)
-		}
+// csppDialer returns the address of the CoinShuffle++ server and a function
+// that connects to it over TLS, through the configured proxy if any.
+func (mw *MultiWallet) csppDialer() (string, w.DialFunc, error) {
+	server := mw.CSPPServer()
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		return "", nil, newError(ErrInvalidAddress)
+	}
+
+	csppTLSConfig := &tls.Config{
+		ServerName: host,
+		MinVersion: tls.VersionTLS12,
+	}
 
-		wallet.cancelAccountMixer = nil
-		if mw.accountMixerNotificationListener != nil {
-			mw.publishAccountMixerEnded(walletID)
+	certificate := mw.ReadStringConfigValueForKey(CSPPCertConfigKey)
+	if certificate == "" && mw.ReadStringConfigValueForKey(CSPPServerConfigKey) == "" &&
+		mw.chainParams.Net == chaincfg.MainNetParams().Net {
+		certificate = certs.CSPP
+	}
+	if certificate != "" {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM([]byte(certificate))
+		csppTLSConfig.RootCAs = pool
+	}
+
+	var dial func(ctx context.Context, network, addr string) (net.Conn, error)
+	if proxy := mw.ReadStringConfigValueForKey(CSPPProxyConfigKey); proxy != "" {
+		dial = (&socks.Proxy{Addr: proxy}).DialContext
+	} else {
+		dial = new(net.Dialer).DialContext
+	}
+
+	dialCSPPServer := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
 		}
-	}()
 
-	return nil
+		return tls.Client(conn, csppTLSConfig), nil
+	}
+	return server, dialCSPPServer, nil
 }
 
 // StopAccountMixer stops the active account mixer
@@ -238,11 +307,19 @@ func (mw *MultiWallet) StopAccountMixer(walletID int) error {
 
 	wallet := mw.WalletWithID(walletID)
 	if wallet == nil {
-		return errors.New(ErrNotExist)
+		return walletError(walletID, "StopAccountMixer", newError(ErrNotExist))
 	}
 
+	wallet.accountMixerMu.Lock()
+	defer wallet.accountMixerMu.Unlock()
+
 	if wallet.cancelAccountMixer == nil {
-		return errors.New(ErrInvalid)
+		// a mixer suspended by CancelSync is not resumed once stopped
+		if mixer := wallet.accountMixer; mixer != nil && mixer.isSuspended() {
+			wallet.endAccountMixer(mixer)
+			return nil
+		}
+		return walletError(walletID, "StopAccountMixer", newError(ErrInvalid))
 	}
 
 	wallet.cancelAccountMixer()
@@ -250,6 +327,36 @@ func (mw *MultiWallet) StopAccountMixer(walletID int) error {
 	return nil
 }
 
+// ResumeAccountMixer unlocks the wallet for the account mixer after
+// OnAccountMixerPassphraseRequired was published. The mixer locks the wallet
+// while it is paused and asks for the passphrase when it can mix again. It
+// resumes mixing from the next block.
+func (mw *MultiWallet) ResumeAccountMixer(walletID int, walletPassphrase string) error {
+	wallet := mw.WalletWithID(walletID)
+	if wallet == nil {
+		return walletError(walletID, "ResumeAccountMixer", newError(ErrNotExist))
+	}
+
+	mixer := wallet.runningAccountMixer()
+	if mixer == nil {
+		return walletError(walletID, "ResumeAccountMixer", newError(ErrInvalid))
+	}
+
+	mixer.mu.Lock()
+	defer mixer.mu.Unlock()
+
+	ownsUnlock := mixer.ownsUnlock || wallet.IsLocked()
+	err := wallet.UnlockWallet([]byte(walletPassphrase))
+	if err != nil {
+		return walletError(walletID, "ResumeAccountMixer", err)
+	}
+	mixer.ownsUnlock = ownsUnlock
+	if mixer.pauseReason == AccountMixerPausedPassphraseRequired {
+		mixer.pauseReason = ""
+	}
+	return nil
+}
+
 func (wallet *Wallet) accountHasMixableOutput(accountNumber int32) (bool, error) {
 
 	policy := w.OutputSelectionPolicy{
@@ -290,9 +397,23 @@ func (wallet *Wallet) accountHasMixableOutput(accountNumber int32) (bool, error)
 
 // IsAccountMixerActive returns true if account mixer is active
 func (wallet *Wallet) IsAccountMixerActive() bool {
+	wallet.accountMixerMu.Lock()
+	defer wallet.accountMixerMu.Unlock()
 	return wallet.cancelAccountMixer != nil
 }
 
+// runningAccountMixer returns the account mixer started by runAccountMixer if
+// it is still running.
+func (wallet *Wallet) runningAccountMixer() *accountMixer {
+	wallet.accountMixerMu.Lock()
+	defer wallet.accountMixerMu.Unlock()
+
+	if wallet.cancelAccountMixer == nil {
+		return nil
+	}
+	return wallet.accountMixer
+}
+
 func (mw *MultiWallet) publishAccountMixerStarted(walletID int) {
 	mw.notificationListenersMu.RLock()
 	defer mw.notificationListenersMu.RUnlock()
@@ -310,3 +431,12 @@ func (mw *MultiWallet) publishAccountMixerEnded(walletID int) {
 		accountMixerNotificationListener.OnAccountMixerEnded(walletID)
 	}
 }
+
+func (mw *MultiWallet) publishAccountMixerPassphraseRequired(walletID int) {
+	mw.notificationListenersMu.RLock()
+	defer mw.notificationListenersMu.RUnlock()
+
+	for _, accountMixerNotificationListener := range mw.accountMixerNotificationListener {
+		accountMixerNotificationListener.OnAccountMixerPassphraseRequired(walletID)
+	}
+}
@@ -0,0 +1,305 @@
+package dcrlibwallet
+
+import (
+	"time"
+)
+
+const (
+	AccountMixerScheduleConfigKey = "account_mixer_schedule"
+
+	// Reasons returned by AccountMixerPauseReason.
+	AccountMixerPausedOutsideSchedule = "outside_schedule"
+	AccountMixerPausedLowBattery      = "low_battery"
+	AccountMixerPausedMeteredNetwork  = "metered_network"
+
+	// AccountMixerPausedPassphraseRequired is returned while the mixer waits
+	// for ResumeAccountMixer to unlock the wallet.
+	AccountMixerPausedPassphraseRequired = "passphrase_required"
+)
+
+// AccountMixerSchedule limits when the account mixer mixes and how much it
+// mixes. The zero value doesn't restrict the mixer.
+type AccountMixerSchedule struct {
+	// StartHour and EndHour restrict mixing to the hours from StartHour up
+	// to EndHour, local time. The window spans midnight if EndHour is less
+	// than StartHour. Mixing is not restricted if both are equal.
+	StartHour int32 `json:"start_hour"`
+	EndHour   int32 `json:"end_hour"`
+
+	// TargetMixedBalance stops the mixer once the total balance of the
+	// mixed account reaches this amount of atoms, if not 0.
+	TargetMixedBalance int64 `json:"target_mixed_balance"`
+
+	// MaxFees stops the mixer once the fees paid during the mixer session
+	// reach this amount of atoms, if not 0.
+	MaxFees int64 `json:"max_fees"`
+
+	// PauseOnLowBattery and PauseOnMeteredNetwork pause mixing while the
+	// host app reports a low battery or a metered network connection.
+	PauseOnLowBattery     bool `json:"pause_on_low_battery"`
+	PauseOnMeteredNetwork bool `json:"pause_on_metered_network"`
+}
+
+// SetAccountMixerSchedule sets the schedule and budget of the account mixer.
+// Changes apply to a running mixer from the next block.
+func (wallet *Wallet) SetAccountMixerSchedule(schedule *AccountMixerSchedule) error {
+	if schedule == nil || schedule.StartHour < 0 || schedule.StartHour > 23 ||
+		schedule.EndHour < 0 || schedule.EndHour > 23 ||
+		schedule.TargetMixedBalance < 0 || schedule.MaxFees < 0 {
+		return newError(ErrInvalid)
+	}
+
+	wallet.SaveUserConfigValue(AccountMixerScheduleConfigKey, schedule)
+	return nil
+}
+
+// AccountMixerSchedule returns the schedule and budget of the account mixer.
+func (wallet *Wallet) AccountMixerSchedule() *AccountMixerSchedule {
+	schedule := new(AccountMixerSchedule)
+	wallet.ReadUserConfigValue(AccountMixerScheduleConfigKey, schedule)
+	return schedule
+}
+
+// ClearAccountMixerSchedule removes the schedule and budget of the account
+// mixer.
+func (wallet *Wallet) ClearAccountMixerSchedule() {
+	wallet.SaveUserConfigValue(AccountMixerScheduleConfigKey, &AccountMixerSchedule{})
+}
+
+// SetLowBattery should be called by the host app whenever the device battery
+// becomes low or stops being low. Account mixers are paused while the battery
+// is low if their schedule requests it.
+func (mw *MultiWallet) SetLowBattery(lowBattery bool) {
+	mw.syncData.mu.Lock()
+	mw.syncData.lowBattery = lowBattery
+	mw.syncData.mu.Unlock()
+}
+
+// AccountMixerPauseReason returns why the running account mixer of the
+// wallet is not mixing, e.g. AccountMixerPausedOutsideSchedule, or an empty
+// string if the mixer is not paused.
+func (mw *MultiWallet) AccountMixerPauseReason(walletID int) string {
+	wallet := mw.WalletWithID(walletID)
+	if wallet == nil {
+		return ""
+	}
+
+	mixer := wallet.runningAccountMixer()
+	if mixer == nil {
+		return ""
+	}
+
+	mixer.mu.Lock()
+	defer mixer.mu.Unlock()
+	return mixer.pauseReason
+}
+
+// runAccountMixer runs the mixer in the background until it is stopped with
+// StopAccountMixer, its budget is spent or sync is canceled. A mixer stopped
+// by CancelSync is suspended and resumed by resumeAccountMixers once wallets
+// are synced again.
+func (mw *MultiWallet) runAccountMixer(mixer *accountMixer) {
+	wallet := mixer.wallet
+
+	ctx, cancel := mw.contextWithShutdownCancel()
+	mixer.stopped = make(chan struct{})
+
+	wallet.accountMixerMu.Lock()
+	wallet.cancelAccountMixer = cancel
+	wallet.accountMixer = mixer
+	wallet.accountMixerMu.Unlock()
+
+	go func() {
+		defer close(mixer.stopped)
+
+		log.Info("Running account mixer")
+		if mw.accountMixerNotificationListener != nil {
+			mw.publishAccountMixerStarted(wallet.ID)
+		}
+
+		// a resumed mixer asks for the passphrase if it locked the wallet
+		// when it was suspended
+		mixer.setPauseReason("")
+
+		err := mixer.run(ctx)
+		if err != nil {
+			log.Errorf("AccountMixer instance errored: %v", err)
+		}
+
+		wallet.accountMixerMu.Lock()
+		if wallet.accountMixer == mixer {
+			wallet.cancelAccountMixer = nil
+
+			// the mixer doesn't keep the wallet unlocked once it stops
+			mixer.mu.Lock()
+			mixer.lockWalletIfIdle()
+			mixer.mu.Unlock()
+		}
+		if !mixer.isSuspended() {
+			wallet.endAccountMixer(mixer)
+		}
+		wallet.accountMixerMu.Unlock()
+
+		if mw.accountMixerNotificationListener != nil {
+			mw.publishAccountMixerEnded(wallet.ID)
+		}
+	}()
+}
+
+// suspendAccountMixers stops the running account mixers so that they can be
+// resumed with resumeAccountMixers.
+func (mw *MultiWallet) suspendAccountMixers() {
+	for _, wallet := range mw.wallets {
+		wallet.accountMixerMu.Lock()
+		if wallet.cancelAccountMixer != nil {
+			log.Infof("[%d] Suspending cspp mixer", wallet.ID)
+			wallet.accountMixer.setSuspended(true)
+			wallet.cancelAccountMixer()
+			wallet.cancelAccountMixer = nil
+		}
+		wallet.accountMixerMu.Unlock()
+	}
+}
+
+// resumeAccountMixers restarts the account mixers suspended by
+// suspendAccountMixers. Suspended mixers lock the wallet, so a resumed mixer
+// publishes OnAccountMixerPassphraseRequired and waits for
+// ResumeAccountMixer before it mixes again.
+func (mw *MultiWallet) resumeAccountMixers() {
+	for _, wallet := range mw.wallets {
+		wallet.accountMixerMu.Lock()
+		mixer := wallet.accountMixer
+		active := wallet.cancelAccountMixer != nil
+		wallet.accountMixerMu.Unlock()
+
+		if mixer == nil || !mixer.isSuspended() || active {
+			continue
+		}
+
+		log.Infof("[%d] Resuming cspp mixer", wallet.ID)
+		<-mixer.stopped
+		mixer.setSuspended(false)
+		mw.runAccountMixer(mixer)
+	}
+}
+
+// endAccountMixer ends the mixer session. It must be called with
+// accountMixerMu held.
+func (wallet *Wallet) endAccountMixer(mixer *accountMixer) {
+	if wallet.accountMixer == mixer {
+		wallet.accountMixer = nil
+	}
+
+	err := wallet.endMixerSession(mixer.sessionID)
+	if err != nil {
+		log.Errorf("[%d] Error saving mixer session: %v", wallet.ID, err)
+	}
+}
+
+// checkSchedule returns why mixing should be paused according to the
+// schedule of the mixer, if at all, and whether the mixing budget is spent.
+func (m *accountMixer) checkSchedule() (pauseReason string, budgetSpent bool) {
+	schedule := m.wallet.AccountMixerSchedule()
+
+	if schedule.MaxFees > 0 {
+		var session MixerSession
+		err := m.wallet.walletDataDB.FindOne("ID", m.sessionID, &session)
+		if err == nil && session.FeesPaid >= schedule.MaxFees {
+			return "", true
+		}
+	}
+
+	if schedule.TargetMixedBalance > 0 {
+		balance, err := m.wallet.GetAccountBalance(int32(m.mixedAccount))
+		if err == nil && balance.Total >= schedule.TargetMixedBalance {
+			return "", true
+		}
+	}
+
+	if !withinHours(time.Now().Hour(), int(schedule.StartHour), int(schedule.EndHour)) {
+		return AccountMixerPausedOutsideSchedule, false
+	}
+
+	m.mw.syncData.mu.RLock()
+	lowBattery := m.mw.syncData.lowBattery
+	networkMetered := m.mw.syncData.networkMetered
+	m.mw.syncData.mu.RUnlock()
+
+	switch {
+	case schedule.PauseOnLowBattery && lowBattery:
+		return AccountMixerPausedLowBattery, false
+	case schedule.PauseOnMeteredNetwork && networkMetered:
+		return AccountMixerPausedMeteredNetwork, false
+	}
+
+	return "", false
+}
+
+// setPauseReason records why the mixer is paused and returns the reason,
+// which is AccountMixerPausedPassphraseRequired if the mixer could mix but
+// the wallet is locked. The wallet is locked while the mixer is paused once
+// the rounds in progress end, and OnAccountMixerPassphraseRequired is
+// published when the mixer needs it unlocked again.
+func (m *accountMixer) setPauseReason(pauseReason string) string {
+	if pauseReason == "" && m.wallet.IsLocked() {
+		pauseReason = AccountMixerPausedPassphraseRequired
+	}
+
+	m.mu.Lock()
+	changed := m.pauseReason != pauseReason
+	if changed {
+		if pauseReason != "" {
+			log.Infof("[%d] Account mixer paused: %s", m.wallet.ID, pauseReason)
+		} else {
+			log.Infof("[%d] Account mixer resumed", m.wallet.ID)
+		}
+	}
+	m.pauseReason = pauseReason
+	if pauseReason != "" {
+		m.lockWalletIfIdle()
+	}
+	m.mu.Unlock()
+
+	if changed && pauseReason == AccountMixerPausedPassphraseRequired {
+		m.mw.publishAccountMixerPassphraseRequired(m.wallet.ID)
+	}
+	return pauseReason
+}
+
+// lockWalletIfIdle locks the wallet if the mixer unlocked it and no outputs
+// are being mixed. It must be called with m.mu held.
+func (m *accountMixer) lockWalletIfIdle() {
+	if !m.ownsUnlock || len(m.mixing) > 0 {
+		return
+	}
+
+	if !m.wallet.internal.Locked() {
+		m.wallet.internal.Lock()
+	}
+	m.ownsUnlock = false
+}
+
+func (m *accountMixer) setSuspended(suspended bool) {
+	m.mu.Lock()
+	m.suspended = suspended
+	m.mu.Unlock()
+}
+
+func (m *accountMixer) isSuspended() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.suspended
+}
+
+// withinHours returns true if hour is in the window from startHour up to
+// endHour, which spans midnight if endHour is less than startHour.
+func withinHours(hour, startHour, endHour int) bool {
+	switch {
+	case startHour == endHour:
+		return true
+	case startHour < endHour:
+		return hour >= startHour && hour < endHour
+	default:
+		return hour >= startHour || hour < endHour
+	}
+}
@@ -0,0 +1,213 @@
+package dcrlibwallet
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/decred/dcrd/wire"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type accountMixerTestListener struct {
+	passphraseRequired int32
+}
+
+func (*accountMixerTestListener) OnAccountMixerStarted(int)                     {}
+func (*accountMixerTestListener) OnAccountMixerEnded(int)                       {}
+func (*accountMixerTestListener) OnAccountMixerRoundJoined(int, *MixerRound)    {}
+func (*accountMixerTestListener) OnAccountMixerRoundCompleted(int, *MixerRound) {}
+func (*accountMixerTestListener) OnAccountMixerRoundFailed(int, *MixerRound)    {}
+func (*accountMixerTestListener) OnAccountMixerOutputsMixed(int, *MixerRound)   {}
+func (l *accountMixerTestListener) OnAccountMixerPassphraseRequired(int) {
+	atomic.AddInt32(&l.passphraseRequired, 1)
+}
+
+var _ = Describe("Account mixer schedule", func() {
+	It("checks whether an hour is within the schedule", func() {
+		for _, test := range []struct {
+			hour, startHour, endHour int
+			within                   bool
+		}{
+			{hour: 5, startHour: 0, endHour: 0, within: true},
+			{hour: 5, startHour: 5, endHour: 5, within: true},
+			{hour: 9, startHour: 9, endHour: 17, within: true},
+			{hour: 16, startHour: 9, endHour: 17, within: true},
+			{hour: 17, startHour: 9, endHour: 17, within: false},
+			{hour: 8, startHour: 9, endHour: 17, within: false},
+			{hour: 23, startHour: 22, endHour: 6, within: true},
+			{hour: 0, startHour: 22, endHour: 6, within: true},
+			{hour: 5, startHour: 22, endHour: 6, within: true},
+			{hour: 6, startHour: 22, endHour: 6, within: false},
+			{hour: 12, startHour: 22, endHour: 6, within: false},
+		} {
+			Expect(withinHours(test.hour, test.startHour, test.endHour)).To(Equal(test.within),
+				"hour %d in %d-%d", test.hour, test.startHour, test.endHour)
+		}
+	})
+
+	Describe("Mixer", func() {
+		var mw *MultiWallet
+		var cleanup func()
+		var wallet *Wallet
+		var mixer *accountMixer
+		var listener *accountMixerTestListener
+
+		BeforeEach(func() {
+			mw, cleanup = newTestMultiWallet()
+			wallet = newTestWallet(mw, "mixer")
+
+			listener = &accountMixerTestListener{}
+			Expect(mw.AddAccountMixerNotificationListener(listener, "schedule")).To(Succeed())
+
+			mixer = &accountMixer{
+				mw:     mw,
+				wallet: wallet,
+				mixing: make(map[wire.OutPoint]bool),
+			}
+			var err error
+			mixer.sessionID, err = wallet.startMixerSession()
+			Expect(err).To(BeNil())
+		})
+
+		AfterEach(func() {
+			cleanup()
+		})
+
+		// startMixer registers mixer as the running account mixer of the
+		// wallet, without mixing, and unlocks the wallet for it.
+		startMixer := func() {
+			_, cancel := context.WithCancel(context.Background())
+			wallet.accountMixerMu.Lock()
+			wallet.cancelAccountMixer = cancel
+			wallet.accountMixer = mixer
+			wallet.accountMixerMu.Unlock()
+
+			Expect(wallet.UnlockWallet([]byte("passphrase"))).To(Succeed())
+			mixer.ownsUnlock = true
+		}
+
+		It("validates and saves schedules", func() {
+			Expect(wallet.SetAccountMixerSchedule(nil)).To(MatchError(ErrInvalid))
+			Expect(wallet.SetAccountMixerSchedule(&AccountMixerSchedule{StartHour: 24})).To(MatchError(ErrInvalid))
+			Expect(wallet.SetAccountMixerSchedule(&AccountMixerSchedule{EndHour: -1})).To(MatchError(ErrInvalid))
+			Expect(wallet.SetAccountMixerSchedule(&AccountMixerSchedule{MaxFees: -1})).To(MatchError(ErrInvalid))
+			Expect(wallet.SetAccountMixerSchedule(&AccountMixerSchedule{TargetMixedBalance: -1})).To(MatchError(ErrInvalid))
+
+			schedule := &AccountMixerSchedule{StartHour: 22, EndHour: 6, MaxFees: 1000, PauseOnLowBattery: true}
+			Expect(wallet.SetAccountMixerSchedule(schedule)).To(Succeed())
+			Expect(wallet.AccountMixerSchedule()).To(Equal(schedule))
+
+			wallet.ClearAccountMixerSchedule()
+			Expect(wallet.AccountMixerSchedule()).To(Equal(&AccountMixerSchedule{}))
+		})
+
+		It("stops once the budget is spent", func() {
+			pauseReason, budgetSpent := mixer.checkSchedule()
+			Expect(pauseReason).To(BeEmpty())
+			Expect(budgetSpent).To(BeFalse())
+
+			By("Spending the fee budget")
+			Expect(wallet.SetAccountMixerSchedule(&AccountMixerSchedule{MaxFees: 1000})).To(Succeed())
+			Expect(wallet.updateMixerSession(mixer.sessionID, func(session *MixerSession) {
+				session.FeesPaid = 999
+			})).To(Succeed())
+			_, budgetSpent = mixer.checkSchedule()
+			Expect(budgetSpent).To(BeFalse())
+
+			Expect(wallet.updateMixerSession(mixer.sessionID, func(session *MixerSession) {
+				session.FeesPaid = 1000
+			})).To(Succeed())
+			_, budgetSpent = mixer.checkSchedule()
+			Expect(budgetSpent).To(BeTrue())
+
+			By("Reaching the target mixed balance")
+			Expect(wallet.SetAccountMixerSchedule(&AccountMixerSchedule{TargetMixedBalance: 1})).To(Succeed())
+			_, budgetSpent = mixer.checkSchedule()
+			Expect(budgetSpent).To(BeFalse())
+		})
+
+		It("pauses outside the schedule and on host conditions", func() {
+			hour := time.Now().Hour()
+			Expect(wallet.SetAccountMixerSchedule(&AccountMixerSchedule{
+				StartHour: int32((hour + 1) % 24),
+				EndHour:   int32((hour + 2) % 24),
+			})).To(Succeed())
+			pauseReason, _ := mixer.checkSchedule()
+			Expect(pauseReason).To(Equal(AccountMixerPausedOutsideSchedule))
+
+			Expect(wallet.SetAccountMixerSchedule(&AccountMixerSchedule{
+				PauseOnLowBattery:     true,
+				PauseOnMeteredNetwork: true,
+			})).To(Succeed())
+			pauseReason, _ = mixer.checkSchedule()
+			Expect(pauseReason).To(BeEmpty())
+
+			mw.SetLowBattery(true)
+			pauseReason, _ = mixer.checkSchedule()
+			Expect(pauseReason).To(Equal(AccountMixerPausedLowBattery))
+
+			mw.SetLowBattery(false)
+			mw.SetNetworkMetered(true)
+			pauseReason, _ = mixer.checkSchedule()
+			Expect(pauseReason).To(Equal(AccountMixerPausedMeteredNetwork))
+
+			By("Ignoring host conditions not in the schedule")
+			wallet.ClearAccountMixerSchedule()
+			pauseReason, _ = mixer.checkSchedule()
+			Expect(pauseReason).To(BeEmpty())
+		})
+
+		It("locks the wallet while paused and asks for the passphrase to resume", func() {
+			startMixer()
+
+			Expect(mixer.setPauseReason("")).To(BeEmpty())
+			Expect(wallet.IsLocked()).To(BeFalse())
+
+			By("Waiting for rounds in progress before locking")
+			outpoint := wire.OutPoint{Index: 1}
+			mixer.mixing[outpoint] = true
+			Expect(mixer.setPauseReason(AccountMixerPausedLowBattery)).To(Equal(AccountMixerPausedLowBattery))
+			Expect(wallet.IsLocked()).To(BeFalse())
+			Expect(mw.AccountMixerPauseReason(wallet.ID)).To(Equal(AccountMixerPausedLowBattery))
+
+			mixer.mu.Lock()
+			delete(mixer.mixing, outpoint)
+			mixer.lockWalletIfIdle()
+			mixer.mu.Unlock()
+			Expect(wallet.IsLocked()).To(BeTrue())
+			Expect(atomic.LoadInt32(&listener.passphraseRequired)).To(BeZero())
+
+			By("Asking for the passphrase once the mixer could mix again")
+			Expect(mixer.setPauseReason("")).To(Equal(AccountMixerPausedPassphraseRequired))
+			Expect(mixer.setPauseReason("")).To(Equal(AccountMixerPausedPassphraseRequired))
+			Expect(atomic.LoadInt32(&listener.passphraseRequired)).To(Equal(int32(1)))
+
+			Expect(mw.ResumeAccountMixer(wallet.ID, "wrong")).To(MatchError(ErrInvalidPassphrase))
+			Expect(wallet.IsLocked()).To(BeTrue())
+
+			Expect(mw.ResumeAccountMixer(wallet.ID, "passphrase")).To(Succeed())
+			Expect(wallet.IsLocked()).To(BeFalse())
+			Expect(mw.AccountMixerPauseReason(wallet.ID)).To(BeEmpty())
+			Expect(mixer.setPauseReason("")).To(BeEmpty())
+
+			By("Locking the wallet again on the next pause")
+			Expect(mixer.setPauseReason(AccountMixerPausedOutsideSchedule)).To(Equal(AccountMixerPausedOutsideSchedule))
+			Expect(wallet.IsLocked()).To(BeTrue())
+		})
+
+		It("doesn't lock a wallet it didn't unlock", func() {
+			startMixer()
+			mixer.ownsUnlock = false
+
+			Expect(mixer.setPauseReason(AccountMixerPausedMeteredNetwork)).To(Equal(AccountMixerPausedMeteredNetwork))
+			Expect(wallet.IsLocked()).To(BeFalse())
+		})
+
+		It("requires a running mixer to resume", func() {
+			Expect(mw.ResumeAccountMixer(wallet.ID+1, "passphrase")).To(MatchError(ErrNotExist))
+			Expect(mw.ResumeAccountMixer(wallet.ID, "passphrase")).To(MatchError(ErrInvalid))
+		})
+	})
+})
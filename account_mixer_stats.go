@@ -0,0 +1,470 @@
+package dcrlibwallet
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	w "decred.org/dcrwallet/wallet"
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	"github.com/decred/dcrd/wire"
+)
+
+// maxConcurrentMixRounds limits the outputs mixed at once, as done by
+// dcrwallet when mixing an account.
+//
+// The mixer calls MixOutput for each output instead of reusing
+// wallet.MixAccount, which mixes up to this many outputs but only returns
+// the first error of all its rounds and dials the CSPP server without
+// telling which output the dial is for. The rounds of each output could
+// then not be recorded or reported.
+const maxConcurrentMixRounds = 32
+
+// accountMixer mixes the outputs of the unmixed account of a wallet on each
+// new block and records each CoinShuffle++ round in the mixer session.
+type accountMixer struct {
+	mw     *MultiWallet
+	wallet *Wallet
+
+	csppServer     string
+	dialCSPPServer w.DialFunc
+	mixedAccount   uint32
+	unmixedAccount uint32
+
+	sessionID int
+
+	mu     sync.Mutex
+	mixing map[wire.OutPoint]bool
+
+	// ownsUnlock is set while the wallet is unlocked by the mixer, which
+	// locks it again whenever it pauses or stops.
+	ownsUnlock bool
+
+	suspended   bool
+	pauseReason string
+	wg          sync.WaitGroup
+
+	// stopped is closed once the mixer started by runAccountMixer stops.
+	stopped chan struct{}
+}
+
+// run mixes outputs until ctx is canceled, then waits for the rounds in
+// progress to end.
+func (m *accountMixer) run(ctx context.Context) error {
+	defer m.wg.Wait()
+
+	c := m.wallet.internal.NtfnServer.MainTipChangedNotifications()
+	defer c.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-c.C:
+			if len(n.AttachedBlocks) == 0 {
+				continue
+			}
+
+			// don't mix while transactions are not synced through the tip block
+			rescanPoint, err := m.wallet.internal.RescanPoint(ctx)
+			if err != nil {
+				return err
+			}
+			if rescanPoint != nil {
+				continue
+			}
+
+			pauseReason, budgetSpent := m.checkSchedule()
+			if budgetSpent {
+				log.Infof("[%d] Account mixer budget spent, stopping account mixer", m.wallet.ID)
+				return nil
+			}
+			if m.setPauseReason(pauseReason) != "" {
+				continue
+			}
+
+			err = m.mixOutputs(ctx)
+			if err != nil {
+				log.Errorf("[%d] Error mixing outputs: %v", m.wallet.ID, err)
+			}
+		}
+	}
+}
+
+func (m *accountMixer) mixOutputs(ctx context.Context) error {
+	policy := w.OutputSelectionPolicy{
+		Account:               m.unmixedAccount,
+		RequiredConfirmations: 1,
+	}
+	outputs, err := m.wallet.internal.UnspentOutputs(ctx, policy)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, output := range outputs {
+		if len(m.mixing) >= maxConcurrentMixRounds {
+			break
+		}
+
+		outpoint := output.OutPoint
+		if AmountCoin(output.Output.Value) <= smalletSplitPoint || m.mixing[outpoint] ||
+			m.wallet.internal.LockedOutpoint(&outpoint.Hash, outpoint.Index) {
+			continue
+		}
+
+		m.mixing[outpoint] = true
+		m.wg.Add(1)
+		go m.mixOutput(ctx, outpoint, output.Output.Value)
+	}
+
+	return nil
+}
+
+func (m *accountMixer) mixOutput(ctx context.Context, outpoint wire.OutPoint, amount int64) {
+	defer m.wg.Done()
+	defer func() {
+		m.mu.Lock()
+		delete(m.mixing, outpoint)
+		if m.pauseReason != "" {
+			m.lockWalletIfIdle()
+		}
+		m.mu.Unlock()
+	}()
+
+	round := &MixerRound{
+		SessionID: m.sessionID,
+		Outpoint:  outpoint.String(),
+		Amount:    amount,
+	}
+
+	// MixOutput only dials the CoinShuffle++ server once the output is
+	// ready to join a session. Outputs that are too small to be mixed or
+	// throttled because many outputs are being mixed to the same
+	// denomination return before that and are retried on the next block.
+	var joined bool
+	dialCSPPServer := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if !joined {
+			joined = true
+			m.joinRound(round)
+		}
+		return m.dialCSPPServer(ctx, network, addr)
+	}
+
+	err := m.wallet.internal.MixOutput(ctx, dialCSPPServer, m.csppServer, &outpoint,
+		m.unmixedAccount, m.mixedAccount, MixedAccountBranch)
+	if !joined {
+		if err != nil && ctx.Err() == nil {
+			log.Debugf("[%d] Output %s not mixed: %v", m.wallet.ID, round.Outpoint, err)
+		}
+		return
+	}
+
+	if err != nil {
+		log.Errorf("[%d] Mixing output %s failed: %v", m.wallet.ID, round.Outpoint, err)
+	}
+	m.endRound(round, err)
+}
+
+// joinRound records and reports that the output of round is joining a
+// CoinShuffle++ session.
+func (m *accountMixer) joinRound(round *MixerRound) {
+	round.StartedAt = time.Now().Unix()
+	err := m.wallet.walletDataDB.Save(round)
+	if err != nil {
+		log.Errorf("[%d] Error saving mixer round: %v", m.wallet.ID, err)
+	}
+
+	err = m.wallet.updateMixerSession(m.sessionID, func(session *MixerSession) {
+		session.RoundsJoined++
+	})
+	if err != nil {
+		log.Errorf("[%d] Error updating mixer session: %v", m.wallet.ID, err)
+	}
+
+	m.mw.publishAccountMixerRoundJoined(m.wallet.ID, round)
+}
+
+// endRound records and reports the result of a round joined with joinRound.
+// The saved round is updated since it may have been linked to its mix
+// transaction in the meantime.
+func (m *accountMixer) endRound(round *MixerRound, mixErr error) {
+	round.EndedAt = time.Now().Unix()
+	if mixErr != nil {
+		round.Error = mixErr.Error()
+	}
+
+	m.wallet.mixerRoundsMu.Lock()
+	var saved MixerRound
+	err := m.wallet.walletDataDB.FindOne("ID", round.ID, &saved)
+	if err == nil {
+		saved.EndedAt, saved.Error = round.EndedAt, round.Error
+		*round = saved
+		err = m.wallet.walletDataDB.Save(round)
+	}
+	m.wallet.mixerRoundsMu.Unlock()
+	if err != nil {
+		log.Errorf("[%d] Error saving mixer round: %v", m.wallet.ID, err)
+	}
+
+	if round.Error == "" {
+		m.mw.publishAccountMixerRoundCompleted(m.wallet.ID, round)
+		return
+	}
+
+	err = m.wallet.updateMixerSession(m.sessionID, func(session *MixerSession) {
+		session.RoundsFailed++
+	})
+	if err != nil {
+		log.Errorf("[%d] Error updating mixer session: %v", m.wallet.ID, err)
+	}
+	m.mw.publishAccountMixerRoundFailed(m.wallet.ID, round)
+}
+
+func (wallet *Wallet) startMixerSession() (int, error) {
+	session := &MixerSession{
+		WalletID:      wallet.ID,
+		StartedAt:     time.Now().Unix(),
+		Denominations: make(map[int64]int32),
+	}
+	err := wallet.walletDataDB.Save(session)
+	return session.ID, err
+}
+
+func (wallet *Wallet) endMixerSession(sessionID int) error {
+	return wallet.updateMixerSession(sessionID, func(session *MixerSession) {
+		session.EndedAt = time.Now().Unix()
+	})
+}
+
+func (wallet *Wallet) updateMixerSession(sessionID int, update func(*MixerSession)) error {
+	wallet.mixerSessionMu.Lock()
+	defer wallet.mixerSessionMu.Unlock()
+
+	var session MixerSession
+	err := wallet.walletDataDB.FindOne("ID", sessionID, &session)
+	if err != nil {
+		return err
+	}
+
+	update(&session)
+	return wallet.walletDataDB.Save(&session)
+}
+
+// linkMixTransaction records the outputs mixed by a TxTypeMixed transaction
+// in the mixer rounds that created it. Several rounds of the wallet may join
+// the same CoinShuffle++ session, so the mixed outputs and fee of the wallet
+// in the transaction are split between the rounds and only counted once in
+// the mixer sessions.
+func (mw *MultiWallet) linkMixTransaction(wallet *Wallet, tx *Transaction) {
+	outpoints := make([]interface{}, len(tx.Inputs))
+	for i, input := range tx.Inputs {
+		outpoints[i] = input.PreviousOutpoint
+	}
+
+	wallet.mixerRoundsMu.Lock()
+	var rounds []MixerRound
+	err := wallet.walletDataDB.Find(q.And(
+		q.In("Outpoint", outpoints),
+		q.Eq("MixTxHash", ""),
+		q.Eq("Error", ""),
+	), &rounds)
+	if err != nil {
+		wallet.mixerRoundsMu.Unlock()
+		log.Errorf("[%d] Error fetching mixer rounds: %v", wallet.ID, err)
+		return
+	}
+
+	attributeMixTransaction(tx, rounds)
+
+	sessionRounds := make(map[int][]*MixerRound)
+	var sessionIDs []int
+	for i := range rounds {
+		round := &rounds[i]
+		err = wallet.walletDataDB.Save(round)
+		if err != nil {
+			log.Errorf("[%d] Error saving mixer round: %v", wallet.ID, err)
+			continue
+		}
+
+		if _, ok := sessionRounds[round.SessionID]; !ok {
+			sessionIDs = append(sessionIDs, round.SessionID)
+		}
+		sessionRounds[round.SessionID] = append(sessionRounds[round.SessionID], round)
+	}
+	wallet.mixerRoundsMu.Unlock()
+
+	for _, sessionID := range sessionIDs {
+		err = wallet.updateMixerSession(sessionID, func(session *MixerSession) {
+			if session.Denominations == nil {
+				session.Denominations = make(map[int64]int32)
+			}
+			for _, round := range sessionRounds[sessionID] {
+				session.OutputsMixed += round.OutputsMixed
+				session.Denominations[round.Denomination] += round.OutputsMixed
+				session.TotalMixed += round.Denomination * int64(round.OutputsMixed)
+				session.FeesPaid += round.Fee
+			}
+			session.MixTransactions = append(session.MixTransactions, tx.Hash)
+		})
+		if err != nil {
+			log.Errorf("[%d] Error updating mixer session: %v", wallet.ID, err)
+		}
+	}
+
+	for _, sessionID := range sessionIDs {
+		for _, round := range sessionRounds[sessionID] {
+			mw.publishAccountMixerOutputsMixed(wallet.ID, round)
+		}
+	}
+}
+
+// attributeMixTransaction links the rounds to the mix transaction and splits
+// the mixed outputs and fee of the wallet in the transaction between them.
+// Like dcrwallet, each round mixes its output into at most 4 outputs of the
+// denomination, the remaining outputs and fee are attributed to the last and
+// first round.
+func attributeMixTransaction(tx *Transaction, rounds []MixerRound) {
+	remainingOutputs := tx.MixCount
+	for i := range rounds {
+		round := &rounds[i]
+		round.MixTxHash = tx.Hash
+		round.Denomination = tx.MixDenomination
+
+		outputs := remainingOutputs
+		if i < len(rounds)-1 && tx.MixDenomination > 0 {
+			outputs = int32(round.Amount / tx.MixDenomination)
+			if outputs > 4 {
+				outputs = 4
+			}
+			if outputs > remainingOutputs {
+				outputs = remainingOutputs
+			}
+		}
+		round.OutputsMixed = outputs
+		remainingOutputs -= outputs
+
+		round.Fee = tx.Fee / int64(len(rounds))
+		if i == 0 {
+			round.Fee += tx.Fee % int64(len(rounds))
+		}
+	}
+}
+
+// GetMixerSessionsRaw returns the account mixer sessions of the wallet,
+// newest first.
+func (wallet *Wallet) GetMixerSessionsRaw(offset, limit int32) ([]MixerSession, error) {
+	var sessions []MixerSession
+	err := wallet.walletDataDB.Find(q.True(), &sessions)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].StartedAt != sessions[j].StartedAt {
+			return sessions[i].StartedAt > sessions[j].StartedAt
+		}
+		return sessions[i].ID > sessions[j].ID
+	})
+
+	if int(offset) >= len(sessions) {
+		return []MixerSession{}, nil
+	}
+	sessions = sessions[offset:]
+	if limit > 0 && int(limit) < len(sessions) {
+		sessions = sessions[:limit]
+	}
+	return sessions, nil
+}
+
+// GetMixerSessions returns the result of GetMixerSessionsRaw as a JSON string.
+func (wallet *Wallet) GetMixerSessions(offset, limit int32) (string, error) {
+	sessions, err := wallet.GetMixerSessionsRaw(offset, limit)
+	if err != nil {
+		return "", err
+	}
+	return marshalMixerHistory(sessions)
+}
+
+// GetMixerRoundsRaw returns the rounds of the account mixer session with the
+// provided ID, oldest first.
+func (wallet *Wallet) GetMixerRoundsRaw(sessionID int) ([]MixerRound, error) {
+	var session MixerSession
+	err := wallet.walletDataDB.FindOne("ID", sessionID, &session)
+	if err != nil {
+		if err == storm.ErrNotFound {
+			return nil, newError(ErrNotExist)
+		}
+		return nil, translateError(err)
+	}
+
+	var rounds []MixerRound
+	err = wallet.walletDataDB.FindAll("SessionID", sessionID, &rounds)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, translateError(err)
+	}
+
+	sort.Slice(rounds, func(i, j int) bool {
+		return rounds[i].StartedAt < rounds[j].StartedAt
+	})
+	return rounds, nil
+}
+
+// GetMixerRounds returns the result of GetMixerRoundsRaw as a JSON string.
+func (wallet *Wallet) GetMixerRounds(sessionID int) (string, error) {
+	rounds, err := wallet.GetMixerRoundsRaw(sessionID)
+	if err != nil {
+		return "", err
+	}
+	return marshalMixerHistory(rounds)
+}
+
+func marshalMixerHistory(history interface{}) (string, error) {
+	result, err := json.Marshal(history)
+	if err != nil {
+		return "", translateError(err)
+	}
+	return string(result), nil
+}
+
+func (mw *MultiWallet) publishAccountMixerRoundJoined(walletID int, round *MixerRound) {
+	mw.notificationListenersMu.RLock()
+	defer mw.notificationListenersMu.RUnlock()
+
+	for _, accountMixerNotificationListener := range mw.accountMixerNotificationListener {
+		accountMixerNotificationListener.OnAccountMixerRoundJoined(walletID, round)
+	}
+}
+
+func (mw *MultiWallet) publishAccountMixerRoundCompleted(walletID int, round *MixerRound) {
+	mw.notificationListenersMu.RLock()
+	defer mw.notificationListenersMu.RUnlock()
+
+	for _, accountMixerNotificationListener := range mw.accountMixerNotificationListener {
+		accountMixerNotificationListener.OnAccountMixerRoundCompleted(walletID, round)
+	}
+}
+
+func (mw *MultiWallet) publishAccountMixerRoundFailed(walletID int, round *MixerRound) {
+	mw.notificationListenersMu.RLock()
+	defer mw.notificationListenersMu.RUnlock()
+
+	for _, accountMixerNotificationListener := range mw.accountMixerNotificationListener {
+		accountMixerNotificationListener.OnAccountMixerRoundFailed(walletID, round)
+	}
+}
+
+func (mw *MultiWallet) publishAccountMixerOutputsMixed(walletID int, round *MixerRound) {
+	mw.notificationListenersMu.RLock()
+	defer mw.notificationListenersMu.RUnlock()
+
+	for _, accountMixerNotificationListener := range mw.accountMixerNotificationListener {
+		accountMixerNotificationListener.OnAccountMixerOutputsMixed(walletID, round)
+	}
+}
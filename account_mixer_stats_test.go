@@ -0,0 +1,210 @@
+package dcrlibwallet
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/decred/dcrd/wire"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// mixerRoundsTestListener records the mixer round events in order.
+type mixerRoundsTestListener struct {
+	accountMixerTestListener
+
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *mixerRoundsTestListener) record(event string, round *MixerRound) {
+	l.mu.Lock()
+	l.events = append(l.events, event+" "+round.Outpoint)
+	l.mu.Unlock()
+}
+
+func (l *mixerRoundsTestListener) OnAccountMixerRoundJoined(_ int, round *MixerRound) {
+	l.record("joined", round)
+}
+
+func (l *mixerRoundsTestListener) OnAccountMixerRoundCompleted(_ int, round *MixerRound) {
+	l.record("completed", round)
+}
+
+func (l *mixerRoundsTestListener) OnAccountMixerRoundFailed(_ int, round *MixerRound) {
+	l.record("failed", round)
+}
+
+var _ = Describe("Account mixer stats", func() {
+	const denomination = 100000000
+
+	mixTx := func(hash string, mixCount int32, fee int64, outpoints ...string) *Transaction {
+		tx := &Transaction{
+			Hash:            hash,
+			Type:            TxTypeMixed,
+			MixDenomination: denomination,
+			MixCount:        mixCount,
+			Fee:             fee,
+		}
+		for _, outpoint := range outpoints {
+			tx.Inputs = append(tx.Inputs, &TxInput{PreviousOutpoint: outpoint})
+		}
+		return tx
+	}
+
+	Describe("attributeMixTransaction", func() {
+		It("attributes the whole transaction to a single round", func() {
+			rounds := []MixerRound{{Amount: 250000000}}
+			attributeMixTransaction(mixTx("tx", 2, 1001, "a:0"), rounds)
+			Expect(rounds[0].MixTxHash).To(Equal("tx"))
+			Expect(rounds[0].Denomination).To(Equal(int64(denomination)))
+			Expect(rounds[0].OutputsMixed).To(Equal(int32(2)))
+			Expect(rounds[0].Fee).To(Equal(int64(1001)))
+		})
+
+		It("splits the transaction between rounds", func() {
+			rounds := []MixerRound{{Amount: 250000000}, {Amount: 900000000}, {Amount: 120000000}}
+			attributeMixTransaction(mixTx("tx", 7, 1001, "a:0", "b:0", "c:0"), rounds)
+
+			var outputs int32
+			var fee int64
+			for _, round := range rounds {
+				outputs += round.OutputsMixed
+				fee += round.Fee
+			}
+			Expect(outputs).To(Equal(int32(7)))
+			Expect(fee).To(Equal(int64(1001)))
+
+			Expect(rounds[0].OutputsMixed).To(Equal(int32(2)))
+			Expect(rounds[1].OutputsMixed).To(Equal(int32(4)))
+			Expect(rounds[2].OutputsMixed).To(Equal(int32(1)))
+			Expect(rounds[0].Fee).To(Equal(int64(335)))
+			Expect(rounds[1].Fee).To(Equal(int64(333)))
+		})
+
+		It("doesn't attribute more outputs than the transaction has", func() {
+			rounds := []MixerRound{{Amount: 900000000}, {Amount: 900000000}}
+			attributeMixTransaction(mixTx("tx", 3, 0, "a:0", "b:0"), rounds)
+			Expect(rounds[0].OutputsMixed).To(Equal(int32(3)))
+			Expect(rounds[1].OutputsMixed).To(BeZero())
+		})
+	})
+
+	Describe("Mixer history", func() {
+		var mw *MultiWallet
+		var cleanup func()
+		var wallet *Wallet
+
+		BeforeEach(func() {
+			mw, cleanup = newTestMultiWallet()
+			wallet = newTestWallet(mw, "mixer")
+		})
+
+		AfterEach(func() {
+			cleanup()
+		})
+
+		It("counts each mix transaction once per session", func() {
+			sessionID, err := wallet.startMixerSession()
+			Expect(err).To(BeNil())
+
+			for _, round := range []*MixerRound{
+				{SessionID: sessionID, Outpoint: "a:0", Amount: 250000000, StartedAt: 1},
+				{SessionID: sessionID, Outpoint: "b:0", Amount: 120000000, StartedAt: 2},
+				{SessionID: sessionID, Outpoint: "c:0", Amount: 120000000, StartedAt: 3, Error: "failed"},
+			} {
+				Expect(wallet.walletDataDB.Save(round)).To(Succeed())
+			}
+
+			tx := mixTx("tx", 3, 1001, "a:0", "b:0", "c:0", "d:0")
+			mw.linkMixTransaction(wallet, tx)
+			By("Ignoring transactions that were already linked")
+			mw.linkMixTransaction(wallet, tx)
+
+			sessions, err := wallet.GetMixerSessionsRaw(0, 0)
+			Expect(err).To(BeNil())
+			Expect(sessions).To(HaveLen(1))
+			session := sessions[0]
+			Expect(session.OutputsMixed).To(Equal(int32(3)))
+			Expect(session.TotalMixed).To(Equal(int64(3 * denomination)))
+			Expect(session.FeesPaid).To(Equal(int64(1001)))
+			Expect(session.Denominations).To(Equal(map[int64]int32{denomination: 3}))
+			Expect(session.MixTransactions).To(Equal([]string{"tx"}))
+
+			rounds, err := wallet.GetMixerRoundsRaw(sessionID)
+			Expect(err).To(BeNil())
+			Expect(rounds).To(HaveLen(3))
+			Expect(rounds[0].MixTxHash).To(Equal("tx"))
+			Expect(rounds[0].OutputsMixed + rounds[1].OutputsMixed).To(Equal(int32(3)))
+			Expect(rounds[2].MixTxHash).To(BeEmpty())
+
+			By("Counting transactions of rounds in different sessions separately")
+			otherSessionID, err := wallet.startMixerSession()
+			Expect(err).To(BeNil())
+			Expect(wallet.walletDataDB.Save(&MixerRound{
+				SessionID: otherSessionID, Outpoint: "e:0", Amount: 120000000,
+			})).To(Succeed())
+			mw.linkMixTransaction(wallet, mixTx("tx2", 1, 200, "e:0"))
+
+			sessions, err = wallet.GetMixerSessionsRaw(0, 1)
+			Expect(err).To(BeNil())
+			Expect(sessions).To(HaveLen(1))
+			Expect(sessions[0].ID).To(Equal(otherSessionID))
+			Expect(sessions[0].FeesPaid).To(Equal(int64(200)))
+			Expect(sessions[0].MixTransactions).To(Equal([]string{"tx2"}))
+
+			sessions, err = wallet.GetMixerSessionsRaw(5, 0)
+			Expect(err).To(BeNil())
+			Expect(sessions).To(BeEmpty())
+
+			_, err = wallet.GetMixerRoundsRaw(otherSessionID + 1)
+			Expect(err).To(MatchError(ErrNotExist))
+		})
+
+		It("counts rounds as joined when they start and reports their results separately", func() {
+			listener := &mixerRoundsTestListener{}
+			Expect(mw.AddAccountMixerNotificationListener(listener, "rounds")).To(Succeed())
+
+			sessionID, err := wallet.startMixerSession()
+			Expect(err).To(BeNil())
+			mixer := &accountMixer{
+				mw:        mw,
+				wallet:    wallet,
+				sessionID: sessionID,
+				mixing:    make(map[wire.OutPoint]bool),
+			}
+
+			completed := &MixerRound{SessionID: sessionID, Outpoint: "a:0", Amount: 250000000}
+			failed := &MixerRound{SessionID: sessionID, Outpoint: "b:0", Amount: 120000000}
+			mixer.joinRound(completed)
+			mixer.joinRound(failed)
+			Expect(listener.events).To(Equal([]string{"joined a:0", "joined b:0"}))
+
+			sessions, err := wallet.GetMixerSessionsRaw(0, 0)
+			Expect(err).To(BeNil())
+			Expect(sessions[0].RoundsJoined).To(Equal(int32(2)))
+			Expect(sessions[0].RoundsFailed).To(BeZero())
+
+			By("Keeping the mix transaction linked while the round was running")
+			mw.linkMixTransaction(wallet, mixTx("tx", 2, 500, "a:0"))
+			mixer.endRound(completed, nil)
+			mixer.endRound(failed, errors.New("peer misbehaved"))
+			Expect(listener.events).To(Equal([]string{"joined a:0", "joined b:0", "completed a:0", "failed b:0"}))
+
+			sessions, err = wallet.GetMixerSessionsRaw(0, 0)
+			Expect(err).To(BeNil())
+			Expect(sessions[0].RoundsJoined).To(Equal(int32(2)))
+			Expect(sessions[0].RoundsFailed).To(Equal(int32(1)))
+
+			rounds, err := wallet.GetMixerRoundsRaw(sessionID)
+			Expect(err).To(BeNil())
+			Expect(rounds).To(HaveLen(2))
+			for _, round := range rounds {
+				Expect(round.EndedAt).NotTo(BeZero())
+			}
+			Expect(rounds[0].MixTxHash).To(Equal("tx"))
+			Expect(rounds[0].Error).To(BeEmpty())
+			Expect(rounds[1].Error).To(Equal("peer misbehaved"))
+		})
+	})
+})
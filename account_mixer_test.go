@@ -0,0 +1,155 @@
+package dcrlibwallet
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// startTestSOCKSProxy starts a SOCKS5 proxy that supports unauthenticated
+// CONNECT requests and counts the connections it forwards.
+func startTestSOCKSProxy() (net.Listener, *int32) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	ExpectWithOffset(1, err).To(BeNil())
+
+	var connections int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+
+				buf := make([]byte, 256)
+				// greeting: version, number of methods, methods
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+					return
+				}
+				conn.Write([]byte{5, 0})
+
+				// request: version, command, reserved, domain type, domain, port
+				if _, err := io.ReadFull(conn, buf[:5]); err != nil {
+					return
+				}
+				host := make([]byte, buf[4])
+				if _, err := io.ReadFull(conn, host); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+					return
+				}
+				port := int(buf[0])<<8 | int(buf[1])
+
+				target, err := net.Dial("tcp", net.JoinHostPort(string(host), strconv.Itoa(port)))
+				if err != nil {
+					conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer target.Close()
+				atomic.AddInt32(&connections, 1)
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+				go io.Copy(target, conn)
+				io.Copy(conn, target)
+			}()
+		}
+	}()
+
+	return listener, &connections
+}
+
+var _ = Describe("Account mixer", func() {
+	Describe("CSPP server", func() {
+		var mw *MultiWallet
+		var cleanup func()
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			mw, cleanup = newTestMultiWallet()
+			server = newTestTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+			cleanup()
+		})
+
+		// handshake dials the configured CSPP server and completes a TLS
+		// handshake with it.
+		handshake := func() error {
+			address, dial, err := mw.csppDialer()
+			ExpectWithOffset(1, err).To(BeNil())
+
+			conn, err := dial(context.Background(), "tcp", address)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			return conn.(*tls.Conn).Handshake()
+		}
+
+		It("uses the default server of the network", func() {
+			Expect(mw.CSPPServer()).To(Equal(net.JoinHostPort(ShuffleServer, TestnetShufflePort)))
+
+			Expect(mw.SetCSPPServer("cspp.example.com", "", "")).To(Succeed())
+			Expect(mw.CSPPServer()).To(Equal(net.JoinHostPort("cspp.example.com", TestnetShufflePort)))
+
+			mw.ClearCSPPServer()
+			Expect(mw.CSPPServer()).To(Equal(net.JoinHostPort(ShuffleServer, TestnetShufflePort)))
+		})
+
+		It("rejects invalid configurations", func() {
+			Expect(mw.SetCSPPServer("[::1", "", "")).To(MatchError(ErrInvalidAddress))
+			Expect(mw.SetCSPPServer("127.0.0.1", "not a certificate", "")).To(MatchError(ErrInvalidCertificate))
+			Expect(mw.SetCSPPServer("127.0.0.1", "", "proxy")).To(MatchError(ErrInvalidAddress))
+
+			By("Keeping the previous server")
+			Expect(mw.CSPPServer()).To(Equal(net.JoinHostPort(ShuffleServer, TestnetShufflePort)))
+		})
+
+		It("connects to a server with the configured certificate", func() {
+			address := server.Listener.Addr().String()
+
+			Expect(mw.SetCSPPServer(address, certificatePEM(server), "")).To(Succeed())
+			Expect(mw.CSPPServer()).To(Equal(address))
+			Expect(handshake()).To(Succeed())
+
+			By("Rejecting servers with other certificates")
+			other := newTestTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			defer other.Close()
+			Expect(mw.SetCSPPServer(address, certificatePEM(other), "")).To(Succeed())
+			Expect(handshake()).ToNot(Succeed())
+
+			By("Verifying the server against the system roots without a certificate")
+			Expect(mw.SetCSPPServer(address, "", "")).To(Succeed())
+			Expect(handshake()).ToNot(Succeed())
+		})
+
+		It("connects through the configured proxy", func() {
+			proxy, connections := startTestSOCKSProxy()
+			defer proxy.Close()
+
+			address := server.Listener.Addr().String()
+			Expect(mw.SetCSPPServer(address, certificatePEM(server), proxy.Addr().String())).To(Succeed())
+			Expect(handshake()).To(Succeed())
+			Expect(atomic.LoadInt32(connections)).To(Equal(int32(1)))
+
+			By("Failing when the proxy is unreachable")
+			proxy.Close()
+			Expect(handshake()).ToNot(Succeed())
+		})
+	})
+})
@@ -6,7 +6,6 @@ import (
 	"strconv"
 	"strings"
 
-	"decred.org/dcrwallet/errors"
 	w "decred.org/dcrwallet/wallet"
 	"github.com/decred/dcrd/chaincfg/v3"
 	"github.com/decred/dcrd/dcrutil/v3"
@@ -18,7 +17,7 @@ const AddressGapLimit uint32 = 20
 func (wallet *Wallet) GetAccounts() (string, error) {
 	accountsResponse, err := wallet.GetAccountsRaw()
 	if err != nil {
-		return "", nil
+		return "", err
 	}
 
 	result, _ := json.Marshal(accountsResponse)
@@ -28,7 +27,7 @@ func (wallet *Wallet) GetAccounts() (string, error) {
 func (wallet *Wallet) GetAccountsRaw() (*Accounts, error) {
 	resp, err := wallet.internal.Accounts(wallet.shutdownContext())
 	if err != nil {
-		return nil, err
+		return nil, walletError(wallet.ID, "GetAccountsRaw", err)
 	}
 
 	accounts := make([]*Account, len(resp.Accounts))
@@ -96,13 +95,13 @@ func (wallet *Wallet) GetAccount(accountNumber int32) (*Account, error) {
 		}
 	}
 
-	return nil, errors.New(ErrNotExist)
+	return nil, walletError(wallet.ID, "GetAccount", newError(ErrNotExist))
 }
 
 func (wallet *Wallet) GetAccountBalance(accountNumber int32) (*Balance, error) {
 	balance, err := wallet.internal.AccountBalance(wallet.shutdownContext(), uint32(accountNumber), wallet.RequiredConfirmations())
 	if err != nil {
-		return nil, err
+		return nil, walletError(wallet.ID, "GetAccountBalance", err)
 	}
 
 	return &Balance{
@@ -120,7 +119,7 @@ func (wallet *Wallet) SpendableForAccount(account int32) (int64, error) {
 	bals, err := wallet.internal.AccountBalance(wallet.shutdownContext(), uint32(account), wallet.RequiredConfirmations())
 	if err != nil {
 		log.Error(err)
-		return 0, translateError(err)
+		return 0, walletError(wallet.ID, "SpendableForAccount", err)
 	}
 	return int64(bals.Spendable), nil
 }
@@ -136,7 +135,7 @@ func (wallet *Wallet) UnspentOutputs(account int32) ([]*UnspentOutput, error) {
 	inputDetail, err := wallet.internal.SelectInputs(wallet.shutdownContext(), dcrutil.Amount(0), policy)
 
 	if err != nil {
-		return nil, err
+		return nil, walletError(wallet.ID, "UnspentOutputs", err)
 	}
 
 	unspentOutputs := make([]*UnspentOutput, len(inputDetail.Inputs))
@@ -144,7 +143,7 @@ func (wallet *Wallet) UnspentOutputs(account int32) ([]*UnspentOutput, error) {
 	for i, input := range inputDetail.Inputs {
 		outputInfo, err := wallet.internal.OutputInfo(wallet.shutdownContext(), &input.PreviousOutPoint)
 		if err != nil {
-			return nil, err
+			return nil, walletError(wallet.ID, "UnspentOutputs", err)
 		}
 
 		// unique key to identify utxo
@@ -192,14 +191,14 @@ func (wallet *Wallet) CreateNewAccount(accountName string, privPass []byte) (int
 func (wallet *Wallet) NextAccount(accountName string) (int32, error) {
 
 	if wallet.IsLocked() {
-		return -1, errors.New(ErrWalletLocked)
+		return -1, walletError(wallet.ID, "NextAccount", newError(ErrWalletLocked))
 	}
 
 	ctx := wallet.shutdownContext()
 
 	accountNumber, err := wallet.internal.NextAccount(ctx, accountName)
 	if err != nil {
-		return -1, err
+		return -1, walletError(wallet.ID, "NextAccount", err)
 	}
 
 	return int32(accountNumber), nil
@@ -208,7 +207,7 @@ func (wallet *Wallet) NextAccount(accountName string) (int32, error) {
 func (wallet *Wallet) RenameAccount(accountNumber int32, newName string) error {
 	err := wallet.internal.RenameAccount(wallet.shutdownContext(), uint32(accountNumber), newName)
 	if err != nil {
-		return translateError(err)
+		return walletError(wallet.ID, "RenameAccount", err)
 	}
 
 	return nil
@@ -217,7 +216,7 @@ func (wallet *Wallet) RenameAccount(accountNumber int32, newName string) error {
 func (wallet *Wallet) AccountName(accountNumber int32) (string, error) {
 	name, err := wallet.AccountNameRaw(uint32(accountNumber))
 	if err != nil {
-		return "", translateError(err)
+		return "", walletError(wallet.ID, "AccountName", err)
 	}
 	return name, nil
 }
@@ -228,7 +227,7 @@ func (wallet *Wallet) AccountNameRaw(accountNumber uint32) (string, error) {
 
 func (wallet *Wallet) AccountNumber(accountName string) (int32, error) {
 	accountNumber, err := wallet.internal.AccountNumber(wallet.shutdownContext(), accountName)
-	return int32(accountNumber), translateError(err)
+	return int32(accountNumber), walletError(wallet.ID, "AccountNumber", err)
 }
 
 func (wallet *Wallet) HasAccount(accountName string) bool {
@@ -239,7 +238,7 @@ func (wallet *Wallet) HasAccount(accountName string) bool {
 func (wallet *Wallet) HDPathForAccount(accountNumber int32) (string, error) {
 	cointype, err := wallet.internal.CoinType(wallet.shutdownContext())
 	if err != nil {
-		return "", translateError(err)
+		return "", walletError(wallet.ID, "HDPathForAccount", err)
 	}
 
 	var hdPath string
@@ -1,9 +1,6 @@
 package dcrlibwallet
 
 import (
-	"fmt"
-
-	"decred.org/dcrwallet/errors"
 	w "decred.org/dcrwallet/wallet"
 	"github.com/decred/dcrd/dcrutil/v3"
 )
@@ -39,12 +36,12 @@ func (wallet *Wallet) HaveAddress(address string) bool {
 func (wallet *Wallet) AccountOfAddress(address string) (string, error) {
 	addr, err := dcrutil.DecodeAddress(address, wallet.chainParams)
 	if err != nil {
-		return "", translateError(err)
+		return "", walletError(wallet.ID, "AccountOfAddress", &Error{Code: ErrInvalidAddress, Err: err})
 	}
 
 	a, err := wallet.internal.KnownAddress(wallet.shutdownContext(), addr)
 	if err != nil {
-		return "", translateError(err)
+		return "", walletError(wallet.ID, "AccountOfAddress", err)
 	}
 
 	return a.AccountName(), nil
@@ -53,7 +50,7 @@ func (wallet *Wallet) AccountOfAddress(address string) (string, error) {
 func (wallet *Wallet) AddressInfo(address string) (*AddressInfo, error) {
 	addr, err := dcrutil.DecodeAddress(address, wallet.chainParams)
 	if err != nil {
-		return nil, err
+		return nil, walletError(wallet.ID, "AddressInfo", &Error{Code: ErrInvalidAddress, Err: err})
 	}
 
 	addressInfo := &AddressInfo{
@@ -77,26 +74,26 @@ func (wallet *Wallet) AddressInfo(address string) (*AddressInfo, error) {
 
 func (wallet *Wallet) CurrentAddress(account int32) (string, error) {
 	if wallet.IsRestored && !wallet.HasDiscoveredAccounts {
-		return "", errors.E(ErrAddressDiscoveryNotDone)
+		return "", walletError(wallet.ID, "CurrentAddress", newError(ErrAddressDiscoveryNotDone))
 	}
 
 	addr, err := wallet.internal.CurrentAddress(uint32(account))
 	if err != nil {
 		log.Error(err)
-		return "", err
+		return "", walletError(wallet.ID, "CurrentAddress", err)
 	}
 	return addr.Address(), nil
 }
 
 func (wallet *Wallet) NextAddress(account int32) (string, error) {
 	if wallet.IsRestored && !wallet.HasDiscoveredAccounts {
-		return "", errors.E(ErrAddressDiscoveryNotDone)
+		return "", walletError(wallet.ID, "NextAddress", newError(ErrAddressDiscoveryNotDone))
 	}
 
 	addr, err := wallet.internal.NewExternalAddress(wallet.shutdownContext(), uint32(account), w.WithGapPolicyWrap())
 	if err != nil {
 		log.Error(err)
-		return "", err
+		return "", walletError(wallet.ID, "NextAddress", err)
 	}
 	return addr.Address(), nil
 }
@@ -104,12 +101,12 @@ func (wallet *Wallet) NextAddress(account int32) (string, error) {
 func (wallet *Wallet) AddressPubKey(address string) (string, error) {
 	addr, err := dcrutil.DecodeAddress(address, wallet.chainParams)
 	if err != nil {
-		return "", err
+		return "", walletError(wallet.ID, "AddressPubKey", &Error{Code: ErrInvalidAddress, Err: err})
 	}
 
 	known, err := wallet.internal.KnownAddress(wallet.shutdownContext(), addr)
 	if err != nil {
-		return "", err
+		return "", walletError(wallet.ID, "AddressPubKey", err)
 	}
 
 	switch known := known.(type) {
@@ -117,10 +114,11 @@ func (wallet *Wallet) AddressPubKey(address string) (string, error) {
 
 		pubKeyAddr, err := dcrutil.NewAddressSecpPubKey(known.PubKey(), wallet.chainParams)
 		if err != nil {
-			return "", err
+			return "", walletError(wallet.ID, "AddressPubKey", err)
 		}
 		return pubKeyAddr.String(), nil
 	default:
-		return "", fmt.Errorf("address is not a managed pub key address")
+		// not a managed pub key address
+		return "", walletError(wallet.ID, "AddressPubKey", newError(ErrInvalidAddress))
 	}
 }
@@ -7,6 +7,7 @@ package badgerdb
 
 import (
 	"bytes"
+	"encoding/binary"
 	"io"
 	"os"
 
@@ -14,6 +15,7 @@ import (
 	"decred.org/dcrwallet/wallet/walletdb"
 	"github.com/dgraph-io/badger"
 	"github.com/dgraph-io/badger/options"
+	"github.com/dgraph-io/badger/pb"
 )
 
 // convertErr wraps a driver-specific error with an error code.
@@ -194,7 +196,7 @@ func (b *Bucket) NestedReadBucket(key []byte) walletdb.ReadBucket {
 // Errors with code Exist if the bucket already exists, and Invalid if the key
 // is empty or otherwise invalid for the driver.
 //
-//This function is part of the walletdb.Bucket interface implementation.
+// This function is part of the walletdb.Bucket interface implementation.
 func (b *Bucket) CreateBucket(key []byte) (walletdb.ReadWriteBucket, error) {
 	if b.dbTransaction.db.closed {
 		return nil, errors.E(errors.Invalid)
@@ -210,7 +212,7 @@ func (b *Bucket) CreateBucket(key []byte) (walletdb.ReadWriteBucket, error) {
 // given key if it does not already exist.  Errors with code Invalid if the key
 // is empty or otherwise invalid for the driver.
 //
-//This function is part of the walletdb.Bucket interface implementation.
+// This function is part of the walletdb.Bucket interface implementation.
 func (b *Bucket) CreateBucketIfNotExists(key []byte) (walletdb.ReadWriteBucket, error) {
 	if b.dbTransaction.db.closed {
 		return nil, errors.E(errors.Invalid)
@@ -224,7 +226,7 @@ func (b *Bucket) CreateBucketIfNotExists(key []byte) (walletdb.ReadWriteBucket,
 
 // DeleteNestedBucket removes a nested bucket with the given key.
 //
-//This function is part of the walletdb.Bucket interface implementation.
+// This function is part of the walletdb.Bucket interface implementation.
 func (b *Bucket) DeleteNestedBucket(key []byte) error {
 	if key == nil {
 		return errors.E(errors.Invalid)
@@ -571,6 +573,7 @@ func (c *Cursor) Close() {
 type db struct {
 	*badger.DB
 	closed bool
+	path   string
 }
 
 // Enforce db implements the walletdb.DB interface.
@@ -597,9 +600,97 @@ func (db *db) BeginReadWriteTx() (walletdb.ReadWriteTx, error) {
 // Copy writes a copy of the database to the provided writer.  This call will
 // start a read-only transaction to perform all operations.
 //
+// The copy is written in the badger backup format, a sequence of protobuf
+// encoded KVLists each prefixed with its little endian uint64 length, and can
+// be restored with badger's DB.Load.
+//
 // This function is part of the walletdb.DB interface implementation.
 func (db *db) Copy(w io.Writer) error {
-	return errors.E(errors.Invalid, "method not implemented")
+	tx, err := db.beginTx(false)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	it := tx.badgerTx.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	list := &pb.KVList{}
+	var listSize int
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return convertErr(err)
+		}
+
+		list.Kv = append(list.Kv, &pb.KV{
+			Key:       item.KeyCopy(nil),
+			Value:     value,
+			UserMeta:  []byte{item.UserMeta()},
+			Version:   item.Version(),
+			ExpiresAt: item.ExpiresAt(),
+		})
+		listSize += len(value)
+
+		if listSize >= copyBatchSize {
+			if err := writeKVList(w, list); err != nil {
+				return err
+			}
+			list.Kv = list.Kv[:0]
+			listSize = 0
+		}
+	}
+
+	if len(list.Kv) > 0 {
+		return writeKVList(w, list)
+	}
+	return nil
+}
+
+// copyBatchSize is the approximate size of the KVLists written by Copy.
+const copyBatchSize = 4 << 20
+
+func writeKVList(w io.Writer, list *pb.KVList) error {
+	buf, err := list.Marshal()
+	if err != nil {
+		return errors.E(errors.Encoding, err)
+	}
+
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(buf)))
+	if _, err := w.Write(size[:]); err != nil {
+		return errors.E(errors.IO, err)
+	}
+	if _, err := w.Write(buf); err != nil {
+		return errors.E(errors.IO, err)
+	}
+	return nil
+}
+
+// loadMaxPendingWrites limits the writes buffered in memory by Load.
+const loadMaxPendingWrites = 256
+
+// Load creates a database at dbPath and restores into it the copy written by
+// Copy from r.
+func Load(dbPath string, r io.Reader) error {
+	if fileExists(dbPath) {
+		return errors.E(errors.Exist, "database already exists")
+	}
+
+	d, err := openDB(dbPath, true)
+	if err != nil {
+		return err
+	}
+	badgerDB := d.(*db)
+
+	err = badgerDB.DB.Load(r, loadMaxPendingWrites)
+	if err != nil {
+		badgerDB.Close()
+		return convertErr(err)
+	}
+
+	return badgerDB.Close()
 }
 
 // Close cleanly shuts down the database and syncs all data.
@@ -611,6 +702,7 @@ func (db *db) Close() error {
 	}
 
 	db.closed = true // setting this to true to pause all operations that will happen while db is closing
+	unregisterDB(db)
 
 	err := db.DB.Close()
 	if err != nil {
@@ -636,6 +728,22 @@ func openDB(dbPath string, create bool) (walletdb.DB, error) {
 		return nil, errors.E(errors.NotExist, "missing database file")
 	}
 
+	d := &db{
+		closed: false,
+		path:   dbPath,
+	}
+	badgerDB, err := badger.Open(dbOptions(dbPath))
+	if err == nil {
+		d.DB = badgerDB
+		registerDB(d)
+	}
+
+	return d, convertErr(err)
+}
+
+// dbOptions returns the options of the database at dbPath. Smaller tables and
+// value log files are used in low memory mode, see SetLowMemoryMode.
+func dbOptions(dbPath string) badger.Options {
 	opts := badger.DefaultOptions(dbPath).
 		WithValueDir(dbPath).
 		WithValueLogLoadingMode(options.FileIO).
@@ -648,13 +756,13 @@ func openDB(dbPath string, create bool) (walletdb.DB, error) {
 		WithNumLevelZeroTables(1).
 		WithNumLevelZeroTablesStall(2)
 
-	d := &db{
-		closed: false,
-	}
-	badgerDB, err := badger.Open(opts)
-	if err == nil {
-		d.DB = badgerDB
+	if IsLowMemoryMode() {
+		opts = opts.
+			WithValueLogFileSize(32 << 20).
+			WithMaxTableSize(8 << 20).
+			WithLevelOneSize(40 << 20).
+			WithValueLogMaxEntries(100000)
 	}
 
-	return d, convertErr(err)
+	return opts
 }
@@ -0,0 +1,108 @@
+package badgerdb
+
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"decred.org/dcrwallet/errors"
+	"github.com/dgraph-io/badger"
+)
+
+var (
+	// openDBs holds the opened databases by path, for maintenance.
+	openDBs   = make(map[string]*db)
+	openDBsMu sync.Mutex
+
+	lowMemoryMode int32
+)
+
+func registerDB(d *db) {
+	openDBsMu.Lock()
+	openDBs[filepath.Clean(d.path)] = d
+	openDBsMu.Unlock()
+}
+
+func unregisterDB(d *db) {
+	openDBsMu.Lock()
+	if openDBs[filepath.Clean(d.path)] == d {
+		delete(openDBs, filepath.Clean(d.path))
+	}
+	openDBsMu.Unlock()
+}
+
+func openedDB(dbPath string) (*db, error) {
+	openDBsMu.Lock()
+	defer openDBsMu.Unlock()
+
+	d, ok := openDBs[filepath.Clean(dbPath)]
+	if !ok || d.closed {
+		return nil, errors.E(errors.NotExist, "database is not open")
+	}
+	return d, nil
+}
+
+// SetLowMemoryMode sets whether the databases opened afterwards use smaller
+// tables and value log files, which lowers memory use on low memory devices
+// at the cost of more compactions.
+//
+// Badger limits a transaction to 15% of the table size, which is ~1.2MB or
+// 13107 writes in low memory mode. The largest write transactions of
+// dcrwallet are the chain switches of the headers sync, which save ~5 keys
+// and ~300 bytes per header for the up to 2000 headers of a headers message,
+// ~10000 writes and ~600KB. Deleting a nested bucket with more keys than the
+// limit commits the transaction and goes on in a new one.
+func SetLowMemoryMode(enabled bool) {
+	var mode int32
+	if enabled {
+		mode = 1
+	}
+	atomic.StoreInt32(&lowMemoryMode, mode)
+}
+
+// IsLowMemoryMode returns true if databases are opened in low memory mode.
+func IsLowMemoryMode() bool {
+	return atomic.LoadInt32(&lowMemoryMode) == 1
+}
+
+// RunValueLogGC rewrites the value log files of the opened database at dbPath
+// in which at least discardRatio of the values were deleted or replaced,
+// reclaiming their space. It returns the number of files rewritten.
+func RunValueLogGC(dbPath string, discardRatio float64) (int, error) {
+	d, err := openedDB(dbPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var rewritten int
+	for {
+		// each run rewrites one file at most
+		err = d.DB.RunValueLogGC(discardRatio)
+		if err == badger.ErrNoRewrite {
+			return rewritten, nil
+		}
+		if err != nil {
+			return rewritten, convertErr(err)
+		}
+		rewritten++
+	}
+}
+
+// Flatten compacts the levels of the LSM tree of the opened database at
+// dbPath into a single level, removing deleted and replaced keys.
+func Flatten(dbPath string) error {
+	d, err := openedDB(dbPath)
+	if err != nil {
+		return err
+	}
+
+	return convertErr(d.DB.Flatten(1))
+}
+
+// IsTxnTooBig returns true if err was returned because a write exceeded the
+// size limit of badger transactions, which is about 15% of the table size:
+// ~6MB by default and ~1.2MB in low memory mode. The transaction can still
+// be committed with the writes made before the failed one.
+func IsTxnTooBig(err error) bool {
+	return errors.Is(err, badger.ErrTxnTooBig)
+}
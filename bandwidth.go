@@ -0,0 +1,183 @@
+package dcrlibwallet
+
+import (
+	"github.com/asdine/storm"
+	"github.com/planetdecred/dcrlibwallet/spv"
+)
+
+const (
+	bandwidthBucketName    = "bandwidth"
+	totalBandwidthUsageKey = "total_usage"
+
+	// DefaultDataSaverBlocksThreshold is the number of block bytes that may be
+	// downloaded in a sync session on a metered network before block downloads
+	// are paused by the data saver mode.
+	DefaultDataSaverBlocksThreshold int64 = 5 << 20 // 5 MiB
+)
+
+func newBandwidthUsage(u spv.BandwidthUsage) *BandwidthUsage {
+	return &BandwidthUsage{
+		HeadersBytes:      int64(u.Headers),
+		CFiltersBytes:     int64(u.CFilters),
+		BlocksBytes:       int64(u.Blocks),
+		TransactionsBytes: int64(u.Transactions),
+		TotalBytes:        int64(u.Total()),
+	}
+}
+
+func (u *BandwidthUsage) add(other *BandwidthUsage) {
+	u.HeadersBytes += other.HeadersBytes
+	u.CFiltersBytes += other.CFiltersBytes
+	u.BlocksBytes += other.BlocksBytes
+	u.TransactionsBytes += other.TransactionsBytes
+	u.TotalBytes += other.TotalBytes
+}
+
+// SessionBandwidthUsage returns the number of bytes received from peers during
+// the current sync session. If sync is not running, the usage of the last
+// sync session is returned.
+func (mw *MultiWallet) SessionBandwidthUsage() *BandwidthUsage {
+	mw.syncData.mu.RLock()
+	defer mw.syncData.mu.RUnlock()
+	return mw.sessionBandwidthUsage()
+}
+
+// this function requires mw.syncData.mu to be held.
+func (mw *MultiWallet) sessionBandwidthUsage() *BandwidthUsage {
+	if mw.syncData.activeSyncData != nil {
+		if mw.syncData.syncer == nil {
+			// bandwidth is only accounted for when syncing over SPV.
+			return &BandwidthUsage{}
+		}
+		return newBandwidthUsage(mw.syncData.syncer.Bandwidth())
+	}
+	if mw.syncData.lastSessionBandwidth != nil {
+		usage := *mw.syncData.lastSessionBandwidth
+		return &usage
+	}
+	return &BandwidthUsage{}
+}
+
+// sessionBytesDownloaded returns the total bytes received from peers during
+// the current sync session.
+// this function requires mw.syncData.mu to be held.
+func (mw *MultiWallet) sessionBytesDownloaded() int64 {
+	if mw.syncData.activeSyncData == nil || mw.syncData.syncer == nil {
+		return 0
+	}
+	return int64(mw.syncData.syncer.Bandwidth().Total())
+}
+
+// WalletSessionBandwidthUsage returns the number of bytes received from peers
+// by the specified wallet's network backend during the current sync session.
+func (mw *MultiWallet) WalletSessionBandwidthUsage(walletID int) *BandwidthUsage {
+	mw.syncData.mu.RLock()
+	defer mw.syncData.mu.RUnlock()
+
+	if mw.syncData.activeSyncData != nil && mw.syncData.syncer != nil {
+		return newBandwidthUsage(mw.syncData.syncer.WalletBandwidth(walletID))
+	}
+	return &BandwidthUsage{}
+}
+
+// TotalBandwidthUsage returns the running total of bytes received from peers
+// across all sync sessions, including the current one.
+func (mw *MultiWallet) TotalBandwidthUsage() (*BandwidthUsage, error) {
+	var total BandwidthUsage
+	err := mw.db.Get(bandwidthBucketName, totalBandwidthUsageKey, &total)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, translateError(err)
+	}
+
+	mw.syncData.mu.RLock()
+	if mw.syncData.activeSyncData != nil && mw.syncData.syncer != nil {
+		total.add(mw.sessionBandwidthUsage())
+	}
+	mw.syncData.mu.RUnlock()
+
+	return &total, nil
+}
+
+// ResetTotalBandwidthUsage clears the running total of bytes received from
+// peers.
+func (mw *MultiWallet) ResetTotalBandwidthUsage() error {
+	err := mw.db.Delete(bandwidthBucketName, totalBandwidthUsageKey)
+	if err != nil && err != storm.ErrNotFound {
+		return translateError(err)
+	}
+	return nil
+}
+
+// saveSessionBandwidthUsage adds the bandwidth used by the sync session that
+// just ended to the saved running total.
+func (mw *MultiWallet) saveSessionBandwidthUsage(session *BandwidthUsage) {
+	var total BandwidthUsage
+	err := mw.db.Get(bandwidthBucketName, totalBandwidthUsageKey, &total)
+	if err != nil && err != storm.ErrNotFound {
+		log.Errorf("error reading total bandwidth usage: %v", err)
+		return
+	}
+
+	total.add(session)
+	err = mw.db.Set(bandwidthBucketName, totalBandwidthUsageKey, &total)
+	if err != nil {
+		log.Errorf("error saving total bandwidth usage: %v", err)
+	}
+}
+
+// SetDataSaverMode enables or disables the data saver mode. While enabled and
+// the host app reports a metered network through SetNetworkMetered, block
+// downloads are paused once blockBytesThreshold bytes of blocks were received
+// in the current sync session and transactions relayed by peers are ignored.
+// A blockBytesThreshold <= 0 uses DefaultDataSaverBlocksThreshold.
+func (mw *MultiWallet) SetDataSaverMode(enabled bool, blockBytesThreshold int64) {
+	if blockBytesThreshold <= 0 {
+		blockBytesThreshold = DefaultDataSaverBlocksThreshold
+	}
+
+	mw.SaveUserConfigValue(DataSaverConfigKey, enabled)
+	mw.SaveUserConfigValue(DataSaverBlocksThresholdConfigKey, blockBytesThreshold)
+
+	mw.syncData.mu.RLock()
+	if mw.syncData.activeSyncData != nil && mw.syncData.syncer != nil {
+		mw.syncData.syncer.SetDataSaver(enabled, uint64(blockBytesThreshold))
+	}
+	mw.syncData.mu.RUnlock()
+}
+
+// IsDataSaverModeEnabled returns true if the data saver mode was enabled with
+// SetDataSaverMode.
+func (mw *MultiWallet) IsDataSaverModeEnabled() bool {
+	return mw.ReadBoolConfigValueForKey(DataSaverConfigKey, false)
+}
+
+// SetNetworkMetered should be called by the host app whenever the device's
+// network connection changes between metered and unmetered.
+func (mw *MultiWallet) SetNetworkMetered(metered bool) {
+	mw.syncData.mu.Lock()
+	mw.syncData.networkMetered = metered
+	if mw.syncData.activeSyncData != nil && mw.syncData.syncer != nil {
+		mw.syncData.syncer.SetNetworkMetered(metered)
+	}
+	mw.syncData.mu.Unlock()
+}
+
+// IsBlockDownloadPaused returns true if block downloads for the current sync
+// session are paused by the data saver mode.
+func (mw *MultiWallet) IsBlockDownloadPaused() bool {
+	mw.syncData.mu.RLock()
+	defer mw.syncData.mu.RUnlock()
+
+	if mw.syncData.activeSyncData != nil && mw.syncData.syncer != nil {
+		return mw.syncData.syncer.BlockDownloadsPaused()
+	}
+	return false
+}
+
+// configureDataSaver applies the saved data saver settings to syncer.
+// this function requires mw.syncData.mu to be held.
+func (mw *MultiWallet) configureDataSaver(syncer *spv.Syncer) {
+	threshold := mw.ReadLongConfigValueForKey(DataSaverBlocksThresholdConfigKey, DefaultDataSaverBlocksThreshold)
+	syncer.SetDataSaver(mw.IsDataSaverModeEnabled(), uint64(threshold))
+	syncer.SetNetworkMetered(mw.syncData.networkMetered)
+}
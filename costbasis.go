@@ -0,0 +1,168 @@
+package dcrlibwallet
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/planetdecred/dcrlibwallet/walletdata"
+)
+
+const (
+	// CostBasisFIFO disposes of the earliest acquired coins first.
+	CostBasisFIFO = "fifo"
+
+	// CostBasisLIFO disposes of the latest acquired coins first.
+	CostBasisLIFO = "lifo"
+)
+
+// costBasisLot is an amount acquired at once and not yet disposed of.
+type costBasisLot struct {
+	atoms     int64
+	cost      float64
+	timestamp int64
+}
+
+// CostBasisReportRaw matches the coins disposed of by the wallet transactions
+// with the coins acquired before, in the order of method, to compute the
+// capital gains of each disposal in the currency. Fiat values are those of
+// the transactions at the time they happened, see
+// SetTransactionFiatCurrency. Only saved rates are used, the transactions
+// without a saved rate are listed in MissingRates and count as acquired or
+// disposed of at no value.
+//
+// Received amounts and vote rewards are acquisitions. Sent amounts and fees
+// are disposals, fees having no proceeds. Ticket purchases and revocations
+// only dispose of their fees since the ticket price returns to the wallet.
+func (wallet *Wallet) CostBasisReportRaw(currency, method string) (*CostBasisReport, error) {
+	currency = strings.ToUpper(currency)
+	if currency == "" || (method != CostBasisFIFO && method != CostBasisLIFO) {
+		return nil, newError(ErrInvalid)
+	}
+
+	var transactions []Transaction
+	err := wallet.walletDataDB.Read(0, 0, walletdata.TxFilterAll, false, wallet.GetBestBlock(), &transactions)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	report := &CostBasisReport{
+		WalletID:  wallet.ID,
+		Currency:  currency,
+		Method:    method,
+		Disposals: make([]*CostBasisDisposal, 0),
+	}
+
+	var lots []*costBasisLot
+	for i := range transactions {
+		tx := &transactions[i]
+
+		var acquired, sent, fee int64
+		switch {
+		case tx.Type == TxTypeVote:
+			acquired = tx.VoteReward
+		case tx.Type == TxTypeTicketPurchase || tx.Type == TxTypeRevocation:
+			fee = tx.Fee
+		case tx.Direction == TxDirectionReceived:
+			acquired = tx.Amount
+		case tx.Direction == TxDirectionSent:
+			sent, fee = tx.Amount, tx.Fee
+		case tx.Direction == TxDirectionTransferred:
+			fee = tx.Fee
+		}
+		if acquired <= 0 && sent+fee <= 0 {
+			continue
+		}
+
+		if tx.FiatCurrency != currency {
+			err = wallet.setTxFiatValues(tx, currency, false)
+			if err != nil {
+				report.MissingRates = append(report.MissingRates, tx.Hash)
+			}
+		}
+		rate := tx.FiatRate
+		if tx.FiatCurrency != currency {
+			rate = 0
+		}
+
+		if acquired > 0 {
+			lots = append(lots, &costBasisLot{
+				atoms:     acquired,
+				cost:      AmountCoin(acquired) * rate,
+				timestamp: tx.Timestamp,
+			})
+			continue
+		}
+
+		disposal := &CostBasisDisposal{
+			Hash:      tx.Hash,
+			Timestamp: tx.Timestamp,
+			Atoms:     sent + fee,
+			Proceeds:  AmountCoin(sent) * rate,
+		}
+		lots, disposal.CostBasis, disposal.AcquiredAt, disposal.UnmatchedAtoms = disposeLots(lots, sent+fee, method)
+		disposal.Gain = disposal.Proceeds - disposal.CostBasis
+
+		report.Disposals = append(report.Disposals, disposal)
+		report.TotalProceeds += disposal.Proceeds
+		report.TotalCostBasis += disposal.CostBasis
+		report.TotalGain += disposal.Gain
+		report.UnmatchedAtoms += disposal.UnmatchedAtoms
+	}
+
+	for _, lot := range lots {
+		report.RemainingAtoms += lot.atoms
+		report.RemainingCostBasis += lot.cost
+	}
+
+	return report, nil
+}
+
+// CostBasisReport returns the result of CostBasisReportRaw as a JSON string.
+func (wallet *Wallet) CostBasisReport(currency, method string) (string, error) {
+	report, err := wallet.CostBasisReportRaw(currency, method)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := json.Marshal(report)
+	if err != nil {
+		return "", translateError(err)
+	}
+	return string(result), nil
+}
+
+// disposeLots removes atoms from the lots in the order of method. It returns
+// the remaining lots, the cost of the removed atoms, the acquisition time of
+// the earliest lot used and the atoms that no lot covered.
+func disposeLots(lots []*costBasisLot, atoms int64, method string) ([]*costBasisLot, float64, int64, int64) {
+	var cost float64
+	var acquiredAt int64
+
+	for atoms > 0 && len(lots) > 0 {
+		index := 0
+		if method == CostBasisLIFO {
+			index = len(lots) - 1
+		}
+		lot := lots[index]
+
+		used := lot.atoms
+		if used > atoms {
+			used = atoms
+		}
+		usedCost := lot.cost * float64(used) / float64(lot.atoms)
+
+		cost += usedCost
+		atoms -= used
+		lot.cost -= usedCost
+		lot.atoms -= used
+		if acquiredAt == 0 || lot.timestamp < acquiredAt {
+			acquiredAt = lot.timestamp
+		}
+
+		if lot.atoms == 0 {
+			lots = append(lots[:index], lots[index+1:]...)
+		}
+	}
+
+	return lots, cost, acquiredAt, atoms
+}
@@ -0,0 +1,213 @@
+package dcrlibwallet
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cost basis", func() {
+	Describe("disposeLots", func() {
+		newLots := func() []*costBasisLot {
+			return []*costBasisLot{
+				{atoms: 100, cost: 10, timestamp: 1},
+				{atoms: 200, cost: 40, timestamp: 2},
+				{atoms: 300, cost: 90, timestamp: 3},
+			}
+		}
+
+		type lot struct {
+			atoms int64
+			cost  float64
+		}
+
+		for _, test := range []struct {
+			name       string
+			method     string
+			atoms      int64
+			cost       float64
+			acquiredAt int64
+			unmatched  int64
+			remaining  []lot
+		}{
+			{"fifo part of a lot", CostBasisFIFO, 50, 5, 1, 0, []lot{{50, 5}, {200, 40}, {300, 90}}},
+			{"fifo across lots", CostBasisFIFO, 200, 30, 1, 0, []lot{{100, 20}, {300, 90}}},
+			{"fifo all lots", CostBasisFIFO, 700, 140, 1, 100, nil},
+			{"lifo part of a lot", CostBasisLIFO, 150, 45, 3, 0, []lot{{100, 10}, {200, 40}, {150, 45}}},
+			{"lifo across lots", CostBasisLIFO, 400, 110, 2, 0, []lot{{100, 10}, {100, 20}}},
+			{"lifo all lots", CostBasisLIFO, 650, 140, 1, 50, nil},
+		} {
+			test := test
+			It("disposes of "+test.name, func() {
+				lots, cost, acquiredAt, unmatched := disposeLots(newLots(), test.atoms, test.method)
+				Expect(cost).To(BeNumerically("~", test.cost, 1e-9))
+				Expect(acquiredAt).To(Equal(test.acquiredAt))
+				Expect(unmatched).To(Equal(test.unmatched))
+
+				Expect(lots).To(HaveLen(len(test.remaining)))
+				for i, remaining := range test.remaining {
+					Expect(lots[i].atoms).To(Equal(remaining.atoms))
+					Expect(lots[i].cost).To(BeNumerically("~", remaining.cost, 1e-9))
+				}
+			})
+		}
+
+		It("leaves the lots alone if nothing is disposed of", func() {
+			lots, cost, acquiredAt, unmatched := disposeLots(newLots(), 0, CostBasisFIFO)
+			Expect(lots).To(HaveLen(3))
+			Expect(cost).To(BeZero())
+			Expect(acquiredAt).To(BeZero())
+			Expect(unmatched).To(BeZero())
+		})
+	})
+
+	Describe("CostBasisReportRaw", func() {
+		const (
+			acquiredAt = 1600000000
+			addedAt    = 1600100000
+			disposedAt = 1600200000
+			unratedAt  = 1600300000
+		)
+
+		var (
+			mw      *MultiWallet
+			cleanup func()
+			wallet  *Wallet
+			source  *countingRateSource
+		)
+
+		fetches := func() int {
+			source.mu.Lock()
+			defer source.mu.Unlock()
+			return source.fetches
+		}
+
+		BeforeEach(func() {
+			mw, cleanup = newTestMultiWallet()
+			wallet = newTestWallet(mw, "costbasis")
+			source = &countingRateSource{rate: 50}
+			mw.UseExchangeRateSource(source)
+
+			for _, rate := range []*ExchangeRate{
+				{Currency: "USD", Rate: 10, Timestamp: acquiredAt},
+				{Currency: "USD", Rate: 20, Timestamp: addedAt},
+				{Currency: "USD", Rate: 30, Timestamp: disposedAt},
+			} {
+				Expect(mw.saveExchangeRate(rate)).To(Succeed())
+			}
+
+			for _, tx := range []*Transaction{
+				{Hash: "acquired", Type: TxTypeRegular, Direction: TxDirectionReceived, Amount: 2e8, Timestamp: acquiredAt, BlockHeight: 1},
+				{Hash: "added", Type: TxTypeRegular, Direction: TxDirectionReceived, Amount: 1e8, Timestamp: addedAt, BlockHeight: 2},
+				{Hash: "disposed", Type: TxTypeRegular, Direction: TxDirectionSent, Amount: 15e7, Fee: 1e7, Timestamp: disposedAt, BlockHeight: 3},
+				{Hash: "unrated", Type: TxTypeRegular, Direction: TxDirectionReceived, Amount: 1e8, Timestamp: unratedAt, BlockHeight: 4},
+			} {
+				_, err := wallet.walletDataDB.SaveOrUpdate(&Transaction{}, tx)
+				Expect(err).To(BeNil())
+			}
+		})
+
+		AfterEach(func() {
+			cleanup()
+		})
+
+		for _, test := range []struct {
+			method             string
+			costBasis          float64
+			remainingCostBasis float64
+		}{
+			// 1.6 DCR of the 2 DCR acquired at 10
+			{CostBasisFIFO, 16, 4 + 20},
+			// 1 DCR added at 20 and 0.6 DCR acquired at 10
+			{CostBasisLIFO, 20 + 6, 14},
+		} {
+			test := test
+			It("matches the disposals with the acquisitions by "+test.method+" using saved rates only", func() {
+				report, err := wallet.CostBasisReportRaw("usd", test.method)
+				Expect(err).To(BeNil())
+				Expect(fetches()).To(BeZero())
+
+				Expect(report.Currency).To(Equal("USD"))
+				Expect(report.Method).To(Equal(test.method))
+				Expect(report.MissingRates).To(Equal([]string{"unrated"}))
+
+				Expect(report.Disposals).To(HaveLen(1))
+				disposal := report.Disposals[0]
+				Expect(disposal.Hash).To(Equal("disposed"))
+				Expect(disposal.Atoms).To(BeEquivalentTo(16e7))
+				Expect(disposal.Proceeds).To(BeNumerically("~", 45, 1e-9))
+				Expect(disposal.CostBasis).To(BeNumerically("~", test.costBasis, 1e-9))
+				Expect(disposal.Gain).To(BeNumerically("~", 45-test.costBasis, 1e-9))
+				Expect(disposal.AcquiredAt).To(BeEquivalentTo(acquiredAt))
+				Expect(disposal.UnmatchedAtoms).To(BeZero())
+
+				Expect(report.TotalGain).To(BeNumerically("~", disposal.Gain, 1e-9))
+				Expect(report.RemainingAtoms).To(BeEquivalentTo(24e7))
+				Expect(report.RemainingCostBasis).To(BeNumerically("~", test.remainingCostBasis, 1e-9))
+			})
+		}
+
+		It("rejects invalid currencies and methods", func() {
+			_, err := wallet.CostBasisReportRaw("", CostBasisFIFO)
+			Expect(err).To(MatchError(ErrInvalid))
+			_, err = wallet.CostBasisReportRaw("USD", "hifo")
+			Expect(err).To(MatchError(ErrInvalid))
+		})
+
+		It("reads transactions without looking up fiat values", func() {
+			mw.SetStringConfigValueForKey(TxFiatCurrencyConfigKey, "USD")
+
+			transactions, err := wallet.GetTransactionsRaw(0, 0, 0, false)
+			Expect(err).To(BeNil())
+			Expect(transactions).To(HaveLen(4))
+			for _, tx := range transactions {
+				Expect(tx.FiatCurrency).To(BeEmpty())
+			}
+			Expect(fetches()).To(BeZero())
+		})
+
+		It("backfills the fiat values in the background", func() {
+			mw.SetTransactionFiatCurrency("usd")
+			Eventually(mw.isTxFiatBackfillRunning, 10).Should(BeFalse())
+			Expect(fetches()).To(Equal(1))
+
+			transactions, err := wallet.GetTransactionsRaw(0, 0, 0, false)
+			Expect(err).To(BeNil())
+			rates := make(map[string]float64)
+			for _, tx := range transactions {
+				Expect(tx.FiatCurrency).To(Equal("USD"))
+				rates[tx.Hash] = tx.FiatRate
+			}
+			Expect(rates).To(Equal(map[string]float64{"acquired": 10, "added": 20, "disposed": 30, "unrated": 50}))
+
+			var disposed Transaction
+			Expect(wallet.walletDataDB.FindOne("Hash", "disposed", &disposed)).To(Succeed())
+			Expect(disposed.FiatAmount).To(BeNumerically("~", 45, 1e-9))
+			Expect(disposed.FiatFee).To(BeNumerically("~", 3, 1e-9))
+		})
+
+		It("keeps fetching rates after an hour without a rate", func() {
+			// sorted before the unrated tx, which is read after it
+			source.listedAt = acquiredAt - 3600
+			_, err := wallet.walletDataDB.SaveOrUpdate(&Transaction{}, &Transaction{Hash: "prelisting", Type: TxTypeRegular,
+				Direction: TxDirectionReceived, Amount: 1e8, Timestamp: acquiredAt - 100000, BlockHeight: 1})
+			Expect(err).To(BeNil())
+
+			mw.SetTransactionFiatCurrency("USD")
+			Eventually(mw.isTxFiatBackfillRunning, 10).Should(BeFalse())
+			Expect(fetches()).To(Equal(2))
+
+			var prelisting Transaction
+			Expect(wallet.walletDataDB.FindOne("Hash", "prelisting", &prelisting)).To(Succeed())
+			Expect(prelisting.FiatCurrency).To(BeEmpty())
+			var unrated Transaction
+			Expect(wallet.walletDataDB.FindOne("Hash", "unrated", &unrated)).To(Succeed())
+			Expect(unrated.FiatCurrency).To(Equal("USD"))
+			Expect(unrated.FiatRate).To(BeEquivalentTo(50))
+
+			By("Not fetching the missing rate again")
+			mw.startTxFiatBackfill()
+			Eventually(mw.isTxFiatBackfillRunning, 10).Should(BeFalse())
+			Expect(fetches()).To(Equal(2))
+		})
+	})
+})
@@ -0,0 +1,316 @@
+package dcrlibwallet
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"decred.org/dcrwallet/errors"
+	"github.com/planetdecred/dcrlibwallet/badgerdb"
+	"github.com/planetdecred/dcrlibwallet/walletdata"
+)
+
+const (
+	// DatabaseMaintenanceIntervalConfigKey holds the number of hours between
+	// scheduled value log GC runs of badger wallet databases, 0 disables
+	// scheduled runs.
+	DatabaseMaintenanceIntervalConfigKey = "db_maintenance_interval"
+
+	// LowMemoryDatabaseConfigKey holds whether badger wallet databases are
+	// opened with options tuned for low memory devices.
+	LowMemoryDatabaseConfigKey = "low_memory_db"
+
+	// DefaultValueLogGCDiscardRatio is the fraction of a value log file that
+	// must be discarded for the file to be rewritten by a GC run.
+	DefaultValueLogGCDiscardRatio = 0.5
+
+	defaultDatabaseMaintenanceInterval = 24
+)
+
+// RunDatabaseGC runs value log garbage collection on the badger database of
+// the wallet until no value log file can be rewritten. It returns the number
+// of value log files rewritten.
+func (wallet *Wallet) RunDatabaseGC() (int32, error) {
+	dbPath, err := wallet.badgerDbPath()
+	if err != nil {
+		return 0, err
+	}
+
+	rewritten, err := badgerdb.RunValueLogGC(dbPath, DefaultValueLogGCDiscardRatio)
+	if err != nil {
+		log.Errorf("[%d] Database GC error: %v", wallet.ID, err)
+		return 0, translateError(err)
+	}
+
+	log.Infof("[%d] Database GC rewrote %d value log files", wallet.ID, rewritten)
+	return int32(rewritten), nil
+}
+
+// CompactDatabase compacts the badger database of the wallet into a single
+// level and then runs value log garbage collection, see RunDatabaseGC.
+// Compaction can take a while on large databases.
+func (wallet *Wallet) CompactDatabase() error {
+	dbPath, err := wallet.badgerDbPath()
+	if err != nil {
+		return err
+	}
+
+	err = badgerdb.Flatten(dbPath)
+	if err != nil {
+		log.Errorf("[%d] Database compaction error: %v", wallet.ID, err)
+		return translateError(err)
+	}
+
+	_, err = wallet.RunDatabaseGC()
+	return err
+}
+
+// badgerDbPath returns the path of the wallet database if the wallet uses an
+// opened badger database.
+func (wallet *Wallet) badgerDbPath() (string, error) {
+	if wallet.dbDriver() != DbDriverBadger {
+		return "", newError(ErrInvalid)
+	}
+	// the database is closed while the wallet is unloaded by a migration or
+	// a backup import, check the loader rather than WalletOpened
+	if _, loaded := wallet.loader.LoadedWallet(); !loaded || wallet.IsMigratingDatabase() {
+		return "", newError(ErrWalletNotLoaded)
+	}
+
+	return filepath.Join(wallet.dataDir, walletDbName), nil
+}
+
+// SetDatabaseMaintenanceInterval saves the number of hours between scheduled
+// value log GC runs of badger wallet databases and reschedules the runs.
+// Scheduled runs are disabled if hours is 0.
+func (mw *MultiWallet) SetDatabaseMaintenanceInterval(hours int32) error {
+	if hours < 0 {
+		return newError(ErrInvalid)
+	}
+
+	mw.SetInt32ConfigValueForKey(DatabaseMaintenanceIntervalConfigKey, hours)
+	mw.scheduleDatabaseMaintenance()
+	return nil
+}
+
+// DatabaseMaintenanceInterval returns the number of hours between scheduled
+// value log GC runs of badger wallet databases.
+func (mw *MultiWallet) DatabaseMaintenanceInterval() int32 {
+	return mw.ReadInt32ConfigValueForKey(DatabaseMaintenanceIntervalConfigKey, defaultDatabaseMaintenanceInterval)
+}
+
+// SetLowMemoryDatabaseMode saves whether badger wallet databases use options
+// tuned for low memory devices. The mode applies to databases opened after
+// this call, wallets already opened keep their options until restarted.
+// Low memory mode also lowers the size limit of database transactions, see
+// badgerdb.SetLowMemoryMode.
+func (mw *MultiWallet) SetLowMemoryDatabaseMode(enabled bool) {
+	mw.SetBoolConfigValueForKey(LowMemoryDatabaseConfigKey, enabled)
+	badgerdb.SetLowMemoryMode(enabled)
+}
+
+// IsLowMemoryDatabaseMode returns true if badger wallet databases use options
+// tuned for low memory devices.
+func (mw *MultiWallet) IsLowMemoryDatabaseMode() bool {
+	return mw.ReadBoolConfigValueForKey(LowMemoryDatabaseConfigKey, false)
+}
+
+// scheduleDatabaseMaintenance (re)starts the scheduled value log GC runs of
+// the opened badger wallet databases, stopping runs scheduled earlier.
+func (mw *MultiWallet) scheduleDatabaseMaintenance() {
+	mw.dbMaintenanceMu.Lock()
+	defer mw.dbMaintenanceMu.Unlock()
+
+	mw.stopDatabaseMaintenanceLocked()
+
+	hours := mw.DatabaseMaintenanceInterval()
+	if hours <= 0 {
+		return
+	}
+
+	var ctx context.Context
+	ctx, mw.cancelDbMaintenance = mw.contextWithShutdownCancel()
+	done := make(chan struct{})
+	mw.dbMaintenanceDone = done
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(time.Duration(hours) * time.Hour)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				mw.runDatabaseMaintenance()
+			}
+		}
+	}()
+}
+
+// stopDatabaseMaintenance stops the scheduled value log GC runs and waits for
+// a run in progress to end.
+func (mw *MultiWallet) stopDatabaseMaintenance() {
+	mw.dbMaintenanceMu.Lock()
+	defer mw.dbMaintenanceMu.Unlock()
+
+	mw.stopDatabaseMaintenanceLocked()
+}
+
+// stopDatabaseMaintenanceLocked is stopDatabaseMaintenance with
+// dbMaintenanceMu held.
+func (mw *MultiWallet) stopDatabaseMaintenanceLocked() {
+	if mw.cancelDbMaintenance == nil {
+		return
+	}
+
+	mw.cancelDbMaintenance()
+	<-mw.dbMaintenanceDone
+	mw.cancelDbMaintenance = nil
+	mw.dbMaintenanceDone = nil
+}
+
+func (mw *MultiWallet) runDatabaseMaintenance() {
+	mw.restoreMu.RLock()
+	defer mw.restoreMu.RUnlock()
+
+	// wallets may be added or deleted while the GC runs
+	for _, wallet := range mw.AllWallets() {
+		if _, err := wallet.badgerDbPath(); err != nil {
+			continue
+		}
+
+		// errors are logged by RunDatabaseGC
+		wallet.RunDatabaseGC()
+	}
+}
+
+// RootDirSizeRaw returns the on-disk size of the multiwallet root directory,
+// broken down per wallet and per database.
+func (mw *MultiWallet) RootDirSizeRaw() (*RootDirSize, error) {
+	entries, err := ioutil.ReadDir(mw.rootDir)
+	if err != nil {
+		return nil, errors.E(errors.IO, err)
+	}
+
+	rootSize := new(RootDirSize)
+	for _, entry := range entries {
+		path := filepath.Join(mw.rootDir, entry.Name())
+
+		if entry.IsDir() {
+			walletID, err := strconv.Atoi(entry.Name())
+			if err != nil || mw.WalletWithID(walletID) == nil {
+				size, err := dirSize(path)
+				if err != nil {
+					return nil, err
+				}
+				rootSize.Other += size
+				rootSize.Total += size
+				continue
+			}
+
+			walletSize, err := walletDirSize(walletID, path)
+			if err != nil {
+				return nil, err
+			}
+			rootSize.Wallets = append(rootSize.Wallets, walletSize)
+			rootSize.Total += walletSize.Total
+			continue
+		}
+
+		switch {
+		case entry.Name() == walletsDbName:
+			rootSize.WalletsDB += entry.Size()
+		case strings.HasPrefix(entry.Name(), strings.TrimSuffix(logFileName, filepath.Ext(logFileName))):
+			// rotated log files share the log file name prefix
+			rootSize.Logs += entry.Size()
+		default:
+			rootSize.Other += entry.Size()
+		}
+		rootSize.Total += entry.Size()
+	}
+
+	return rootSize, nil
+}
+
+// RootDirSize returns the result of RootDirSizeRaw as a JSON string.
+func (mw *MultiWallet) RootDirSize() (string, error) {
+	size, err := mw.RootDirSizeRaw()
+	if err != nil {
+		return "", err
+	}
+
+	result, err := json.Marshal(size)
+	if err != nil {
+		return "", translateError(err)
+	}
+	return string(result), nil
+}
+
+func walletDirSize(walletID int, walletDir string) (*WalletDirSize, error) {
+	walletSize := &WalletDirSize{WalletID: walletID}
+
+	walletDbPath := filepath.Join(walletDir, walletDbName)
+	walletDataDbPath := filepath.Join(walletDir, walletdata.DbName)
+
+	err := filepath.Walk(walletDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		size := info.Size()
+		walletSize.Total += size
+
+		switch {
+		case path == walletDataDbPath:
+			walletSize.WalletDataDB += size
+		case path == walletDbPath:
+			// bdb wallet database
+			walletSize.WalletDB += size
+		case filepath.Dir(path) == walletDbPath:
+			// badger wallet database directory
+			walletSize.WalletDB += size
+			switch filepath.Ext(path) {
+			case ".sst":
+				walletSize.WalletDBIndex += size
+			case ".vlog":
+				walletSize.WalletDBValueLog += size
+			}
+		default:
+			walletSize.Other += size
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.E(errors.IO, err)
+	}
+
+	return walletSize, nil
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.E(errors.IO, err)
+	}
+	return size, nil
+}
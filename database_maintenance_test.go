@@ -0,0 +1,244 @@
+package dcrlibwallet
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"decred.org/dcrwallet/wallet/walletdb"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/planetdecred/dcrlibwallet/badgerdb"
+)
+
+// putTestKeys writes count keys with 100 byte values made of fill to the meta
+// bucket of db in transactions of 10000 keys.
+func putTestKeys(db walletdb.DB, count int, fill byte) {
+	value := make([]byte, 100)
+	for i := range value {
+		value[i] = fill
+	}
+
+	for start := 0; start < count; start += 10000 {
+		err := walletdb.Update(context.Background(), db, func(tx walletdb.ReadWriteTx) error {
+			meta, err := tx.CreateTopLevelBucket([]byte("meta"))
+			if err != nil {
+				return err
+			}
+			for i := start; i < start+10000 && i < count; i++ {
+				var k [8]byte
+				binary.BigEndian.PutUint64(k[:], uint64(i))
+				if err = meta.Put(k[:], value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		ExpectWithOffset(1, err).To(BeNil())
+	}
+}
+
+var _ = Describe("Database maintenance", func() {
+	AfterEach(func() {
+		badgerdb.SetLowMemoryMode(false)
+	})
+
+	Describe("RunDatabaseGC", func() {
+		It("runs on opened badger wallet databases only", func() {
+			mw, cleanup := newTestMultiWalletWithDriver(DbDriverBadger)
+			defer cleanup()
+
+			wallet := newTestWallet(mw, "gc")
+			_, err := wallet.RunDatabaseGC()
+			Expect(err).To(BeNil())
+			Expect(wallet.CompactDatabase()).To(Succeed())
+
+			Expect(wallet.loader.UnloadWallet()).To(Succeed())
+			_, err = wallet.RunDatabaseGC()
+			Expect(err).To(MatchError(ErrWalletNotLoaded))
+			Expect(wallet.CompactDatabase()).To(MatchError(ErrWalletNotLoaded))
+
+			wallet.DbDriver = DbDriverBdb
+			_, err = wallet.RunDatabaseGC()
+			Expect(err).To(MatchError(ErrInvalid))
+		})
+
+		It("rewrites the value log files of replaced values", func() {
+			// low memory mode starts a value log file every 100000 values
+			badgerdb.SetLowMemoryMode(true)
+
+			dir, err := ioutil.TempDir("", "gc")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+
+			dbPath := filepath.Join(dir, walletDbName)
+			db, err := walletdb.Create(DbDriverBadger, dbPath)
+			Expect(err).To(BeNil())
+			defer func() {
+				db.Close()
+			}()
+
+			putTestKeys(db, 100000, 1)
+			putTestKeys(db, 100000, 2)
+
+			// closing the database flushes the memtable, which records the
+			// head of the value log that GC runs must not rewrite
+			Expect(db.Close()).To(Succeed())
+			db, err = walletdb.Open(DbDriverBadger, dbPath)
+			Expect(err).To(BeNil())
+
+			Expect(badgerdb.Flatten(dbPath)).To(Succeed())
+			rewritten, err := badgerdb.RunValueLogGC(dbPath, DefaultValueLogGCDiscardRatio)
+			Expect(err).To(BeNil())
+			Expect(rewritten).To(BeNumerically(">=", 1))
+
+			err = walletdb.View(context.Background(), db, func(tx walletdb.ReadTx) error {
+				var k [8]byte
+				binary.BigEndian.PutUint64(k[:], 99999)
+				Expect(tx.ReadBucket([]byte("meta")).Get(k[:])[0]).To(BeEquivalentTo(2))
+				return nil
+			})
+			Expect(err).To(BeNil())
+
+			_, err = badgerdb.RunValueLogGC(filepath.Join(dir, "closed"), DefaultValueLogGCDiscardRatio)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	It("fits a chain switch of a headers message in a low memory transaction", func() {
+		badgerdb.SetLowMemoryMode(true)
+
+		dir, err := ioutil.TempDir("", "txnsize")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+
+		db, err := walletdb.Create(DbDriverBadger, filepath.Join(dir, walletDbName))
+		Expect(err).To(BeNil())
+		defer db.Close()
+
+		// the writes of udb.Store.ExtendMainChain for 2000 headers: the
+		// header, the tip block, the block record, the stake validation of
+		// the parent block record and the cfilter
+		err = walletdb.Update(context.Background(), db, func(tx walletdb.ReadWriteTx) error {
+			ns, err := tx.CreateTopLevelBucket([]byte("wtxmgr"))
+			if err != nil {
+				return err
+			}
+			headers, err := ns.CreateBucket([]byte("h"))
+			if err != nil {
+				return err
+			}
+			blocks, err := ns.CreateBucket([]byte("b"))
+			if err != nil {
+				return err
+			}
+			cfilters, err := ns.CreateBucket([]byte("c"))
+			if err != nil {
+				return err
+			}
+
+			for height := 1; height <= 2000; height++ {
+				var hash [32]byte
+				binary.BigEndian.PutUint32(hash[:], uint32(height))
+				var blockKey [4]byte
+				binary.BigEndian.PutUint32(blockKey[:], uint32(height))
+				var parentKey [4]byte
+				binary.BigEndian.PutUint32(parentKey[:], uint32(height-1))
+
+				for _, put := range []struct {
+					bucket walletdb.ReadWriteBucket
+					key    []byte
+					size   int
+				}{
+					{headers, hash[:], 180},
+					{ns, []byte("tip"), 32},
+					{blocks, blockKey[:], 220},
+					{blocks, parentKey[:], 220},
+					{cfilters, hash[:], 300},
+				} {
+					if err := put.bucket.Put(put.key, make([]byte, put.size)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		Expect(err).To(BeNil())
+	})
+
+	Describe("RootDirSizeRaw", func() {
+		It("breaks down the size of the root directory", func() {
+			mw, cleanup := newTestMultiWalletWithDriver(DbDriverBadger)
+			defer cleanup()
+
+			wallet := newTestWallet(mw, "size")
+			_, err := wallet.walletDataDB.SaveOrUpdate(&Transaction{}, &Transaction{Hash: "tx", Timestamp: 1})
+			Expect(err).To(BeNil())
+
+			Expect(ioutil.WriteFile(filepath.Join(mw.rootDir, "stray"), make([]byte, 1000), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(wallet.dataDir, "stray"), make([]byte, 2000), 0600)).To(Succeed())
+			orphanDir := filepath.Join(mw.rootDir, strconv.Itoa(wallet.ID+1))
+			Expect(os.MkdirAll(orphanDir, 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(orphanDir, walletDbName), make([]byte, 3000), 0600)).To(Succeed())
+
+			size, err := mw.RootDirSizeRaw()
+			Expect(err).To(BeNil())
+			Expect(size.WalletsDB).To(BeNumerically(">", 0))
+			Expect(size.Logs).To(BeNumerically(">", 0))
+			Expect(size.Other).To(BeNumerically(">=", 4000))
+
+			Expect(size.Wallets).To(HaveLen(1))
+			walletSize := size.Wallets[0]
+			Expect(walletSize.WalletID).To(Equal(wallet.ID))
+			Expect(walletSize.WalletDB).To(BeNumerically(">", 0))
+			Expect(walletSize.WalletDBValueLog).To(BeNumerically(">", 0))
+			Expect(walletSize.WalletDBIndex + walletSize.WalletDBValueLog).To(BeNumerically("<=", walletSize.WalletDB))
+			Expect(walletSize.WalletDataDB).To(BeNumerically(">", 0))
+			Expect(walletSize.Other).To(BeNumerically(">=", 2000))
+			Expect(walletSize.Total).To(Equal(walletSize.WalletDB + walletSize.WalletDataDB + walletSize.Other))
+
+			Expect(size.Total).To(Equal(size.WalletsDB + size.Logs + size.Other + walletSize.Total))
+		})
+
+		It("counts bdb wallet databases", func() {
+			mw, cleanup := newTestMultiWalletWithDriver(DbDriverBdb)
+			defer cleanup()
+
+			wallet := newTestWallet(mw, "size")
+			size, err := mw.RootDirSizeRaw()
+			Expect(err).To(BeNil())
+
+			Expect(size.Wallets).To(HaveLen(1))
+			walletSize := size.Wallets[0]
+			info, err := os.Stat(filepath.Join(wallet.dataDir, walletDbName))
+			Expect(err).To(BeNil())
+			Expect(walletSize.WalletDB).To(Equal(info.Size()))
+			Expect(walletSize.WalletDBIndex).To(BeZero())
+			Expect(walletSize.WalletDBValueLog).To(BeZero())
+		})
+	})
+
+	Describe("SetDatabaseMaintenanceInterval", func() {
+		It("saves the interval and rejects negative intervals", func() {
+			mw, cleanup := newTestMultiWallet()
+			defer cleanup()
+
+			Expect(mw.DatabaseMaintenanceInterval()).To(BeEquivalentTo(defaultDatabaseMaintenanceInterval))
+			Expect(mw.SetDatabaseMaintenanceInterval(-1)).To(MatchError(ErrInvalid))
+
+			Expect(mw.SetDatabaseMaintenanceInterval(0)).To(Succeed())
+			Expect(mw.DatabaseMaintenanceInterval()).To(BeZero())
+			Expect(mw.cancelDbMaintenance).To(BeNil())
+
+			Expect(mw.SetDatabaseMaintenanceInterval(6)).To(Succeed())
+			Expect(mw.DatabaseMaintenanceInterval()).To(BeEquivalentTo(6))
+			Expect(mw.cancelDbMaintenance).NotTo(BeNil())
+
+			mw.stopDatabaseMaintenance()
+			Expect(mw.cancelDbMaintenance).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,605 @@
+package dcrlibwallet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"decred.org/dcrwallet/errors"
+	"decred.org/dcrwallet/wallet/walletdb"
+	"github.com/planetdecred/dcrlibwallet/badgerdb"
+)
+
+const (
+	DbDriverBdb    = "bdb"
+	DbDriverBadger = "badgerdb"
+
+	// Stages of DatabaseMigrationProgressReport.
+	DatabaseMigrationStageCopying   = "copying"
+	DatabaseMigrationStageVerifying = "verifying"
+
+	// migrationBatchSize and migrationBatchBytes are the number of keys
+	// and the size of the keys and values copied in each database
+	// transaction. badger limits the size of transactions to ~1.2MB in low
+	// memory mode, transactions that still grow too big are committed and
+	// the copy goes on in a new transaction.
+	migrationBatchSize  = 5000
+	migrationBatchBytes = 512 << 10
+
+	// databaseMigrationMarkerName is the name of the file written in the
+	// wallet directory while the migrated database replaces the wallet
+	// database, see recoverDatabaseMigration.
+	databaseMigrationMarkerName = "wallet.db.migration"
+)
+
+// walletDbTopLevelBuckets are the top level buckets created by dcrwallet. The
+// walletdb interfaces can't list the top level buckets of a database.
+var walletDbTopLevelBuckets = []string{
+	"meta",
+	"waddrmgr",
+	"wtxmgr",
+	"wstakemgr",
+	"agendaprefs",
+	"ticketsagendaprefs",
+	"treasurypolicy",
+	"tspendpolicy",
+	"vsp",
+}
+
+func (mw *MultiWallet) SetDatabaseMigrationProgressListener(databaseMigrationListener DatabaseMigrationProgressListener) {
+	mw.databaseMigrationListener = databaseMigrationListener
+}
+
+// MigrateWalletDatabase moves the wallet database of the wallet with the
+// provided ID to targetDriver, DbDriverBdb or DbDriverBadger, in the
+// background. The wallet is removed from sync and closed while every bucket
+// and key is copied to a new database, then the copy is verified and replaces
+// the wallet database. The replaced database is kept next to the new one as
+// wallet.db.<driver>.bak for rollback. A replacement interrupted by the app
+// being killed is completed or undone when the wallets are loaded again.
+// Progress is reported through the DatabaseMigrationProgressListener.
+func (mw *MultiWallet) MigrateWalletDatabase(walletID int, targetDriver string) error {
+	wallet := mw.WalletWithID(walletID)
+	if wallet == nil {
+		return newError(ErrNotExist)
+	}
+
+	if targetDriver != DbDriverBdb && targetDriver != DbDriverBadger {
+		return newError(ErrInvalid)
+	}
+	if targetDriver == wallet.dbDriver() || wallet.IsAccountMixerActive() || mw.IsRescanning() {
+		return newError(ErrInvalid)
+	}
+
+	wallet.dbMigrationMu.Lock()
+	if wallet.migratingDatabase {
+		wallet.dbMigrationMu.Unlock()
+		return newError(ErrInvalid)
+	}
+	wallet.migratingDatabase = true
+	wallet.dbMigrationMu.Unlock()
+
+	restartSync, err := mw.removeWalletFromSync(wallet)
+	if err != nil {
+		wallet.setMigratingDatabase(false)
+		return translateError(err)
+	}
+
+	go func() {
+		if mw.databaseMigrationListener != nil {
+			mw.databaseMigrationListener.OnDatabaseMigrationStarted(walletID)
+		}
+
+		err := mw.migrateWalletDatabase(wallet, targetDriver)
+		if err != nil {
+			log.Errorf("[%d] Error migrating wallet database to %s: %v", walletID, targetDriver, err)
+		} else {
+			log.Infof("[%d] Migrated wallet database to %s", walletID, targetDriver)
+		}
+
+		wallet.setMigratingDatabase(false)
+
+		if restartSync {
+			if len(mw.syncableWallets()) > 0 {
+				if syncErr := mw.Sync(); syncErr != nil {
+					log.Errorf("[%d] error restarting sync: %v", walletID, syncErr)
+				}
+			}
+		} else if syncErr := mw.addWalletToSync(wallet); syncErr != nil {
+			log.Errorf("[%d] error adding wallet to sync: %v", walletID, syncErr)
+		}
+
+		if mw.databaseMigrationListener != nil {
+			mw.databaseMigrationListener.OnDatabaseMigrationEnded(walletID, err)
+		}
+	}()
+
+	return nil
+}
+
+// IsMigratingDatabase returns true while the wallet database is migrated with
+// MigrateWalletDatabase.
+func (wallet *Wallet) IsMigratingDatabase() bool {
+	wallet.dbMigrationMu.Lock()
+	defer wallet.dbMigrationMu.Unlock()
+	return wallet.migratingDatabase
+}
+
+func (wallet *Wallet) setMigratingDatabase(migrating bool) {
+	wallet.dbMigrationMu.Lock()
+	wallet.migratingDatabase = migrating
+	wallet.dbMigrationMu.Unlock()
+}
+
+// dbDriver returns the driver of the wallet database. Wallets created before
+// the driver was saved use bdb.
+func (wallet *Wallet) dbDriver() string {
+	if wallet.DbDriver == "" {
+		return DbDriverBdb
+	}
+	return wallet.DbDriver
+}
+
+func (mw *MultiWallet) migrateWalletDatabase(wallet *Wallet, targetDriver string) error {
+	// the wallet database can't be opened twice, close it for the duration
+	// of the migration and open it again with the driver in use afterwards
+	wasOpened := wallet.WalletOpened()
+	if wasOpened {
+		err := wallet.loader.UnloadWallet()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err := wallet.openWallet()
+			if err != nil {
+				log.Errorf("[%d] Error opening wallet after database migration: %v", wallet.ID, err)
+			}
+		}()
+	}
+
+	dbPath := filepath.Join(wallet.dataDir, walletDbName)
+	migrationPath := dbPath + ".migrating"
+	sourceDriver := wallet.dbDriver()
+
+	err := os.RemoveAll(migrationPath)
+	if err != nil {
+		return err
+	}
+
+	err = mw.copyWalletDatabase(wallet.ID, sourceDriver, dbPath, targetDriver, migrationPath)
+	if err != nil {
+		os.RemoveAll(migrationPath)
+		return err
+	}
+
+	// keep the replaced database for rollback
+	rollbackPath := fmt.Sprintf("%s.%s.bak", dbPath, sourceDriver)
+	err = os.RemoveAll(rollbackPath)
+	if err != nil {
+		os.RemoveAll(migrationPath)
+		return err
+	}
+
+	// the database files and the saved driver can't be replaced atomically,
+	// mark the swap as in progress for recoverDatabaseMigration to complete
+	// or undo it if the app is killed before it is done
+	marker := &databaseMigrationMarker{SourceDriver: sourceDriver, TargetDriver: targetDriver}
+	err = marker.write(wallet.dataDir)
+	if err != nil {
+		os.RemoveAll(migrationPath)
+		return err
+	}
+
+	err = os.Rename(dbPath, rollbackPath)
+	if err == nil {
+		err = os.Rename(migrationPath, dbPath)
+	}
+	if err == nil {
+		wallet.DbDriver = targetDriver
+		err = translateError(mw.db.Save(wallet))
+		if err != nil {
+			wallet.DbDriver = sourceDriver
+		}
+	}
+	if err != nil {
+		if recoverErr := recoverDatabaseMigration(wallet); recoverErr != nil {
+			log.Errorf("[%d] Error restoring wallet database: %v", wallet.ID, recoverErr)
+		}
+		return err
+	}
+
+	err = removeDatabaseMigrationMarker(wallet.dataDir)
+	if err != nil {
+		log.Errorf("[%d] Error removing database migration marker: %v", wallet.ID, err)
+	}
+
+	wallet.loader = initWalletLoader(wallet.chainParams, wallet.dataDir, wallet.DbDriver)
+	return nil
+}
+
+// databaseMigrationMarker is saved as JSON in the wallet directory while a
+// migrated database replaces the wallet database.
+type databaseMigrationMarker struct {
+	SourceDriver string `json:"sourceDriver"`
+	TargetDriver string `json:"targetDriver"`
+}
+
+func (m *databaseMigrationMarker) write(walletDir string) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(filepath.Join(walletDir, databaseMigrationMarkerName))
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func removeDatabaseMigrationMarker(walletDir string) error {
+	err := os.Remove(filepath.Join(walletDir, databaseMigrationMarkerName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// recoverDatabaseMigration completes or undoes the replacement of the wallet
+// database by a migrated database that was interrupted, as recorded by the
+// marker written by migrateWalletDatabase. The migration is complete if the
+// target driver was saved, otherwise the replaced database is restored from
+// the rollback file and the wallet keeps using the source driver.
+func recoverDatabaseMigration(wallet *Wallet) error {
+	data, err := ioutil.ReadFile(filepath.Join(wallet.dataDir, databaseMigrationMarkerName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	marker := new(databaseMigrationMarker)
+	err = json.Unmarshal(data, marker)
+	if err != nil {
+		return err
+	}
+
+	dbPath := filepath.Join(wallet.dataDir, walletDbName)
+	migrationPath := dbPath + ".migrating"
+	rollbackPath := fmt.Sprintf("%s.%s.bak", dbPath, marker.SourceDriver)
+
+	if wallet.dbDriver() != marker.TargetDriver {
+		// the marker is written after removing older rollback files, the
+		// rollback file is the replaced database if it exists
+		if exists, _ := fileExists(rollbackPath); exists {
+			err = os.RemoveAll(dbPath)
+			if err == nil {
+				err = os.Rename(rollbackPath, dbPath)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		log.Infof("[%d] Restored the wallet database interrupted while migrating to %s", wallet.ID, marker.TargetDriver)
+	}
+
+	err = os.RemoveAll(migrationPath)
+	if err != nil {
+		return err
+	}
+	return removeDatabaseMigrationMarker(wallet.dataDir)
+}
+
+// copyWalletDatabase copies every bucket and key of the database at srcPath to
+// a new database at dstPath through the walletdb interfaces, then checks that
+// both databases hold the same buckets and keys.
+func (mw *MultiWallet) copyWalletDatabase(walletID int, srcDriver, srcPath, dstDriver, dstPath string) (err error) {
+	src, err := walletdb.Open(srcDriver, srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := walletdb.Create(dstDriver, dstPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := dst.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	srcTx, err := src.BeginReadTx()
+	if err != nil {
+		return err
+	}
+	defer srcTx.Rollback()
+
+	report := &DatabaseMigrationProgressReport{
+		WalletID:     walletID,
+		TargetDriver: dstDriver,
+		Stage:        DatabaseMigrationStageCopying,
+	}
+	for _, name := range walletDbTopLevelBuckets {
+		if bucket := srcTx.ReadBucket([]byte(name)); bucket != nil {
+			report.TotalKeys += countBucketKeys(bucket)
+		}
+	}
+
+	copier := &dbCopier{
+		db:         dst,
+		maxTxKeys:  migrationBatchSize,
+		maxTxBytes: migrationBatchBytes,
+		progress: func(copied int64) {
+			report.CopiedKeys = copied
+			mw.publishDatabaseMigrationProgress(report)
+		},
+	}
+	for _, name := range walletDbTopLevelBuckets {
+		bucket := srcTx.ReadBucket([]byte(name))
+		if bucket == nil {
+			continue
+		}
+
+		err = copier.copyTopLevelBucket([]byte(name), bucket)
+		if err != nil {
+			copier.rollback()
+			return err
+		}
+	}
+	err = copier.commit()
+	if err != nil {
+		return err
+	}
+
+	report.Stage = DatabaseMigrationStageVerifying
+	mw.publishDatabaseMigrationProgress(report)
+
+	dstTx, err := dst.BeginReadTx()
+	if err != nil {
+		return err
+	}
+	defer dstTx.Rollback()
+
+	for _, name := range walletDbTopLevelBuckets {
+		srcBucket := srcTx.ReadBucket([]byte(name))
+		dstBucket := dstTx.ReadBucket([]byte(name))
+		if srcBucket == nil && dstBucket == nil {
+			continue
+		}
+		if srcBucket == nil || dstBucket == nil {
+			return errors.E(errors.Invalid, fmt.Sprintf("bucket %s not copied", name))
+		}
+
+		err = verifyBucketCopy(srcBucket, dstBucket, func() {
+			report.VerifiedKeys++
+			if report.VerifiedKeys%migrationBatchSize == 0 {
+				mw.publishDatabaseMigrationProgress(report)
+			}
+		})
+		if err != nil {
+			return errors.E(errors.Invalid, fmt.Sprintf("bucket %s: %v", name, err))
+		}
+	}
+
+	mw.publishDatabaseMigrationProgress(report)
+	return nil
+}
+
+func (mw *MultiWallet) publishDatabaseMigrationProgress(report *DatabaseMigrationProgressReport) {
+	if report.TotalKeys > 0 {
+		// copying and verifying each count for half of the migration
+		report.Progress = int32((report.CopiedKeys + report.VerifiedKeys) * 100 / (2 * report.TotalKeys))
+	}
+
+	if mw.databaseMigrationListener != nil {
+		mw.databaseMigrationListener.OnDatabaseMigrationProgress(report)
+	}
+}
+
+// isNestedBucket returns true if the key returned by ForEach with value v is
+// the key of a nested bucket of bucket.
+func isNestedBucket(bucket walletdb.ReadBucket, k, v []byte) bool {
+	return v == nil && bucket.NestedReadBucket(k) != nil
+}
+
+// countBucketKeys returns the number of keys of bucket and its nested
+// buckets, including the keys of the nested buckets.
+func countBucketKeys(bucket walletdb.ReadBucket) int64 {
+	var count int64
+	bucket.ForEach(func(k, v []byte) error {
+		count++
+		if isNestedBucket(bucket, k, v) {
+			count += countBucketKeys(bucket.NestedReadBucket(k))
+		}
+		return nil
+	})
+	return count
+}
+
+// verifyBucketCopy checks that dst holds the same keys, values and nested
+// buckets as src, calling verified for each key.
+func verifyBucketCopy(src, dst walletdb.ReadBucket, verified func()) error {
+	var srcKeys int64
+	err := src.ForEach(func(k, v []byte) error {
+		srcKeys++
+		defer verified()
+
+		if isNestedBucket(src, k, v) {
+			nested := dst.NestedReadBucket(k)
+			if nested == nil {
+				return fmt.Errorf("nested bucket %x not copied", k)
+			}
+			return verifyBucketCopy(src.NestedReadBucket(k), nested, verified)
+		}
+
+		if !bytes.Equal(v, dst.Get(k)) {
+			return fmt.Errorf("value of key %x not copied", k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var dstKeys int64
+	err = dst.ForEach(func(_, _ []byte) error {
+		dstKeys++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if dstKeys != srcKeys {
+		return fmt.Errorf("%d keys copied, expected %d", dstKeys, srcKeys)
+	}
+	return nil
+}
+
+// dbCopier writes the copied keys to a database in transactions of up to
+// maxTxKeys keys and maxTxBytes bytes of keys and values.
+type dbCopier struct {
+	db         walletdb.DB
+	tx         walletdb.ReadWriteTx
+	txKeys     int
+	txBytes    int
+	maxTxKeys  int
+	maxTxBytes int
+	copied     int64
+	progress   func(copied int64)
+}
+
+func (c *dbCopier) copyTopLevelBucket(key []byte, src walletdb.ReadBucket) error {
+	err := c.write(func(tx walletdb.ReadWriteTx) error {
+		_, err := tx.CreateTopLevelBucket(key)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.copyBucket([][]byte{key}, src)
+}
+
+// copyBucket copies the keys and nested buckets of src to the bucket at path,
+// which is made of the keys of the top level bucket and of the nested
+// buckets.
+func (c *dbCopier) copyBucket(path [][]byte, src walletdb.ReadBucket) error {
+	var prefixSize int
+	for _, key := range path {
+		prefixSize += len(key)
+	}
+
+	return src.ForEach(func(k, v []byte) error {
+		// the transaction may be committed after any key, the destination
+		// bucket is read from the transaction in use for each key
+		if isNestedBucket(src, k, v) {
+			err := c.write(func(tx walletdb.ReadWriteTx) error {
+				_, err := c.bucket(tx, path).CreateBucket(k)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if err = c.keyCopied(prefixSize + len(k)); err != nil {
+				return err
+			}
+
+			nestedPath := append(path[:len(path):len(path)], k)
+			return c.copyBucket(nestedPath, src.NestedReadBucket(k))
+		}
+
+		err := c.write(func(tx walletdb.ReadWriteTx) error {
+			return c.bucket(tx, path).Put(k, v)
+		})
+		if err != nil {
+			return err
+		}
+		return c.keyCopied(prefixSize + len(k) + len(v))
+	})
+}
+
+// write calls fn with the transaction in use. If fn fails because the
+// transaction is too big for badger, the keys written so far are committed
+// and fn is called again with a new transaction.
+func (c *dbCopier) write(fn func(tx walletdb.ReadWriteTx) error) error {
+	err := c.beginTx()
+	if err != nil {
+		return err
+	}
+
+	err = fn(c.tx)
+	if !badgerdb.IsTxnTooBig(err) || c.txKeys == 0 {
+		return err
+	}
+
+	err = c.commit()
+	if err == nil {
+		err = c.beginTx()
+	}
+	if err != nil {
+		return err
+	}
+	return fn(c.tx)
+}
+
+func (c *dbCopier) bucket(tx walletdb.ReadWriteTx, path [][]byte) walletdb.ReadWriteBucket {
+	bucket := tx.ReadWriteBucket(path[0])
+	for _, key := range path[1:] {
+		bucket = bucket.NestedReadWriteBucket(key)
+	}
+	return bucket
+}
+
+func (c *dbCopier) keyCopied(size int) error {
+	c.copied++
+	c.txKeys++
+	c.txBytes += size
+	if c.txKeys < c.maxTxKeys && c.txBytes < c.maxTxBytes {
+		return nil
+	}
+	return c.commit()
+}
+
+func (c *dbCopier) beginTx() (err error) {
+	if c.tx == nil {
+		c.tx, err = c.db.BeginReadWriteTx()
+	}
+	return err
+}
+
+func (c *dbCopier) commit() error {
+	if c.tx == nil {
+		return nil
+	}
+
+	err := c.tx.Commit()
+	c.tx = nil
+	c.txKeys = 0
+	c.txBytes = 0
+	if c.progress != nil {
+		c.progress(c.copied)
+	}
+	return err
+}
+
+func (c *dbCopier) rollback() {
+	if c.tx != nil {
+		c.tx.Rollback()
+		c.tx = nil
+	}
+}
@@ -0,0 +1,260 @@
+package dcrlibwallet
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"decred.org/dcrwallet/wallet/walletdb"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/planetdecred/dcrlibwallet/badgerdb"
+)
+
+type databaseMigrationTestListener struct {
+	reports chan DatabaseMigrationProgressReport
+	ended   chan error
+}
+
+func newDatabaseMigrationTestListener() *databaseMigrationTestListener {
+	return &databaseMigrationTestListener{
+		reports: make(chan DatabaseMigrationProgressReport, 1000),
+		ended:   make(chan error, 1),
+	}
+}
+
+func (l *databaseMigrationTestListener) OnDatabaseMigrationStarted(walletID int) {}
+
+func (l *databaseMigrationTestListener) OnDatabaseMigrationProgress(report *DatabaseMigrationProgressReport) {
+	select {
+	case l.reports <- *report:
+	default:
+	}
+}
+
+func (l *databaseMigrationTestListener) OnDatabaseMigrationEnded(walletID int, err error) {
+	l.ended <- err
+}
+
+// createTestWalletDB creates a database with the driver at dbPath holding
+// a meta bucket of small keys and a nested bucket.
+func createTestWalletDB(driver, dbPath string, keys int) walletdb.DB {
+	db, err := walletdb.Create(driver, dbPath)
+	ExpectWithOffset(1, err).To(BeNil())
+
+	err = walletdb.Update(context.Background(), db, func(tx walletdb.ReadWriteTx) error {
+		meta, err := tx.CreateTopLevelBucket([]byte("meta"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < keys; i++ {
+			var k [8]byte
+			binary.BigEndian.PutUint64(k[:], uint64(i))
+			if err = meta.Put(k[:], []byte(fmt.Sprintf("value %08d", i))); err != nil {
+				return err
+			}
+		}
+
+		nested, err := meta.CreateBucket([]byte("nested"))
+		if err != nil {
+			return err
+		}
+		return nested.Put([]byte("key"), []byte("value"))
+	})
+	ExpectWithOffset(1, err).To(BeNil())
+	return db
+}
+
+var _ = Describe("MigrateWalletDatabase", func() {
+	It("migrates a wallet database from bdb to badgerdb and back", func() {
+		mw, cleanup := newTestMultiWalletWithDriver(DbDriverBdb)
+		defer cleanup()
+
+		wallet := newTestWallet(mw, "migration")
+		_, err := wallet.NextAddress(0)
+		Expect(err).To(BeNil())
+		address, err := wallet.CurrentAddress(0)
+		Expect(err).To(BeNil())
+		xpub, err := wallet.internal.AccountXpub(context.Background(), 0)
+		Expect(err).To(BeNil())
+
+		listener := newDatabaseMigrationTestListener()
+		mw.SetDatabaseMigrationProgressListener(listener)
+
+		dbPath := filepath.Join(wallet.dataDir, walletDbName)
+		for _, migration := range []struct{ source, target string }{
+			{DbDriverBdb, DbDriverBadger},
+			{DbDriverBadger, DbDriverBdb},
+		} {
+			By("Migrating from " + migration.source + " to " + migration.target)
+			Expect(mw.MigrateWalletDatabase(wallet.ID, migration.target)).To(Succeed())
+			Eventually(listener.ended, time.Minute).Should(Receive(BeNil()))
+
+			var last DatabaseMigrationProgressReport
+			for len(listener.reports) > 0 {
+				last = <-listener.reports
+			}
+			Expect(last.Stage).To(Equal(DatabaseMigrationStageVerifying))
+			Expect(last.Progress).To(BeEquivalentTo(100))
+
+			Expect(wallet.DbDriver).To(Equal(migration.target))
+			var saved Wallet
+			Expect(mw.db.One("ID", wallet.ID, &saved)).To(Succeed())
+			Expect(saved.DbDriver).To(Equal(migration.target))
+
+			Expect(fileExists(fmt.Sprintf("%s.%s.bak", dbPath, migration.source))).To(BeTrue())
+			Expect(fileExists(dbPath + ".migrating")).To(BeFalse())
+			Expect(fileExists(filepath.Join(wallet.dataDir, databaseMigrationMarkerName))).To(BeFalse())
+
+			Expect(wallet.WalletOpened()).To(BeTrue())
+			migratedXpub, err := wallet.internal.AccountXpub(context.Background(), 0)
+			Expect(err).To(BeNil())
+			Expect(migratedXpub.String()).To(Equal(xpub.String()))
+			migratedAddress, err := wallet.CurrentAddress(0)
+			Expect(err).To(BeNil())
+			Expect(migratedAddress).To(Equal(address))
+		}
+
+		Expect(mw.MigrateWalletDatabase(wallet.ID, DbDriverBdb)).To(MatchError(ErrInvalid))
+		Expect(mw.MigrateWalletDatabase(wallet.ID, "sqlite")).To(MatchError(ErrInvalid))
+		Expect(mw.MigrateWalletDatabase(wallet.ID+1, DbDriverBadger)).To(MatchError(ErrNotExist))
+	})
+
+	Describe("recoverDatabaseMigration", func() {
+		var (
+			mw      *MultiWallet
+			cleanup func()
+			wallet  *Wallet
+			dbPath  string
+			xpub    string
+		)
+
+		BeforeEach(func() {
+			mw, cleanup = newTestMultiWalletWithDriver(DbDriverBdb)
+			wallet = newTestWallet(mw, "recovery")
+			extendedKey, err := wallet.internal.AccountXpub(context.Background(), 0)
+			Expect(err).To(BeNil())
+			xpub = extendedKey.String()
+
+			// copy the database as the migration does before swapping
+			Expect(wallet.loader.UnloadWallet()).To(Succeed())
+			dbPath = filepath.Join(wallet.dataDir, walletDbName)
+			Expect(mw.copyWalletDatabase(wallet.ID, DbDriverBdb, dbPath, DbDriverBadger, dbPath+".migrating")).To(Succeed())
+			marker := &databaseMigrationMarker{SourceDriver: DbDriverBdb, TargetDriver: DbDriverBadger}
+			Expect(marker.write(wallet.dataDir)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			cleanup()
+		})
+
+		expectRecovered := func(driver string) {
+			Expect(recoverDatabaseMigration(wallet)).To(Succeed())
+			Expect(fileExists(dbPath + ".migrating")).To(BeFalse())
+			Expect(fileExists(filepath.Join(wallet.dataDir, databaseMigrationMarkerName))).To(BeFalse())
+
+			wallet.loader = initWalletLoader(wallet.chainParams, wallet.dataDir, driver)
+			Expect(wallet.openWallet()).To(Succeed())
+			recoveredXpub, err := wallet.internal.AccountXpub(context.Background(), 0)
+			Expect(err).To(BeNil())
+			Expect(recoveredXpub.String()).To(Equal(xpub))
+		}
+
+		It("keeps the source database if it was not replaced", func() {
+			expectRecovered(DbDriverBdb)
+		})
+
+		It("restores the source database if the migrated database was not moved in place", func() {
+			Expect(os.Rename(dbPath, dbPath+".bdb.bak")).To(Succeed())
+			expectRecovered(DbDriverBdb)
+			Expect(fileExists(dbPath + ".bdb.bak")).To(BeFalse())
+		})
+
+		It("restores the source database if the driver was not saved", func() {
+			Expect(os.Rename(dbPath, dbPath+".bdb.bak")).To(Succeed())
+			Expect(os.Rename(dbPath+".migrating", dbPath)).To(Succeed())
+			expectRecovered(DbDriverBdb)
+			Expect(fileExists(dbPath + ".bdb.bak")).To(BeFalse())
+		})
+
+		It("keeps the migrated database if the driver was saved", func() {
+			Expect(os.Rename(dbPath, dbPath+".bdb.bak")).To(Succeed())
+			Expect(os.Rename(dbPath+".migrating", dbPath)).To(Succeed())
+			wallet.DbDriver = DbDriverBadger
+			Expect(mw.db.Save(wallet)).To(Succeed())
+			expectRecovered(DbDriverBadger)
+			Expect(fileExists(dbPath + ".bdb.bak")).To(BeTrue())
+		})
+	})
+
+	Describe("dbCopier", func() {
+		var (
+			dir string
+			src walletdb.DB
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "migration")
+			Expect(err).To(BeNil())
+		})
+
+		AfterEach(func() {
+			src.Close()
+			badgerdb.SetLowMemoryMode(false)
+			os.RemoveAll(dir)
+		})
+
+		copyDB := func(maxTxKeys, maxTxBytes int) (commits int) {
+			dstDir, err := ioutil.TempDir(dir, "dst")
+			Expect(err).To(BeNil())
+			dst, err := walletdb.Create(DbDriverBadger, filepath.Join(dstDir, walletDbName))
+			Expect(err).To(BeNil())
+			defer dst.Close()
+
+			copier := &dbCopier{
+				db:         dst,
+				maxTxKeys:  maxTxKeys,
+				maxTxBytes: maxTxBytes,
+				progress:   func(int64) { commits++ },
+			}
+			err = walletdb.View(context.Background(), src, func(srcTx walletdb.ReadTx) error {
+				err := copier.copyTopLevelBucket([]byte("meta"), srcTx.ReadBucket([]byte("meta")))
+				if err != nil {
+					copier.rollback()
+					return err
+				}
+				if err = copier.commit(); err != nil {
+					return err
+				}
+
+				return walletdb.View(context.Background(), dst, func(dstTx walletdb.ReadTx) error {
+					return verifyBucketCopy(srcTx.ReadBucket([]byte("meta")), dstTx.ReadBucket([]byte("meta")), func() {})
+				})
+			})
+			Expect(err).To(BeNil())
+			return commits
+		}
+
+		It("commits the copied keys in batches of up to maxTxBytes", func() {
+			src = createTestWalletDB(DbDriverBdb, filepath.Join(dir, "src.db"), 1000)
+
+			// each key is 4 bytes of prefix, 8 bytes of key and 14 bytes
+			// of value
+			Expect(copyDB(math.MaxInt32, 2600)).To(Equal(11))
+			Expect(copyDB(100, math.MaxInt32)).To(Equal(11))
+		})
+
+		It("commits and retries the writes that are too big for a badger transaction", func() {
+			badgerdb.SetLowMemoryMode(true)
+			src = createTestWalletDB(DbDriverBdb, filepath.Join(dir, "src.db"), 100000)
+
+			Expect(copyDB(math.MaxInt32, math.MaxInt32)).To(BeNumerically(">", 1))
+		})
+	})
+})
@@ -1,6 +1,9 @@
 package dcrlibwallet
 
 import (
+	"context"
+	stderrors "errors"
+
 	"decred.org/dcrwallet/errors"
 	"github.com/asdine/storm"
 )
@@ -40,21 +43,148 @@ const (
 	ErrSavingWallet                 = "err_saving_wallet"
 	ErrIndexOutOfRange              = "err_index_out_of_range"
 	ErrNoMixableOutput              = "err_no_mixable_output"
+	ErrInvalidCertificate           = "invalid_certificate"
+	ErrRPCNotConfigured             = "rpc_not_configured"
+	ErrNoEligibleTickets            = "no_eligible_tickets"
+	ErrVoteNotStarted               = "vote_not_started"
+	ErrCertificatePinMismatch       = "certificate_pin_mismatch"
+	ErrInvalidBackup                = "invalid_backup"
+	ErrExpired                      = "expired"
+	ErrInternal                     = "internal_error"
+	ErrPermission                   = "permission_denied"
+	ErrIO                           = "io_error"
+	ErrEncoding                     = "invalid_encoding"
+	ErrCrypto                       = "crypto_error"
+	ErrInvalidSeed                  = "invalid_seed"
+	ErrScriptFailure                = "script_failure"
+	ErrPolicy                       = "policy_violation"
+	ErrConsensus                    = "consensus_violation"
+	ErrDoubleSpend                  = "double_spend"
+	ErrProtocol                     = "protocol_violation"
+	ErrInactiveDeployment           = "inactive_deployment"
 )
 
-// todo, should update this method to translate more error kinds.
+// errorCodesByKind maps the dcrwallet error kinds to error codes. Errors of
+// the Other kind are unclassified and keep their message.
+var errorCodesByKind = map[errors.Kind]string{
+	errors.Bug:                 ErrInternal,
+	errors.Invalid:             ErrInvalid,
+	errors.Permission:          ErrPermission,
+	errors.IO:                  ErrIO,
+	errors.Exist:               ErrExist,
+	errors.NotExist:            ErrNotExist,
+	errors.Encoding:            ErrEncoding,
+	errors.Crypto:              ErrCrypto,
+	errors.Locked:              ErrWalletLocked,
+	errors.Passphrase:          ErrInvalidPassphrase,
+	errors.Seed:                ErrInvalidSeed,
+	errors.WatchingOnly:        ErrWalletIsWatchOnly,
+	errors.InsufficientBalance: ErrInsufficientBalance,
+	errors.ScriptFailure:       ErrScriptFailure,
+	errors.Policy:              ErrPolicy,
+	errors.Consensus:           ErrConsensus,
+	errors.DoubleSpend:         ErrDoubleSpend,
+	errors.Protocol:            ErrProtocol,
+	errors.NoPeers:             ErrNoPeers,
+	errors.Deployment:          ErrInactiveDeployment,
+}
+
+// Error is returned by the library for failures with an error code. The
+// error string is the code so that mobile bindings, which only see error
+// strings, can keep comparing them with the codes.
+//
+// Errors with the same code match with errors.Is, e.g.
+// errors.Is(err, &Error{Code: ErrNotExist}), and so does the cause, e.g.
+// errors.Is(err, errors.NotExist) for dcrwallet errors. WalletID and Op are
+// set when known.
+type Error struct {
+	Code     string
+	WalletID int
+	Op       string
+	Err      error
+}
+
+func newError(code string) error {
+	return &Error{Code: code}
+}
+
+func (e *Error) Error() string {
+	return e.Code
+}
+
+// Unwrap returns the cause of the error, if any.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is returns true if target is an *Error with the same code.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// ErrorCode returns the code of the *Error in the chain of err, or an empty
+// string if there is none.
+func ErrorCode(err error) string {
+	var e *Error
+	if stderrors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
+
+// IsErrorCode returns true if err has the code, see ErrorCode.
+func IsErrorCode(err error, code string) bool {
+	return err != nil && ErrorCode(err) == code
+}
+
+// walletError translates err and records the wallet and the operation in
+// which it occurred.
+func walletError(walletID int, op string, err error) error {
+	err = translateError(err)
+
+	var e *Error
+	if !stderrors.As(err, &e) {
+		return err
+	}
+
+	withWallet := *e
+	withWallet.WalletID = walletID
+	if withWallet.Op == "" {
+		withWallet.Op = op
+	}
+	return &withWallet
+}
+
+// translateError returns an *Error with the code of err if err is a dcrwallet
+// error of a known kind, a storm error or a context error. Other errors are
+// returned as is.
 func translateError(err error) error {
-	if err, ok := err.(*errors.Error); ok {
-		switch err.Kind {
-		case errors.InsufficientBalance:
-			return errors.New(ErrInsufficientBalance)
-		case errors.NotExist, storm.ErrNotFound:
-			return errors.New(ErrNotExist)
-		case errors.Passphrase:
-			return errors.New(ErrInvalidPassphrase)
-		case errors.NoPeers:
-			return errors.New(ErrNoPeers)
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+	if stderrors.As(err, &e) {
+		return err
+	}
+
+	switch err {
+	case storm.ErrNotFound:
+		return &Error{Code: ErrNotExist, Err: err}
+	case storm.ErrAlreadyExists:
+		return &Error{Code: ErrExist, Err: err}
+	case context.Canceled:
+		return &Error{Code: ErrContextCanceled, Err: err}
+	}
+
+	if walletErr, ok := err.(*errors.Error); ok {
+		code, ok := errorCodesByKind[walletErr.Kind]
+		if !ok {
+			return err
 		}
+		return &Error{Code: code, Op: string(walletErr.Op), Err: err}
 	}
+
 	return err
 }
@@ -0,0 +1,266 @@
+package dcrlibwallet
+
+import (
+	"context"
+	stderrors "errors"
+
+	"decred.org/dcrwallet/errors"
+	"github.com/asdine/storm"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Errors", func() {
+	Describe("translateError", func() {
+		It("maps every classified dcrwallet error kind to a code", func() {
+			for kind := errors.Bug; kind <= errors.Deployment; kind++ {
+				code, ok := errorCodesByKind[kind]
+				Expect(ok).To(BeTrue(), "no code for kind %v", kind)
+
+				cause := errors.E(errors.Op("wallet.Op"), kind, "failure")
+				err := translateError(cause)
+				Expect(err.Error()).To(Equal(code))
+				Expect(ErrorCode(err)).To(Equal(code))
+				Expect(stderrors.Is(err, cause)).To(BeTrue())
+
+				var e *Error
+				Expect(stderrors.As(err, &e)).To(BeTrue())
+				Expect(e.Op).To(Equal("wallet.Op"))
+			}
+		})
+
+		It("keeps the existing codes of dcrwallet error kinds", func() {
+			Expect(translateError(errors.E(errors.Locked)).Error()).To(Equal(ErrWalletLocked))
+			Expect(translateError(errors.E(errors.Passphrase)).Error()).To(Equal(ErrInvalidPassphrase))
+			Expect(translateError(errors.E(errors.NotExist)).Error()).To(Equal(ErrNotExist))
+			Expect(translateError(errors.E(errors.InsufficientBalance)).Error()).To(Equal(ErrInsufficientBalance))
+		})
+
+		It("maps storm and context errors", func() {
+			Expect(ErrorCode(translateError(storm.ErrNotFound))).To(Equal(ErrNotExist))
+			Expect(ErrorCode(translateError(storm.ErrAlreadyExists))).To(Equal(ErrExist))
+			Expect(ErrorCode(translateError(context.Canceled))).To(Equal(ErrContextCanceled))
+		})
+
+		It("returns unclassified errors as is", func() {
+			Expect(translateError(nil)).To(BeNil())
+
+			other := errors.E("unclassified")
+			Expect(translateError(other)).To(Equal(other))
+			Expect(ErrorCode(other)).To(BeEmpty())
+
+			plain := stderrors.New("plain")
+			Expect(translateError(plain)).To(Equal(plain))
+
+			coded := newError(ErrInvalid)
+			Expect(translateError(coded)).To(Equal(coded))
+		})
+	})
+
+	Describe("Error", func() {
+		It("matches errors with the same code", func() {
+			err := newError(ErrNotExist)
+			Expect(stderrors.Is(err, &Error{Code: ErrNotExist})).To(BeTrue())
+			Expect(stderrors.Is(err, &Error{Code: ErrExist})).To(BeFalse())
+			Expect(IsErrorCode(err, ErrNotExist)).To(BeTrue())
+			Expect(IsErrorCode(nil, ErrNotExist)).To(BeFalse())
+		})
+
+		It("records the wallet and operation", func() {
+			err := walletError(3, "UnlockWallet", errors.E(errors.Passphrase))
+
+			var e *Error
+			Expect(stderrors.As(err, &e)).To(BeTrue())
+			Expect(e.Code).To(Equal(ErrInvalidPassphrase))
+			Expect(e.WalletID).To(Equal(3))
+			Expect(e.Op).To(Equal("UnlockWallet"))
+			Expect(stderrors.Is(err, errors.Passphrase)).To(BeTrue())
+
+			By("Keeping the dcrwallet operation of the cause")
+			err = walletError(3, "UnlockWallet", errors.E(errors.Op("wallet.Unlock"), errors.Passphrase))
+			Expect(stderrors.As(err, &e)).To(BeTrue())
+			Expect(e.Op).To(Equal("wallet.Unlock"))
+
+			By("Not modifying shared errors")
+			shared := newError(ErrInvalid)
+			walletError(1, "Op", shared)
+			Expect(shared.(*Error).WalletID).To(BeZero())
+		})
+	})
+
+	Describe("Public APIs", func() {
+		var mw *MultiWallet
+		var cleanup func()
+
+		BeforeEach(func() {
+			mw, cleanup = newTestMultiWallet()
+		})
+
+		AfterEach(func() {
+			cleanup()
+		})
+
+		It("return errors with codes", func() {
+			expectCode := func(err error, code string) {
+				ExpectWithOffset(1, err).ToNot(BeNil())
+				ExpectWithOffset(1, err.Error()).To(Equal(code))
+				ExpectWithOffset(1, IsErrorCode(err, code)).To(BeTrue())
+			}
+
+			wallet := newTestWallet(mw, "errors")
+			var err error
+
+			By("Using missing wallets")
+			expectCode(mw.UnlockWallet(wallet.ID+1, []byte("passphrase")), ErrNotExist)
+			_, err = mw.CreateInvoice(wallet.ID+1, 0, 1, "", "", 0, 0)
+			expectCode(err, ErrNotExist)
+			expectCode(mw.MigrateWalletDatabase(wallet.ID+1, DbDriverBadger), ErrNotExist)
+
+			By("Using a wrong passphrase")
+			err = mw.UnlockWallet(wallet.ID, []byte("wrong"))
+			expectCode(err, ErrInvalidPassphrase)
+			var e *Error
+			Expect(stderrors.As(err, &e)).To(BeTrue())
+			Expect(e.WalletID).To(Equal(wallet.ID))
+			Expect(stderrors.Is(err, errors.Passphrase)).To(BeTrue())
+
+			err = mw.ChangePrivatePassphraseForWallet(wallet.ID, []byte("wrong"), []byte("new"), PassphraseTypePass)
+			expectCode(err, ErrInvalidPassphrase)
+			expectCode(mw.VerifyStartupPassphrase([]byte("wrong")), ErrInvalidPassphrase)
+
+			By("Passing invalid arguments")
+			expectCode(mw.ChangePrivatePassphraseForWallet(wallet.ID, nil, nil, -1), ErrInvalid)
+			expectCode(mw.RenameWallet(wallet.ID, "wallet-1"), ErrReservedWalletName)
+			expectCode(mw.RenameWallet(wallet.ID, "errors"), ErrExist)
+			expectCode(mw.MigrateWalletDatabase(wallet.ID, "unknown"), ErrInvalid)
+			expectCode(mw.SetExchangeRateSource("unknown", ""), ErrInvalid)
+			expectCode(mw.SetExchangeRateSource(ExchangeRateSourceCustom, "https://rates"), ErrInvalid)
+			_, err = mw.CreateInvoice(wallet.ID, 0, 0, "", "", 0, 0)
+			expectCode(err, ErrInvalid)
+			_, err = wallet.CostBasisReportRaw("USD", "average")
+			expectCode(err, ErrInvalid)
+			_, err = wallet.RunDatabaseGC()
+			expectCode(err, ErrInvalid)
+
+			By("Parsing invalid payment URIs")
+			_, err = mw.ParsePaymentURIRaw("decred:notanaddress")
+			expectCode(err, ErrInvalidAddress)
+			address, err := wallet.CurrentAddress(0)
+			Expect(err).To(BeNil())
+			_, err = mw.ParsePaymentURIRaw("bitcoin:" + address)
+			expectCode(err, ErrInvalid)
+			_, err = mw.ParsePaymentURIRaw("decred:" + address + "?req-unknown=1")
+			expectCode(err, ErrInvalid)
+			_, err = mw.BuildPaymentURI("notanaddress", 1, "", "", 0)
+			expectCode(err, ErrInvalidAddress)
+
+			By("Using missing items")
+			_, err = wallet.GetAccount(100)
+			expectCode(err, ErrNotExist)
+			_, err = mw.GetInvoiceRaw(1)
+			expectCode(err, ErrNotExist)
+			expectCode(mw.DeleteInvoice(1), ErrNotExist)
+
+			mw.UseExchangeRateSource(NewLocalExchangeRateSource())
+			_, err = mw.ExchangeRateRaw("USD")
+			expectCode(err, ErrNotExist)
+
+			By("Adding listeners twice")
+			listener := &errorsTestRateListener{}
+			Expect(mw.AddExchangeRateListener(listener, "errors")).To(BeNil())
+			expectCode(mw.AddExchangeRateListener(listener, "errors"), ErrListenerAlreadyExist)
+		})
+
+		It("record the wallet and operation of per-wallet errors", func() {
+			wallet := newTestWallet(mw, "errors")
+
+			expectWalletCode := func(err error, walletID int, code, op string) {
+				ExpectWithOffset(1, err).ToNot(BeNil())
+				ExpectWithOffset(1, err.Error()).To(Equal(code))
+
+				var e *Error
+				ExpectWithOffset(1, stderrors.As(err, &e)).To(BeTrue())
+				ExpectWithOffset(1, e.WalletID).To(Equal(walletID))
+				ExpectWithOffset(1, e.Op).NotTo(BeEmpty())
+				if op != "" {
+					ExpectWithOffset(1, e.Op).To(Equal(op))
+				}
+			}
+
+			var err error
+			missingAccount := int32(100)
+
+			By("Using accounts")
+			_, err = wallet.GetAccount(missingAccount)
+			expectWalletCode(err, wallet.ID, ErrNotExist, "GetAccount")
+			_, err = wallet.AccountNumber("missing")
+			expectWalletCode(err, wallet.ID, ErrNotExist, "")
+			_, err = wallet.AccountName(missingAccount)
+			expectWalletCode(err, wallet.ID, ErrNotExist, "")
+			expectWalletCode(wallet.RenameAccount(missingAccount, "renamed"), wallet.ID, ErrNotExist, "")
+			_, err = wallet.NextAccount("locked")
+			expectWalletCode(err, wallet.ID, ErrWalletLocked, "NextAccount")
+			_, err = wallet.CreateNewAccount("new", []byte("wrong"))
+			expectWalletCode(err, wallet.ID, ErrInvalidPassphrase, "")
+
+			By("Using addresses")
+			_, err = wallet.AccountOfAddress("notanaddress")
+			expectWalletCode(err, wallet.ID, ErrInvalidAddress, "AccountOfAddress")
+			_, err = wallet.AddressInfo("notanaddress")
+			expectWalletCode(err, wallet.ID, ErrInvalidAddress, "AddressInfo")
+			_, err = wallet.AddressPubKey("notanaddress")
+			expectWalletCode(err, wallet.ID, ErrInvalidAddress, "AddressPubKey")
+			_, err = wallet.NextAddress(missingAccount)
+			expectWalletCode(err, wallet.ID, ErrNotExist, "")
+			address, err := wallet.CurrentAddress(0)
+			Expect(err).To(BeNil())
+
+			By("Authoring transactions")
+			_, err = mw.NewUnsignedTx(wallet.ID+1, 0)
+			expectWalletCode(err, wallet.ID+1, ErrWalletNotFound, "NewUnsignedTx")
+			_, err = mw.NewUnsignedTx(wallet.ID, missingAccount)
+			expectWalletCode(err, wallet.ID, ErrNotExist, "")
+
+			txAuthor, err := mw.NewUnsignedTx(wallet.ID, 0)
+			Expect(err).To(BeNil())
+			expectWalletCode(txAuthor.AddSendDestination("notanaddress", 1, false), wallet.ID, ErrInvalidAddress, "AddSendDestination")
+			expectWalletCode(txAuthor.AddSendDestination(address, 0, false), wallet.ID, ErrInvalid, "AddSendDestination")
+			expectWalletCode(txAuthor.UpdateSendDestination(5, address, 1, false), wallet.ID, ErrIndexOutOfRange, "UpdateSendDestination")
+			expectWalletCode(txAuthor.UseInputs([]string{"hash:index"}), wallet.ID, ErrInvalid, "UseInputs")
+			expectWalletCode(txAuthor.UseInputs([]string{"notahash:0"}), wallet.ID, ErrInvalid, "UseInputs")
+			expectWalletCode(txAuthor.UseInputs([]string{chainhashZero + ":0"}), wallet.ID, ErrNotExist, "UseInputs")
+
+			Expect(txAuthor.AddSendDestination(address, 1e8, false)).To(Succeed())
+			_, err = txAuthor.EstimateFeeAndSize()
+			expectWalletCode(err, wallet.ID, ErrInsufficientBalance, "")
+			_, err = txAuthor.Broadcast([]byte("passphrase"))
+			expectWalletCode(err, wallet.ID, ErrNoPeers, "")
+
+			By("Syncing")
+			expectWalletCode(mw.PauseWalletSync(wallet.ID+1), wallet.ID+1, ErrNotExist, "PauseWalletSync")
+			expectWalletCode(mw.ResumeWalletSync(wallet.ID+1), wallet.ID+1, ErrNotExist, "ResumeWalletSync")
+
+			By("Mixing")
+			expectWalletCode(wallet.CreateMixerAccounts("default", "unmixed", "passphrase"), wallet.ID, ErrExist, "CreateMixerAccounts")
+			expectWalletCode(wallet.CreateMixerAccounts("mixed", "unmixed", "wrong"), wallet.ID, ErrInvalidPassphrase, "")
+			expectWalletCode(wallet.SetAccountMixerConfig(0, 0, "passphrase"), wallet.ID, ErrInvalid, "SetAccountMixerConfig")
+			expectWalletCode(wallet.SetAccountMixerConfig(0, missingAccount, "passphrase"), wallet.ID, ErrNotExist, "SetAccountMixerConfig")
+			_, err = mw.ReadyToMix(wallet.ID + 1)
+			expectWalletCode(err, wallet.ID+1, ErrNotExist, "ReadyToMix")
+			expectWalletCode(mw.StartAccountMixer(wallet.ID, "passphrase"), wallet.ID, ErrNotConnected, "StartAccountMixer")
+			expectWalletCode(mw.StopAccountMixer(wallet.ID), wallet.ID, ErrInvalid, "StopAccountMixer")
+			expectWalletCode(mw.ResumeAccountMixer(wallet.ID, "passphrase"), wallet.ID, ErrInvalid, "ResumeAccountMixer")
+
+			By("Voting")
+			expectWalletCode(mw.Politeia.CastVotes(wallet.ID+1, "token", "yes", "passphrase"), wallet.ID+1, ErrNotExist, "CastVotes")
+			expectWalletCode(mw.Politeia.CastVotes(wallet.ID, "token", "yes", "passphrase"), wallet.ID, ErrNotExist, "CastVotes")
+		})
+	})
+})
+
+type errorsTestRateListener struct{}
+
+func (*errorsTestRateListener) OnExchangeRateUpdated(*ExchangeRate) {}
+
+// chainhashZero is the string of the zero hash, which no wallet output has.
+const chainhashZero = "0000000000000000000000000000000000000000000000000000000000000000"
@@ -0,0 +1,273 @@
+package dcrlibwallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ExchangeRateSourceBinance = "binance"
+	ExchangeRateSourceCustom  = "custom"
+	ExchangeRateSourceLocal   = "local"
+
+	// DefaultExchangeRateSource is used until another source is set.
+	DefaultExchangeRateSource = ExchangeRateSourceBinance
+
+	binanceAPIURL     = "https://api.binance.com/api/v3"
+	binanceTickerPath = "/ticker/price?symbol=DCR%s"
+	binanceKlinesPath = "/klines?symbol=DCR%s&interval=1h&startTime=%d&limit=1"
+
+	// customRateURLCurrency and customRateURLTimestamp are replaced in the
+	// URL of custom sources by the requested currency and unix timestamp.
+	customRateURLCurrency  = "{currency}"
+	customRateURLTimestamp = "{timestamp}"
+
+	exchangeRateRequestTimeout = 30 * time.Second
+)
+
+// ExchangeRateSource provides the price of 1 DCR in fiat currencies. Apps may
+// implement their own source and use it with UseExchangeRateSource.
+type ExchangeRateSource interface {
+	Name() string
+
+	// FetchRate returns the current rate of the currency.
+	FetchRate(currency string) (*ExchangeRate, error)
+
+	// FetchHistoricalRate returns the rate of the currency at the unix
+	// timestamp. Sources without historical rates return an ErrNotExist
+	// error.
+	FetchHistoricalRate(currency string, timestamp int64) (*ExchangeRate, error)
+}
+
+// newExchangeRateSource returns the built-in source with the name. The custom
+// source requests rates from customURL.
+func newExchangeRateSource(name, customURL string) (ExchangeRateSource, error) {
+	switch name {
+	case ExchangeRateSourceBinance:
+		return &binanceRateSource{apiURL: binanceAPIURL, client: newExchangeRateClient()}, nil
+	case ExchangeRateSourceCustom:
+		if !strings.Contains(customURL, customRateURLCurrency) {
+			return nil, newError(ErrInvalid)
+		}
+		return &customRateSource{url: customURL, client: newExchangeRateClient()}, nil
+	case ExchangeRateSourceLocal:
+		return NewLocalExchangeRateSource(), nil
+	default:
+		return nil, newError(ErrInvalid)
+	}
+}
+
+func newExchangeRateClient() *http.Client {
+	return &http.Client{Timeout: exchangeRateRequestTimeout}
+}
+
+func getExchangeRateJSON(client *http.Client, url string, dest interface{}) error {
+	r, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("error requesting exchange rate: %s", err.Error())
+	}
+	defer r.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("error reading exchange rate response: %s", err.Error())
+	}
+
+	if r.StatusCode == http.StatusNotFound || r.StatusCode == http.StatusBadRequest {
+		// unknown market or currency
+		return newError(ErrNotExist)
+	}
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("exchange rate request failed: %s", http.StatusText(r.StatusCode))
+	}
+
+	err = json.Unmarshal(responseBody, dest)
+	if err != nil {
+		return fmt.Errorf("error unmarshaling exchange rate response: %s", err.Error())
+	}
+	return nil
+}
+
+func parseRate(rate string) (float64, error) {
+	value, err := strconv.ParseFloat(rate, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid exchange rate %q", rate)
+	}
+	return value, nil
+}
+
+// binanceRateSource reads the DCR markets of Binance, which quotes DCR in
+// USDT rather than USD. Historical rates are the closing rates of hourly
+// klines.
+type binanceRateSource struct {
+	apiURL string
+	client *http.Client
+}
+
+func (s *binanceRateSource) Name() string {
+	return ExchangeRateSourceBinance
+}
+
+func binanceQuote(currency string) string {
+	if currency == "USD" {
+		return "USDT"
+	}
+	return currency
+}
+
+func (s *binanceRateSource) FetchRate(currency string) (*ExchangeRate, error) {
+	var ticker struct {
+		Price string `json:"price"`
+	}
+	err := getExchangeRateJSON(s.client, s.apiURL+fmt.Sprintf(binanceTickerPath, binanceQuote(currency)), &ticker)
+	if err != nil {
+		return nil, err
+	}
+
+	rate, err := parseRate(ticker.Price)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExchangeRate{
+		Currency:  currency,
+		Rate:      rate,
+		Source:    s.Name(),
+		Timestamp: time.Now().Unix(),
+	}, nil
+}
+
+func (s *binanceRateSource) FetchHistoricalRate(currency string, timestamp int64) (*ExchangeRate, error) {
+	// klines are arrays of open time, open, high, low, close and more
+	var klines [][]interface{}
+	startTime := (timestamp - timestamp%3600) * 1000
+	url := s.apiURL + fmt.Sprintf(binanceKlinesPath, binanceQuote(currency), startTime)
+	err := getExchangeRateJSON(s.client, url, &klines)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(klines) == 0 || len(klines[0]) < 5 {
+		return nil, newError(ErrNotExist)
+	}
+
+	openTime, ok := klines[0][0].(float64)
+	if !ok || int64(openTime) != startTime {
+		return nil, newError(ErrNotExist)
+	}
+	closeRate, _ := klines[0][4].(string)
+	rate, err := parseRate(closeRate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExchangeRate{
+		Currency:  currency,
+		Rate:      rate,
+		Source:    s.Name(),
+		Timestamp: startTime / 1000,
+	}, nil
+}
+
+// customRateSource requests rates from a URL in which {currency} and
+// {timestamp} are replaced by the requested currency and unix timestamp. The
+// URL must respond with a JSON object such as {"rate": 25.1, "timestamp":
+// 1600000000}, the timestamp is optional. Historical rates are only available
+// if the URL includes {timestamp}.
+type customRateSource struct {
+	url    string
+	client *http.Client
+}
+
+func (s *customRateSource) Name() string {
+	return ExchangeRateSourceCustom
+}
+
+func (s *customRateSource) FetchRate(currency string) (*ExchangeRate, error) {
+	url := strings.Replace(s.url, customRateURLTimestamp, strconv.FormatInt(time.Now().Unix(), 10), -1)
+	return s.fetch(url, currency, time.Now().Unix())
+}
+
+func (s *customRateSource) FetchHistoricalRate(currency string, timestamp int64) (*ExchangeRate, error) {
+	if !strings.Contains(s.url, customRateURLTimestamp) {
+		return nil, newError(ErrNotExist)
+	}
+
+	url := strings.Replace(s.url, customRateURLTimestamp, strconv.FormatInt(timestamp, 10), -1)
+	return s.fetch(url, currency, timestamp)
+}
+
+func (s *customRateSource) fetch(url, currency string, timestamp int64) (*ExchangeRate, error) {
+	var response struct {
+		Rate      float64 `json:"rate"`
+		Timestamp int64   `json:"timestamp"`
+	}
+	url = strings.Replace(url, customRateURLCurrency, currency, -1)
+	err := getExchangeRateJSON(s.client, url, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Rate <= 0 {
+		return nil, fmt.Errorf("invalid exchange rate %v", response.Rate)
+	}
+	if response.Timestamp != 0 {
+		timestamp = response.Timestamp
+	}
+
+	return &ExchangeRate{
+		Currency:  currency,
+		Rate:      response.Rate,
+		Source:    s.Name(),
+		Timestamp: timestamp,
+	}, nil
+}
+
+// LocalExchangeRateSource is a stand-in source returning rates set by the
+// app, for offline use and testing. The set rates are also returned as the
+// historical rates of any time, so they are not saved.
+type LocalExchangeRateSource struct {
+	mu    sync.RWMutex
+	rates map[string]float64
+}
+
+func NewLocalExchangeRateSource() *LocalExchangeRateSource {
+	return &LocalExchangeRateSource{rates: make(map[string]float64)}
+}
+
+// SetRate sets the price of 1 DCR in the currency.
+func (s *LocalExchangeRateSource) SetRate(currency string, rate float64) {
+	s.mu.Lock()
+	s.rates[strings.ToUpper(currency)] = rate
+	s.mu.Unlock()
+}
+
+func (s *LocalExchangeRateSource) Name() string {
+	return ExchangeRateSourceLocal
+}
+
+func (s *LocalExchangeRateSource) FetchRate(currency string) (*ExchangeRate, error) {
+	return s.FetchHistoricalRate(currency, time.Now().Unix())
+}
+
+func (s *LocalExchangeRateSource) FetchHistoricalRate(currency string, timestamp int64) (*ExchangeRate, error) {
+	s.mu.RLock()
+	rate, ok := s.rates[strings.ToUpper(currency)]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, newError(ErrNotExist)
+	}
+
+	return &ExchangeRate{
+		Currency:  strings.ToUpper(currency),
+		Rate:      rate,
+		Source:    s.Name(),
+		Timestamp: timestamp,
+	}, nil
+}
@@ -0,0 +1,381 @@
+package dcrlibwallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asdine/storm"
+)
+
+const (
+	// ExchangeRateSourceConfigKey and ExchangeRateSourceURLConfigKey hold the
+	// name of the built-in exchange rate source in use and the URL of the
+	// custom source.
+	ExchangeRateSourceConfigKey    = "exchange_rate_source"
+	ExchangeRateSourceURLConfigKey = "exchange_rate_source_url"
+
+	// exchangeRateCacheDuration is how long fetched rates are used before
+	// being fetched again.
+	exchangeRateCacheDuration = 5 * time.Minute
+
+	// historicalRateTolerance is the largest difference between the time of
+	// a saved rate and the time it is used for.
+	historicalRateTolerance = int64(time.Hour / time.Second)
+
+	// savedExchangeRateInterval is the number of seconds for which a single
+	// rate of each currency is saved.
+	savedExchangeRateInterval = int64(time.Hour / time.Second)
+)
+
+type exchangeRates struct {
+	mu     sync.RWMutex
+	source ExchangeRateSource
+	cache  map[string]*ExchangeRate
+
+	listenersMu sync.RWMutex
+	listeners   map[string]ExchangeRateListener
+}
+
+// initExchangeRates sets up the exchange rate source saved in the config db,
+// falling back to DefaultExchangeRateSource.
+func (mw *MultiWallet) initExchangeRates() {
+	mw.exchangeRates = &exchangeRates{
+		cache:     make(map[string]*ExchangeRate),
+		listeners: make(map[string]ExchangeRateListener),
+	}
+
+	name := mw.ReadStringConfigValueForKey(ExchangeRateSourceConfigKey)
+	source, err := newExchangeRateSource(name, mw.ReadStringConfigValueForKey(ExchangeRateSourceURLConfigKey))
+	if err != nil {
+		if name != "" {
+			log.Warnf("Invalid exchange rate source %q, using %s", name, DefaultExchangeRateSource)
+		}
+		source, _ = newExchangeRateSource(DefaultExchangeRateSource, "")
+	}
+	mw.exchangeRates.source = source
+}
+
+// SetExchangeRateSource saves and uses the built-in exchange rate source with
+// the name, one of ExchangeRateSourceBinance, ExchangeRateSourceCustom or
+// ExchangeRateSourceLocal. customURL is the URL of the custom source, in
+// which {currency} and {timestamp} are replaced by the requested currency and
+// unix timestamp. It is ignored by other sources.
+func (mw *MultiWallet) SetExchangeRateSource(name, customURL string) error {
+	source, err := newExchangeRateSource(name, customURL)
+	if err != nil {
+		return err
+	}
+
+	mw.SetStringConfigValueForKey(ExchangeRateSourceConfigKey, name)
+	mw.SetStringConfigValueForKey(ExchangeRateSourceURLConfigKey, customURL)
+	mw.UseExchangeRateSource(source)
+	return nil
+}
+
+// UseExchangeRateSource uses the source for exchange rates until the next
+// restart or call to SetExchangeRateSource. It allows apps to provide their
+// own source.
+func (mw *MultiWallet) UseExchangeRateSource(source ExchangeRateSource) {
+	mw.exchangeRates.mu.Lock()
+	mw.exchangeRates.source = source
+	mw.exchangeRates.cache = make(map[string]*ExchangeRate)
+	mw.exchangeRates.mu.Unlock()
+
+	// the new source may have the rates the previous one didn't have
+	mw.txFiatBackfillMu.Lock()
+	mw.txFiatMissingRates = nil
+	mw.txFiatBackfillMu.Unlock()
+}
+
+// ExchangeRateSourceName returns the name of the exchange rate source in use.
+func (mw *MultiWallet) ExchangeRateSourceName() string {
+	mw.exchangeRates.mu.RLock()
+	defer mw.exchangeRates.mu.RUnlock()
+	return mw.exchangeRates.source.Name()
+}
+
+// ExchangeRateRaw returns the price of 1 DCR in the currency. Rates are
+// fetched again once they are older than 5 minutes. If the source can't be
+// reached, the last saved rate is returned, check its timestamp to tell how
+// old it is.
+func (mw *MultiWallet) ExchangeRateRaw(currency string) (*ExchangeRate, error) {
+	currency = strings.ToUpper(currency)
+
+	mw.exchangeRates.mu.RLock()
+	rate, ok := mw.exchangeRates.cache[currency]
+	mw.exchangeRates.mu.RUnlock()
+	if ok && time.Since(time.Unix(rate.Timestamp, 0)) < exchangeRateCacheDuration {
+		return rate, nil
+	}
+
+	rate, err := mw.RefreshExchangeRateRaw(currency)
+	if err == nil {
+		return rate, nil
+	}
+
+	log.Warnf("Error fetching %s exchange rate: %v", currency, err)
+	savedRate, savedErr := mw.latestSavedExchangeRate(currency)
+	if savedErr != nil {
+		return nil, err
+	}
+	return savedRate, nil
+}
+
+// ExchangeRate returns the result of ExchangeRateRaw as a JSON string.
+func (mw *MultiWallet) ExchangeRate(currency string) (string, error) {
+	return marshalExchangeRate(mw.ExchangeRateRaw(currency))
+}
+
+// RefreshExchangeRateRaw fetches the rate of the currency from the source,
+// saves it and notifies the exchange rate listeners.
+func (mw *MultiWallet) RefreshExchangeRateRaw(currency string) (*ExchangeRate, error) {
+	currency = strings.ToUpper(currency)
+
+	mw.exchangeRates.mu.RLock()
+	source := mw.exchangeRates.source
+	mw.exchangeRates.mu.RUnlock()
+
+	rate, err := source.FetchRate(currency)
+	if err != nil {
+		return nil, err
+	}
+
+	mw.exchangeRates.mu.Lock()
+	if mw.exchangeRates.source == source {
+		mw.exchangeRates.cache[currency] = rate
+	}
+	mw.exchangeRates.mu.Unlock()
+
+	if err = mw.saveExchangeRate(rate); err != nil {
+		log.Errorf("Error saving %s exchange rate: %v", currency, err)
+	}
+
+	mw.publishExchangeRateUpdate(rate)
+	return rate, nil
+}
+
+// HistoricalExchangeRateRaw returns the price of 1 DCR in the currency at
+// the unix timestamp. Saved rates within an hour of the timestamp are used,
+// otherwise the rate is fetched from the source and saved.
+func (mw *MultiWallet) HistoricalExchangeRateRaw(currency string, timestamp int64) (*ExchangeRate, error) {
+	currency = strings.ToUpper(currency)
+
+	rate, err := mw.savedExchangeRateAt(currency, timestamp)
+	if err == nil {
+		return rate, nil
+	}
+	if err != storm.ErrNotFound {
+		return nil, translateError(err)
+	}
+
+	mw.exchangeRates.mu.RLock()
+	source := mw.exchangeRates.source
+	mw.exchangeRates.mu.RUnlock()
+
+	rate, err = source.FetchHistoricalRate(currency, timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = mw.saveExchangeRate(rate); err != nil {
+		log.Errorf("Error saving %s exchange rate: %v", currency, err)
+	}
+	return rate, nil
+}
+
+// HistoricalExchangeRate returns the result of HistoricalExchangeRateRaw as a
+// JSON string.
+func (mw *MultiWallet) HistoricalExchangeRate(currency string, timestamp int64) (string, error) {
+	return marshalExchangeRate(mw.HistoricalExchangeRateRaw(currency, timestamp))
+}
+
+// AmountFiat returns the current value of the atoms in the currency.
+func (mw *MultiWallet) AmountFiat(atoms int64, currency string) (float64, error) {
+	rate, err := mw.ExchangeRateRaw(currency)
+	if err != nil {
+		return 0, err
+	}
+	return AmountCoin(atoms) * rate.Rate, nil
+}
+
+// AmountFiatAt returns the value of the atoms in the currency at the unix
+// timestamp.
+func (mw *MultiWallet) AmountFiatAt(atoms int64, currency string, timestamp int64) (float64, error) {
+	rate, err := mw.HistoricalExchangeRateRaw(currency, timestamp)
+	if err != nil {
+		return 0, err
+	}
+	return AmountCoin(atoms) * rate.Rate, nil
+}
+
+func (mw *MultiWallet) AddExchangeRateListener(listener ExchangeRateListener, uniqueIdentifier string) error {
+	mw.exchangeRates.listenersMu.Lock()
+	defer mw.exchangeRates.listenersMu.Unlock()
+
+	if _, ok := mw.exchangeRates.listeners[uniqueIdentifier]; ok {
+		return newError(ErrListenerAlreadyExist)
+	}
+
+	mw.exchangeRates.listeners[uniqueIdentifier] = listener
+	return nil
+}
+
+func (mw *MultiWallet) RemoveExchangeRateListener(uniqueIdentifier string) {
+	mw.exchangeRates.listenersMu.Lock()
+	defer mw.exchangeRates.listenersMu.Unlock()
+
+	delete(mw.exchangeRates.listeners, uniqueIdentifier)
+}
+
+func (mw *MultiWallet) publishExchangeRateUpdate(rate *ExchangeRate) {
+	mw.exchangeRates.listenersMu.RLock()
+	defer mw.exchangeRates.listenersMu.RUnlock()
+
+	for _, listener := range mw.exchangeRates.listeners {
+		listener.OnExchangeRateUpdated(rate)
+	}
+}
+
+type exchangeRateFn = func(currency string, timestamp int64, fetch bool) (*ExchangeRate, error)
+
+// exchangeRateAt returns the rate of the currency at the unix timestamp. Only
+// saved rates are used unless fetch is true, see HistoricalExchangeRateRaw.
+// Rates are never fetched from the local source, which has no rates of the
+// past.
+func (mw *MultiWallet) exchangeRateAt(currency string, timestamp int64, fetch bool) (*ExchangeRate, error) {
+	mw.exchangeRates.mu.RLock()
+	localSource := mw.exchangeRates.source.Name() == ExchangeRateSourceLocal
+	mw.exchangeRates.mu.RUnlock()
+
+	if fetch && !localSource {
+		return mw.HistoricalExchangeRateRaw(currency, timestamp)
+	}
+
+	rate, err := mw.savedExchangeRateAt(strings.ToUpper(currency), timestamp)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return rate, nil
+}
+
+// savedExchangeRateKey returns the key of the saved rate of the currency for
+// the hour of the timestamp. Keys sort by currency and time.
+func savedExchangeRateKey(currency string, timestamp int64) string {
+	return fmt.Sprintf("%s-%012d", currency, timestamp/savedExchangeRateInterval)
+}
+
+// latestExchangeRateKey returns the key of the latest saved rate of the
+// currency, which is saved twice to be read without a range query.
+func latestExchangeRateKey(currency string) string {
+	return currency + "-latest"
+}
+
+// saveExchangeRate saves the rate as the rate of its currency for the hour of
+// its timestamp, replacing the rate saved earlier for that hour. Saved rates
+// are downsampled this way to one per hour for each currency. Rates of the
+// local source are set by the app for any time and are not saved, so that
+// they aren't used as past rates once another source is used.
+func (mw *MultiWallet) saveExchangeRate(rate *ExchangeRate) error {
+	if rate.Source == ExchangeRateSourceLocal {
+		return nil
+	}
+
+	saved := *rate
+	saved.Currency = strings.ToUpper(saved.Currency)
+	saved.Key = savedExchangeRateKey(saved.Currency, saved.Timestamp)
+
+	mw.restoreMu.RLock()
+	defer mw.restoreMu.RUnlock()
+
+	tx, err := mw.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.Save(&saved)
+	if err != nil {
+		return err
+	}
+
+	var latest ExchangeRate
+	err = tx.One("Key", latestExchangeRateKey(saved.Currency), &latest)
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+	if err == nil && latest.Timestamp > saved.Timestamp {
+		return tx.Commit()
+	}
+
+	saved.Key = latestExchangeRateKey(saved.Currency)
+	err = tx.Save(&saved)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (mw *MultiWallet) latestSavedExchangeRate(currency string) (*ExchangeRate, error) {
+	mw.restoreMu.RLock()
+	defer mw.restoreMu.RUnlock()
+
+	var rate ExchangeRate
+	err := mw.db.One("Key", latestExchangeRateKey(currency), &rate)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &rate, nil
+}
+
+// savedExchangeRateAt returns the saved rate closest to the timestamp, within
+// historicalRateTolerance.
+func (mw *MultiWallet) savedExchangeRateAt(currency string, timestamp int64) (*ExchangeRate, error) {
+	mw.restoreMu.RLock()
+	defer mw.restoreMu.RUnlock()
+
+	// only the rates of the hours within the tolerance are read, the keys
+	// of latest rates sort after them
+	var rates []ExchangeRate
+	minKey := savedExchangeRateKey(currency, timestamp-historicalRateTolerance)
+	maxKey := savedExchangeRateKey(currency, timestamp+historicalRateTolerance)
+	err := mw.db.Range("Key", minKey, maxKey, &rates)
+	if err != nil {
+		return nil, err
+	}
+
+	var closest *ExchangeRate
+	for i := range rates {
+		if abs64(rates[i].Timestamp-timestamp) > historicalRateTolerance {
+			continue
+		}
+		if closest == nil || abs64(rates[i].Timestamp-timestamp) < abs64(closest.Timestamp-timestamp) {
+			closest = &rates[i]
+		}
+	}
+	if closest == nil {
+		return nil, storm.ErrNotFound
+	}
+	return closest, nil
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func marshalExchangeRate(rate *ExchangeRate, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+
+	result, err := json.Marshal(rate)
+	if err != nil {
+		return "", translateError(err)
+	}
+	return string(result), nil
+}
@@ -0,0 +1,396 @@
+package dcrlibwallet
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// countingRateSource returns rate for every currency and counts the fetches,
+// or fails while failing is set. It has no rates before listedAt.
+type countingRateSource struct {
+	mu       sync.Mutex
+	rate     float64
+	failing  bool
+	listedAt int64
+	fetches  int
+}
+
+func (s *countingRateSource) Name() string {
+	return "counting"
+}
+
+func (s *countingRateSource) FetchRate(currency string) (*ExchangeRate, error) {
+	return s.FetchHistoricalRate(currency, time.Now().Unix())
+}
+
+func (s *countingRateSource) FetchHistoricalRate(currency string, timestamp int64) (*ExchangeRate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fetches++
+	if s.failing {
+		return nil, fmt.Errorf("source unreachable")
+	}
+	if timestamp < s.listedAt {
+		return nil, newError(ErrNotExist)
+	}
+	return &ExchangeRate{Currency: currency, Rate: s.rate, Source: s.Name(), Timestamp: timestamp}, nil
+}
+
+type exchangeRateTestListener struct {
+	rates chan *ExchangeRate
+}
+
+func (l *exchangeRateTestListener) OnExchangeRateUpdated(rate *ExchangeRate) {
+	l.rates <- rate
+}
+
+var _ = Describe("Exchange rates", func() {
+	var (
+		mw      *MultiWallet
+		cleanup func()
+	)
+
+	BeforeEach(func() {
+		mw, cleanup = newTestMultiWallet()
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	It("defaults to a live source", func() {
+		Expect(mw.ExchangeRateSourceName()).To(Equal(DefaultExchangeRateSource))
+
+		mw.SetStringConfigValueForKey(ExchangeRateSourceConfigKey, "bittrex")
+		mw.initExchangeRates()
+		Expect(mw.ExchangeRateSourceName()).To(Equal(DefaultExchangeRateSource))
+
+		Expect(mw.SetExchangeRateSource(ExchangeRateSourceLocal, "")).To(Succeed())
+		mw.initExchangeRates()
+		Expect(mw.ExchangeRateSourceName()).To(Equal(ExchangeRateSourceLocal))
+	})
+
+	Describe("binanceRateSource", func() {
+		var (
+			server     *httptest.Server
+			source     *binanceRateSource
+			klineShift int64
+		)
+
+		BeforeEach(func() {
+			klineShift = 0
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				symbol := r.URL.Query().Get("symbol")
+				if symbol != "DCRUSDT" && symbol != "DCRBTC" {
+					w.WriteHeader(http.StatusBadRequest)
+					fmt.Fprint(w, `{"code":-1121,"msg":"Invalid symbol."}`)
+					return
+				}
+
+				switch r.URL.Path {
+				case "/ticker/price":
+					fmt.Fprintf(w, `{"symbol":%q,"price":"25.10000000"}`, symbol)
+				case "/klines":
+					Expect(r.URL.Query().Get("interval")).To(Equal("1h"))
+					startTime, err := strconv.ParseInt(r.URL.Query().Get("startTime"), 10, 64)
+					Expect(err).To(BeNil())
+					fmt.Fprintf(w, `[[%d,"24.0","26.0","23.0","24.50000000","100",%d]]`, startTime+klineShift, startTime+3599999)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+
+			s, err := newExchangeRateSource(ExchangeRateSourceBinance, "")
+			Expect(err).To(BeNil())
+			source = s.(*binanceRateSource)
+			source.apiURL = server.URL
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("reads the ticker price, quoting USD in USDT", func() {
+			rate, err := source.FetchRate("USD")
+			Expect(err).To(BeNil())
+			Expect(rate.Currency).To(Equal("USD"))
+			Expect(rate.Rate).To(Equal(25.1))
+			Expect(rate.Source).To(Equal(ExchangeRateSourceBinance))
+			Expect(rate.Timestamp).To(BeNumerically("~", time.Now().Unix(), 5))
+
+			_, err = source.FetchRate("EUR")
+			Expect(err).To(MatchError(ErrNotExist))
+		})
+
+		It("reads the close of the hourly kline of the timestamp", func() {
+			rate, err := source.FetchHistoricalRate("USD", 1600001234)
+			Expect(err).To(BeNil())
+			Expect(rate.Rate).To(Equal(24.5))
+			Expect(rate.Timestamp).To(BeEquivalentTo(1599998400))
+
+			By("Rejecting klines of another hour")
+			klineShift = 3600 * 1000
+			_, err = source.FetchHistoricalRate("USD", 1600001234)
+			Expect(err).To(MatchError(ErrNotExist))
+
+			_, err = source.FetchHistoricalRate("EUR", 1600001234)
+			Expect(err).To(MatchError(ErrNotExist))
+		})
+	})
+
+	Describe("customRateSource", func() {
+		var (
+			server   *httptest.Server
+			response string
+			requests chan string
+		)
+
+		BeforeEach(func() {
+			response = `{"rate": 10.5}`
+			requests = make(chan string, 10)
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests <- r.URL.RequestURI()
+				if response == "" {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				fmt.Fprint(w, response)
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("requires the {currency} placeholder", func() {
+			_, err := newExchangeRateSource(ExchangeRateSourceCustom, server.URL+"/rate")
+			Expect(err).To(MatchError(ErrInvalid))
+		})
+
+		It("replaces the placeholders of the URL", func() {
+			source, err := newExchangeRateSource(ExchangeRateSourceCustom, server.URL+"/rate/{currency}?at={timestamp}")
+			Expect(err).To(BeNil())
+
+			rate, err := source.FetchRate("EUR")
+			Expect(err).To(BeNil())
+			Expect(rate.Rate).To(Equal(10.5))
+			Expect(rate.Currency).To(Equal("EUR"))
+			Expect(rate.Timestamp).To(BeNumerically("~", time.Now().Unix(), 5))
+			Expect(<-requests).To(Equal(fmt.Sprintf("/rate/EUR?at=%d", rate.Timestamp)))
+
+			rate, err = source.FetchHistoricalRate("EUR", 1600000000)
+			Expect(err).To(BeNil())
+			Expect(rate.Timestamp).To(BeEquivalentTo(1600000000))
+			Expect(<-requests).To(Equal("/rate/EUR?at=1600000000"))
+
+			By("Using the timestamp of the response")
+			response = `{"rate": 11, "timestamp": 1599999000}`
+			rate, err = source.FetchHistoricalRate("EUR", 1600000000)
+			Expect(err).To(BeNil())
+			Expect(rate.Rate).To(BeEquivalentTo(11))
+			Expect(rate.Timestamp).To(BeEquivalentTo(1599999000))
+		})
+
+		It("has historical rates only with the {timestamp} placeholder", func() {
+			source, err := newExchangeRateSource(ExchangeRateSourceCustom, server.URL+"/rate/{currency}")
+			Expect(err).To(BeNil())
+
+			_, err = source.FetchRate("USD")
+			Expect(err).To(BeNil())
+			_, err = source.FetchHistoricalRate("USD", 1600000000)
+			Expect(err).To(MatchError(ErrNotExist))
+		})
+
+		It("rejects invalid responses", func() {
+			source, err := newExchangeRateSource(ExchangeRateSourceCustom, server.URL+"/rate/{currency}")
+			Expect(err).To(BeNil())
+
+			response = `{"rate": 0}`
+			_, err = source.FetchRate("USD")
+			Expect(err).To(HaveOccurred())
+
+			response = `not json`
+			_, err = source.FetchRate("USD")
+			Expect(err).To(HaveOccurred())
+
+			response = ""
+			_, err = source.FetchRate("USD")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("ExchangeRateRaw", func() {
+		var source *countingRateSource
+
+		BeforeEach(func() {
+			source = &countingRateSource{rate: 20}
+			mw.UseExchangeRateSource(source)
+		})
+
+		It("caches the fetched rates and notifies the listeners", func() {
+			listener := &exchangeRateTestListener{rates: make(chan *ExchangeRate, 10)}
+			Expect(mw.AddExchangeRateListener(listener, "test")).To(Succeed())
+
+			rate, err := mw.ExchangeRateRaw("usd")
+			Expect(err).To(BeNil())
+			Expect(rate.Currency).To(Equal("USD"))
+			Expect(rate.Rate).To(BeEquivalentTo(20))
+			Expect(listener.rates).To(Receive(Equal(rate)))
+
+			_, err = mw.ExchangeRateRaw("USD")
+			Expect(err).To(BeNil())
+			Expect(source.fetches).To(Equal(1))
+			Expect(listener.rates).NotTo(Receive())
+
+			amount, err := mw.AmountFiat(250000000, "USD")
+			Expect(err).To(BeNil())
+			Expect(amount).To(BeEquivalentTo(50))
+			Expect(source.fetches).To(Equal(1))
+		})
+
+		It("fetches expired rates and falls back to the saved rate", func() {
+			_, err := mw.ExchangeRateRaw("USD")
+			Expect(err).To(BeNil())
+
+			// expire the cached rate
+			mw.exchangeRates.cache["USD"] = &ExchangeRate{Currency: "USD", Rate: 20, Timestamp: time.Now().Add(-exchangeRateCacheDuration).Unix()}
+			source.rate = 21
+			rate, err := mw.ExchangeRateRaw("USD")
+			Expect(err).To(BeNil())
+			Expect(rate.Rate).To(BeEquivalentTo(21))
+			Expect(source.fetches).To(Equal(2))
+
+			mw.exchangeRates.cache["USD"] = &ExchangeRate{Currency: "USD", Rate: 21, Timestamp: time.Now().Add(-exchangeRateCacheDuration).Unix()}
+			source.failing = true
+			rate, err = mw.ExchangeRateRaw("USD")
+			Expect(err).To(BeNil())
+			Expect(rate.Rate).To(BeEquivalentTo(21))
+			Expect(source.fetches).To(Equal(3))
+
+			_, err = mw.ExchangeRateRaw("EUR")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("HistoricalExchangeRateRaw", func() {
+		var source *countingRateSource
+
+		BeforeEach(func() {
+			source = &countingRateSource{rate: 20}
+			mw.UseExchangeRateSource(source)
+		})
+
+		It("uses saved rates within an hour and saves fetched rates", func() {
+			Expect(mw.saveExchangeRate(&ExchangeRate{Currency: "usd", Rate: 15, Timestamp: 1600000000})).To(Succeed())
+
+			rate, err := mw.HistoricalExchangeRateRaw("USD", 1600003000)
+			Expect(err).To(BeNil())
+			Expect(rate.Rate).To(BeEquivalentTo(15))
+			Expect(source.fetches).To(BeZero())
+
+			rate, err = mw.HistoricalExchangeRateRaw("USD", 1600003601)
+			Expect(err).To(BeNil())
+			Expect(rate.Rate).To(BeEquivalentTo(20))
+			Expect(source.fetches).To(Equal(1))
+
+			_, err = mw.HistoricalExchangeRateRaw("USD", 1600003601)
+			Expect(err).To(BeNil())
+			Expect(source.fetches).To(Equal(1))
+
+			amount, err := mw.AmountFiatAt(100000000, "USD", 1600000100)
+			Expect(err).To(BeNil())
+			Expect(amount).To(BeEquivalentTo(15))
+		})
+
+		It("reads only saved rates unless asked to fetch", func() {
+			_, err := mw.exchangeRateAt("USD", 1600000000, false)
+			Expect(err).To(MatchError(ErrNotExist))
+			Expect(source.fetches).To(BeZero())
+
+			rate, err := mw.exchangeRateAt("USD", 1600000000, true)
+			Expect(err).To(BeNil())
+			Expect(rate.Rate).To(BeEquivalentTo(20))
+
+			rate, err = mw.exchangeRateAt("usd", 1600000000, false)
+			Expect(err).To(BeNil())
+			Expect(rate.Rate).To(BeEquivalentTo(20))
+		})
+
+		It("doesn't save or record the rates of the local source", func() {
+			local := NewLocalExchangeRateSource()
+			local.SetRate("USD", 30)
+			mw.UseExchangeRateSource(local)
+
+			rate, err := mw.HistoricalExchangeRateRaw("USD", 1600000000)
+			Expect(err).To(BeNil())
+			Expect(rate.Rate).To(BeEquivalentTo(30))
+			_, err = mw.ExchangeRateRaw("USD")
+			Expect(err).To(BeNil())
+
+			_, err = mw.exchangeRateAt("USD", 1600000000, true)
+			Expect(err).To(MatchError(ErrNotExist))
+
+			mw.UseExchangeRateSource(source)
+			rate, err = mw.exchangeRateAt("USD", 1600000000, true)
+			Expect(err).To(BeNil())
+			Expect(rate.Rate).To(BeEquivalentTo(20))
+			_, err = mw.latestSavedExchangeRate("USD")
+			Expect(err).To(BeNil())
+			count, err := mw.db.Count(&ExchangeRate{})
+			Expect(err).To(BeNil())
+			Expect(count).To(Equal(2))
+		})
+	})
+
+	Describe("saved rates", func() {
+		It("keeps the last saved rate of each hour", func() {
+			hour := int64(1600000000) / 3600 * 3600
+			for i, timestamp := range []int64{hour + 10, hour + 1800, hour + 3599, hour + 3600, hour + 7300} {
+				rate := &ExchangeRate{Currency: "USD", Rate: float64(10 + i), Timestamp: timestamp}
+				Expect(mw.saveExchangeRate(rate)).To(Succeed())
+			}
+			Expect(mw.saveExchangeRate(&ExchangeRate{Currency: "EUR", Rate: 9, Timestamp: hour + 20000})).To(Succeed())
+
+			count, err := mw.db.Count(&ExchangeRate{})
+			Expect(err).To(BeNil())
+			// 3 hourly USD rates, 1 hourly EUR rate and the latest rates
+			Expect(count).To(Equal(6))
+
+			rate, err := mw.savedExchangeRateAt("USD", hour+100)
+			Expect(err).To(BeNil())
+			Expect(rate.Timestamp).To(Equal(hour + 3599))
+
+			rate, err = mw.savedExchangeRateAt("USD", hour+5000)
+			Expect(err).To(BeNil())
+			Expect(rate.Timestamp).To(Equal(hour + 3600))
+
+			_, err = mw.savedExchangeRateAt("USD", hour-3600)
+			Expect(err).To(HaveOccurred())
+			_, err = mw.savedExchangeRateAt("USD", hour+7300+3601)
+			Expect(err).To(HaveOccurred())
+
+			latest, err := mw.latestSavedExchangeRate("USD")
+			Expect(err).To(BeNil())
+			Expect(latest.Timestamp).To(Equal(hour + 7300))
+			By("Keeping the latest rate when older rates are saved")
+			Expect(mw.saveExchangeRate(&ExchangeRate{Currency: "USD", Rate: 5, Timestamp: hour - 7200})).To(Succeed())
+			latest, err = mw.latestSavedExchangeRate("USD")
+			Expect(err).To(BeNil())
+			Expect(latest.Timestamp).To(Equal(hour + 7300))
+
+			latest, err = mw.latestSavedExchangeRate("EUR")
+			Expect(err).To(BeNil())
+			Expect(latest.Rate).To(BeEquivalentTo(9))
+			_, err = mw.latestSavedExchangeRate("GBP")
+			Expect(err).To(MatchError(ErrNotExist))
+		})
+	})
+})
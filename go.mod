@@ -8,6 +8,7 @@ require (
 	github.com/decred/dcrd/chaincfg/chainhash v1.0.3-0.20200921185235-6d75c7ec1199
 	github.com/decred/dcrd/chaincfg/v3 v3.0.0
 	github.com/decred/dcrd/connmgr/v3 v3.0.0
+	github.com/decred/dcrd/crypto/blake256 v1.0.1-0.20200921185235-6d75c7ec1199
 	github.com/decred/dcrd/dcrec v1.0.1-0.20200921185235-6d75c7ec1199
 	github.com/decred/dcrd/dcrutil/v3 v3.0.0
 	github.com/decred/dcrd/gcs/v2 v2.1.0
@@ -15,6 +16,7 @@ require (
 	github.com/decred/dcrd/txscript/v3 v3.0.0
 	github.com/decred/dcrd/wire v1.4.0
 	github.com/decred/dcrdata/txhelpers/v4 v4.0.1
+	github.com/decred/go-socks v1.1.0
 	github.com/decred/politeia v1.0.0
 	github.com/decred/slog v1.1.0
 	github.com/dgraph-io/badger v1.6.2
@@ -0,0 +1,87 @@
+package dcrlibwallet
+
+import (
+	"os"
+
+	"decred.org/dcrwallet/errors"
+	"github.com/planetdecred/dcrlibwallet/spv"
+)
+
+// ExportHeaderSnapshot writes the block headers and compact filters synced by
+// the wallet with the provided ID to a header snapshot file at filePath. The
+// snapshot can be imported on a fresh install with ImportHeaderSnapshot to
+// skip downloading every block header since genesis.
+func (mw *MultiWallet) ExportHeaderSnapshot(walletID int, filePath string) error {
+	wallet := mw.WalletWithID(walletID)
+	if wallet == nil {
+		return newError(ErrNotExist)
+	} else if !wallet.WalletOpened() {
+		return newError(ErrWalletNotLoaded)
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+
+	exported, err := spv.ExportHeaderSnapshot(wallet.shutdownContext(), wallet.internal, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filePath)
+		log.Errorf("[%d] error exporting header snapshot: %v", walletID, err)
+		return translateError(err)
+	}
+
+	log.Infof("[%d] Exported %d block headers to header snapshot", walletID, exported)
+	return nil
+}
+
+// ImportHeaderSnapshot connects the block headers and compact filters of the
+// header snapshot file at filePath to the chain of all opened wallets, so
+// that sync only fetches the headers mined after the snapshot was created.
+// Snapshot headers are checked against the hard-coded checkpoints of the
+// network and their proof of work, and filters against the commitments of
+// their headers, before anything is accepted. Mainnet and testnet snapshots
+// must reach the DCP0005 activation height for the earlier filters to be
+// verified. The highest number of headers imported by a wallet is returned.
+//
+// Headers can only be imported while wallets are not syncing.
+func (mw *MultiWallet) ImportHeaderSnapshot(filePath string) (int32, error) {
+	if mw.IsSyncing() || mw.IsSynced() {
+		return 0, newError(ErrSyncAlreadyInProgress)
+	}
+
+	var imported int32
+	for _, wallet := range mw.wallets {
+		if !wallet.WalletOpened() {
+			continue
+		}
+
+		walletImported, err := mw.importHeaderSnapshot(wallet, filePath)
+		if err != nil {
+			log.Errorf("[%d] error importing header snapshot: %v", wallet.ID, err)
+			if errors.Is(err, errors.Encoding) || errors.Is(err, errors.Invalid) ||
+				errors.Is(err, errors.Protocol) || errors.Is(err, errors.Consensus) {
+				return imported, newError(ErrInvalid)
+			}
+			return imported, translateError(err)
+		}
+		if walletImported > imported {
+			imported = walletImported
+		}
+	}
+
+	return imported, nil
+}
+
+func (mw *MultiWallet) importHeaderSnapshot(wallet *Wallet, filePath string) (int32, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return spv.ImportHeaderSnapshot(wallet.shutdownContext(), wallet.internal, file)
+}
@@ -0,0 +1,75 @@
+package dcrlibwallet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/decred/dcrd/gcs/v2"
+	"github.com/decred/dcrd/gcs/v2/blockcf2"
+	"github.com/decred/dcrd/wire"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HeaderSnapshot", func() {
+	var mw *MultiWallet
+	var cleanup func()
+	var wallet *Wallet
+	var snapshotPath string
+
+	BeforeEach(func() {
+		mw, cleanup = newTestMultiWallet()
+		wallet = newTestWallet(mw, "snapshot")
+		snapshotPath = filepath.Join(mw.rootDir, "headers.snapshot")
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	It("exports and imports an empty snapshot", func() {
+		Expect(mw.ExportHeaderSnapshot(wallet.ID, snapshotPath)).To(Succeed())
+
+		imported, err := mw.ImportHeaderSnapshot(snapshotPath)
+		Expect(err).To(BeNil())
+		Expect(imported).To(BeZero())
+	})
+
+	It("rejects testnet snapshots with unverifiable filters", func() {
+		filter, err := gcs.NewFilterV2(blockcf2.B, blockcf2.M, [gcs.KeySize]byte{}, nil)
+		Expect(err).To(BeNil())
+		header := &wire.BlockHeader{
+			PrevBlock: mw.chainParams.GenesisHash,
+			Height:    1,
+		}
+
+		var b bytes.Buffer
+		var buf [4]byte
+		b.WriteString("DCRHDRS1")
+		binary.LittleEndian.PutUint32(buf[:], uint32(mw.chainParams.Net))
+		b.Write(buf[:])
+		binary.LittleEndian.PutUint32(buf[:], 1)
+		b.Write(buf[:])
+		Expect(header.Serialize(&b)).To(Succeed())
+		binary.LittleEndian.PutUint32(buf[:], uint32(len(filter.Bytes())))
+		b.Write(buf[:])
+		b.Write(filter.Bytes())
+		Expect(ioutil.WriteFile(snapshotPath, b.Bytes(), os.ModePerm)).To(Succeed())
+
+		_, err = mw.ImportHeaderSnapshot(snapshotPath)
+		Expect(err).To(MatchError(ErrInvalid))
+
+		_, height := wallet.internal.MainChainTip(wallet.shutdownContext())
+		Expect(height).To(BeZero())
+	})
+
+	It("rejects missing wallets and files", func() {
+		Expect(mw.ExportHeaderSnapshot(wallet.ID+1, snapshotPath)).To(MatchError(ErrNotExist))
+
+		_, err := mw.ImportHeaderSnapshot(snapshotPath)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+})
@@ -7,6 +7,7 @@ package loader
 
 import (
 	"context"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
@@ -14,9 +15,10 @@ import (
 	"decred.org/dcrwallet/errors"
 	"decred.org/dcrwallet/wallet"
 	_ "decred.org/dcrwallet/wallet/drivers/bdb" // driver loaded during init
+	"decred.org/dcrwallet/wallet/walletdb"
 	"github.com/decred/dcrd/chaincfg/v3"
 	"github.com/decred/dcrd/dcrutil/v3"
-	_ "github.com/planetdecred/dcrlibwallet/badgerdb" // initialize badger driver
+	"github.com/planetdecred/dcrlibwallet/badgerdb" // initialize badger driver
 )
 
 const (
@@ -374,6 +376,72 @@ func (l *Loader) LoadedWallet() (*wallet.Wallet, bool) {
 	return w, w != nil
 }
 
+// CopyDatabase writes a consistent copy of the database of the loaded wallet
+// to w, in the format of the database driver.
+func (l *Loader) CopyDatabase(w io.Writer) error {
+	const op errors.Op = "loader.CopyDatabase"
+
+	defer l.mu.Unlock()
+	l.mu.Lock()
+
+	if l.wallet == nil {
+		return errors.E(op, errors.Invalid, "wallet is unopened")
+	}
+
+	// wallet.DB is opaque but embeds the walletdb.DB it wraps
+	db, ok := l.db.(walletdb.DB)
+	if !ok {
+		return errors.E(op, errors.Invalid, "database cannot be copied")
+	}
+
+	err := db.Copy(w)
+	if err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+// RestoreDatabase creates the wallet database from the copy written by
+// CopyDatabase to r. The database must not exist yet.
+func (l *Loader) RestoreDatabase(r io.Reader) error {
+	const op errors.Op = "loader.RestoreDatabase"
+
+	defer l.mu.Unlock()
+	l.mu.Lock()
+
+	if l.wallet != nil {
+		return errors.E(op, errors.Invalid, "wallet already opened")
+	}
+
+	dbPath := filepath.Join(l.dbDirPath, walletDbName)
+	exists, err := fileExists(dbPath)
+	if err != nil {
+		return errors.E(op, err)
+	}
+	if exists {
+		return errors.E(op, errors.Exist, "wallet DB exists")
+	}
+
+	err = os.MkdirAll(l.dbDirPath, 0700)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	switch l.dbDriver {
+	case "bdb":
+		// bdb copies are complete database files
+		err = writeFile(dbPath, r)
+	case "badgerdb":
+		err = badgerdb.Load(dbPath, r)
+	default:
+		err = errors.Errorf("unknown database driver %q", l.dbDriver)
+	}
+	if err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
 // UnloadWallet stops the loaded wallet, if any, and closes the wallet database.
 // Returns with errors.Invalid if the wallet has not been loaded with
 // CreateNewWallet or LoadExistingWallet.  The Loader may be reused if this
@@ -419,3 +487,19 @@ func fileExists(filePath string) (bool, error) {
 	}
 	return true, nil
 }
+
+func writeFile(filePath string, r io.Reader) error {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, r)
+	if err != nil {
+		file.Close()
+		os.Remove(filePath)
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,479 @@
+package dcrlibwallet
+
+import (
+	"encoding/json"
+	"time"
+
+	w "decred.org/dcrwallet/wallet"
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+)
+
+const (
+	InvoiceStatusAll int32 = iota - 1
+	InvoiceStatusPending
+	InvoiceStatusPartiallyPaid
+	InvoiceStatusPaid
+	InvoiceStatusConfirmed
+	InvoiceStatusExpired
+
+	// DefaultInvoiceConfirmations is the number of confirmations a paid
+	// invoice needs to be confirmed if none is specified.
+	DefaultInvoiceConfirmations int32 = 2
+
+	invoiceTrackerListenerID = "dcrlibwallet_invoice_tracker"
+)
+
+// CreateInvoice creates an invoice requesting atomAmount to a new address of
+// the account. The invoice expires at the unix timestamp expiry unless it is
+// paid by then, 0 for invoices that don't expire. A paid invoice is confirmed
+// once all its payments have requiredConfirmations, DefaultInvoiceConfirmations
+// if 0.
+//
+// Invoices are updated as payments to their address are seen and confirmed,
+// see AddInvoiceNotificationListener.
+func (mw *MultiWallet) CreateInvoice(walletID int, account int32, atomAmount int64, label, message string, expiry int64, requiredConfirmations int32) (*Invoice, error) {
+	wallet := mw.WalletWithID(walletID)
+	if wallet == nil {
+		return nil, newError(ErrNotExist)
+	}
+	if !wallet.WalletOpened() {
+		return nil, newError(ErrWalletNotLoaded)
+	}
+
+	now := time.Now().Unix()
+	if atomAmount <= 0 || atomAmount > MaxAmountAtom || (expiry != 0 && expiry <= now) || requiredConfirmations < 0 {
+		return nil, newError(ErrInvalid)
+	}
+	if requiredConfirmations == 0 {
+		requiredConfirmations = DefaultInvoiceConfirmations
+	}
+
+	mw.invoicesMu.Lock()
+	defer mw.invoicesMu.Unlock()
+
+	address, err := mw.nextInvoiceAddress(wallet, account)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice := &Invoice{
+		WalletID:              walletID,
+		Account:               account,
+		Address:               address,
+		Amount:                atomAmount,
+		Label:                 label,
+		Message:               message,
+		Status:                InvoiceStatusPending,
+		RequiredConfirmations: requiredConfirmations,
+		Payments:              make([]*InvoicePayment, 0),
+		CreatedAt:             now,
+		UpdatedAt:             now,
+		Expiry:                expiry,
+	}
+
+	invoice.URI, err = buildPaymentURI(&PaymentRequest{
+		Address: address,
+		Amount:  atomAmount,
+		Label:   label,
+		Message: message,
+		Expiry:  expiry,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = mw.db.Save(invoice)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	log.Infof("[%d] Created invoice %d for %s", walletID, invoice.ID, address)
+	return invoice, nil
+}
+
+// nextInvoiceAddress returns a new address of the account for an invoice.
+// Unlike NextAddress, the gap limit is ignored rather than wrapped around so
+// that open invoices never share an address, and addresses held by earlier
+// invoices are skipped. invoicesMu must be held.
+func (mw *MultiWallet) nextInvoiceAddress(wallet *Wallet, account int32) (string, error) {
+	if wallet.IsRestored && !wallet.HasDiscoveredAccounts {
+		return "", newError(ErrAddressDiscoveryNotDone)
+	}
+
+	for {
+		addr, err := wallet.internal.NewExternalAddress(wallet.shutdownContext(), uint32(account), w.WithGapPolicyIgnore())
+		if err != nil {
+			return "", translateError(err)
+		}
+
+		address := addr.Address()
+		err = mw.db.One("Address", address, &Invoice{})
+		if err == storm.ErrNotFound {
+			return address, nil
+		}
+		if err != nil {
+			return "", translateError(err)
+		}
+	}
+}
+
+// GetInvoiceRaw returns the invoice with the ID.
+func (mw *MultiWallet) GetInvoiceRaw(invoiceID int) (*Invoice, error) {
+	mw.invoicesMu.Lock()
+	var invoice Invoice
+	err := mw.db.One("ID", invoiceID, &invoice)
+	if err != nil {
+		mw.invoicesMu.Unlock()
+		if err == storm.ErrNotFound {
+			return nil, newError(ErrNotExist)
+		}
+		return nil, translateError(err)
+	}
+
+	updated := mw.refreshInvoice(&invoice)
+	mw.invoicesMu.Unlock()
+
+	mw.publishInvoiceUpdates(updated)
+	return &invoice, nil
+}
+
+// GetInvoice returns the result of GetInvoiceRaw as a JSON string.
+func (mw *MultiWallet) GetInvoice(invoiceID int) (string, error) {
+	invoice, err := mw.GetInvoiceRaw(invoiceID)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := json.Marshal(invoice)
+	if err != nil {
+		return "", translateError(err)
+	}
+	return string(result), nil
+}
+
+// GetInvoicesRaw returns the invoices of the wallet, or of all wallets if
+// walletID is 0, with the status, or with any status if status is
+// InvoiceStatusAll. The newest invoices come first.
+func (mw *MultiWallet) GetInvoicesRaw(walletID int, status int32) ([]*Invoice, error) {
+	mw.invoicesMu.Lock()
+	var invoices []*Invoice
+	err := mw.db.Select(q.True()).OrderBy("CreatedAt").Reverse().Find(&invoices)
+	if err != nil && err != storm.ErrNotFound {
+		mw.invoicesMu.Unlock()
+		return nil, translateError(err)
+	}
+
+	var updated []*Invoice
+	filtered := make([]*Invoice, 0, len(invoices))
+	for _, invoice := range invoices {
+		if walletID != 0 && invoice.WalletID != walletID {
+			continue
+		}
+
+		// statuses change with time, filter after the refresh
+		updated = append(updated, mw.refreshInvoice(invoice)...)
+		if status != InvoiceStatusAll && invoice.Status != status {
+			continue
+		}
+		filtered = append(filtered, invoice)
+	}
+	mw.invoicesMu.Unlock()
+
+	mw.publishInvoiceUpdates(updated)
+	return filtered, nil
+}
+
+// GetInvoices returns the result of GetInvoicesRaw as a JSON string.
+func (mw *MultiWallet) GetInvoices(walletID int, status int32) (string, error) {
+	invoices, err := mw.GetInvoicesRaw(walletID, status)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := json.Marshal(invoices)
+	if err != nil {
+		return "", translateError(err)
+	}
+	return string(result), nil
+}
+
+// DeleteInvoice stops tracking the invoice and deletes it.
+func (mw *MultiWallet) DeleteInvoice(invoiceID int) error {
+	mw.invoicesMu.Lock()
+	defer mw.invoicesMu.Unlock()
+
+	err := mw.db.DeleteStruct(&Invoice{ID: invoiceID})
+	if err == storm.ErrNotFound {
+		return newError(ErrNotExist)
+	}
+	return translateError(err)
+}
+
+func (mw *MultiWallet) deleteWalletInvoices(walletID int) {
+	mw.invoicesMu.Lock()
+	defer mw.invoicesMu.Unlock()
+
+	err := mw.db.Select(q.Eq("WalletID", walletID)).Delete(&Invoice{})
+	if err != nil && err != storm.ErrNotFound {
+		log.Errorf("[%d] Error deleting invoices: %v", walletID, err)
+	}
+}
+
+func (mw *MultiWallet) AddInvoiceNotificationListener(listener InvoiceNotificationListener, uniqueIdentifier string) error {
+	mw.invoiceListenersMu.Lock()
+	defer mw.invoiceListenersMu.Unlock()
+
+	if _, ok := mw.invoiceListeners[uniqueIdentifier]; ok {
+		return newError(ErrListenerAlreadyExist)
+	}
+
+	mw.invoiceListeners[uniqueIdentifier] = listener
+	return nil
+}
+
+func (mw *MultiWallet) RemoveInvoiceNotificationListener(uniqueIdentifier string) {
+	mw.invoiceListenersMu.Lock()
+	defer mw.invoiceListenersMu.Unlock()
+
+	delete(mw.invoiceListeners, uniqueIdentifier)
+}
+
+// publishInvoiceUpdates notifies the invoice listeners of the updated
+// invoices. It must be called without holding invoicesMu so that listeners
+// can read invoices.
+func (mw *MultiWallet) publishInvoiceUpdates(invoices []*Invoice) {
+	mw.invoiceListenersMu.RLock()
+	defer mw.invoiceListenersMu.RUnlock()
+
+	for _, invoice := range invoices {
+		for _, listener := range mw.invoiceListeners {
+			listener.OnInvoiceUpdated(invoice)
+		}
+	}
+}
+
+// trackInvoicePayments records the outputs of the wallet tx paying to
+// invoice addresses as payments of the invoices.
+func (mw *MultiWallet) trackInvoicePayments(walletID int, tx *Transaction) {
+	mw.invoicesMu.Lock()
+	updated := mw.recordInvoicePayments(walletID, tx)
+	mw.invoicesMu.Unlock()
+
+	mw.publishInvoiceUpdates(updated)
+}
+
+// recordInvoicePayments records the payments of the tx, it returns the
+// updated invoices. invoicesMu must be held.
+func (mw *MultiWallet) recordInvoicePayments(walletID int, tx *Transaction) (updated []*Invoice) {
+	paid := make(map[string]int64)
+	for _, output := range tx.Outputs {
+		if output.Address != "" {
+			paid[output.Address] += output.Amount
+		}
+	}
+
+	for address, amount := range paid {
+		var invoice Invoice
+		err := mw.db.One("Address", address, &invoice)
+		if err != nil {
+			if err != storm.ErrNotFound {
+				log.Errorf("Error reading invoice for %s: %v", address, err)
+			}
+			continue
+		}
+		if invoice.WalletID != walletID {
+			continue
+		}
+
+		payment := invoice.payment(tx.Hash)
+		if payment == nil {
+			payment = &InvoicePayment{TxHash: tx.Hash, Timestamp: tx.Timestamp}
+			invoice.Payments = append(invoice.Payments, payment)
+		} else if payment.Amount == amount && payment.BlockHeight == tx.BlockHeight {
+			continue
+		}
+		payment.Amount = amount
+		payment.BlockHeight = tx.BlockHeight
+
+		invoice.updateStatus(mw.walletBestBlock(walletID), time.Now().Unix())
+		if mw.saveInvoice(&invoice) {
+			updated = append(updated, &invoice)
+		}
+	}
+
+	return updated
+}
+
+// updateInvoices updates the confirmations and statuses of the unconfirmed
+// invoices of the wallet.
+func (mw *MultiWallet) updateInvoices(walletID int) {
+	mw.invoicesMu.Lock()
+	var invoices, updated []*Invoice
+	err := mw.db.Select(q.Eq("WalletID", walletID), q.Not(q.Eq("Status", InvoiceStatusConfirmed))).Find(&invoices)
+	if err != nil && err != storm.ErrNotFound {
+		log.Errorf("[%d] Error reading invoices: %v", walletID, err)
+	}
+	for _, invoice := range invoices {
+		updated = append(updated, mw.refreshInvoice(invoice)...)
+	}
+	mw.invoicesMu.Unlock()
+
+	mw.publishInvoiceUpdates(updated)
+}
+
+// checkInvoicePayments records the payments to the open invoices of the
+// wallet found in the tx index, catching up on payments made while the
+// wallet wasn't synced.
+func (mw *MultiWallet) checkInvoicePayments(wallet *Wallet) {
+	mw.restoreMu.RLock()
+	defer mw.restoreMu.RUnlock()
+
+	var invoice Invoice
+	query := mw.db.Select(q.Eq("WalletID", wallet.ID), q.In("Status", []int32{InvoiceStatusPending, InvoiceStatusPartiallyPaid, InvoiceStatusPaid}))
+	err := query.OrderBy("CreatedAt").First(&invoice)
+	if err != nil {
+		if err != storm.ErrNotFound {
+			log.Errorf("[%d] Error reading invoices: %v", wallet.ID, err)
+		}
+		return
+	}
+
+	var transactions []*Transaction
+	err = wallet.walletDataDB.Find(q.Gte("Timestamp", invoice.CreatedAt), &transactions)
+	if err != nil {
+		log.Errorf("[%d] Error reading transactions for invoices: %v", wallet.ID, err)
+		return
+	}
+
+	for _, tx := range transactions {
+		mw.trackInvoicePayments(wallet.ID, tx)
+	}
+	mw.updateInvoices(wallet.ID)
+}
+
+// refreshInvoice updates the status of the invoice with the wallet's best
+// block and the current time, saving the changes. It returns the invoice if
+// it was updated. invoicesMu must be held.
+func (mw *MultiWallet) refreshInvoice(invoice *Invoice) []*Invoice {
+	if invoice.updateStatus(mw.walletBestBlock(invoice.WalletID), time.Now().Unix()) && mw.saveInvoice(invoice) {
+		return []*Invoice{invoice}
+	}
+	return nil
+}
+
+func (mw *MultiWallet) saveInvoice(invoice *Invoice) bool {
+	invoice.UpdatedAt = time.Now().Unix()
+	err := mw.db.Save(invoice)
+	if err != nil {
+		log.Errorf("[%d] Error saving invoice %d: %v", invoice.WalletID, invoice.ID, err)
+		return false
+	}
+	return true
+}
+
+func (mw *MultiWallet) walletBestBlock(walletID int) int32 {
+	wallet := mw.WalletWithID(walletID)
+	if wallet == nil || !wallet.WalletOpened() {
+		return 0
+	}
+	return wallet.GetBestBlock()
+}
+
+func (invoice *Invoice) payment(txHash string) *InvoicePayment {
+	for _, payment := range invoice.Payments {
+		if payment.TxHash == txHash {
+			return payment
+		}
+	}
+	return nil
+}
+
+// updateStatus computes the received amount, confirmations and status of the
+// invoice and returns true if any changed. Confirmed and expired invoices keep
+// their status, payments made to expired invoices are still recorded.
+func (invoice *Invoice) updateStatus(bestBlock int32, now int64) bool {
+	var received int64
+	var confirmations int32 = -1
+	for _, payment := range invoice.Payments {
+		received += payment.Amount
+
+		var paymentConfirmations int32
+		if payment.BlockHeight > 0 && bestBlock >= payment.BlockHeight {
+			paymentConfirmations = bestBlock - payment.BlockHeight + 1
+		}
+		if confirmations == -1 || paymentConfirmations < confirmations {
+			confirmations = paymentConfirmations
+		}
+	}
+	if confirmations == -1 {
+		confirmations = 0
+	}
+
+	status := invoice.Status
+	switch {
+	case status == InvoiceStatusConfirmed || status == InvoiceStatusExpired:
+	case received >= invoice.Amount && confirmations >= invoice.RequiredConfirmations:
+		status = InvoiceStatusConfirmed
+	case received >= invoice.Amount:
+		status = InvoiceStatusPaid
+	case invoice.Expiry > 0 && now >= invoice.Expiry:
+		status = InvoiceStatusExpired
+	case received > 0:
+		status = InvoiceStatusPartiallyPaid
+	default:
+		status = InvoiceStatusPending
+	}
+
+	changed := status != invoice.Status || received != invoice.AmountReceived || confirmations != invoice.Confirmations
+	invoice.Status = status
+	invoice.AmountReceived = received
+	invoice.Confirmations = confirmations
+	return changed
+}
+
+// invoiceTracker updates invoices from the tx and block notifications of the
+// wallets.
+type invoiceTracker struct {
+	mw *MultiWallet
+}
+
+func (t *invoiceTracker) OnTransaction(transaction string) {
+	t.mw.restoreMu.RLock()
+	defer t.mw.restoreMu.RUnlock()
+
+	var tx Transaction
+	err := json.Unmarshal([]byte(transaction), &tx)
+	if err != nil {
+		log.Errorf("Error decoding tx for invoices: %v", err)
+		return
+	}
+
+	t.mw.trackInvoicePayments(tx.WalletID, &tx)
+}
+
+func (t *invoiceTracker) OnTransactionConfirmed(walletID int, hash string, blockHeight int32) {
+	t.mw.restoreMu.RLock()
+	defer t.mw.restoreMu.RUnlock()
+
+	wallet := t.mw.WalletWithID(walletID)
+	if wallet == nil {
+		return
+	}
+
+	var tx Transaction
+	err := wallet.walletDataDB.FindOne("Hash", hash, &tx)
+	if err != nil {
+		log.Errorf("[%d] Error reading tx %s for invoices: %v", walletID, hash, err)
+		return
+	}
+
+	t.mw.trackInvoicePayments(walletID, &tx)
+}
+
+func (t *invoiceTracker) OnBlockAttached(walletID int, blockHeight int32) {
+	t.mw.restoreMu.RLock()
+	defer t.mw.restoreMu.RUnlock()
+
+	t.mw.updateInvoices(walletID)
+}
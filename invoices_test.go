@@ -0,0 +1,119 @@
+package dcrlibwallet
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Invoices", func() {
+	Describe("updateStatus", func() {
+		const (
+			bestBlock = 100
+			now       = 1600000000
+		)
+
+		for _, test := range []struct {
+			name          string
+			status        int32
+			expiry        int64
+			payments      []*InvoicePayment
+			newStatus     int32
+			received      int64
+			confirmations int32
+		}{
+			{"pending invoices without payments", InvoiceStatusPending, 0, nil, InvoiceStatusPending, 0, 0},
+			{"pending invoices before their expiry", InvoiceStatusPending, now + 1, nil, InvoiceStatusPending, 0, 0},
+			{"partially paid invoices", InvoiceStatusPending, 0,
+				[]*InvoicePayment{{TxHash: "a", Amount: 40, BlockHeight: bestBlock}}, InvoiceStatusPartiallyPaid, 40, 1},
+			{"paid invoices with unmined payments", InvoiceStatusPending, 0,
+				[]*InvoicePayment{{TxHash: "a", Amount: 100, BlockHeight: -1}}, InvoiceStatusPaid, 100, 0},
+			{"paid invoices without enough confirmations", InvoiceStatusPartiallyPaid, 0,
+				[]*InvoicePayment{{TxHash: "a", Amount: 60, BlockHeight: 90}, {TxHash: "b", Amount: 60, BlockHeight: bestBlock}}, InvoiceStatusPaid, 120, 1},
+			{"confirmed invoices", InvoiceStatusPaid, 0,
+				[]*InvoicePayment{{TxHash: "a", Amount: 60, BlockHeight: 90}, {TxHash: "b", Amount: 40, BlockHeight: bestBlock - 1}}, InvoiceStatusConfirmed, 100, 2},
+			{"expired pending invoices", InvoiceStatusPending, now, nil, InvoiceStatusExpired, 0, 0},
+			{"expired partially paid invoices", InvoiceStatusPartiallyPaid, now - 1,
+				[]*InvoicePayment{{TxHash: "a", Amount: 40, BlockHeight: 90}}, InvoiceStatusExpired, 40, 11},
+			{"invoices paid before their expiry", InvoiceStatusPaid, now - 1,
+				[]*InvoicePayment{{TxHash: "a", Amount: 100, BlockHeight: -1}}, InvoiceStatusPaid, 100, 0},
+			{"payments to expired invoices", InvoiceStatusExpired, now - 1,
+				[]*InvoicePayment{{TxHash: "a", Amount: 100, BlockHeight: 90}}, InvoiceStatusExpired, 100, 11},
+			{"paid invoices whose payment was reorged out", InvoiceStatusPaid, 0,
+				[]*InvoicePayment{{TxHash: "a", Amount: 100, BlockHeight: -1}}, InvoiceStatusPaid, 100, 0},
+			{"paid invoices whose payment block is past the best block after a reorg", InvoiceStatusPaid, 0,
+				[]*InvoicePayment{{TxHash: "a", Amount: 100, BlockHeight: bestBlock + 1}}, InvoiceStatusPaid, 100, 0},
+			{"confirmed invoices whose payment was reorged out", InvoiceStatusConfirmed, 0,
+				[]*InvoicePayment{{TxHash: "a", Amount: 100, BlockHeight: -1}}, InvoiceStatusConfirmed, 100, 0},
+		} {
+			test := test
+			It("updates "+test.name, func() {
+				invoice := &Invoice{
+					Amount:                100,
+					Status:                test.status,
+					RequiredConfirmations: 2,
+					Expiry:                test.expiry,
+					Payments:              test.payments,
+				}
+
+				changed := invoice.updateStatus(bestBlock, now)
+				Expect(invoice.Status).To(Equal(test.newStatus))
+				Expect(invoice.AmountReceived).To(Equal(test.received))
+				Expect(invoice.Confirmations).To(Equal(test.confirmations))
+				Expect(changed).To(Equal(test.status != test.newStatus || test.received != 0 || test.confirmations != 0))
+
+				Expect(invoice.updateStatus(bestBlock, now)).To(BeFalse())
+			})
+		}
+	})
+
+	Describe("CreateInvoice", func() {
+		It("requests each invoice to a different address", func() {
+			mw, cleanup := newTestMultiWallet()
+			defer cleanup()
+
+			wallet := newTestWallet(mw, "invoices")
+			expiry := time.Now().Unix() + 3600
+
+			// more invoices than the gap limit of unused addresses
+			addresses := make(map[string]bool)
+			for i := 0; i < 30; i++ {
+				invoice, err := mw.CreateInvoice(wallet.ID, 0, 1e8, "label", "", expiry, 0)
+				Expect(err).To(BeNil())
+				Expect(addresses).NotTo(HaveKey(invoice.Address))
+				addresses[invoice.Address] = true
+
+				Expect(invoice.Status).To(Equal(InvoiceStatusPending))
+				Expect(invoice.RequiredConfirmations).To(Equal(DefaultInvoiceConfirmations))
+				Expect(invoice.URI).To(HavePrefix(PaymentURIScheme + ":" + invoice.Address + "?amount=1&"))
+			}
+
+			invoices, err := mw.GetInvoicesRaw(wallet.ID, InvoiceStatusPending)
+			Expect(err).To(BeNil())
+			Expect(invoices).To(HaveLen(30))
+		})
+
+		It("rejects invalid invoices", func() {
+			mw, cleanup := newTestMultiWallet()
+			defer cleanup()
+
+			wallet := newTestWallet(mw, "invoices")
+			for _, invoice := range []struct {
+				amount, expiry int64
+				confirmations  int32
+			}{
+				{0, 0, 0},
+				{MaxAmountAtom + 1, 0, 0},
+				{1, time.Now().Unix() - 1, 0},
+				{1, 0, -1},
+			} {
+				_, err := mw.CreateInvoice(wallet.ID, 0, invoice.amount, "", "", invoice.expiry, invoice.confirmations)
+				Expect(err).To(MatchError(ErrInvalid))
+			}
+
+			_, err := mw.CreateInvoice(wallet.ID+1, 0, 1, "", "", 0, 0)
+			Expect(err).To(MatchError(ErrNotExist))
+		})
+	})
+})
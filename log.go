@@ -8,6 +8,7 @@ package dcrlibwallet
 import (
 	"os"
 
+	"decred.org/dcrwallet/chain"
 	"decred.org/dcrwallet/errors"
 	"decred.org/dcrwallet/p2p"
 	"decred.org/dcrwallet/ticketbuyer"
@@ -67,6 +68,7 @@ func init() {
 	udb.UseLogger(walletLog)
 	ticketbuyer.UseLogger(tkbyLog)
 	spv.UseLogger(syncLog)
+	chain.UseLogger(syncLog)
 	p2p.UseLogger(syncLog)
 	connmgr.UseLogger(cmgrLog)
 	addrmgr.UseLogger(amgrLog)
@@ -107,6 +109,7 @@ func UseLoggers(main, loaderLog, walletLog, tkbyLog,
 	udb.UseLogger(walletLog)
 	ticketbuyer.UseLogger(tkbyLog)
 	spv.UseLogger(syncLog)
+	chain.UseLogger(syncLog)
 	p2p.UseLogger(syncLog)
 	connmgr.UseLogger(cmgrLog)
 	addrmgr.UseLogger(amgrLog)
@@ -120,11 +123,11 @@ func UseLogger(logger slog.Logger) {
 // RegisterLogger should be called before logRotator is initialized.
 func RegisterLogger(tag string) (slog.Logger, error) {
 	if logRotator != nil {
-		return nil, errors.E(ErrLogRotatorAlreadyInitialized)
+		return nil, newError(ErrLogRotatorAlreadyInitialized)
 	}
 
 	if _, exists := subsystemLoggers[tag]; exists {
-		return nil, errors.E(ErrLoggerAlreadyRegistered)
+		return nil, newError(ErrLoggerAlreadyRegistered)
 	}
 
 	logger := backendLog.Logger(tag)
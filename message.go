@@ -3,7 +3,6 @@ package dcrlibwallet
 import (
 	"time"
 
-	"decred.org/dcrwallet/errors"
 	w "decred.org/dcrwallet/wallet"
 	"github.com/decred/dcrd/dcrec"
 	"github.com/decred/dcrd/dcrutil/v3"
@@ -31,10 +30,10 @@ func (wallet *Wallet) SignMessage(passphrase []byte, address string, message str
 	case *dcrutil.AddressSecpPubKey:
 	case *dcrutil.AddressPubKeyHash:
 		if a.DSA() != dcrec.STEcdsaSecp256k1 {
-			return nil, errors.New(ErrInvalidAddress)
+			return nil, newError(ErrInvalidAddress)
 		}
 	default:
-		return nil, errors.New(ErrInvalidAddress)
+		return nil, newError(ErrInvalidAddress)
 	}
 
 	sig, err = wallet.internal.SignMessage(ctx, message, addr)
@@ -64,10 +63,10 @@ func (mw *MultiWallet) VerifyMessage(address string, message string, signatureBa
 	case *dcrutil.AddressSecpPubKey:
 	case *dcrutil.AddressPubKeyHash:
 		if a.DSA() != dcrec.STEcdsaSecp256k1 {
-			return false, errors.New(ErrInvalidAddress)
+			return false, newError(ErrInvalidAddress)
 		}
 	default:
-		return false, errors.New(ErrInvalidAddress)
+		return false, newError(ErrInvalidAddress)
 	}
 
 	valid, err = w.VerifyMessage(message, addr, signature, mw.chainParams)
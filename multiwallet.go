@@ -15,6 +15,7 @@ import (
 	"github.com/asdine/storm"
 	"github.com/asdine/storm/q"
 	"github.com/decred/dcrd/chaincfg/v3"
+	"github.com/planetdecred/dcrlibwallet/badgerdb"
 	"github.com/planetdecred/dcrlibwallet/utils"
 	"github.com/planetdecred/dcrlibwallet/walletdata"
 	bolt "go.etcd.io/bbolt"
@@ -27,18 +28,48 @@ type MultiWallet struct {
 	db       *storm.DB
 
 	chainParams *chaincfg.Params
-	wallets     map[int]*Wallet
 	syncData    *syncData
 
+	// walletsMu guards the changes to the wallets map, the background jobs
+	// read the wallets through AllWallets.
+	walletsMu sync.RWMutex
+	wallets   map[int]*Wallet
+
 	notificationListenersMu         sync.RWMutex
 	txAndBlockNotificationListeners map[string]TxAndBlockNotificationListener
 
 	blocksRescanProgressListener     BlocksRescanProgressListener
+	databaseMigrationListener        DatabaseMigrationProgressListener
 	accountMixerNotificationListener map[string]AccountMixerNotificationListener
 
 	shuttingDown chan bool
 	cancelFuncs  []context.CancelFunc
 
+	dbMaintenanceMu     sync.Mutex
+	cancelDbMaintenance context.CancelFunc
+	dbMaintenanceDone   chan struct{}
+
+	// restoreMu is held for writing by ImportBackup while it replaces the
+	// wallets and the wallets database. The database maintenance, the
+	// invoice tracker and the exchange rate code hold it for reading while
+	// they use them.
+	restoreMu sync.RWMutex
+
+	exchangeRates *exchangeRates
+
+	txFiatBackfillMu      sync.Mutex
+	txFiatBackfillRunning bool
+	txFiatBackfillAgain   bool
+
+	// txFiatMissingRates holds the keys of the hours the exchange rate
+	// source has no rate for, which are skipped by later backfills until
+	// the source changes.
+	txFiatMissingRates map[string]bool
+
+	invoicesMu         sync.Mutex
+	invoiceListenersMu sync.RWMutex
+	invoiceListeners   map[string]InvoiceNotificationListener
+
 	Politeia *Politeia
 }
 
@@ -61,12 +92,60 @@ func NewMultiWallet(rootDir, dbDriver, netType string) (*MultiWallet, error) {
 		return nil, errors.Errorf("failed to init logRotator: %v", err.Error())
 	}
 
+	mwDB, err := openWalletsDB(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	mw := &MultiWallet{
+		dbDriver:    dbDriver,
+		rootDir:     rootDir,
+		db:          mwDB,
+		chainParams: chainParams,
+		wallets:     make(map[int]*Wallet),
+		syncData: &syncData{
+			syncProgressListeners: make(map[string]SyncProgressListener),
+		},
+		txAndBlockNotificationListeners:  make(map[string]TxAndBlockNotificationListener),
+		accountMixerNotificationListener: make(map[string]AccountMixerNotificationListener),
+		invoiceListeners:                 make(map[string]InvoiceNotificationListener),
+	}
+
+	badgerdb.SetLowMemoryMode(mw.IsLowMemoryDatabaseMode())
+	mw.initExchangeRates()
+
+	// track invoice payments through tx and block notifications
+	mw.txAndBlockNotificationListeners[invoiceTrackerListenerID] = &invoiceTracker{mw: mw}
+
+	mw.Politeia, err = newPoliteia(mw)
+	if err != nil {
+		return nil, err
+	}
+
+	err = mw.loadWallets()
+	if err != nil {
+		return nil, err
+	}
+
+	mw.listenForShutdown()
+
+	logLevel := mw.ReadStringConfigValueForKey(LogLevelConfigKey)
+	SetLogLevels(logLevel)
+
+	log.Infof("Loaded %d wallets", mw.LoadedWalletsCount())
+
+	return mw, nil
+}
+
+// openWalletsDB opens the database holding the wallets info, config values
+// and proposals.
+func openWalletsDB(rootDir string) (*storm.DB, error) {
 	mwDB, err := storm.Open(filepath.Join(rootDir, walletsDbName))
 	if err != nil {
 		log.Errorf("Error opening wallets database: %s", err.Error())
 		if err == bolt.ErrTimeout {
 			// timeout error occurs if storm fails to acquire a lock on the database file
-			return nil, errors.E(ErrWalletDatabaseInUse)
+			return nil, newError(ErrWalletDatabaseInUse)
 		}
 		return nil, errors.Errorf("error opening wallets database: %s", err.Error())
 	}
@@ -85,49 +164,54 @@ func NewMultiWallet(rootDir, dbDriver, netType string) (*MultiWallet, error) {
 		return nil, err
 	}
 
-	mw := &MultiWallet{
-		dbDriver:    dbDriver,
-		rootDir:     rootDir,
-		db:          mwDB,
-		chainParams: chainParams,
-		wallets:     make(map[int]*Wallet),
-		syncData: &syncData{
-			syncProgressListeners: make(map[string]SyncProgressListener),
-		},
-		txAndBlockNotificationListeners:  make(map[string]TxAndBlockNotificationListener),
-		accountMixerNotificationListener: make(map[string]AccountMixerNotificationListener),
+	// init database for saving/reading invoices
+	err = mwDB.Init(&Invoice{})
+	if err != nil {
+		log.Errorf("Error initializing wallets database: %s", err.Error())
+		return nil, err
 	}
 
-	mw.Politeia, err = newPoliteia(mw)
+	// init database for saving/reading exchange rates
+	err = mwDB.Init(&ExchangeRate{})
 	if err != nil {
+		log.Errorf("Error initializing wallets database: %s", err.Error())
 		return nil, err
 	}
 
-	// read saved wallets info from db and initialize wallets
+	return mwDB, nil
+}
+
+// loadWallets reads the saved wallets info from db and prepares the wallets
+// for use.
+func (mw *MultiWallet) loadWallets() error {
 	query := mw.db.Select(q.True()).OrderBy("ID")
 	var wallets []*Wallet
-	err = query.Find(&wallets)
+	err := query.Find(&wallets)
 	if err != nil && err != storm.ErrNotFound {
-		return nil, err
+		return err
 	}
 
 	// prepare the wallets loaded from db for use
 	for _, wallet := range wallets {
-		err = wallet.prepare(rootDir, chainParams, mw.walletConfigSetFn(wallet.ID), mw.walletConfigReadFn(wallet.ID))
+		err = wallet.prepare(mw.rootDir, mw.chainParams, mw.walletConfigSetFn(wallet.ID), mw.walletConfigReadFn(wallet.ID), mw.exchangeRateAt)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		mw.wallets[wallet.ID] = wallet
-	}
 
-	mw.listenForShutdown()
-
-	logLevel := mw.ReadStringConfigValueForKey(LogLevelConfigKey)
-	SetLogLevels(logLevel)
+		// the app may have been killed while the wallet database was
+		// replaced by a migrated database
+		err = recoverDatabaseMigration(wallet)
+		if err != nil {
+			log.Errorf("[%d] Error recovering wallet database migration: %v", wallet.ID, err)
+			return err
+		}
 
-	log.Infof("Loaded %d wallets", mw.LoadedWalletsCount())
+		mw.walletsMu.Lock()
+		mw.wallets[wallet.ID] = wallet
+		mw.walletsMu.Unlock()
+	}
 
-	return mw, nil
+	return nil
 }
 
 func (mw *MultiWallet) Shutdown() {
@@ -172,7 +256,7 @@ func (mw *MultiWallet) VerifyStartupPassphrase(startupPassphrase []byte) error {
 	if startupPassphraseHash == nil {
 		// startup passphrase was not previously set
 		if len(startupPassphrase) > 0 {
-			return errors.E(ErrInvalidPassphrase)
+			return newError(ErrInvalidPassphrase)
 		}
 		return nil
 	}
@@ -180,7 +264,7 @@ func (mw *MultiWallet) VerifyStartupPassphrase(startupPassphrase []byte) error {
 	// startup passphrase was set, verify
 	err = bcrypt.CompareHashAndPassword(startupPassphraseHash, startupPassphrase)
 	if err != nil {
-		return errors.E(ErrInvalidPassphrase)
+		return newError(ErrInvalidPassphrase)
 	}
 
 	return nil
@@ -239,7 +323,7 @@ func (mw *MultiWallet) StartupSecurityType() int32 {
 
 func (mw *MultiWallet) OpenWallets(startupPassphrase []byte) error {
 	if mw.IsSyncing() {
-		return errors.New(ErrSyncAlreadyInProgress)
+		return newError(ErrSyncAlreadyInProgress)
 	}
 
 	err := mw.VerifyStartupPassphrase(startupPassphrase)
@@ -254,12 +338,14 @@ func (mw *MultiWallet) OpenWallets(startupPassphrase []byte) error {
 		}
 	}
 
+	mw.scheduleDatabaseMaintenance()
+
 	return nil
 }
 
 func (mw *MultiWallet) AllWalletsAreWatchOnly() (bool, error) {
 	if len(mw.wallets) == 0 {
-		return false, errors.New(ErrInvalid)
+		return false, newError(ErrInvalid)
 	}
 
 	for _, w := range mw.wallets {
@@ -279,7 +365,7 @@ func (mw *MultiWallet) CreateWatchOnlyWallet(walletName, extendedPublicKey strin
 	}
 
 	return mw.saveNewWallet(wallet, func() error {
-		err := wallet.prepare(mw.rootDir, mw.chainParams, mw.walletConfigSetFn(wallet.ID), mw.walletConfigReadFn(wallet.ID))
+		err := wallet.prepare(mw.rootDir, mw.chainParams, mw.walletConfigSetFn(wallet.ID), mw.walletConfigReadFn(wallet.ID), mw.exchangeRateAt)
 		if err != nil {
 			return err
 		}
@@ -307,7 +393,7 @@ func (mw *MultiWallet) CreateNewWallet(walletName, privatePassphrase string, pri
 	}
 
 	return mw.saveNewWallet(wallet, func() error {
-		err := wallet.prepare(mw.rootDir, mw.chainParams, mw.walletConfigSetFn(wallet.ID), mw.walletConfigReadFn(wallet.ID))
+		err := wallet.prepare(mw.rootDir, mw.chainParams, mw.walletConfigSetFn(wallet.ID), mw.walletConfigReadFn(wallet.ID), mw.exchangeRateAt)
 		if err != nil {
 			return err
 		}
@@ -326,7 +412,7 @@ func (mw *MultiWallet) RestoreWallet(walletName, seedMnemonic, privatePassphrase
 	}
 
 	return mw.saveNewWallet(wallet, func() error {
-		err := wallet.prepare(mw.rootDir, mw.chainParams, mw.walletConfigSetFn(wallet.ID), mw.walletConfigReadFn(wallet.ID))
+		err := wallet.prepare(mw.rootDir, mw.chainParams, mw.walletConfigSetFn(wallet.ID), mw.walletConfigReadFn(wallet.ID), mw.exchangeRateAt)
 		if err != nil {
 			return err
 		}
@@ -338,7 +424,7 @@ func (mw *MultiWallet) RestoreWallet(walletName, seedMnemonic, privatePassphrase
 func (mw *MultiWallet) LinkExistingWallet(walletName, walletDataDir, originalPubPass string, privatePassphraseType int32) (*Wallet, error) {
 	// check if `walletDataDir` contains wallet.db
 	if !WalletExistsAt(walletDataDir) {
-		return nil, errors.New(ErrNotExist)
+		return nil, newError(ErrNotExist)
 	}
 
 	ctx, _ := mw.contextWithShutdownCancel()
@@ -371,7 +457,7 @@ func (mw *MultiWallet) LinkExistingWallet(walletName, walletDataDir, originalPub
 
 		// prepare the wallet for use and open it
 		err := (func() error {
-			err := wallet.prepare(mw.rootDir, mw.chainParams, mw.walletConfigSetFn(wallet.ID), mw.walletConfigReadFn(wallet.ID))
+			err := wallet.prepare(mw.rootDir, mw.chainParams, mw.walletConfigSetFn(wallet.ID), mw.walletConfigReadFn(wallet.ID), mw.exchangeRateAt)
 			if err != nil {
 				return err
 			}
@@ -404,12 +490,12 @@ func (mw *MultiWallet) LinkExistingWallet(walletName, walletDataDir, originalPub
 // saveNewWallet performs the following tasks using a db batch operation to ensure
 // that db changes are rolled back if any of the steps below return an error.
 //
-// - saves the initial wallet info to mw.walletsDb to get a wallet id
-// - creates a data directory for the wallet using the auto-generated wallet id
-// - updates the initial wallet info with name, dataDir (created above), db driver
-//   and saves the updated info to mw.walletsDb
-// - calls the provided `setupWallet` function to perform any necessary creation,
-//   restoration or linking of the just saved wallet
+//   - saves the initial wallet info to mw.walletsDb to get a wallet id
+//   - creates a data directory for the wallet using the auto-generated wallet id
+//   - updates the initial wallet info with name, dataDir (created above), db driver
+//     and saves the updated info to mw.walletsDb
+//   - calls the provided `setupWallet` function to perform any necessary creation,
+//     restoration or linking of the just saved wallet
 //
 // IFF all the above operations succeed, the wallet info will be persisted to db
 // and the wallet will be added to `mw.wallets`.
@@ -418,13 +504,9 @@ func (mw *MultiWallet) saveNewWallet(wallet *Wallet, setupWallet func() error) (
 	if err != nil {
 		return nil, err
 	} else if exists {
-		return nil, errors.New(ErrExist)
+		return nil, newError(ErrExist)
 	}
 
-	if mw.IsConnectedToDecredNetwork() {
-		mw.CancelSync()
-		defer mw.SpvSync()
-	}
 	// Perform database save operations in batch transaction
 	// for automatic rollback if error occurs at any point.
 	err = mw.batchDbTransaction(func(db storm.Node) error {
@@ -468,25 +550,32 @@ func (mw *MultiWallet) saveNewWallet(wallet *Wallet, setupWallet func() error) (
 		return nil, translateError(err)
 	}
 
+	mw.walletsMu.Lock()
 	mw.wallets[wallet.ID] = wallet
+	mw.walletsMu.Unlock()
+
+	// sync the new wallet without restarting the sync of other wallets.
+	if err := mw.addWalletToSync(wallet); err != nil {
+		log.Errorf("[%d] error adding wallet to sync: %v", wallet.ID, err)
+	}
 
 	return wallet, nil
 }
 
 func (mw *MultiWallet) RenameWallet(walletID int, newName string) error {
 	if strings.HasPrefix(newName, "wallet-") {
-		return errors.E(ErrReservedWalletName)
+		return newError(ErrReservedWalletName)
 	}
 
 	if exists, err := mw.WalletNameExists(newName); err != nil {
 		return translateError(err)
 	} else if exists {
-		return errors.New(ErrExist)
+		return newError(ErrExist)
 	}
 
 	wallet := mw.WalletWithID(walletID)
 	if wallet == nil {
-		return errors.New(ErrInvalid)
+		return newError(ErrInvalid)
 	}
 
 	wallet.Name = newName
@@ -497,19 +586,23 @@ func (mw *MultiWallet) DeleteWallet(walletID int, privPass []byte) error {
 
 	wallet := mw.WalletWithID(walletID)
 	if wallet == nil {
-		return errors.New(ErrNotExist)
+		return newError(ErrNotExist)
 	}
 
-	if mw.IsConnectedToDecredNetwork() {
-		mw.CancelSync()
+	// stop syncing the wallet without restarting the sync of other wallets.
+	restartSync, err := mw.removeWalletFromSync(wallet)
+	if err != nil {
+		return translateError(err)
+	}
+	if restartSync {
 		defer func() {
-			if mw.OpenedWalletsCount() > 0 {
-				mw.SpvSync()
+			if len(mw.syncableWallets()) > 0 {
+				mw.Sync()
 			}
 		}()
 	}
 
-	err := wallet.deleteWallet(privPass)
+	err = wallet.deleteWallet(privPass)
 	if err != nil {
 		return translateError(err)
 	}
@@ -519,12 +612,19 @@ func (mw *MultiWallet) DeleteWallet(walletID int, privPass []byte) error {
 		return translateError(err)
 	}
 
+	mw.deleteWalletInvoices(walletID)
+
+	mw.walletsMu.Lock()
 	delete(mw.wallets, walletID)
+	mw.walletsMu.Unlock()
 
 	return nil
 }
 
 func (mw *MultiWallet) WalletWithID(walletID int) *Wallet {
+	mw.walletsMu.RLock()
+	defer mw.walletsMu.RUnlock()
+
 	if wallet, ok := mw.wallets[walletID]; ok {
 		return wallet
 	}
@@ -535,7 +635,7 @@ func (mw *MultiWallet) WalletWithID(walletID int) *Wallet {
 func (mw *MultiWallet) VerifySeedForWallet(walletID int, seedMnemonic string, privpass []byte) (bool, error) {
 	wallet := mw.WalletWithID(walletID)
 	if wallet == nil {
-		return false, errors.New(ErrNotExist)
+		return false, newError(ErrNotExist)
 	}
 
 	decryptedSeed, err := decryptWalletSeed(privpass, wallet.EncryptedSeed)
@@ -548,7 +648,7 @@ func (mw *MultiWallet) VerifySeedForWallet(walletID int, seedMnemonic string, pr
 		return true, translateError(mw.db.Save(wallet))
 	}
 
-	return false, errors.New(ErrInvalid)
+	return false, newError(ErrInvalid)
 }
 
 // NumWalletsNeedingSeedBackup returns the number of opened wallets whose seed haven't been verified.
@@ -599,7 +699,7 @@ func (mw *MultiWallet) SyncedWalletsCount() int32 {
 
 func (mw *MultiWallet) WalletNameExists(walletName string) (bool, error) {
 	if strings.HasPrefix(walletName, "wallet-") {
-		return false, errors.E(ErrReservedWalletName)
+		return false, newError(ErrReservedWalletName)
 	}
 
 	err := mw.db.One("Name", walletName, &Wallet{})
@@ -615,7 +715,7 @@ func (mw *MultiWallet) WalletNameExists(walletName string) (bool, error) {
 func (mw *MultiWallet) UnlockWallet(walletID int, privPass []byte) error {
 	wallet := mw.WalletWithID(walletID)
 	if wallet == nil {
-		return errors.New(ErrNotExist)
+		return newError(ErrNotExist)
 	}
 
 	return wallet.UnlockWallet(privPass)
@@ -624,19 +724,19 @@ func (mw *MultiWallet) UnlockWallet(walletID int, privPass []byte) error {
 // ChangePrivatePassphraseForWallet attempts to change the wallet's passphrase and re-encrypts the seed with the new passphrase.
 func (mw *MultiWallet) ChangePrivatePassphraseForWallet(walletID int, oldPrivatePassphrase, newPrivatePassphrase []byte, privatePassphraseType int32) error {
 	if privatePassphraseType != PassphraseTypePin && privatePassphraseType != PassphraseTypePass {
-		return errors.New(ErrInvalid)
+		return newError(ErrInvalid)
 	}
 
 	wallet := mw.WalletWithID(walletID)
 	if wallet == nil {
-		return errors.New(ErrInvalid)
+		return newError(ErrInvalid)
 	}
 
 	encryptedSeed := wallet.EncryptedSeed
 	if encryptedSeed != nil {
 		decryptedSeed, err := decryptWalletSeed(oldPrivatePassphrase, encryptedSeed)
 		if err != nil {
-			return err
+			return walletError(wallet.ID, "ChangePrivatePassphraseForWallet", err)
 		}
 
 		encryptedSeed, err = encryptWalletSeed(newPrivatePassphrase, decryptedSeed)
@@ -647,7 +747,7 @@ func (mw *MultiWallet) ChangePrivatePassphraseForWallet(walletID int, oldPrivate
 
 	err := wallet.changePrivatePassphrase(oldPrivatePassphrase, newPrivatePassphrase)
 	if err != nil {
-		return translateError(err)
+		return walletError(wallet.ID, "ChangePrivatePassphraseForWallet", err)
 	}
 
 	wallet.EncryptedSeed = encryptedSeed
@@ -660,10 +760,10 @@ func (mw *MultiWallet) ChangePrivatePassphraseForWallet(walletID int, oldPrivate
 		if err2 != nil {
 			log.Errorf("error undoing wallet passphrase change: %v", err2)
 			log.Errorf("error wallet passphrase was changed but passphrase type and newly encrypted seed could not be saved: %v", err)
-			return errors.New(ErrSavingWallet)
+			return newError(ErrSavingWallet)
 		}
 
-		return errors.New(ErrChangingPassphrase)
+		return newError(ErrChangingPassphrase)
 	}
 
 	return nil
@@ -0,0 +1,846 @@
+package dcrlibwallet
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"decred.org/dcrwallet/errors"
+	w "decred.org/dcrwallet/wallet"
+	"decred.org/dcrwallet/walletseed"
+	"github.com/asdine/storm"
+	"github.com/decred/dcrd/chaincfg/v3"
+	"github.com/decred/dcrd/hdkeychain/v3"
+	"github.com/planetdecred/dcrlibwallet/walletdata"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// backupMagic starts every file written by ExportBackup.
+	backupMagic = "dcrlwbak"
+
+	backupSaltSize        = 32
+	backupNoncePrefixSize = 16
+	backupChunkSize       = 64 << 10
+
+	// backupFinalChunk is set in the chunk counter of the nonce of the last
+	// chunk so that truncated backups are detected.
+	backupFinalChunk = 1 << 63
+
+	backupStagingDirName  = "restore"
+	backupRollbackDirName = "pre-restore"
+)
+
+// backupManifest is the first file of the archive written by ExportBackup.
+type backupManifest struct {
+	Version   int                 `json:"version"`
+	Network   string              `json:"network"`
+	CreatedAt int64               `json:"createdat"`
+	Wallets   []*backupWalletInfo `json:"wallets"`
+}
+
+// backupWalletInfo describes a wallet in a backup. AccountXpub is the
+// extended public key of the default account, used to verify restored wallet
+// databases and seeds.
+type backupWalletInfo struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	DbDriver    string `json:"dbdriver"`
+	AccountXpub string `json:"accountxpub"`
+}
+
+// ExportBackup writes an encrypted backup of every wallet of the MultiWallet to
+// filePath. The backup holds the wallet databases, the wallet data databases
+// and the wallets database with the config values and proposals. It is
+// encrypted and authenticated with a key derived from passphrase. All wallets
+// must be opened.
+func (mw *MultiWallet) ExportBackup(passphrase []byte, filePath string) error {
+	if len(passphrase) == 0 {
+		return newError(ErrPassphraseRequired)
+	}
+
+	// the wallets must not be replaced by ImportBackup during the export
+	mw.restoreMu.RLock()
+	defer mw.restoreMu.RUnlock()
+
+	manifest := &backupManifest{
+		Version:   BackupArchiveVersion,
+		Network:   mw.chainParams.Name,
+		CreatedAt: time.Now().Unix(),
+	}
+	wallets := mw.AllWallets()
+	for _, wallet := range wallets {
+		if !wallet.WalletOpened() {
+			return newError(ErrWalletNotLoaded)
+		}
+
+		xpub, err := wallet.internal.AccountXpub(wallet.shutdownContext(), 0)
+		if err != nil {
+			return translateError(err)
+		}
+
+		manifest.Wallets = append(manifest.Wallets, &backupWalletInfo{
+			ID:          wallet.ID,
+			Name:        wallet.Name,
+			DbDriver:    wallet.DbDriver,
+			AccountXpub: xpub.String(),
+		})
+	}
+
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return errors.E(errors.Encoding, err)
+	}
+
+	// write to a temporary file first to never leave a partial backup at
+	// filePath
+	tmpFilePath := filePath + ".tmp"
+	file, err := os.OpenFile(tmpFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	defer os.Remove(tmpFilePath)
+	defer file.Close()
+
+	encrypter, err := newBackupEncrypter(file, passphrase)
+	if err != nil {
+		return err
+	}
+
+	archive := tar.NewWriter(encrypter)
+
+	err = writeBackupFile(archive, backupManifestFileName, manifestBytes)
+	if err != nil {
+		return err
+	}
+
+	err = mw.writeBackupCopy(archive, walletsDbName, func(w io.Writer) error {
+		return mw.db.Bolt.View(func(tx *bolt.Tx) error {
+			_, err := tx.WriteTo(w)
+			return err
+		})
+	})
+	if err != nil {
+		return translateError(err)
+	}
+
+	for _, wallet := range wallets {
+		err = mw.writeBackupCopy(archive, backupFilePath(wallet.ID, backupWalletDbFileName), wallet.loader.CopyDatabase)
+		if err != nil {
+			return translateError(err)
+		}
+
+		err = mw.writeBackupCopy(archive, backupFilePath(wallet.ID, walletdata.DbName), wallet.walletDataDB.Backup)
+		if err != nil {
+			return translateError(err)
+		}
+	}
+
+	if err = archive.Close(); err != nil {
+		return errors.E(errors.IO, err)
+	}
+	if err = encrypter.Close(); err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return errors.E(errors.IO, err)
+	}
+
+	err = os.Rename(tmpFilePath, filePath)
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+
+	log.Infof("Exported backup of %d wallets", len(manifest.Wallets))
+	return nil
+}
+
+// ImportBackup replaces every wallet of the MultiWallet with the wallets of
+// the backup written by ExportBackup to filePath. The backup is decrypted and
+// verified before any wallet is replaced, and the replaced wallets are kept in
+// the pre-restore directory of the root directory.
+//
+// Restored wallets that still hold their seed, see VerifySeedForWallet, are
+// checked against it with VerifyWalletSeed if the seed decrypts with
+// privatePassphrase. The import fails with ErrInvalidBackup if a seed doesn't
+// match its wallet. Wallets without a seed or with another private passphrase
+// are only checked against the backup manifest.
+//
+// Sync is canceled and the restored wallets must be opened with OpenWallets
+// using the startup passphrase of the backup, if any.
+func (mw *MultiWallet) ImportBackup(passphrase []byte, filePath string, privatePassphrase []byte) error {
+	if len(passphrase) == 0 {
+		return newError(ErrPassphraseRequired)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	defer file.Close()
+
+	stagingDir := filepath.Join(mw.rootDir, backupStagingDirName)
+	err = os.RemoveAll(stagingDir)
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	manifest, err := mw.extractBackup(file, passphrase, stagingDir)
+	if err != nil {
+		return err
+	}
+
+	err = mw.verifyExtractedBackup(manifest, stagingDir, privatePassphrase)
+	if err != nil {
+		return err
+	}
+
+	mw.Politeia.StopSync()
+	mw.CancelRescan()
+	mw.CancelSync()
+	mw.stopDatabaseMaintenance()
+
+	// wait for the invoice tracker and the exchange rate code to stop using
+	// the wallets and the wallets database
+	mw.restoreMu.Lock()
+	defer mw.restoreMu.Unlock()
+
+	for _, wallet := range mw.wallets {
+		wallet.Shutdown()
+	}
+	mw.walletsMu.Lock()
+	mw.wallets = make(map[int]*Wallet)
+	mw.walletsMu.Unlock()
+
+	err = mw.db.Close()
+	if err != nil {
+		return translateError(err)
+	}
+
+	rollbackDir := filepath.Join(mw.rootDir, backupRollbackDirName)
+	err = mw.replaceWalletFiles(stagingDir, rollbackDir, manifest)
+	if err != nil {
+		log.Errorf("Error restoring backup: %v", err)
+
+		// put the replaced wallets back
+		rollbackErr := mw.replaceWalletFiles(rollbackDir, "", nil)
+		if rollbackErr != nil {
+			log.Errorf("Error rolling back backup restore: %v", rollbackErr)
+		}
+	}
+
+	db, openErr := openWalletsDB(mw.rootDir)
+	if openErr != nil {
+		return openErr
+	}
+	mw.db = db
+
+	if loadErr := mw.loadWallets(); loadErr != nil {
+		return loadErr
+	}
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+
+	log.Infof("Imported backup of %d wallets", len(manifest.Wallets))
+	return nil
+}
+
+// VerifyWalletSeed returns true if the default account of the wallet with the
+// provided ID derives from seedMnemonic, e.g. to check a wallet restored with
+// ImportBackup.
+func (mw *MultiWallet) VerifyWalletSeed(walletID int, seedMnemonic string) (bool, error) {
+	wallet := mw.WalletWithID(walletID)
+	if wallet == nil {
+		return false, newError(ErrNotExist)
+	}
+	if !wallet.WalletOpened() {
+		return false, newError(ErrWalletNotLoaded)
+	}
+	if wallet.IsWatchingOnlyWallet() {
+		return false, newError(ErrWalletIsWatchOnly)
+	}
+
+	return seedMatchesWallet(wallet.shutdownContext(), wallet.internal, wallet.chainParams, seedMnemonic)
+}
+
+// seedMatchesWallet returns true if the default account of the dcrwallet
+// wallet derives from seedMnemonic.
+func seedMatchesWallet(ctx context.Context, wallet *w.Wallet, chainParams *chaincfg.Params, seedMnemonic string) (bool, error) {
+	seed, err := walletseed.DecodeUserInput(seedMnemonic)
+	if err != nil {
+		return false, newError(ErrInvalid)
+	}
+	defer func() {
+		for i := range seed {
+			seed[i] = 0
+		}
+	}()
+
+	coinType, err := wallet.CoinType(ctx)
+	if err != nil {
+		return false, translateError(err)
+	}
+	xpub, err := wallet.AccountXpub(ctx, 0)
+	if err != nil {
+		return false, translateError(err)
+	}
+
+	seedXpub, err := accountXpubFromSeed(seed, chainParams, coinType, 0)
+	if err != nil {
+		return false, newError(ErrUnusableSeed)
+	}
+
+	return seedXpub == xpub.String(), nil
+}
+
+// accountXpubFromSeed derives the extended public key of the BIP0044 account
+// from seed.
+func accountXpubFromSeed(seed []byte, net hdkeychain.NetworkParams, coinType, account uint32) (string, error) {
+	key, err := hdkeychain.NewMaster(seed, net)
+	if err != nil {
+		return "", err
+	}
+	defer key.Zero()
+
+	for _, index := range []uint32{44, coinType, account} {
+		child, err := key.Child(index + hdkeychain.HardenedKeyStart)
+		if err != nil {
+			return "", err
+		}
+		key.Zero()
+		key = child
+	}
+
+	return key.Neuter().String(), nil
+}
+
+// extractBackup decrypts the backup read from r and extracts its files into
+// dir. Wallet databases are restored in the format of their driver.
+func (mw *MultiWallet) extractBackup(r io.Reader, passphrase []byte, dir string) (*backupManifest, error) {
+	decrypter, err := newBackupDecrypter(r, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	// report the reason decryption failed rather than its effect on the
+	// extraction
+	fail := func(err error) error {
+		if decrypter.err != nil {
+			return decrypter.err
+		}
+		return backupReadError(err)
+	}
+
+	archive := tar.NewReader(decrypter)
+
+	header, err := archive.Next()
+	if err != nil {
+		return nil, fail(err)
+	}
+	if header.Name != backupManifestFileName {
+		return nil, newError(ErrInvalidBackup)
+	}
+
+	manifest := new(backupManifest)
+	err = json.NewDecoder(archive).Decode(manifest)
+	if err != nil {
+		return nil, fail(err)
+	}
+	if manifest.Version != BackupArchiveVersion || manifest.Network != mw.chainParams.Name {
+		return nil, newError(ErrInvalidBackup)
+	}
+
+	drivers := make(map[int]string, len(manifest.Wallets))
+	for _, info := range manifest.Wallets {
+		drivers[info.ID] = info.DbDriver
+	}
+
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fail(err)
+		}
+
+		walletID, fileName, err := parseBackupFilePath(header.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		if walletID == 0 {
+			err = writeRestoredFile(filepath.Join(dir, fileName), archive)
+		} else if driver, ok := drivers[walletID]; !ok {
+			return nil, newError(ErrInvalidBackup)
+		} else if fileName == backupWalletDbFileName {
+			walletDir := filepath.Join(dir, strconv.Itoa(walletID))
+			err = initWalletLoader(mw.chainParams, walletDir, driver).RestoreDatabase(archive)
+		} else {
+			err = writeRestoredFile(filepath.Join(dir, strconv.Itoa(walletID), fileName), archive)
+		}
+		if err != nil {
+			return nil, fail(err)
+		}
+	}
+
+	// read up to the last chunk to detect truncated backups
+	_, err = io.Copy(ioutil.Discard, decrypter)
+	if err != nil {
+		return nil, fail(err)
+	}
+
+	return manifest, nil
+}
+
+// verifyExtractedBackup checks that every file of the backup was extracted
+// and that each wallet database opens with the default account recorded when
+// the backup was written, and derives from the wallet seed if it decrypts
+// with privatePassphrase.
+func (mw *MultiWallet) verifyExtractedBackup(manifest *backupManifest, dir string, privatePassphrase []byte) error {
+	if exists, _ := fileExists(filepath.Join(dir, walletsDbName)); !exists {
+		return newError(ErrInvalidBackup)
+	}
+
+	seeds, err := restoredWalletSeeds(filepath.Join(dir, walletsDbName), privatePassphrase)
+	if err != nil {
+		log.Errorf("Error reading restored wallets: %v", err)
+		return newError(ErrInvalidBackup)
+	}
+
+	ctx, cancel := mw.contextWithShutdownCancel()
+	defer cancel()
+
+	for _, info := range manifest.Wallets {
+		walletDir := filepath.Join(dir, strconv.Itoa(info.ID))
+		if exists, _ := fileExists(filepath.Join(walletDir, walletdata.DbName)); !exists {
+			return newError(ErrInvalidBackup)
+		}
+
+		err := verifyRestoredWalletDB(ctx, mw.chainParams, walletDir, info, seeds[info.ID])
+		if err != nil {
+			log.Errorf("[%d] Error verifying restored wallet: %v", info.ID, err)
+			return newError(ErrInvalidBackup)
+		}
+	}
+
+	return nil
+}
+
+// restoredWalletSeeds returns the seeds of the wallets in the wallets
+// database at dbPath that decrypt with privatePassphrase, keyed by wallet ID.
+func restoredWalletSeeds(dbPath string, privatePassphrase []byte) (map[int]string, error) {
+	seeds := make(map[int]string)
+	if len(privatePassphrase) == 0 {
+		return seeds, nil
+	}
+
+	db, err := storm.Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var wallets []*Wallet
+	err = db.All(&wallets)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, wallet := range wallets {
+		if wallet.EncryptedSeed == nil {
+			continue
+		}
+
+		seed, err := decryptWalletSeed(privatePassphrase, wallet.EncryptedSeed)
+		if err == nil {
+			seeds[wallet.ID] = seed
+		}
+	}
+	return seeds, nil
+}
+
+func verifyRestoredWalletDB(ctx context.Context, chainParams *chaincfg.Params, walletDir string, info *backupWalletInfo, seedMnemonic string) error {
+	walletLoader := initWalletLoader(chainParams, walletDir, info.DbDriver)
+	wallet, err := walletLoader.OpenExistingWallet(ctx, []byte(w.InsecurePubPassphrase))
+	if err != nil {
+		return err
+	}
+	defer walletLoader.UnloadWallet()
+
+	xpub, err := wallet.AccountXpub(ctx, 0)
+	if err != nil {
+		return err
+	}
+	if xpub.String() != info.AccountXpub {
+		return fmt.Errorf("account xpub mismatch")
+	}
+
+	if seedMnemonic == "" {
+		return nil
+	}
+	matches, err := seedMatchesWallet(ctx, wallet, chainParams, seedMnemonic)
+	if err != nil {
+		return err
+	}
+	if !matches {
+		return fmt.Errorf("wallet does not derive from its seed")
+	}
+	return nil
+}
+
+// replaceWalletFiles moves the wallets database and the wallet directories of
+// manifest from srcDir to the root directory. The files replaced are moved to
+// rollbackDir, unless it is empty. The wallet directories in srcDir are all
+// moved if manifest is nil.
+func (mw *MultiWallet) replaceWalletFiles(srcDir, rollbackDir string, manifest *backupManifest) error {
+	var names []string
+	if manifest != nil {
+		for _, info := range manifest.Wallets {
+			names = append(names, strconv.Itoa(info.ID))
+		}
+	} else {
+		entries, err := ioutil.ReadDir(srcDir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if _, err := strconv.Atoi(entry.Name()); err == nil && entry.IsDir() {
+				names = append(names, entry.Name())
+			}
+		}
+	}
+	names = append(names, walletsDbName)
+
+	if rollbackDir != "" {
+		err := os.RemoveAll(rollbackDir)
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(rollbackDir, 0700)
+		if err != nil {
+			return err
+		}
+
+		// move every existing wallet aside, not only those in the backup
+		entries, err := ioutil.ReadDir(mw.rootDir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			_, err := strconv.Atoi(entry.Name())
+			if (err == nil && entry.IsDir()) || entry.Name() == walletsDbName {
+				err = os.Rename(filepath.Join(mw.rootDir, entry.Name()), filepath.Join(rollbackDir, entry.Name()))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, name := range names {
+		destination := filepath.Join(mw.rootDir, name)
+		err := os.RemoveAll(destination)
+		if err != nil {
+			return err
+		}
+
+		err = os.Rename(filepath.Join(srcDir, name), destination)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// backupFilePath returns the path of the file of the wallet with the provided
+// ID in the archive written by ExportBackup.
+func backupFilePath(walletID int, fileName string) string {
+	return strconv.Itoa(walletID) + "/" + fileName
+}
+
+// parseBackupFilePath returns the wallet ID and file name of a path written
+// by backupFilePath, or a wallet ID of 0 for the wallets database. Other
+// paths are rejected to never extract files out of the staging directory.
+func parseBackupFilePath(path string) (walletID int, fileName string, err error) {
+	if path == walletsDbName {
+		return 0, path, nil
+	}
+
+	parts := strings.Split(path, "/")
+	if len(parts) == 2 && (parts[1] == backupWalletDbFileName || parts[1] == walletdata.DbName) {
+		walletID, err = strconv.Atoi(parts[0])
+		if err == nil && walletID > 0 && strconv.Itoa(walletID) == parts[0] {
+			return walletID, parts[1], nil
+		}
+	}
+
+	return 0, "", newError(ErrInvalidBackup)
+}
+
+func writeRestoredFile(filePath string, r io.Reader) error {
+	err := os.MkdirAll(filepath.Dir(filePath), 0700)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, r)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// backupReadError returns ErrInvalidBackup if err is caused by a malformed
+// backup.
+func backupReadError(err error) error {
+	switch err.(type) {
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return newError(ErrInvalidBackup)
+	}
+
+	switch {
+	case err == io.ErrUnexpectedEOF, err == tar.ErrHeader:
+		return newError(ErrInvalidBackup)
+	case IsErrorCode(err, ErrInvalidBackup), IsErrorCode(err, ErrInvalidPassphrase):
+		return err
+	}
+	return errors.E(errors.IO, err)
+}
+
+// deriveBackupKey derives the key encrypting a backup from passphrase using
+// scrypt.
+func deriveBackupKey(passphrase, salt []byte) (*[32]byte, error) {
+	const N, r, p = 1 << 15, 8, 1
+
+	hash, err := scrypt.Key(passphrase, salt, N, r, p, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	key := new([32]byte)
+	copy(key[:], hash)
+	return key, nil
+}
+
+// backupEncrypter encrypts the data written to it in chunks sealed with
+// secretbox. The nonce of each chunk holds the index of the chunk, so that
+// reordered chunks fail to open, and marks the last chunk.
+type backupEncrypter struct {
+	w       io.Writer
+	key     *[32]byte
+	nonce   [24]byte
+	counter uint64
+	buf     []byte
+}
+
+func newBackupEncrypter(w io.Writer, passphrase []byte) (*backupEncrypter, error) {
+	header := make([]byte, len(backupMagic)+1+backupSaltSize+backupNoncePrefixSize)
+	copy(header, backupMagic)
+	header[len(backupMagic)] = BackupArchiveVersion
+	salt := header[len(backupMagic)+1 : len(backupMagic)+1+backupSaltSize]
+	noncePrefix := header[len(backupMagic)+1+backupSaltSize:]
+
+	_, err := rand.Read(header[len(backupMagic)+1:])
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := deriveBackupKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = w.Write(header)
+	if err != nil {
+		return nil, errors.E(errors.IO, err)
+	}
+
+	e := &backupEncrypter{
+		w:   w,
+		key: key,
+		buf: make([]byte, 0, backupChunkSize),
+	}
+	copy(e.nonce[:], noncePrefix)
+	return e, nil
+}
+
+func (e *backupEncrypter) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+
+		// the last chunk is written by Close
+		if len(e.buf) == cap(e.buf) && len(p) > 0 {
+			if err := e.sealChunk(false); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close writes the last chunk. It doesn't close the underlying writer.
+func (e *backupEncrypter) Close() error {
+	return e.sealChunk(true)
+}
+
+func (e *backupEncrypter) sealChunk(final bool) error {
+	counter := e.counter
+	if final {
+		counter |= backupFinalChunk
+	}
+	binary.BigEndian.PutUint64(e.nonce[backupNoncePrefixSize:], counter)
+
+	sealed := secretbox.Seal(make([]byte, 4, 4+len(e.buf)+secretbox.Overhead), e.buf, &e.nonce, e.key)
+	binary.BigEndian.PutUint32(sealed, uint32(len(sealed)-4))
+
+	_, err := e.w.Write(sealed)
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+
+	e.counter++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+// backupDecrypter reads the data encrypted by backupEncrypter. Reads fail
+// with ErrInvalidBackup if the data was modified, reordered or truncated.
+type backupDecrypter struct {
+	r       io.Reader
+	key     *[32]byte
+	nonce   [24]byte
+	counter uint64
+	final   bool
+	buf     []byte
+	sealed  []byte
+
+	// err is the error returned by all reads after a chunk failed to be
+	// read, which is also reported by extractBackup instead of the errors
+	// of the readers of the decrypted data.
+	err error
+}
+
+func newBackupDecrypter(r io.Reader, passphrase []byte) (*backupDecrypter, error) {
+	header := make([]byte, len(backupMagic)+1+backupSaltSize+backupNoncePrefixSize)
+	_, err := io.ReadFull(r, header)
+	if err != nil || !bytes.Equal(header[:len(backupMagic)], []byte(backupMagic)) ||
+		header[len(backupMagic)] != BackupArchiveVersion {
+		return nil, newError(ErrInvalidBackup)
+	}
+
+	key, err := deriveBackupKey(passphrase, header[len(backupMagic)+1:len(backupMagic)+1+backupSaltSize])
+	if err != nil {
+		return nil, err
+	}
+
+	d := &backupDecrypter{
+		r:      r,
+		key:    key,
+		sealed: make([]byte, backupChunkSize+secretbox.Overhead),
+	}
+	copy(d.nonce[:], header[len(backupMagic)+1+backupSaltSize:])
+	return d, nil
+}
+
+func (d *backupDecrypter) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.final {
+			return 0, io.EOF
+		}
+		d.err = d.openChunk()
+	}
+
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *backupDecrypter) openChunk() error {
+	var size [4]byte
+	_, err := io.ReadFull(d.r, size[:])
+	if err != nil {
+		return backupReadError(unexpectedEOF(err))
+	}
+
+	sealedSize := binary.BigEndian.Uint32(size[:])
+	if sealedSize < secretbox.Overhead || int(sealedSize) > len(d.sealed) {
+		return newError(ErrInvalidBackup)
+	}
+	sealed := d.sealed[:sealedSize]
+	_, err = io.ReadFull(d.r, sealed)
+	if err != nil {
+		return backupReadError(unexpectedEOF(err))
+	}
+
+	for _, counter := range []uint64{d.counter, d.counter | backupFinalChunk} {
+		binary.BigEndian.PutUint64(d.nonce[backupNoncePrefixSize:], counter)
+
+		chunk, ok := secretbox.Open(nil, sealed, &d.nonce, d.key)
+		if ok {
+			d.buf = chunk
+			d.final = counter&backupFinalChunk != 0
+			d.counter++
+			return d.checkTrailingData()
+		}
+	}
+
+	// the first chunk only fails to open with a wrong passphrase, unless the
+	// backup was modified
+	if d.counter == 0 {
+		return newError(ErrInvalidPassphrase)
+	}
+	return newError(ErrInvalidBackup)
+}
+
+// checkTrailingData rejects data appended after the last chunk.
+func (d *backupDecrypter) checkTrailingData() error {
+	if !d.final {
+		return nil
+	}
+
+	var b [1]byte
+	n, err := d.r.Read(b[:])
+	if n > 0 {
+		return newError(ErrInvalidBackup)
+	}
+	if err != nil && err != io.EOF {
+		return errors.E(errors.IO, err)
+	}
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
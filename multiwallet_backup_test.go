@@ -0,0 +1,198 @@
+package dcrlibwallet
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MultiWallet backup", func() {
+	const backupPassphrase = "backup passphrase"
+
+	var mw *MultiWallet
+	var cleanup func()
+	var wallet *Wallet
+	var backupPath string
+
+	BeforeEach(func() {
+		mw, cleanup = newTestMultiWallet()
+		wallet = newTestWallet(mw, "backup")
+		backupPath = filepath.Join(mw.rootDir, "..", "wallets.backup")
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	accountXpub := func(wallet *Wallet) string {
+		xpub, err := wallet.internal.AccountXpub(context.Background(), 0)
+		ExpectWithOffset(1, err).To(BeNil())
+		return xpub.String()
+	}
+
+	// backupChunks returns the offsets of the encrypted chunks of the backup
+	// and the backup.
+	backupChunks := func() ([]int, []byte) {
+		backup, err := ioutil.ReadFile(backupPath)
+		ExpectWithOffset(1, err).To(BeNil())
+
+		var offsets []int
+		offset := len(backupMagic) + 1 + backupSaltSize + backupNoncePrefixSize
+		for offset < len(backup) {
+			offsets = append(offsets, offset)
+			offset += 4 + int(binary.BigEndian.Uint32(backup[offset:]))
+		}
+		ExpectWithOffset(1, offset).To(Equal(len(backup)))
+		return offsets, backup
+	}
+
+	expectWalletKept := func() {
+		ExpectWithOffset(1, mw.WalletWithID(wallet.ID)).To(Equal(wallet))
+		ExpectWithOffset(1, wallet.WalletOpened()).To(BeTrue())
+	}
+
+	It("restores the wallets and config", func() {
+		other := newTestWallet(mw, "other")
+		xpubs := map[int]string{wallet.ID: accountXpub(wallet), other.ID: accountXpub(other)}
+		wallet.SetStringConfigValueForKey("label", "before")
+
+		Expect(mw.ExportBackup(nil, backupPath)).To(MatchError(ErrPassphraseRequired))
+		Expect(mw.ExportBackup([]byte(backupPassphrase), backupPath)).To(Succeed())
+
+		By("Changing the wallets after the backup")
+		wallet.SetStringConfigValueForKey("label", "after")
+		Expect(mw.DeleteWallet(other.ID, []byte("passphrase"))).To(Succeed())
+		added := newTestWallet(mw, "added")
+
+		Expect(mw.ImportBackup([]byte(backupPassphrase), backupPath, []byte("passphrase"))).To(Succeed())
+		Expect(mw.OpenWallets(nil)).To(Succeed())
+
+		Expect(mw.LoadedWalletsCount()).To(Equal(int32(2)))
+		Expect(mw.WalletWithID(added.ID)).To(BeNil())
+		for id, xpub := range xpubs {
+			restored := mw.WalletWithID(id)
+			Expect(restored).ToNot(BeNil())
+			Expect(accountXpub(restored)).To(Equal(xpub))
+		}
+		Expect(mw.WalletWithID(wallet.ID).Name).To(Equal("backup"))
+		Expect(mw.WalletWithID(other.ID).Name).To(Equal("other"))
+		Expect(mw.WalletWithID(wallet.ID).ReadStringConfigValueForKey("label", "")).To(Equal("before"))
+
+		By("Keeping the replaced wallets")
+		entries, err := ioutil.ReadDir(filepath.Join(mw.rootDir, backupRollbackDirName))
+		Expect(err).To(BeNil())
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		Expect(names).To(ConsistOf(walletsDbName, filepath.Base(wallet.dataDir), filepath.Base(added.dataDir)))
+	})
+
+	It("rejects wrong passphrases", func() {
+		Expect(mw.ExportBackup([]byte(backupPassphrase), backupPath)).To(Succeed())
+
+		Expect(mw.ImportBackup(nil, backupPath, nil)).To(MatchError(ErrPassphraseRequired))
+		Expect(mw.ImportBackup([]byte("wrong"), backupPath, nil)).To(MatchError(ErrInvalidPassphrase))
+		expectWalletKept()
+	})
+
+	It("rejects modified backups", func() {
+		// make the backup span enough chunks regardless of the size of the
+		// databases
+		padding := make([]byte, 2*backupChunkSize)
+		_, err := rand.Read(padding)
+		Expect(err).To(BeNil())
+		wallet.SetStringConfigValueForKey("padding", hex.EncodeToString(padding))
+
+		Expect(mw.ExportBackup([]byte(backupPassphrase), backupPath)).To(Succeed())
+		offsets, backup := backupChunks()
+		Expect(len(offsets)).To(BeNumerically(">", 3))
+
+		importModified := func(modified []byte) error {
+			ExpectWithOffset(1, ioutil.WriteFile(backupPath, modified, 0600)).To(Succeed())
+			return mw.ImportBackup([]byte(backupPassphrase), backupPath, nil)
+		}
+
+		By("Truncating the last chunk")
+		Expect(importModified(backup[:len(backup)-1])).To(MatchError(ErrInvalidBackup))
+
+		By("Removing the last chunk")
+		Expect(importModified(backup[:offsets[len(offsets)-1]])).To(MatchError(ErrInvalidBackup))
+
+		By("Reordering chunks")
+		first, second := backup[offsets[1]:offsets[2]], backup[offsets[2]:offsets[3]]
+		Expect(len(first)).To(Equal(len(second)))
+		reordered := append([]byte(nil), backup...)
+		copy(reordered[offsets[1]:], second)
+		copy(reordered[offsets[2]:], first)
+		Expect(importModified(reordered)).To(MatchError(ErrInvalidBackup))
+
+		By("Modifying a chunk")
+		modified := append([]byte(nil), backup...)
+		modified[offsets[2]+100] ^= 1
+		Expect(importModified(modified)).To(MatchError(ErrInvalidBackup))
+
+		By("Appending data")
+		Expect(importModified(append(append([]byte(nil), backup...), 0))).To(MatchError(ErrInvalidBackup))
+
+		expectWalletKept()
+	})
+
+	It("rejects paths out of the restore directory", func() {
+		for _, path := range []string{"../wallets.db", "1/../../wallet.db", "01/wallet.db", "0/wallet.db",
+			"-1/wallet.db", "1/other.db", "1/2/wallet.db", "/1/wallet.db", "1\\..\\wallet.db"} {
+			_, _, err := parseBackupFilePath(path)
+			Expect(err).To(MatchError(ErrInvalidBackup), path)
+		}
+
+		walletID, fileName, err := parseBackupFilePath("12/wallet.db")
+		Expect(err).To(BeNil())
+		Expect(walletID).To(Equal(12))
+		Expect(fileName).To(Equal(backupWalletDbFileName))
+
+		By("Importing a backup with a file out of the restore directory")
+		file, err := os.Create(backupPath)
+		Expect(err).To(BeNil())
+		encrypter, err := newBackupEncrypter(file, []byte(backupPassphrase))
+		Expect(err).To(BeNil())
+		archive := tar.NewWriter(encrypter)
+		manifest, err := json.Marshal(&backupManifest{Version: BackupArchiveVersion, Network: mw.chainParams.Name})
+		Expect(err).To(BeNil())
+		Expect(writeBackupFile(archive, backupManifestFileName, manifest)).To(Succeed())
+		Expect(writeBackupFile(archive, "../escaped", []byte("escaped"))).To(Succeed())
+		Expect(archive.Close()).To(Succeed())
+		Expect(encrypter.Close()).To(Succeed())
+		Expect(file.Close()).To(Succeed())
+
+		Expect(mw.ImportBackup([]byte(backupPassphrase), backupPath, nil)).To(MatchError(ErrInvalidBackup))
+		_, err = os.Stat(filepath.Join(mw.rootDir, "escaped"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		expectWalletKept()
+	})
+
+	It("verifies restored wallets against their seed", func() {
+		By("Replacing the seed of the wallet")
+		otherSeed, err := GenerateSeed()
+		Expect(err).To(BeNil())
+		wallet.EncryptedSeed, err = encryptWalletSeed([]byte("passphrase"), otherSeed)
+		Expect(err).To(BeNil())
+		Expect(mw.db.Save(wallet)).To(Succeed())
+
+		Expect(mw.ExportBackup([]byte(backupPassphrase), backupPath)).To(Succeed())
+
+		Expect(mw.ImportBackup([]byte(backupPassphrase), backupPath, []byte("passphrase"))).To(MatchError(ErrInvalidBackup))
+		expectWalletKept()
+
+		By("Skipping seeds encrypted with other passphrases")
+		Expect(mw.ImportBackup([]byte(backupPassphrase), backupPath, []byte("other"))).To(Succeed())
+	})
+})
@@ -24,12 +24,29 @@ const (
 	SpvPersistentPeerAddressesConfigKey = "spv_peer_addresses"
 	UserAgentConfigKey                  = "user_agent"
 
+	DcrdRPCHostConfigKey = "dcrd_rpc_host"
+	DcrdRPCUserConfigKey = "dcrd_rpc_user"
+	DcrdRPCCertConfigKey = "dcrd_rpc_cert"
+
+	// DcrdRPCPassConfigKey held the dcrd RPC password in previous versions.
+	// The password is no longer saved, see SetDcrdRPCPassword.
+	DcrdRPCPassConfigKey = "dcrd_rpc_pass"
+
+	DataSaverConfigKey                = "data_saver"
+	DataSaverBlocksThresholdConfigKey = "data_saver_blocks_threshold"
+
+	SyncOnceMempoolGracePeriodConfigKey = "sync_once_mempool_grace_period"
+
 	PoliteiaNotificationConfigKey = "politeia_notification"
 
 	LastTxHashConfigKey = "last_tx_hash"
 
 	VSPHostConfigKey = "vsp_host"
 
+	CSPPServerConfigKey = "cspp_server"
+	CSPPCertConfigKey   = "cspp_cert"
+	CSPPProxyConfigKey  = "cspp_proxy"
+
 	PassphraseTypePin  int32 = 0
 	PassphraseTypePass int32 = 1
 )
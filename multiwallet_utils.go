@@ -2,10 +2,7 @@ package dcrlibwallet
 
 import (
 	"context"
-	"os"
-	"path/filepath"
 
-	"decred.org/dcrwallet/errors"
 	w "decred.org/dcrwallet/wallet"
 	"github.com/asdine/storm"
 	"github.com/kevinburke/nacl"
@@ -73,7 +70,7 @@ func (mw *MultiWallet) loadWalletTemporarily(ctx context.Context, walletDataDir,
 func (mw *MultiWallet) markWalletAsDiscoveredAccounts(walletID int) error {
 	wallet := mw.WalletWithID(walletID)
 	if wallet == nil {
-		return errors.New(ErrNotExist)
+		return newError(ErrNotExist)
 	}
 
 	log.Infof("Set discovered accounts = true for wallet %d", wallet.ID)
@@ -87,19 +84,14 @@ func (mw *MultiWallet) markWalletAsDiscoveredAccounts(walletID int) error {
 }
 
 // RootDirFileSizeInBytes returns the total directory size of
-// multiwallet's root directory in bytes.
+// multiwallet's root directory in bytes. See RootDirSizeRaw for a breakdown
+// per wallet and per database.
 func (mw *MultiWallet) RootDirFileSizeInBytes() (int64, error) {
-	var size int64
-	err := filepath.Walk(mw.rootDir, func(_ string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			size += info.Size()
-		}
-		return err
-	})
-	return size, err
+	size, err := mw.RootDirSizeRaw()
+	if err != nil {
+		return 0, err
+	}
+	return size.Total, nil
 }
 
 // naclLoadFromPass derives a nacl.Key from pass using scrypt.Key.
@@ -132,7 +124,7 @@ func decryptWalletSeed(pass []byte, encryptedSeed []byte) (string, error) {
 
 	decryptedSeed, err := secretbox.EasyOpen(encryptedSeed, key)
 	if err != nil {
-		return "", errors.New(ErrInvalidPassphrase)
+		return "", newError(ErrInvalidPassphrase)
 	}
 
 	return string(decryptedSeed), nil
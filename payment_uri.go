@@ -0,0 +1,246 @@
+package dcrlibwallet
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/decred/dcrd/chaincfg/v3"
+	"github.com/decred/dcrd/dcrutil/v3"
+)
+
+const (
+	PaymentURIScheme = "decred"
+
+	paymentURIAmountParam  = "amount"
+	paymentURILabelParam   = "label"
+	paymentURIMessageParam = "message"
+	paymentURIExpiryParam  = "expiry"
+
+	// paymentURIRequiredParamPrefix marks parameters that must be understood
+	// for the URI to be used, as in BIP 21.
+	paymentURIRequiredParamPrefix = "req-"
+)
+
+// BuildPaymentURI returns a decred: URI requesting a payment to the address,
+// such as decred:Dsa...?amount=1.5&label=Shop. The amount is in atoms and
+// the expiry is a unix timestamp. Zero amounts and expiries and empty labels
+// and messages are left out.
+func (mw *MultiWallet) BuildPaymentURI(address string, atomAmount int64, label, message string, expiry int64) (string, error) {
+	if !mw.IsAddressValid(address) {
+		return "", newError(ErrInvalidAddress)
+	}
+
+	return buildPaymentURI(&PaymentRequest{
+		Address: address,
+		Amount:  atomAmount,
+		Label:   label,
+		Message: message,
+		Expiry:  expiry,
+	})
+}
+
+func buildPaymentURI(request *PaymentRequest) (string, error) {
+	if request.Amount < 0 || request.Amount > MaxAmountAtom || request.Expiry < 0 {
+		return "", newError(ErrInvalid)
+	}
+
+	var params []string
+	addParam := func(name, value string) {
+		// spaces are encoded as %20 rather than + which not all parsers
+		// decode as a space
+		value = strings.Replace(url.QueryEscape(value), "+", "%20", -1)
+		params = append(params, name+"="+value)
+	}
+
+	if request.Amount > 0 {
+		addParam(paymentURIAmountParam, strconv.FormatFloat(AmountCoin(request.Amount), 'f', -1, 64))
+	}
+	if request.Label != "" {
+		addParam(paymentURILabelParam, request.Label)
+	}
+	if request.Message != "" {
+		addParam(paymentURIMessageParam, request.Message)
+	}
+	if request.Expiry > 0 {
+		addParam(paymentURIExpiryParam, strconv.FormatInt(request.Expiry, 10))
+	}
+
+	uri := PaymentURIScheme + ":" + request.Address
+	if len(params) > 0 {
+		uri += "?" + strings.Join(params, "&")
+	}
+	return uri, nil
+}
+
+// ParsePaymentURIRaw parses a decred: payment URI, or a bare address. The
+// address must be valid for the active network. Expired requests are parsed
+// without error, see PaymentRequest.IsExpired.
+func (mw *MultiWallet) ParsePaymentURIRaw(uri string) (*PaymentRequest, error) {
+	return parsePaymentURI(uri, mw.chainParams)
+}
+
+// ParsePaymentURI returns the result of ParsePaymentURIRaw as a JSON string.
+func (mw *MultiWallet) ParsePaymentURI(uri string) (string, error) {
+	request, err := mw.ParsePaymentURIRaw(uri)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := json.Marshal(request)
+	if err != nil {
+		return "", translateError(err)
+	}
+	return string(result), nil
+}
+
+func parsePaymentURI(uri string, chainParams *chaincfg.Params) (*PaymentRequest, error) {
+	uri = strings.TrimSpace(uri)
+
+	var address, query string
+	if i := strings.Index(uri, ":"); i >= 0 {
+		if !strings.EqualFold(uri[:i], PaymentURIScheme) {
+			return nil, newError(ErrInvalid)
+		}
+		address = strings.TrimPrefix(uri[i+1:], "//")
+	} else {
+		address = uri
+	}
+	if i := strings.Index(address, "?"); i >= 0 {
+		address, query = address[:i], address[i+1:]
+	}
+
+	if _, err := dcrutil.DecodeAddress(address, chainParams); err != nil {
+		return nil, newError(ErrInvalidAddress)
+	}
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, newError(ErrInvalid)
+	}
+
+	request := &PaymentRequest{Address: address}
+	for name, values := range params {
+		value := values[len(values)-1]
+
+		switch name {
+		case paymentURIAmountParam:
+			request.Amount, err = parsePaymentURIAmount(value)
+			if err != nil {
+				return nil, err
+			}
+
+		case paymentURILabelParam:
+			request.Label = value
+
+		case paymentURIMessageParam:
+			request.Message = value
+
+		case paymentURIExpiryParam:
+			request.Expiry, err = strconv.ParseInt(value, 10, 64)
+			if err != nil || request.Expiry < 0 {
+				return nil, newError(ErrInvalid)
+			}
+
+		default:
+			if strings.HasPrefix(name, paymentURIRequiredParamPrefix) {
+				// unknown required parameter
+				return nil, newError(ErrInvalid)
+			}
+		}
+	}
+
+	return request, nil
+}
+
+// parsePaymentURIAmount parses a DCR amount of at most 8 decimals, the
+// precision of an atom, to atoms.
+func parsePaymentURIAmount(value string) (int64, error) {
+	coins, decimals := value, ""
+	if i := strings.Index(value, "."); i >= 0 {
+		coins, decimals = value[:i], value[i+1:]
+	}
+	if coins == "" && decimals == "" || len(decimals) > 8 || !isDigits(coins) || !isDigits(decimals) {
+		return 0, newError(ErrInvalid)
+	}
+
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, newError(ErrInvalid)
+	}
+	atoms, err := dcrutil.NewAmount(amount)
+	if err != nil || int64(atoms) > MaxAmountAtom {
+		return 0, newError(ErrInvalid)
+	}
+	return int64(atoms), nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// IsExpired returns true if the request has an expiry in the past.
+func (request *PaymentRequest) IsExpired() bool {
+	return request.Expiry > 0 && time.Now().Unix() >= request.Expiry
+}
+
+// AddPaymentURI parses the payment URI and adds a send destination paying
+// the requested amount to the requested address, see AddSendDestination.
+// Requests without an amount are rejected with ErrInvalid and expired
+// requests with ErrExpired.
+func (tx *TxAuthor) AddPaymentURI(uri string) error {
+	request, err := parsePaymentURI(uri, tx.sourceWallet.chainParams)
+	if err != nil {
+		return err
+	}
+
+	if request.Amount == 0 {
+		return newError(ErrInvalid)
+	}
+	if request.IsExpired() {
+		return newError(ErrExpired)
+	}
+
+	return tx.AddSendDestination(request.Address, request.Amount, false)
+}
+
+// CurrentAddressURI returns a payment URI for the current address of the
+// account, see CurrentAddress and BuildPaymentURI.
+func (wallet *Wallet) CurrentAddressURI(account int32, atomAmount int64, label, message string, expiry int64) (string, error) {
+	address, err := wallet.CurrentAddress(account)
+	if err != nil {
+		return "", err
+	}
+
+	return buildPaymentURI(&PaymentRequest{
+		Address: address,
+		Amount:  atomAmount,
+		Label:   label,
+		Message: message,
+		Expiry:  expiry,
+	})
+}
+
+// NextAddressURI returns a payment URI for a new address of the account, see
+// NextAddress and BuildPaymentURI.
+func (wallet *Wallet) NextAddressURI(account int32, atomAmount int64, label, message string, expiry int64) (string, error) {
+	address, err := wallet.NextAddress(account)
+	if err != nil {
+		return "", err
+	}
+
+	return buildPaymentURI(&PaymentRequest{
+		Address: address,
+		Amount:  atomAmount,
+		Label:   label,
+		Message: message,
+		Expiry:  expiry,
+	})
+}
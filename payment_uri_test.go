@@ -0,0 +1,135 @@
+package dcrlibwallet
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/decred/dcrd/chaincfg/v3"
+	"github.com/decred/dcrd/dcrec"
+	"github.com/decred/dcrd/dcrutil/v3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// testAddress returns a pay to pubkey hash address of the network.
+func testAddress(params *chaincfg.Params) string {
+	address, err := dcrutil.NewAddressPubKeyHash(make([]byte, 20), params, dcrec.STEcdsaSecp256k1)
+	ExpectWithOffset(1, err).To(BeNil())
+	return address.Address()
+}
+
+var _ = Describe("Payment URIs", func() {
+	testnet := chaincfg.TestNet3Params()
+	address := testAddress(testnet)
+	mainnetAddress := testAddress(chaincfg.MainNetParams())
+
+	Describe("buildPaymentURI", func() {
+		for _, request := range []*PaymentRequest{
+			{Address: address},
+			{Address: address, Amount: 15e7},
+			{Address: address, Amount: 1},
+			{Address: address, Amount: MaxAmountAtom},
+			{Address: address, Amount: 123456789, Label: "Shop & Co", Message: "Order #12 = 100%+tax", Expiry: 1600000000},
+			{Address: address, Label: "café ☕"},
+		} {
+			request := request
+			It("round trips "+strconv.FormatInt(request.Amount, 10)+" atoms "+request.Label, func() {
+				uri, err := buildPaymentURI(request)
+				Expect(err).To(BeNil())
+
+				parsed, err := parsePaymentURI(uri, testnet)
+				Expect(err).To(BeNil())
+				Expect(parsed).To(Equal(request))
+			})
+		}
+
+		It("encodes the parameters", func() {
+			uri, err := buildPaymentURI(&PaymentRequest{Address: address, Amount: 15e7, Label: "a b&c", Expiry: 1})
+			Expect(err).To(BeNil())
+			Expect(uri).To(Equal("decred:" + address + "?amount=1.5&label=a%20b%26c&expiry=1"))
+
+			uri, err = buildPaymentURI(&PaymentRequest{Address: address})
+			Expect(err).To(BeNil())
+			Expect(uri).To(Equal("decred:" + address))
+		})
+
+		It("rejects invalid amounts and expiries", func() {
+			for _, request := range []*PaymentRequest{
+				{Address: address, Amount: -1},
+				{Address: address, Amount: MaxAmountAtom + 1},
+				{Address: address, Expiry: -1},
+			} {
+				_, err := buildPaymentURI(request)
+				Expect(err).To(MatchError(ErrInvalid))
+			}
+		})
+	})
+
+	Describe("parsePaymentURI", func() {
+		for _, test := range []struct {
+			name    string
+			uri     string
+			request *PaymentRequest
+			err     string
+		}{
+			{"a bare address", address, &PaymentRequest{Address: address}, ""},
+			{"an address with spaces around", " decred:" + address + "\n", &PaymentRequest{Address: address}, ""},
+			{"the decred:// form", "decred://" + address + "?amount=2", &PaymentRequest{Address: address, Amount: 2e8}, ""},
+			{"an upper case scheme", "DECRED:" + address + "?amount=0.00000001", &PaymentRequest{Address: address, Amount: 1}, ""},
+			{"amounts without integer digits", "decred:" + address + "?amount=.5", &PaymentRequest{Address: address, Amount: 5e7}, ""},
+			{"amounts without decimals", "decred:" + address + "?amount=5.", &PaymentRequest{Address: address, Amount: 5e8}, ""},
+			{"unknown optional parameters", "decred:" + address + "?foo=bar&label=x", &PaymentRequest{Address: address, Label: "x"}, ""},
+			{"expired requests", "decred:" + address + "?expiry=1", &PaymentRequest{Address: address, Expiry: 1}, ""},
+			{"other schemes", "bitcoin:" + address, nil, ErrInvalid},
+			{"more than 8 decimals", "decred:" + address + "?amount=0.123456789", nil, ErrInvalid},
+			{"exponents", "decred:" + address + "?amount=1e3", nil, ErrInvalid},
+			{"negative amounts", "decred:" + address + "?amount=-1", nil, ErrInvalid},
+			{"signed amounts", "decred:" + address + "?amount=+1", nil, ErrInvalid},
+			{"amounts without digits", "decred:" + address + "?amount=.", nil, ErrInvalid},
+			{"amounts over the supply", "decred:" + address + "?amount=21000001", nil, ErrInvalid},
+			{"invalid expiries", "decred:" + address + "?expiry=soon", nil, ErrInvalid},
+			{"negative expiries", "decred:" + address + "?expiry=-1", nil, ErrInvalid},
+			{"unknown required parameters", "decred:" + address + "?req-foo=bar", nil, ErrInvalid},
+			{"invalid queries", "decred:" + address + "?label=%zz", nil, ErrInvalid},
+			{"addresses of another network", "decred:" + mainnetAddress, nil, ErrInvalidAddress},
+			{"invalid addresses", "decred:Dsnotanaddress", nil, ErrInvalidAddress},
+		} {
+			test := test
+			It("parses "+test.name, func() {
+				request, err := parsePaymentURI(test.uri, testnet)
+				if test.err != "" {
+					Expect(err).To(MatchError(test.err))
+					return
+				}
+				Expect(err).To(BeNil())
+				Expect(request).To(Equal(test.request))
+			})
+		}
+
+		It("reports expired requests", func() {
+			Expect((&PaymentRequest{}).IsExpired()).To(BeFalse())
+			Expect((&PaymentRequest{Expiry: time.Now().Unix() - 1}).IsExpired()).To(BeTrue())
+			Expect((&PaymentRequest{Expiry: time.Now().Unix() + 60}).IsExpired()).To(BeFalse())
+		})
+	})
+
+	Describe("AddPaymentURI", func() {
+		It("adds a destination for requests with an amount that have not expired", func() {
+			mw, cleanup := newTestMultiWallet()
+			defer cleanup()
+
+			wallet := newTestWallet(mw, "paymenturi")
+			txAuthor, err := mw.NewUnsignedTx(wallet.ID, 0)
+			Expect(err).To(BeNil())
+
+			Expect(txAuthor.AddPaymentURI("decred:" + address)).To(MatchError(ErrInvalid))
+			Expect(txAuthor.AddPaymentURI("decred:" + address + "?amount=1&expiry=1")).To(MatchError(ErrExpired))
+			Expect(txAuthor.AddPaymentURI("decred:" + mainnetAddress + "?amount=1")).To(MatchError(ErrInvalidAddress))
+			Expect(txAuthor.destinations).To(BeEmpty())
+
+			expiry := strconv.FormatInt(time.Now().Unix()+60, 10)
+			Expect(txAuthor.AddPaymentURI("decred:" + address + "?amount=1.5&expiry=" + expiry)).To(Succeed())
+			Expect(txAuthor.destinations).To(Equal([]TransactionDestination{{Address: address, AtomAmount: 15e7}}))
+		})
+	})
+})
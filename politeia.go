@@ -9,6 +9,8 @@ import (
 	"decred.org/dcrwallet/errors"
 	"github.com/asdine/storm"
 	"github.com/asdine/storm/q"
+	"github.com/decred/dcrd/chaincfg/v3"
+	bolt "go.etcd.io/bbolt"
 )
 
 type Politeia struct {
@@ -17,8 +19,10 @@ type Politeia struct {
 	ctx                     context.Context
 	cancelSync              context.CancelFunc
 	client                  *politeiaClient
+	clients                 map[string]*politeiaClient
 	notificationListenersMu sync.RWMutex
 	notificationListeners   map[string]ProposalNotificationListener
+	voteRemindersMu         sync.Mutex
 }
 
 const (
@@ -38,6 +42,7 @@ func newPoliteia(mwRef *MultiWallet) (*Politeia, error) {
 	p := &Politeia{
 		mwRef:                 mwRef,
 		client:                nil,
+		clients:               make(map[string]*politeiaClient),
 		notificationListeners: make(map[string]ProposalNotificationListener),
 	}
 
@@ -184,6 +189,17 @@ func (p *Politeia) ClearSavedProposals() error {
 		return translateError(err)
 	}
 
+	err = p.clearProposalDetails()
+	if err != nil {
+		return translateError(err)
+	}
+
+	// the next sync must fetch the full inventory
+	err = p.mwRef.db.Delete(politeiaBucketName, politeiaSyncPointKey)
+	if err != nil && err != storm.ErrNotFound && err != bolt.ErrBucketNotFound {
+		return translateError(err)
+	}
+
 	return p.mwRef.db.Init(&Proposal{})
 }
 
@@ -200,3 +216,58 @@ func (p *Politeia) marshalResult(result interface{}, err error) (string, error)
 
 	return string(response), nil
 }
+
+// getClient returns the cached client for politeiaHost, or for the host of
+// the politeia sync or the last client used if politeiaHost is empty. A
+// client is created and cached if there is none for the host yet, using the
+// default politeia host of the network if no host is known. Caching clients
+// ensures that the server policy and session are only fetched once per host.
+func (p *Politeia) getClient(politeiaHost string) (*politeiaClient, error) {
+	p.mu.RLock()
+	if politeiaHost == "" && p.client != nil {
+		politeiaHost = p.client.host
+	}
+	client := p.cachedClient(politeiaHost)
+	p.mu.RUnlock()
+	if client != nil {
+		return client, nil
+	}
+
+	if politeiaHost == "" {
+		politeiaHost = PoliteiaTestnetHost
+		if p.mwRef.chainParams.Net == chaincfg.MainNetParams().Net {
+			politeiaHost = PoliteiaMainnetHost
+		}
+	}
+
+	client, err := p.newClient(politeiaHost)
+	if err != nil {
+		return nil, err
+	}
+	err = client.loadServerPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cached := p.cachedClient(politeiaHost); cached != nil {
+		return cached, nil
+	}
+	p.clients[politeiaHost] = client
+	if p.cancelSync == nil {
+		p.client = client
+	}
+	return client, nil
+}
+
+// cachedClient returns the client cached for host, if any. p.mu must be held.
+func (p *Politeia) cachedClient(host string) *politeiaClient {
+	if client := p.clients[host]; client != nil {
+		return client
+	}
+	if p.client != nil && p.client.host == host {
+		return p.client
+	}
+	return nil
+}
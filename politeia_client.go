@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	www "github.com/decred/politeia/politeiawww/api/www/v1"
@@ -19,7 +20,11 @@ type politeiaClient struct {
 	host       string
 	httpClient *http.Client
 
+	// mu protects the server policy and the session, which are shared by
+	// the politeia sync and the requests made for the app.
+	mu                 sync.RWMutex
 	policy             *www.PolicyReply
+	apiGeneration      int
 	csrfToken          string
 	cookies            []*http.Cookie
 	csrfTokenExpiresAt time.Time
@@ -37,13 +42,14 @@ const (
 	proposalDetailsPath  = "/proposals/"
 	batchProposalsPath   = "/proposals/batch"
 	batchVoteSummaryPath = "/proposals/batchvotesummary"
+	voteResultsPath      = "/votes"
+	commentsPath         = "/comments"
+	castVotesPath        = "/proposals/castvotes"
 )
 
-func newPoliteiaClient(host string) *politeiaClient {
+func newPoliteiaClient(host string, tlsConfig *tls.Config) *politeiaClient {
 	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
+		TLSClientConfig: tlsConfig,
 	}
 
 	httpClient := &http.Client{
@@ -57,6 +63,16 @@ func newPoliteiaClient(host string) *politeiaClient {
 	}
 }
 
+// unwrapPinningError returns the *CertificatePinningError wrapped by err, if
+// any, so that callers can tell pinning failures from other network errors.
+func unwrapPinningError(err error) error {
+	var pinningErr *CertificatePinningError
+	if errors.As(err, &pinningErr) {
+		return pinningErr
+	}
+	return err
+}
+
 func (c *politeiaClient) getRequestBody(method string, body interface{}) ([]byte, error) {
 	if body == nil {
 		return nil, nil
@@ -80,21 +96,34 @@ func (c *politeiaClient) getRequestBody(method string, body interface{}) ([]byte
 }
 
 func (c *politeiaClient) makeRequest(method, path string, body interface{}, dest interface{}) error {
+	return c.makeAPIRequest(method, apiPath+path, body, dest)
+}
+
+// makeAPIRequest sends a request to path, which includes the API route
+// prefix, e.g. /api/v1/policy.
+func (c *politeiaClient) makeAPIRequest(method, path string, body interface{}, dest interface{}) error {
+	_, _, err := c.makeConditionalAPIRequest(method, path, body, dest, "")
+	return err
+}
+
+// makeConditionalAPIRequest sends a request to path like makeAPIRequest. If
+// etag is not empty, the server is asked to only send the resource if its
+// entity tag changed. The entity tag of the resource sent by the server is
+// returned, along with true if the resource was not modified, in which case
+// dest is left unchanged.
+func (c *politeiaClient) makeConditionalAPIRequest(method, path string, body interface{}, dest interface{}, etag string) (string, bool, error) {
 	var err error
 	var requestBody []byte
 
-	if c.csrfToken == "" || time.Now().Unix() >= c.csrfTokenExpiresAt.Unix() {
-		_, err := c.version()
-		if err != nil {
-			return err
-		}
+	if err = c.ensureSession(); err != nil {
+		return "", false, err
 	}
 
-	route := c.host + apiPath + path
+	route := c.host + path
 	if body != nil {
 		requestBody, err = c.getRequestBody(method, body)
 		if err != nil {
-			return err
+			return "", false, err
 		}
 	}
 
@@ -105,40 +134,64 @@ func (c *politeiaClient) makeRequest(method, path string, body interface{}, dest
 	// Create http request
 	req, err := http.NewRequest(method, route, nil)
 	if err != nil {
-		return fmt.Errorf("error creating http request: %s", err.Error())
+		return "", false, fmt.Errorf("error creating http request: %s", err.Error())
 	}
 	if method == http.MethodPost && requestBody != nil {
 		req.Body = ioutil.NopCloser(bytes.NewReader(requestBody))
 	}
+	c.mu.RLock()
 	req.Header.Add(www.CsrfToken, c.csrfToken)
-
 	for _, cookie := range c.cookies {
 		req.AddCookie(cookie)
 	}
+	c.mu.RUnlock()
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
 
 	// Send request
 	r, err := c.httpClient.Do(req)
 	if err != nil {
-		return err
+		return "", false, unwrapPinningError(err)
 	}
 	defer func() {
 		r.Body.Close()
 	}()
 
+	if etag != "" && r.StatusCode == http.StatusNotModified {
+		return etag, true, nil
+	}
+
 	responseBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return err
+		return "", false, err
 	}
 
 	if r.StatusCode != http.StatusOK {
-		return c.handleError(r.StatusCode, responseBody)
+		return "", false, c.handleError(r.StatusCode, responseBody)
 	}
 
 	err = json.Unmarshal(responseBody, dest)
 	if err != nil {
-		return fmt.Errorf("error unmarshaling response: %s", err.Error())
+		return "", false, fmt.Errorf("error unmarshaling response: %s", err.Error())
 	}
 
+	return r.Header.Get("ETag"), false, nil
+}
+
+// ensureSession fetches the server version, which sets the CSRF token and
+// session cookies, if they were not fetched yet or have expired.
+func (c *politeiaClient) ensureSession() error {
+	c.mu.RLock()
+	expired := c.csrfToken == "" || time.Now().Unix() >= c.csrfTokenExpiresAt.Unix()
+	c.mu.RUnlock()
+
+	if expired {
+		_, err := c.version()
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -157,10 +210,17 @@ func (c *politeiaClient) handleError(statusCode int, responseBody []byte) error
 		}
 		return fmt.Errorf("unauthorized: %d", errResp.ErrorCode)
 	case http.StatusBadRequest:
-		var errResp www.ErrorReply
+		// The records API replies with a single error context string.
+		var errResp struct {
+			PluginID  string `json:"pluginid"`
+			ErrorCode int64  `json:"errorcode"`
+		}
 		if err := json.Unmarshal(responseBody, &errResp); err != nil {
 			return err
 		}
+		if errResp.PluginID != "" {
+			return fmt.Errorf("bad request: plugin %s error %d", errResp.PluginID, errResp.ErrorCode)
+		}
 		return fmt.Errorf("bad request: %d", errResp.ErrorCode)
 	}
 
@@ -173,37 +233,47 @@ func (c *politeiaClient) version() (*www.VersionReply, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error creating version request: %s", err.Error())
 	}
+	c.mu.RLock()
 	req.Header.Add(www.CsrfToken, c.csrfToken)
+	c.mu.RUnlock()
 
 	// Send request
 	r, err := c.httpClient.Do(req)
 	if err != nil {
+		if pinningErr := unwrapPinningError(err); pinningErr != err {
+			return nil, pinningErr
+		}
 		return nil, fmt.Errorf("error fetching politeia server version: %s", err.Error())
 	}
 	defer func() {
 		r.Body.Close()
 	}()
 
+	c.mu.Lock()
 	c.cookies = r.Cookies()
+	c.mu.Unlock()
 
 	responseBody := util.ConvertBodyToByteArray(r.Body, false)
 	if r.StatusCode != http.StatusOK {
 		return nil, c.handleError(r.StatusCode, responseBody)
 	}
 
-	var versionReply www.VersionReply
+	var versionReply politeiaVersionReply
 	err = json.Unmarshal(responseBody, &versionReply)
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshaling version response: %s", err.Error())
 	}
 
+	c.mu.Lock()
+	c.apiGeneration = versionReply.apiGeneration()
 	newCsrfToken := r.Header.Get(www.CsrfToken)
 	if newCsrfToken != "" {
 		c.csrfToken = newCsrfToken
 	}
 	c.csrfTokenExpiresAt = time.Now().Add(time.Hour * 23)
+	c.mu.Unlock()
 
-	return &versionReply, nil
+	return &versionReply.VersionReply, nil
 }
 
 func (c *politeiaClient) loadServerPolicy() error {
@@ -212,18 +282,40 @@ func (c *politeiaClient) loadServerPolicy() error {
 		return err
 	}
 
+	c.mu.Lock()
 	c.policy = &serverPolicy
+	c.mu.Unlock()
 
 	return nil
 }
 
+// loadedPolicy returns the server policy fetched with loadServerPolicy, or
+// nil if it was not fetched yet.
+func (c *politeiaClient) loadedPolicy() *www.PolicyReply {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.policy
+}
+
 func (c *politeiaClient) serverPolicy() (www.PolicyReply, error) {
+	if recordsAPI, err := c.usesRecordsAPI(); err != nil {
+		return www.PolicyReply{}, err
+	} else if recordsAPI {
+		return c.recordsServerPolicy(), nil
+	}
+
 	var policyReply www.PolicyReply
 	err := c.makeRequest(http.MethodGet, policyPath, nil, &policyReply)
 	return policyReply, err
 }
 
 func (c *politeiaClient) batchProposals(tokens []string) ([]Proposal, error) {
+	if recordsAPI, err := c.usesRecordsAPI(); err != nil {
+		return nil, err
+	} else if recordsAPI {
+		return c.recordsBatchProposals(tokens)
+	}
+
 	b, err := json.Marshal(&www.BatchProposals{Tokens: tokens})
 	if err != nil {
 		return nil, err
@@ -265,6 +357,11 @@ func (c *politeiaClient) batchProposals(tokens []string) ([]Proposal, error) {
 }
 
 func (c *politeiaClient) proposalDetails(token string) (*www.ProposalDetailsReply, error) {
+	if recordsAPI, err := c.usesRecordsAPI(); err != nil {
+		return nil, err
+	} else if recordsAPI {
+		return c.recordsProposalDetails(token, "")
+	}
 
 	route := proposalDetailsPath + token
 
@@ -277,18 +374,36 @@ func (c *politeiaClient) proposalDetails(token string) (*www.ProposalDetailsRepl
 	return &proposalDetailsReply, nil
 }
 
-func (c *politeiaClient) tokenInventory() (*www.TokenInventoryReply, error) {
+// tokenInventory fetches the token inventory if its entity tag is not etag,
+// which is ignored if empty. The entity tag of the inventory is returned with
+// the inventory, which is nil if it was not modified. The records API is
+// paginated and doesn't tag the inventory, so it is always fetched.
+func (c *politeiaClient) tokenInventory(etag string) (*www.TokenInventoryReply, string, error) {
+	if recordsAPI, err := c.usesRecordsAPI(); err != nil {
+		return nil, "", err
+	} else if recordsAPI {
+		tokenInventory, err := c.recordsTokenInventory()
+		return tokenInventory, "", err
+	}
+
 	var tokenInventoryReply www.TokenInventoryReply
 
-	err := c.makeRequest(http.MethodGet, tokenInventoryPath, nil, &tokenInventoryReply)
-	if err != nil {
-		return nil, err
+	etag, notModified, err := c.makeConditionalAPIRequest(http.MethodGet, apiPath+tokenInventoryPath,
+		nil, &tokenInventoryReply, etag)
+	if err != nil || notModified {
+		return nil, etag, err
 	}
 
-	return &tokenInventoryReply, nil
+	return &tokenInventoryReply, etag, nil
 }
 
 func (c *politeiaClient) batchVoteSummary(tokens []string) (map[string]www.VoteSummary, error) {
+	if recordsAPI, err := c.usesRecordsAPI(); err != nil {
+		return nil, err
+	} else if recordsAPI {
+		return c.recordsBatchVoteSummary(tokens)
+	}
+
 	b, err := json.Marshal(&www.BatchVoteSummary{Tokens: tokens})
 	if err != nil {
 		return nil, err
@@ -303,3 +418,79 @@ func (c *politeiaClient) batchVoteSummary(tokens []string) (map[string]www.VoteS
 
 	return batchVoteSummaryReply.Summaries, err
 }
+
+func (c *politeiaClient) voteResults(token string) (*www.VoteResultsReply, error) {
+	if recordsAPI, err := c.usesRecordsAPI(); err != nil {
+		return nil, err
+	} else if recordsAPI {
+		return c.recordsVoteResults(token)
+	}
+
+	route := proposalDetailsPath + token + voteResultsPath
+
+	var voteResultsReply www.VoteResultsReply
+	err := c.makeRequest(http.MethodGet, route, nil, &voteResultsReply)
+	if err != nil {
+		return nil, err
+	}
+
+	return &voteResultsReply, nil
+}
+
+func (c *politeiaClient) castVotes(votes []www.CastVote) ([]www.CastVoteReply, error) {
+	if recordsAPI, err := c.usesRecordsAPI(); err != nil {
+		return nil, err
+	} else if recordsAPI {
+		return c.recordsCastVotes(votes)
+	}
+
+	b, err := json.Marshal(&www.Ballot{Votes: votes})
+	if err != nil {
+		return nil, err
+	}
+
+	var ballotReply www.BallotReply
+
+	err = c.makeRequest(http.MethodPost, castVotesPath, b, &ballotReply)
+	if err != nil {
+		return nil, err
+	}
+
+	return ballotReply.Receipts, nil
+}
+
+func (c *politeiaClient) proposalVersionDetails(token, version string) (*www.ProposalDetailsReply, error) {
+	if recordsAPI, err := c.usesRecordsAPI(); err != nil {
+		return nil, err
+	} else if recordsAPI {
+		return c.recordsProposalDetails(token, version)
+	}
+
+	route := proposalDetailsPath + token + "?version=" + url.QueryEscape(version)
+
+	var proposalDetailsReply www.ProposalDetailsReply
+	err := c.makeRequest(http.MethodGet, route, nil, &proposalDetailsReply)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proposalDetailsReply, nil
+}
+
+func (c *politeiaClient) proposalComments(token string) ([]www.Comment, error) {
+	if recordsAPI, err := c.usesRecordsAPI(); err != nil {
+		return nil, err
+	} else if recordsAPI {
+		return c.recordsProposalComments(token)
+	}
+
+	route := proposalDetailsPath + token + commentsPath
+
+	var commentsReply www.GetCommentsReply
+	err := c.makeRequest(http.MethodGet, route, nil, &commentsReply)
+	if err != nil {
+		return nil, err
+	}
+
+	return commentsReply.Comments, nil
+}
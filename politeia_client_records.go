@@ -0,0 +1,487 @@
+package dcrlibwallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	cmv1 "github.com/decred/politeia/politeiawww/api/comments/v1"
+	piv1 "github.com/decred/politeia/politeiawww/api/pi/v1"
+	rcv1 "github.com/decred/politeia/politeiawww/api/records/v1"
+	tkv1 "github.com/decred/politeia/politeiawww/api/ticketvote/v1"
+	www "github.com/decred/politeia/politeiawww/api/www/v1"
+)
+
+const (
+	// politeiaAPILegacy identifies servers that only support the www v1
+	// proposal routes.
+	politeiaAPILegacy = iota
+
+	// politeiaAPIRecords identifies servers that serve proposals through
+	// the records, ticketvote and comments plugin APIs.
+	politeiaAPIRecords
+)
+
+// recordsAPIPath is prefixed onto the routes of the plugin APIs.
+const recordsAPIPath = "/api"
+
+// usermd plugin metadata streams of a record.
+const (
+	userMetadataPluginID         = "usermd"
+	userMetadataStreamID  uint32 = 1
+	statusChangesStreamID uint32 = 2
+)
+
+// politeiaVersionReply is the version reply of politeiawww. Servers that
+// support the plugin APIs list their routes in APIRoutes.
+type politeiaVersionReply struct {
+	www.VersionReply
+	APIRoutes []string `json:"apiroutes"`
+}
+
+func (v *politeiaVersionReply) apiGeneration() int {
+	var records, ticketvote bool
+	for _, route := range v.APIRoutes {
+		switch route {
+		case rcv1.APIRoute:
+			records = true
+		case tkv1.APIRoute:
+			ticketvote = true
+		}
+	}
+	if records && ticketvote {
+		return politeiaAPIRecords
+	}
+	return politeiaAPILegacy
+}
+
+// usesRecordsAPI probes the server version, if not done yet, and returns true
+// if proposals should be fetched using the plugin APIs.
+func (c *politeiaClient) usesRecordsAPI() (bool, error) {
+	if err := c.ensureSession(); err != nil {
+		return false, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.apiGeneration == politeiaAPIRecords, nil
+}
+
+func (c *politeiaClient) recordsRequest(apiRoute, route string, request, dest interface{}) error {
+	b, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	return c.makeAPIRequest(http.MethodPost, recordsAPIPath+apiRoute+route, b, dest)
+}
+
+// recordsServerPolicy returns a policy with the page size supported by all
+// the batched routes of the plugin APIs.
+func (c *politeiaClient) recordsServerPolicy() www.PolicyReply {
+	return www.PolicyReply{
+		ProposalListPageSize: uint(tkv1.SummariesPageSize),
+	}
+}
+
+func (c *politeiaClient) recordsTokenInventory() (*www.TokenInventoryReply, error) {
+	inventory := &www.TokenInventoryReply{}
+	// The statuses are fetched in a fixed order so that unauthorized
+	// proposals always come before authorized ones in the pre-vote tokens.
+	statuses := []struct {
+		status tkv1.VoteStatusT
+		tokens *[]string
+	}{
+		{tkv1.VoteStatusUnauthorized, &inventory.Pre},
+		{tkv1.VoteStatusAuthorized, &inventory.Pre},
+		{tkv1.VoteStatusStarted, &inventory.Active},
+		{tkv1.VoteStatusApproved, &inventory.Approved},
+		{tkv1.VoteStatusRejected, &inventory.Rejected},
+		{tkv1.VoteStatusIneligible, &inventory.Abandoned},
+	}
+
+	for _, s := range statuses {
+		status, tokens := s.status, s.tokens
+		statusName := tkv1.VoteStatuses[status]
+		for page := uint32(1); ; page++ {
+			var reply tkv1.InventoryReply
+			err := c.recordsRequest(tkv1.APIRoute, tkv1.RouteInventory,
+				tkv1.Inventory{Status: status, Page: page}, &reply)
+			if err != nil {
+				return nil, err
+			}
+
+			pageTokens := reply.Vetted[statusName]
+			*tokens = append(*tokens, pageTokens...)
+			if uint32(len(pageTokens)) < tkv1.InventoryPageSize {
+				break
+			}
+		}
+	}
+
+	return inventory, nil
+}
+
+func (c *politeiaClient) recordsBatchProposals(tokens []string) ([]Proposal, error) {
+	requests := make([]rcv1.RecordRequest, len(tokens))
+	for i, token := range tokens {
+		requests[i] = rcv1.RecordRequest{
+			Token:     token,
+			Filenames: []string{piv1.FileNameProposalMetadata},
+		}
+	}
+
+	var recordsReply rcv1.RecordsReply
+	err := c.recordsRequest(rcv1.APIRoute, rcv1.RouteRecords, rcv1.Records{Requests: requests}, &recordsReply)
+	if err != nil {
+		return nil, err
+	}
+
+	var countReply cmv1.CountReply
+	err = c.recordsRequest(cmv1.APIRoute, cmv1.RouteCount, cmv1.Count{Tokens: tokens}, &countReply)
+	if err != nil {
+		return nil, err
+	}
+
+	proposals := make([]Proposal, 0, len(recordsReply.Records))
+	for _, token := range tokens {
+		record, ok := recordsReply.Records[token]
+		if !ok {
+			continue
+		}
+
+		proposalRecord := convertRecord(record)
+		proposals = append(proposals, Proposal{
+			Token:       proposalRecord.CensorshipRecord.Token,
+			Name:        proposalRecord.Name,
+			State:       int32(proposalRecord.State),
+			Status:      int32(proposalRecord.Status),
+			Timestamp:   proposalRecord.Timestamp,
+			UserID:      proposalRecord.UserId,
+			Username:    proposalRecord.Username,
+			NumComments: int32(countReply.Counts[token]),
+			Version:     proposalRecord.Version,
+			PublishedAt: proposalRecord.PublishedAt,
+		})
+	}
+
+	return proposals, nil
+}
+
+func (c *politeiaClient) recordsProposalDetails(token, version string) (*www.ProposalDetailsReply, error) {
+	details := rcv1.Details{Token: token}
+	if version != "" {
+		v, err := strconv.ParseUint(version, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proposal version %q", version)
+		}
+		details.Version = uint32(v)
+	}
+
+	var detailsReply rcv1.DetailsReply
+	err := c.recordsRequest(rcv1.APIRoute, rcv1.RouteDetails, details, &detailsReply)
+	if err != nil {
+		return nil, err
+	}
+
+	return &www.ProposalDetailsReply{Proposal: convertRecord(detailsReply.Record)}, nil
+}
+
+func (c *politeiaClient) recordsBatchVoteSummary(tokens []string) (map[string]www.VoteSummary, error) {
+	var summariesReply tkv1.SummariesReply
+	err := c.recordsRequest(tkv1.APIRoute, tkv1.RouteSummaries, tkv1.Summaries{Tokens: tokens}, &summariesReply)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make(map[string]www.VoteSummary, len(summariesReply.Summaries))
+	for token, summary := range summariesReply.Summaries {
+		results := make([]www.VoteOptionResult, len(summary.Results))
+		for i, result := range summary.Results {
+			results[i] = www.VoteOptionResult{
+				Option: www.VoteOption{
+					Id:          result.ID,
+					Description: result.Description,
+					Bits:        result.VoteBit,
+				},
+				VotesReceived: result.Votes,
+			}
+		}
+
+		summaries[token] = www.VoteSummary{
+			Status:           convertVoteStatus(summary.Status),
+			Approved:         summary.Status == tkv1.VoteStatusApproved,
+			Type:             www.VoteT(summary.Type),
+			EligibleTickets:  summary.EligibleTickets,
+			Duration:         summary.Duration,
+			EndHeight:        uint64(summary.EndBlockHeight),
+			QuorumPercentage: summary.QuorumPercentage,
+			PassPercentage:   summary.PassPercentage,
+			Results:          results,
+		}
+	}
+
+	return summaries, nil
+}
+
+func (c *politeiaClient) recordsVoteResults(token string) (*www.VoteResultsReply, error) {
+	var detailsReply tkv1.DetailsReply
+	err := c.recordsRequest(tkv1.APIRoute, tkv1.RouteDetails, tkv1.Details{Token: token}, &detailsReply)
+	if err != nil {
+		return nil, err
+	}
+
+	var resultsReply tkv1.ResultsReply
+	err = c.recordsRequest(tkv1.APIRoute, tkv1.RouteResults, tkv1.Results{Token: token}, &resultsReply)
+	if err != nil {
+		return nil, err
+	}
+
+	voteResults := &www.VoteResultsReply{
+		CastVotes: make([]www.CastVote, len(resultsReply.Votes)),
+	}
+	for i, vote := range resultsReply.Votes {
+		voteResults.CastVotes[i] = www.CastVote{
+			Token:     vote.Token,
+			Ticket:    vote.Ticket,
+			VoteBit:   vote.VoteBit,
+			Signature: vote.Signature,
+		}
+	}
+
+	// The vote details are nil if the vote has not started.
+	if vote := detailsReply.Vote; vote != nil {
+		options := make([]www.VoteOption, len(vote.Params.Options))
+		for i, option := range vote.Params.Options {
+			options[i] = www.VoteOption{
+				Id:          option.ID,
+				Description: option.Description,
+				Bits:        option.Bit,
+			}
+		}
+
+		voteResults.StartVote = www.StartVote{
+			PublicKey: vote.PublicKey,
+			Signature: vote.Signature,
+			Vote: www.Vote{
+				Token:            vote.Params.Token,
+				Mask:             vote.Params.Mask,
+				Duration:         vote.Params.Duration,
+				QuorumPercentage: vote.Params.QuorumPercentage,
+				PassPercentage:   vote.Params.PassPercentage,
+				Options:          options,
+			},
+		}
+		voteResults.StartVoteReply = www.StartVoteReply{
+			StartBlockHeight: strconv.FormatUint(uint64(vote.StartBlockHeight), 10),
+			StartBlockHash:   vote.StartBlockHash,
+			EndHeight:        strconv.FormatUint(uint64(vote.EndBlockHeight), 10),
+			EligibleTickets:  vote.EligibleTickets,
+		}
+	}
+
+	return voteResults, nil
+}
+
+func (c *politeiaClient) recordsCastVotes(votes []www.CastVote) ([]www.CastVoteReply, error) {
+	ballot := tkv1.CastBallot{
+		Votes: make([]tkv1.CastVote, len(votes)),
+	}
+	for i, vote := range votes {
+		ballot.Votes[i] = tkv1.CastVote{
+			Token:     vote.Token,
+			Ticket:    vote.Ticket,
+			VoteBit:   vote.VoteBit,
+			Signature: vote.Signature,
+		}
+	}
+
+	var ballotReply tkv1.CastBallotReply
+	err := c.recordsRequest(tkv1.APIRoute, tkv1.RouteCastBallot, ballot, &ballotReply)
+	if err != nil {
+		return nil, err
+	}
+
+	// Receipts are matched to votes by ticket, in the order of votes.
+	receiptsByTicket := make(map[string]tkv1.CastVoteReply, len(ballotReply.Receipts))
+	for _, receipt := range ballotReply.Receipts {
+		receiptsByTicket[receipt.Ticket] = receipt
+	}
+
+	receipts := make([]www.CastVoteReply, len(votes))
+	for i, vote := range votes {
+		receipt, ok := receiptsByTicket[vote.Ticket]
+		if !ok {
+			receipts[i] = www.CastVoteReply{
+				ClientSignature: vote.Signature,
+				Error:           "no receipt for vote",
+			}
+			continue
+		}
+
+		receipts[i] = www.CastVoteReply{
+			ClientSignature: vote.Signature,
+			Signature:       receipt.Receipt,
+		}
+		if receipt.ErrorCode != tkv1.VoteErrorInvalid {
+			receipts[i].Error = fmt.Sprintf("vote error %d: %s", receipt.ErrorCode, receipt.ErrorContext)
+		}
+	}
+
+	return receipts, nil
+}
+
+func (c *politeiaClient) recordsProposalComments(token string) ([]www.Comment, error) {
+	var commentsReply cmv1.CommentsReply
+	err := c.recordsRequest(cmv1.APIRoute, cmv1.RouteComments, cmv1.Comments{Token: token}, &commentsReply)
+	if err != nil {
+		return nil, err
+	}
+
+	comments := make([]www.Comment, len(commentsReply.Comments))
+	for i, comment := range commentsReply.Comments {
+		comments[i] = www.Comment{
+			Token:       comment.Token,
+			ParentID:    strconv.FormatUint(uint64(comment.ParentID), 10),
+			Comment:     comment.Comment,
+			Signature:   comment.Signature,
+			PublicKey:   comment.PublicKey,
+			CommentID:   strconv.FormatUint(uint64(comment.CommentID), 10),
+			Receipt:     comment.Receipt,
+			Timestamp:   comment.Timestamp,
+			ResultVotes: int64(comment.Upvotes) - int64(comment.Downvotes),
+			Upvotes:     comment.Upvotes,
+			Downvotes:   comment.Downvotes,
+			Censored:    comment.Deleted,
+			UserID:      comment.UserID,
+			Username:    comment.Username,
+		}
+	}
+
+	return comments, nil
+}
+
+// convertRecord converts a proposal record of the records API to the www v1
+// proposal record used by the rest of the package.
+func convertRecord(record rcv1.Record) www.ProposalRecord {
+	proposalRecord := www.ProposalRecord{
+		State:     convertRecordState(record.State),
+		Status:    convertRecordStatus(record.Status),
+		Timestamp: record.Timestamp,
+		Username:  record.Username,
+		Version:   strconv.FormatUint(uint64(record.Version), 10),
+		CensorshipRecord: www.CensorshipRecord{
+			Token:     record.CensorshipRecord.Token,
+			Merkle:    record.CensorshipRecord.Merkle,
+			Signature: record.CensorshipRecord.Signature,
+		},
+	}
+
+	for _, file := range record.Files {
+		if file.Name == piv1.FileNameProposalMetadata {
+			b, err := DecodeBase64(file.Payload)
+			if err != nil {
+				log.Errorf("Politeia: invalid metadata of proposal %s: %v", record.CensorshipRecord.Token, err)
+				continue
+			}
+			var metadata piv1.ProposalMetadata
+			if err := json.Unmarshal(b, &metadata); err != nil {
+				log.Errorf("Politeia: invalid metadata of proposal %s: %v", record.CensorshipRecord.Token, err)
+				continue
+			}
+			proposalRecord.Name = metadata.Name
+		}
+
+		proposalRecord.Files = append(proposalRecord.Files, www.File{
+			Name:    file.Name,
+			MIME:    file.MIME,
+			Digest:  file.Digest,
+			Payload: file.Payload,
+		})
+	}
+
+	for _, stream := range record.Metadata {
+		if stream.PluginID != userMetadataPluginID {
+			continue
+		}
+
+		switch stream.StreamID {
+		case userMetadataStreamID:
+			var userMetadata rcv1.UserMetadata
+			if err := json.Unmarshal([]byte(stream.Payload), &userMetadata); err == nil {
+				proposalRecord.UserId = userMetadata.UserID
+				proposalRecord.PublicKey = userMetadata.PublicKey
+				proposalRecord.Signature = userMetadata.Signature
+			}
+		case statusChangesStreamID:
+			// Status changes are appended to the stream as
+			// consecutive JSON objects.
+			decoder := json.NewDecoder(strings.NewReader(stream.Payload))
+			for {
+				var statusChange rcv1.StatusChange
+				err := decoder.Decode(&statusChange)
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					log.Errorf("Politeia: invalid status changes of proposal %s: %v",
+						record.CensorshipRecord.Token, err)
+					break
+				}
+
+				switch statusChange.Status {
+				case rcv1.RecordStatusPublic:
+					proposalRecord.PublishedAt = statusChange.Timestamp
+				case rcv1.RecordStatusCensored:
+					proposalRecord.CensoredAt = statusChange.Timestamp
+				case rcv1.RecordStatusArchived:
+					proposalRecord.AbandonedAt = statusChange.Timestamp
+				}
+				proposalRecord.StatusChangeMessage = statusChange.Reason
+			}
+		}
+	}
+
+	return proposalRecord
+}
+
+func convertRecordState(state rcv1.RecordStateT) www.PropStateT {
+	switch state {
+	case rcv1.RecordStateUnvetted:
+		return www.PropStateUnvetted
+	case rcv1.RecordStateVetted:
+		return www.PropStateVetted
+	}
+	return www.PropStateInvalid
+}
+
+func convertRecordStatus(status rcv1.RecordStatusT) www.PropStatusT {
+	switch status {
+	case rcv1.RecordStatusUnreviewed:
+		return www.PropStatusNotReviewed
+	case rcv1.RecordStatusPublic:
+		return www.PropStatusPublic
+	case rcv1.RecordStatusCensored:
+		return www.PropStatusCensored
+	case rcv1.RecordStatusArchived:
+		return www.PropStatusAbandoned
+	}
+	return www.PropStatusInvalid
+}
+
+func convertVoteStatus(status tkv1.VoteStatusT) www.PropVoteStatusT {
+	switch status {
+	case tkv1.VoteStatusUnauthorized:
+		return www.PropVoteStatusNotAuthorized
+	case tkv1.VoteStatusAuthorized:
+		return www.PropVoteStatusAuthorized
+	case tkv1.VoteStatusStarted:
+		return www.PropVoteStatusStarted
+	case tkv1.VoteStatusFinished, tkv1.VoteStatusApproved, tkv1.VoteStatusRejected:
+		return www.PropVoteStatusFinished
+	case tkv1.VoteStatusIneligible:
+		return www.PropVoteStatusDoesntExist
+	}
+	return www.PropVoteStatusInvalid
+}
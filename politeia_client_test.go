@@ -0,0 +1,229 @@
+package dcrlibwallet
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	cmv1 "github.com/decred/politeia/politeiawww/api/comments/v1"
+	piv1 "github.com/decred/politeia/politeiawww/api/pi/v1"
+	rcv1 "github.com/decred/politeia/politeiawww/api/records/v1"
+	tkv1 "github.com/decred/politeia/politeiawww/api/ticketvote/v1"
+	www "github.com/decred/politeia/politeiawww/api/www/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	fakeProposalToken = "0123456789abcdef"
+	fakeProposalName  = "Test proposal"
+)
+
+// fakePoliteiaServer serves a single proposal with an active vote using
+// either the legacy www v1 routes or the records plugin APIs.
+func fakePoliteiaServer(recordsAPI bool) *httptest.Server {
+	reply := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set(www.CsrfToken, "csrf")
+		Expect(json.NewEncoder(w).Encode(v)).To(Succeed())
+	}
+
+	voteResults := []www.VoteOptionResult{
+		{Option: www.VoteOption{Id: "yes", Bits: 2}, VotesReceived: 7},
+		{Option: www.VoteOption{Id: "no", Bits: 1}, VotesReceived: 3},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/version", func(w http.ResponseWriter, r *http.Request) {
+		version := politeiaVersionReply{
+			VersionReply: www.VersionReply{Version: 1, Route: "/v1"},
+		}
+		if recordsAPI {
+			version.APIRoutes = []string{rcv1.APIRoute, tkv1.APIRoute, cmv1.APIRoute}
+		}
+		reply(w, version)
+	})
+
+	if !recordsAPI {
+		mux.HandleFunc("/api/v1/policy", func(w http.ResponseWriter, r *http.Request) {
+			reply(w, www.PolicyReply{ProposalListPageSize: 20})
+		})
+		mux.HandleFunc("/api/v1/proposals/tokeninventory", func(w http.ResponseWriter, r *http.Request) {
+			reply(w, www.TokenInventoryReply{Active: []string{fakeProposalToken}})
+		})
+		mux.HandleFunc("/api/v1/proposals/batch", func(w http.ResponseWriter, r *http.Request) {
+			reply(w, www.BatchProposalsReply{Proposals: []www.ProposalRecord{{
+				Name:             fakeProposalName,
+				State:            www.PropStateVetted,
+				Status:           www.PropStatusPublic,
+				NumComments:      3,
+				Version:          "2",
+				PublishedAt:      1600000000,
+				CensorshipRecord: www.CensorshipRecord{Token: fakeProposalToken},
+			}}})
+		})
+		mux.HandleFunc("/api/v1/proposals/batchvotesummary", func(w http.ResponseWriter, r *http.Request) {
+			reply(w, www.BatchVoteSummaryReply{Summaries: map[string]www.VoteSummary{
+				fakeProposalToken: {
+					Status:          www.PropVoteStatusStarted,
+					EligibleTickets: 40960,
+					Results:         voteResults,
+				},
+			}})
+		})
+		return httptest.NewTLSServer(mux)
+	}
+
+	mux.HandleFunc("/api/ticketvote/v1/inventory", func(w http.ResponseWriter, r *http.Request) {
+		var inventory tkv1.Inventory
+		Expect(json.NewDecoder(r.Body).Decode(&inventory)).To(Succeed())
+		vetted := map[string][]string{}
+		if inventory.Status == tkv1.VoteStatusStarted && inventory.Page == 1 {
+			vetted[tkv1.VoteStatuses[tkv1.VoteStatusStarted]] = []string{fakeProposalToken}
+		}
+		reply(w, tkv1.InventoryReply{Vetted: vetted})
+	})
+	mux.HandleFunc("/api/records/v1/records", func(w http.ResponseWriter, r *http.Request) {
+		metadata, _ := json.Marshal(piv1.ProposalMetadata{Name: fakeProposalName})
+		statusChange, _ := json.Marshal(rcv1.StatusChange{Status: rcv1.RecordStatusPublic, Timestamp: 1600000000})
+		reply(w, rcv1.RecordsReply{Records: map[string]rcv1.Record{
+			fakeProposalToken: {
+				State:   rcv1.RecordStateVetted,
+				Status:  rcv1.RecordStatusPublic,
+				Version: 2,
+				Files: []rcv1.File{{
+					Name:    piv1.FileNameProposalMetadata,
+					Payload: base64.StdEncoding.EncodeToString(metadata),
+				}},
+				Metadata: []rcv1.MetadataStream{{
+					PluginID: userMetadataPluginID,
+					StreamID: statusChangesStreamID,
+					Payload:  string(statusChange),
+				}},
+				CensorshipRecord: rcv1.CensorshipRecord{Token: fakeProposalToken},
+			},
+		}})
+	})
+	mux.HandleFunc("/api/comments/v1/count", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, cmv1.CountReply{Counts: map[string]uint32{fakeProposalToken: 3}})
+	})
+	mux.HandleFunc("/api/ticketvote/v1/summaries", func(w http.ResponseWriter, r *http.Request) {
+		results := make([]tkv1.VoteResult, len(voteResults))
+		for i, result := range voteResults {
+			results[i] = tkv1.VoteResult{
+				ID:      result.Option.Id,
+				VoteBit: result.Option.Bits,
+				Votes:   result.VotesReceived,
+			}
+		}
+		reply(w, tkv1.SummariesReply{Summaries: map[string]tkv1.Summary{
+			fakeProposalToken: {
+				Status:          tkv1.VoteStatusStarted,
+				EligibleTickets: 40960,
+				Results:         results,
+			},
+		}})
+	})
+	return httptest.NewTLSServer(mux)
+}
+
+func fakePoliteiaClient(server *httptest.Server) *politeiaClient {
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	return newPoliteiaClient(server.URL, &tls.Config{RootCAs: roots})
+}
+
+var _ = Describe("PoliteiaClient", func() {
+	for _, recordsAPI := range []bool{false, true} {
+		recordsAPI := recordsAPI
+		generation := "the www v1 API"
+		if recordsAPI {
+			generation = "the records API"
+		}
+
+		Context("with a server supporting "+generation, func() {
+			var server *httptest.Server
+			var client *politeiaClient
+
+			BeforeEach(func() {
+				server = fakePoliteiaServer(recordsAPI)
+				client = fakePoliteiaClient(server)
+			})
+
+			AfterEach(func() {
+				server.Close()
+			})
+
+			It("selects the API by probing the server version", func() {
+				usesRecordsAPI, err := client.usesRecordsAPI()
+				Expect(err).To(BeNil())
+				Expect(usesRecordsAPI).To(Equal(recordsAPI))
+			})
+
+			It("fetches proposals into the same proposal model", func() {
+				Expect(client.loadServerPolicy()).To(Succeed())
+				Expect(client.policy.ProposalListPageSize).NotTo(BeZero())
+
+				inventory, _, err := client.tokenInventory("")
+				Expect(err).To(BeNil())
+				Expect(inventory.Active).To(Equal([]string{fakeProposalToken}))
+				Expect(inventory.Pre).To(BeEmpty())
+
+				proposals, err := client.batchProposals(inventory.Active)
+				Expect(err).To(BeNil())
+				Expect(proposals).To(HaveLen(1))
+				Expect(proposals[0].Token).To(Equal(fakeProposalToken))
+				Expect(proposals[0].Name).To(Equal(fakeProposalName))
+				Expect(proposals[0].Status).To(Equal(int32(www.PropStatusPublic)))
+				Expect(proposals[0].State).To(Equal(int32(www.PropStateVetted)))
+				Expect(proposals[0].NumComments).To(Equal(int32(3)))
+				Expect(proposals[0].Version).To(Equal("2"))
+				Expect(proposals[0].PublishedAt).To(Equal(int64(1600000000)))
+
+				summaries, err := client.batchVoteSummary(inventory.Active)
+				Expect(err).To(BeNil())
+				summary := summaries[fakeProposalToken]
+				Expect(summary.Status).To(Equal(www.PropVoteStatusStarted))
+				Expect(summary.EligibleTickets).To(Equal(uint32(40960)))
+
+				yes, no := getVotesCount(summary.Results)
+				Expect(yes).To(Equal(int32(7)))
+				Expect(no).To(Equal(int32(3)))
+			})
+		})
+	}
+
+	It("lists unauthorized proposals before authorized ones with the records API", func() {
+		server := fakePoliteiaServer(true)
+		defer server.Close()
+
+		// serve a pre-vote token for each status on top of the fake server
+		inventoryServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/ticketvote/v1/inventory" {
+				server.Config.Handler.ServeHTTP(w, r)
+				return
+			}
+			var inventory tkv1.Inventory
+			Expect(json.NewDecoder(r.Body).Decode(&inventory)).To(Succeed())
+			vetted := map[string][]string{}
+			if inventory.Page == 1 {
+				statusName := tkv1.VoteStatuses[inventory.Status]
+				vetted[statusName] = []string{statusName}
+			}
+			Expect(json.NewEncoder(w).Encode(tkv1.InventoryReply{Vetted: vetted})).To(Succeed())
+		}))
+		defer inventoryServer.Close()
+		client := fakePoliteiaClient(inventoryServer)
+
+		for i := 0; i < 10; i++ {
+			inventory, _, err := client.tokenInventory("")
+			Expect(err).To(BeNil())
+			Expect(inventory.Pre).To(Equal([]string{
+				tkv1.VoteStatuses[tkv1.VoteStatusUnauthorized],
+				tkv1.VoteStatuses[tkv1.VoteStatusAuthorized],
+			}))
+		}
+	})
+})
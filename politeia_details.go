@@ -0,0 +1,386 @@
+package dcrlibwallet
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	www "github.com/decred/politeia/politeiawww/api/www/v1"
+	bolt "go.etcd.io/bbolt"
+)
+
+const proposalIndexFileName = "index.md"
+
+// FetchProposalCommentsRaw fetches the comments of the proposal identified by
+// token, including the votes on each comment, and caches them so that they
+// can be read offline with GetProposalCommentsRaw.
+func (p *Politeia) FetchProposalCommentsRaw(politeiaHost, token string) ([]ProposalComment, error) {
+	client, err := p.getClient(politeiaHost)
+	if err != nil {
+		return nil, err
+	}
+
+	comments, err := client.proposalComments(token)
+	if err != nil {
+		return nil, err
+	}
+
+	proposalComments := make([]ProposalComment, len(comments))
+	for i, comment := range comments {
+		proposalComments[i] = ProposalComment{
+			ID:          token + ":" + comment.CommentID,
+			Token:       token,
+			CommentID:   comment.CommentID,
+			ParentID:    comment.ParentID,
+			Comment:     comment.Comment,
+			Timestamp:   comment.Timestamp,
+			ResultVotes: comment.ResultVotes,
+			Upvotes:     int64(comment.Upvotes),
+			Downvotes:   int64(comment.Downvotes),
+			Censored:    comment.Censored,
+			UserID:      comment.UserID,
+			Username:    comment.Username,
+		}
+	}
+
+	tx, err := p.mwRef.db.Begin(true)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.Select(q.Eq("Token", token)).Delete(&ProposalComment{})
+	if err != nil && err != storm.ErrNotFound {
+		return nil, fmt.Errorf("error deleting cached comments: %s", err.Error())
+	}
+	for i := range proposalComments {
+		err = tx.Save(&proposalComments[i])
+		if err != nil {
+			return nil, fmt.Errorf("error saving comment: %s", err.Error())
+		}
+	}
+
+	return proposalComments, tx.Commit()
+}
+
+// FetchProposalComments returns the result of FetchProposalCommentsRaw as a
+// JSON string.
+func (p *Politeia) FetchProposalComments(politeiaHost, token string) (string, error) {
+	return p.marshalResult(p.FetchProposalCommentsRaw(politeiaHost, token))
+}
+
+// GetProposalCommentsRaw returns the cached comments of the proposal
+// identified by token, oldest first.
+func (p *Politeia) GetProposalCommentsRaw(token string) ([]ProposalComment, error) {
+	var comments []ProposalComment
+	err := p.mwRef.db.Select(q.Eq("Token", token)).OrderBy("Timestamp").Find(&comments)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, fmt.Errorf("error fetching comments: %s", err.Error())
+	}
+
+	return comments, nil
+}
+
+// GetProposalComments returns the result of GetProposalCommentsRaw as a JSON
+// string.
+func (p *Politeia) GetProposalComments(token string) (string, error) {
+	return p.marshalResult(p.GetProposalCommentsRaw(token))
+}
+
+// FetchProposalVersionsRaw fetches every version of the proposal identified
+// by token that isn't cached yet, along with the attachments of each version,
+// and returns all versions oldest first. Versions can be read offline with
+// GetProposalVersionsRaw.
+func (p *Politeia) FetchProposalVersionsRaw(politeiaHost, token string) ([]ProposalVersion, error) {
+	proposal, err := p.GetProposalRaw(token)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	latestVersion, err := strconv.Atoi(proposal.Version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proposal version %q", proposal.Version)
+	}
+
+	var client *politeiaClient
+	for version := 1; version <= latestVersion; version++ {
+		versionID := proposalVersionID(token, strconv.Itoa(version))
+		var cached ProposalVersion
+		err = p.mwRef.db.One("ID", versionID, &cached)
+		if err == nil {
+			continue
+		} else if err != storm.ErrNotFound {
+			return nil, err
+		}
+
+		if client == nil {
+			client, err = p.getClient(politeiaHost)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		detailsReply, err := client.proposalVersionDetails(token, strconv.Itoa(version))
+		if err != nil {
+			return nil, err
+		}
+		err = p.saveProposalVersion(token, &detailsReply.Proposal)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p.GetProposalVersionsRaw(token)
+}
+
+// FetchProposalVersions returns the result of FetchProposalVersionsRaw as a
+// JSON string.
+func (p *Politeia) FetchProposalVersions(politeiaHost, token string) (string, error) {
+	return p.marshalResult(p.FetchProposalVersionsRaw(politeiaHost, token))
+}
+
+// GetProposalVersionsRaw returns the cached versions of the proposal
+// identified by token, oldest first.
+func (p *Politeia) GetProposalVersionsRaw(token string) ([]ProposalVersion, error) {
+	var versions []ProposalVersion
+	err := p.mwRef.db.Select(q.Eq("Token", token)).Find(&versions)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, fmt.Errorf("error fetching proposal versions: %s", err.Error())
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		vi, _ := strconv.Atoi(versions[i].Version)
+		vj, _ := strconv.Atoi(versions[j].Version)
+		return vi < vj
+	})
+	return versions, nil
+}
+
+// GetProposalVersions returns the result of GetProposalVersionsRaw as a JSON
+// string.
+func (p *Politeia) GetProposalVersions(token string) (string, error) {
+	return p.marshalResult(p.GetProposalVersionsRaw(token))
+}
+
+// FetchProposalAttachmentsRaw fetches the proposal versions that aren't cached
+// yet and returns the attachments of the latest version.
+func (p *Politeia) FetchProposalAttachmentsRaw(politeiaHost, token string) ([]ProposalAttachment, error) {
+	versions, err := p.FetchProposalVersionsRaw(politeiaHost, token)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, newError(ErrNotExist)
+	}
+
+	return p.GetProposalAttachmentsRaw(token, versions[len(versions)-1].Version)
+}
+
+// FetchProposalAttachments returns the result of FetchProposalAttachmentsRaw
+// as a JSON string.
+func (p *Politeia) FetchProposalAttachments(politeiaHost, token string) (string, error) {
+	return p.marshalResult(p.FetchProposalAttachmentsRaw(politeiaHost, token))
+}
+
+// GetProposalAttachmentsRaw returns the cached attachments of a version of
+// the proposal identified by token.
+func (p *Politeia) GetProposalAttachmentsRaw(token, version string) ([]ProposalAttachment, error) {
+	var attachments []ProposalAttachment
+	err := p.mwRef.db.Select(
+		q.Eq("Token", token),
+		q.Eq("Version", version),
+	).OrderBy("Name").Find(&attachments)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, fmt.Errorf("error fetching proposal attachments: %s", err.Error())
+	}
+
+	return attachments, nil
+}
+
+// GetProposalAttachments returns the result of GetProposalAttachmentsRaw as
+// a JSON string.
+func (p *Politeia) GetProposalAttachments(token, version string) (string, error) {
+	return p.marshalResult(p.GetProposalAttachmentsRaw(token, version))
+}
+
+// ProposalVersionDiff returns a line diff of the index files of two cached
+// versions of the proposal identified by token. Lines removed in toVersion
+// are prefixed with "-", lines added with "+" and unchanged lines with " ".
+func (p *Politeia) ProposalVersionDiff(token, fromVersion, toVersion string) (string, error) {
+	var from, to ProposalVersion
+	err := p.mwRef.db.One("ID", proposalVersionID(token, fromVersion), &from)
+	if err != nil {
+		return "", translateError(err)
+	}
+	err = p.mwRef.db.One("ID", proposalVersionID(token, toVersion), &to)
+	if err != nil {
+		return "", translateError(err)
+	}
+
+	return diffLines(from.IndexFile, to.IndexFile), nil
+}
+
+func (p *Politeia) saveProposalVersion(token string, record *www.ProposalRecord) error {
+	version := &ProposalVersion{
+		ID:        proposalVersionID(token, record.Version),
+		Token:     token,
+		Version:   record.Version,
+		Name:      record.Name,
+		Timestamp: record.Timestamp,
+	}
+
+	tx, err := p.mwRef.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, file := range record.Files {
+		if file.Name == proposalIndexFileName {
+			b, err := DecodeBase64(file.Payload)
+			if err != nil {
+				return err
+			}
+			version.IndexFile = string(b)
+			continue
+		}
+
+		version.Attachments = append(version.Attachments, file.Name)
+		err = tx.Save(&ProposalAttachment{
+			ID:      version.ID + ":" + file.Name,
+			Token:   token,
+			Version: record.Version,
+			Name:    file.Name,
+			MIME:    file.MIME,
+			Digest:  file.Digest,
+			Payload: file.Payload,
+		})
+		if err != nil {
+			return fmt.Errorf("error saving proposal attachment: %s", err.Error())
+		}
+	}
+
+	err = tx.Save(version)
+	if err != nil {
+		return fmt.Errorf("error saving proposal version: %s", err.Error())
+	}
+
+	return tx.Commit()
+}
+
+// clearProposalDetails removes the cached comments, versions and attachments
+// of all proposals.
+func (p *Politeia) clearProposalDetails() error {
+	for _, data := range []interface{}{&ProposalComment{}, &ProposalVersion{}, &ProposalAttachment{}} {
+		err := p.mwRef.db.Drop(data)
+		if err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+func proposalVersionID(token, version string) string {
+	return token + ":" + version
+}
+
+// diffLines returns the line diff of a and b computed from their longest
+// common subsequence of lines.
+func diffLines(a, b string) string {
+	var diff strings.Builder
+	writeLineDiff(&diff, strings.Split(a, "\n"), strings.Split(b, "\n"))
+	return diff.String()
+}
+
+// writeLineDiff writes the line diff of a and b to diff. The longest common
+// subsequence is found with Hirschberg's algorithm, which only keeps two rows
+// of the LCS table in memory, so that large proposals with many changed lines
+// don't need a table of len(a)*len(b) entries.
+func writeLineDiff(diff *strings.Builder, a, b []string) {
+	writeLines := func(prefix string, lines []string) {
+		for _, line := range lines {
+			diff.WriteString(prefix + line + "\n")
+		}
+	}
+
+	// Lines common to the start and end of a and b are unchanged.
+	var prefix, suffix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	writeLines(" ", a[:prefix])
+	common := a[len(a)-suffix:]
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	switch {
+	case len(a) == 0:
+		writeLines("+", b)
+	case len(b) == 0:
+		writeLines("-", a)
+	case len(a) == 1:
+		j := 0
+		for j < len(b) && b[j] != a[0] {
+			j++
+		}
+		if j == len(b) {
+			writeLines("-", a)
+			writeLines("+", b)
+		} else {
+			writeLines("+", b[:j])
+			writeLines(" ", a)
+			writeLines("+", b[j+1:])
+		}
+	default:
+		// Split b where the LCS of the first half of a with b[:j] and
+		// of the second half of a with b[j:] is the longest, and diff
+		// both halves separately.
+		mid := len(a) / 2
+		forward := lcsLengths(a[:mid], b)
+		backward := lcsLengths(reverseLines(a[mid:]), reverseLines(b))
+		split := 0
+		for j := range forward {
+			if forward[j]+backward[len(b)-j] > forward[split]+backward[len(b)-split] {
+				split = j
+			}
+		}
+		writeLineDiff(diff, a[:mid], b[:split])
+		writeLineDiff(diff, a[mid:], b[split:])
+	}
+
+	writeLines(" ", common)
+}
+
+// lcsLengths returns the lengths of the longest common subsequences of a and
+// b[:j] for every j from 0 to len(b).
+func lcsLengths(a, b []string) []int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else if prev[j+1] >= cur[j] {
+				cur[j+1] = prev[j+1]
+			} else {
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
+
+func reverseLines(lines []string) []string {
+	reversed := make([]string, len(lines))
+	for i, line := range lines {
+		reversed[len(lines)-1-i] = line
+	}
+	return reversed
+}
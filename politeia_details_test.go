@@ -0,0 +1,217 @@
+package dcrlibwallet
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+
+	www "github.com/decred/politeia/politeiawww/api/www/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// applyDiff returns the lines of the old and new text of a line diff.
+func applyDiff(diff string) (string, string) {
+	var oldLines, newLines []string
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		switch line[0] {
+		case ' ':
+			oldLines = append(oldLines, line[1:])
+			newLines = append(newLines, line[1:])
+		case '-':
+			oldLines = append(oldLines, line[1:])
+		case '+':
+			newLines = append(newLines, line[1:])
+		}
+	}
+	return strings.Join(oldLines, "\n"), strings.Join(newLines, "\n")
+}
+
+var _ = Describe("Politeia details", func() {
+	Describe("diffLines", func() {
+		It("diffs lines", func() {
+			Expect(diffLines("a\nb\nc", "a\nb\nc")).To(Equal(" a\n b\n c\n"))
+			Expect(diffLines("a\nc", "a\nb\nc")).To(Equal(" a\n+b\n c\n"))
+			Expect(diffLines("a\nb\nc", "a\nc")).To(Equal(" a\n-b\n c\n"))
+			Expect(diffLines("a\nb\nc", "a\nx\nc")).To(Equal(" a\n-b\n+x\n c\n"))
+			Expect(diffLines("", "a")).To(Equal("-\n+a\n"))
+		})
+
+		It("keeps the longest common subsequence of lines", func() {
+			rng := rand.New(rand.NewSource(1))
+			randomText := func() string {
+				lines := make([]string, rng.Intn(30))
+				for i := range lines {
+					lines[i] = string(rune('a' + rng.Intn(4)))
+				}
+				return strings.Join(lines, "\n")
+			}
+
+			for i := 0; i < 200; i++ {
+				a, b := randomText(), randomText()
+				diff := diffLines(a, b)
+
+				oldText, newText := applyDiff(diff)
+				Expect(oldText).To(Equal(a))
+				Expect(newText).To(Equal(b))
+
+				aLines, bLines := strings.Split(a, "\n"), strings.Split(b, "\n")
+				unchanged := strings.Count("\n"+diff, "\n ")
+				Expect(unchanged).To(Equal(lcsLengths(aLines, bLines)[len(bLines)]))
+			}
+		})
+
+		It("diffs large texts", func() {
+			aLines := make([]string, 5000)
+			bLines := make([]string, 5000)
+			for i := range aLines {
+				aLines[i] = fmt.Sprintf("a%d", i)
+				bLines[i] = fmt.Sprintf("b%d", i)
+			}
+			bLines[2500] = aLines[2500]
+
+			diff := diffLines(strings.Join(aLines, "\n"), strings.Join(bLines, "\n"))
+			Expect(strings.Count("\n"+diff, "\n ")).To(Equal(1))
+		})
+	})
+
+	Describe("Fetching", func() {
+		var mw *MultiWallet
+		var cleanup func()
+		var server *httptest.Server
+		var versionRequests, detailsRequests int32
+
+		BeforeEach(func() {
+			mw, cleanup = newTestMultiWallet()
+			atomic.StoreInt32(&versionRequests, 0)
+			atomic.StoreInt32(&detailsRequests, 0)
+
+			reply := func(w http.ResponseWriter, v interface{}) {
+				w.Header().Set(www.CsrfToken, "csrf")
+				Expect(json.NewEncoder(w).Encode(v)).To(Succeed())
+			}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v1/version", func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&versionRequests, 1)
+				reply(w, www.VersionReply{Version: 1, Route: "/v1"})
+			})
+			mux.HandleFunc("/api/v1/policy", func(w http.ResponseWriter, r *http.Request) {
+				reply(w, www.PolicyReply{ProposalListPageSize: 20})
+			})
+			mux.HandleFunc("/api/v1/proposals/"+fakeProposalToken, func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&detailsRequests, 1)
+				version := r.URL.Query().Get("version")
+				index := "Title\nVersion " + version
+				files := []www.File{{
+					Name:    proposalIndexFileName,
+					Payload: base64.StdEncoding.EncodeToString([]byte(index)),
+				}}
+				if version == "2" {
+					files = append(files, www.File{Name: "chart.png", MIME: "image/png", Payload: "AA=="})
+				}
+				reply(w, www.ProposalDetailsReply{Proposal: www.ProposalRecord{
+					Name:    fakeProposalName,
+					Version: version,
+					Files:   files,
+				}})
+			})
+			mux.HandleFunc("/api/v1/proposals/"+fakeProposalToken+"/comments", func(w http.ResponseWriter, r *http.Request) {
+				reply(w, www.GetCommentsReply{Comments: []www.Comment{
+					{CommentID: "1", Comment: "first", Timestamp: 1, Upvotes: 2},
+					{CommentID: "2", ParentID: "1", Comment: "reply", Timestamp: 2, Downvotes: 1},
+				}})
+			})
+			server = newTestTLSServer(mux)
+			Expect(mw.Politeia.AddTrustedCertificate(certificatePEM(server))).To(Succeed())
+
+			Expect(mw.Politeia.saveOrOverwiteProposal(&Proposal{
+				Token:   fakeProposalToken,
+				Version: "2",
+			})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			server.Close()
+			cleanup()
+		})
+
+		It("caches clients", func() {
+			client, err := mw.Politeia.getClient(server.URL)
+			Expect(err).To(BeNil())
+			cached, err := mw.Politeia.getClient(server.URL)
+			Expect(err).To(BeNil())
+			Expect(cached).To(BeIdenticalTo(client))
+			Expect(atomic.LoadInt32(&versionRequests)).To(Equal(int32(1)))
+
+			By("Creating a new client after trust changes")
+			mw.Politeia.ClearTrustedCertificates()
+			Expect(mw.Politeia.AddTrustedCertificate(certificatePEM(server))).To(Succeed())
+			newClient, err := mw.Politeia.getClient(server.URL)
+			Expect(err).To(BeNil())
+			Expect(newClient).ToNot(BeIdenticalTo(client))
+		})
+
+		It("only reuses the sync client for its host", func() {
+			syncClient := newPoliteiaClient("https://other.example", nil)
+			mw.Politeia.mu.Lock()
+			mw.Politeia.client = syncClient
+			mw.Politeia.cancelSync = func() {}
+			mw.Politeia.mu.Unlock()
+			defer mw.Politeia.StopSync()
+
+			client, err := mw.Politeia.getClient(server.URL)
+			Expect(err).To(BeNil())
+			Expect(client.host).To(Equal(server.URL))
+			cached, err := mw.Politeia.getClient(server.URL)
+			Expect(err).To(BeNil())
+			Expect(cached).To(BeIdenticalTo(client))
+
+			client, err = mw.Politeia.getClient("")
+			Expect(err).To(BeNil())
+			Expect(client).To(BeIdenticalTo(syncClient))
+		})
+
+		It("caches proposal versions, attachments and comments", func() {
+			versions, err := mw.Politeia.FetchProposalVersionsRaw(server.URL, fakeProposalToken)
+			Expect(err).To(BeNil())
+			Expect(versions).To(HaveLen(2))
+			Expect(versions[0].Version).To(Equal("1"))
+			Expect(versions[1].IndexFile).To(Equal("Title\nVersion 2"))
+			Expect(versions[1].Attachments).To(Equal([]string{"chart.png"}))
+			Expect(atomic.LoadInt32(&detailsRequests)).To(Equal(int32(2)))
+
+			By("Reading cached versions without fetching them again")
+			versions, err = mw.Politeia.FetchProposalVersionsRaw(server.URL, fakeProposalToken)
+			Expect(err).To(BeNil())
+			Expect(versions).To(HaveLen(2))
+			Expect(atomic.LoadInt32(&detailsRequests)).To(Equal(int32(2)))
+
+			attachments, err := mw.Politeia.FetchProposalAttachmentsRaw(server.URL, fakeProposalToken)
+			Expect(err).To(BeNil())
+			Expect(attachments).To(HaveLen(1))
+			Expect(attachments[0].MIME).To(Equal("image/png"))
+
+			diff, err := mw.Politeia.ProposalVersionDiff(fakeProposalToken, "1", "2")
+			Expect(err).To(BeNil())
+			Expect(diff).To(Equal(" Title\n-Version 1\n+Version 2\n"))
+			_, err = mw.Politeia.ProposalVersionDiff(fakeProposalToken, "1", "3")
+			Expect(err).To(MatchError(ErrNotExist))
+
+			comments, err := mw.Politeia.FetchProposalCommentsRaw(server.URL, fakeProposalToken)
+			Expect(err).To(BeNil())
+			Expect(comments).To(HaveLen(2))
+
+			cachedComments, err := mw.Politeia.GetProposalCommentsRaw(fakeProposalToken)
+			Expect(err).To(BeNil())
+			Expect(cachedComments).To(HaveLen(2))
+			Expect(cachedComments[1].ParentID).To(Equal("1"))
+			Expect(cachedComments[0].Upvotes).To(Equal(int64(2)))
+			Expect(atomic.LoadInt32(&versionRequests)).To(Equal(int32(1)))
+		})
+	})
+})
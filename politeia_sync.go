@@ -1,8 +1,8 @@
 package dcrlibwallet
 
 import (
-	"errors"
 	"fmt"
+	"math/rand"
 	"reflect"
 	"time"
 
@@ -11,48 +11,89 @@ import (
 )
 
 const (
-	retryInterval = 15 // 15 seconds
+	politeiaBucketName   = "politeia"
+	politeiaSyncPointKey = "sync_point"
+
+	// Failed sync attempts are retried after a delay that doubles on each
+	// attempt, from minRetryDelay up to maxRetryDelay, with random jitter.
+	minRetryDelay = 5 * time.Second
+	maxRetryDelay = 10 * time.Minute
 )
 
-// Sync fetches all proposals from the server and
+// politeiaSyncPoint records the state of the politeia server as of the last
+// complete sync.
+type politeiaSyncPoint struct {
+	Host      string
+	Timestamp int64
+
+	// InventoryETag is the entity tag of the token inventory, used to only
+	// fetch the inventory again if it changed. Empty if the server doesn't
+	// tag the inventory.
+	InventoryETag string
+}
+
+// politeiaSyncProgress counts the proposals fetched during a sync.
+type politeiaSyncProgress struct {
+	fetched int32
+	total   int32
+}
+
+// Sync fetches the proposals that were added or changed on the server since
+// the last sync and reports progress to notification listeners. Failed
+// attempts are retried with exponential backoff until StopSync is called.
 func (p *Politeia) Sync(host string) error {
 
 	p.mu.Lock()
 
 	if p.cancelSync != nil {
 		p.mu.Unlock()
-		return errors.New(ErrSyncAlreadyInProgress)
+		return newError(ErrSyncAlreadyInProgress)
 	}
 
 	log.Info("Politeia sync: started")
 
+	client := p.cachedClient(host)
+	if client == nil {
+		var err error
+		client, err = p.newClient(host)
+		if err != nil {
+			p.mu.Unlock()
+			return err
+		}
+		p.clients[host] = client
+	}
+
 	p.ctx, p.cancelSync = p.mwRef.contextWithShutdownCancel()
-	p.client = newPoliteiaClient(host)
+	p.client = client
 	defer p.resetSyncData()
 
 	p.mu.Unlock()
 
-	for {
+	for attempt := 0; ; attempt++ {
 		// fetch server policy if it's not been fetched
-		if p.client.policy == nil {
-			err := p.client.loadServerPolicy()
+		if client.loadedPolicy() == nil {
+			err := client.loadServerPolicy()
 			if err != nil {
 				log.Errorf("Error fetching for politeia server policy: %v", err)
-				time.Sleep(retryInterval * time.Second)
+				if err = p.waitBeforeRetry(attempt); err != nil {
+					return err
+				}
 				continue
 			}
 		}
 
 		if done(p.ctx) {
-			return errors.New(ErrContextCanceled)
+			return newError(ErrContextCanceled)
 		}
 
 		log.Info("Politeia sync: checking for updates")
 
-		err := p.checkForUpdates()
+		err := p.checkForUpdates(host)
 		if err != nil {
 			log.Errorf("Error checking for politeia updates: %v", err)
-			time.Sleep(retryInterval * time.Second)
+			if err = p.waitBeforeRetry(attempt); err != nil {
+				return err
+			}
 			continue
 		}
 
@@ -62,6 +103,34 @@ func (p *Politeia) Sync(host string) error {
 	}
 }
 
+// waitBeforeRetry waits for the retry delay of the failed attempt before the
+// next sync attempt.
+func (p *Politeia) waitBeforeRetry(attempt int) error {
+	delay := retryDelay(attempt)
+	log.Infof("Politeia sync: retrying in %v", delay.Round(time.Second))
+
+	select {
+	case <-p.ctx.Done():
+		return newError(ErrContextCanceled)
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+// retryDelay returns the delay before retrying a failed sync attempt, where
+// attempt counts from 0. The delay doubles with each failed attempt and is
+// randomized so that clients don't retry in lockstep after a server outage.
+func retryDelay(attempt int) time.Duration {
+	delay := maxRetryDelay
+	if attempt < 10 {
+		delay = minRetryDelay << uint(attempt)
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
 func (p *Politeia) IsSyncing() bool {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -83,58 +152,143 @@ func (p *Politeia) StopSync() {
 	log.Info("Politeia sync: stopped")
 }
 
-func (p *Politeia) checkForUpdates() error {
-	offset := 0
+// checkForUpdates fetches the proposals added to the server inventory and
+// refreshes the saved proposals that may have changed since the last sync.
+// Proposals in pre-vote may be edited and votes of active proposals are
+// being counted, so these are always refreshed. Other proposals are only
+// refreshed if their category in the server inventory changed. The inventory
+// is requested with the entity tag of the last sync, so it is only sent and
+// compared with the saved proposals if it changed since then.
+func (p *Politeia) checkForUpdates(host string) error {
 	p.mu.RLock()
-	limit := int32(p.client.policy.ProposalListPageSize)
+	client := p.client
+	limit := int(client.loadedPolicy().ProposalListPageSize)
 	p.mu.RUnlock()
 
-	for {
-		proposals, err := p.getProposalsRaw(ProposalCategoryAll, int32(offset), limit, true, true)
-		if err != nil && err != storm.ErrNotFound {
-			return err
+	var inventoryETag string
+	if lastSyncPoint := p.lastSyncPoint(); lastSyncPoint != nil && lastSyncPoint.Host == host {
+		inventoryETag = lastSyncPoint.InventoryETag
+	}
+
+	tokenInventory, inventoryETag, err := client.tokenInventory(inventoryETag)
+	if err != nil {
+		return err
+	}
+	inventoryChanged := tokenInventory != nil
+
+	// include abandoned proposals
+	savedProposals, err := p.getProposalsRaw(ProposalCategoryAll, 0, 0, true, false)
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+
+	var inventoryCategories map[string]int32
+	if inventoryChanged {
+		inventoryCategories = tokenInventoryCategories(tokenInventory)
+	}
+	savedTokens := make([]string, len(savedProposals))
+	var changedProposals []Proposal
+	for i, proposal := range savedProposals {
+		savedTokens[i] = proposal.Token
+
+		category, inInventory := inventoryCategories[proposal.Token]
+		switch {
+		case proposal.Category == ProposalCategoryPre, proposal.Category == ProposalCategoryActive:
+			changedProposals = append(changedProposals, proposal)
+		case inventoryChanged && inInventory && category != proposal.Category:
+			changedProposals = append(changedProposals, proposal)
 		}
+	}
 
-		if len(proposals) == 0 {
-			break
+	var newTokens map[int32][]string
+	var newTokensCount int
+	if inventoryChanged {
+		newTokens = p.unfetchedProposalTokens(tokenInventory, savedTokens)
+		for _, tokens := range newTokens {
+			newTokensCount += len(tokens)
 		}
+	}
 
-		offset += len(proposals)
+	progress := &politeiaSyncProgress{
+		total: int32(len(changedProposals) + newTokensCount),
+	}
+	p.publishSyncProgress(progress)
 
-		err = p.handleProposalsUpdate(proposals)
+	log.Infof("Politeia sync: refreshing %d proposals", len(changedProposals))
+	for len(changedProposals) > 0 {
+		if done(p.ctx) {
+			return newError(ErrContextCanceled)
+		}
+
+		batchSize := limit
+		if len(changedProposals) < batchSize {
+			batchSize = len(changedProposals)
+		}
+
+		var batch []Proposal
+		batch, changedProposals = changedProposals[:batchSize], changedProposals[batchSize:]
+		err = p.handleProposalsUpdate(batch)
 		if err != nil {
 			return err
 		}
-	}
 
-	// include abandoned proposals
-	allProposals, err := p.getProposalsRaw(ProposalCategoryAll, 0, 0, true, false)
-	if err != nil && err != storm.ErrNotFound {
-		return err
+		progress.fetched += int32(len(batch))
+		p.publishSyncProgress(progress)
 	}
 
-	err = p.handleNewProposals(allProposals)
-	if err != nil {
-		return err
+	if inventoryChanged {
+		err = p.fetchAllUnfetchedProposals(newTokens, len(savedTokens) > 0, progress)
+		if err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return p.saveSyncPoint(&politeiaSyncPoint{
+		Host:          host,
+		Timestamp:     time.Now().Unix(),
+		InventoryETag: inventoryETag,
+	})
 }
 
-func (p *Politeia) handleNewProposals(proposals []Proposal) error {
-	loadedTokens := make([]string, len(proposals))
-	for i := range proposals {
-		loadedTokens[i] = proposals[i].Token
+// LastSyncTimestamp returns the time of the last complete politeia sync as a
+// unix timestamp, or 0 if proposals were never synced.
+func (p *Politeia) LastSyncTimestamp() int64 {
+	if syncPoint := p.lastSyncPoint(); syncPoint != nil {
+		return syncPoint.Timestamp
 	}
+	return 0
+}
 
-	p.mu.RLock()
-	tokenInventory, err := p.client.tokenInventory()
-	p.mu.RUnlock()
+func (p *Politeia) lastSyncPoint() *politeiaSyncPoint {
+	var syncPoint politeiaSyncPoint
+	err := p.mwRef.db.Get(politeiaBucketName, politeiaSyncPointKey, &syncPoint)
 	if err != nil {
-		return err
+		if err != storm.ErrNotFound {
+			log.Errorf("Error reading politeia sync point: %v", err)
+		}
+		return nil
 	}
+	return &syncPoint
+}
 
-	return p.fetchAllUnfetchedProposals(tokenInventory, loadedTokens)
+func (p *Politeia) saveSyncPoint(syncPoint *politeiaSyncPoint) error {
+	return p.mwRef.db.Set(politeiaBucketName, politeiaSyncPointKey, syncPoint)
+}
+
+func tokenInventoryCategories(tokenInventory *www.TokenInventoryReply) map[string]int32 {
+	categories := make(map[string]int32)
+	for category, tokens := range map[int32][]string{
+		ProposalCategoryPre:       tokenInventory.Pre,
+		ProposalCategoryActive:    tokenInventory.Active,
+		ProposalCategoryApproved:  tokenInventory.Approved,
+		ProposalCategoryRejected:  tokenInventory.Rejected,
+		ProposalCategoryAbandoned: tokenInventory.Abandoned,
+	} {
+		for _, token := range tokens {
+			categories[token] = category
+		}
+	}
+	return categories
 }
 
 func (p *Politeia) handleProposalsUpdate(proposals []Proposal) error {
@@ -163,6 +317,7 @@ func (p *Politeia) handleProposalsUpdate(proposals []Proposal) error {
 			batchProposals[i].PassPercentage = int32(voteSummary.PassPercentage)
 			batchProposals[i].EligibleTickets = int32(voteSummary.EligibleTickets)
 			batchProposals[i].QuorumPercentage = int32(voteSummary.QuorumPercentage)
+			batchProposals[i].VoteEndHeight = int32(voteSummary.EndHeight)
 			batchProposals[i].YesVotes, batchProposals[i].NoVotes = getVotesCount(voteSummary.Results)
 		}
 
@@ -184,6 +339,7 @@ func (p *Politeia) handleProposalsUpdate(proposals []Proposal) error {
 
 func (p *Politeia) updateProposalDetails(oldProposal, updatedProposal Proposal) error {
 	updatedProposal.ID = oldProposal.ID
+	updatedProposal.WalletVotes = oldProposal.WalletVotes
 
 	if reflect.DeepEqual(oldProposal, updatedProposal) {
 		return nil
@@ -222,9 +378,10 @@ func (p *Politeia) updateProposalDetails(oldProposal, updatedProposal Proposal)
 	return nil
 }
 
-func (p *Politeia) fetchAllUnfetchedProposals(tokenInventory *www.TokenInventoryReply, savedTokens []string) error {
-
-	broadcastNotification := len(savedTokens) > 0
+// unfetchedProposalTokens returns the tokens in the inventory that are not
+// saved, by category.
+func (p *Politeia) unfetchedProposalTokens(tokenInventory *www.TokenInventoryReply, savedTokens []string) map[int32][]string {
+	savedTokens = append([]string(nil), savedTokens...)
 
 	approvedTokens, savedTokens := p.getUniqueTokens(tokenInventory.Approved, savedTokens)
 	rejectedTokens, savedTokens := p.getUniqueTokens(tokenInventory.Rejected, savedTokens)
@@ -232,14 +389,16 @@ func (p *Politeia) fetchAllUnfetchedProposals(tokenInventory *www.TokenInventory
 	preTokens, savedTokens := p.getUniqueTokens(tokenInventory.Pre, savedTokens)
 	activeTokens, _ := p.getUniqueTokens(tokenInventory.Active, savedTokens)
 
-	inventoryMap := map[int32][]string{
+	return map[int32][]string{
 		ProposalCategoryPre:       preTokens,
 		ProposalCategoryActive:    activeTokens,
 		ProposalCategoryApproved:  approvedTokens,
 		ProposalCategoryRejected:  rejectedTokens,
 		ProposalCategoryAbandoned: abandonedTokens,
 	}
+}
 
+func (p *Politeia) fetchAllUnfetchedProposals(inventoryMap map[int32][]string, broadcastNotification bool, progress *politeiaSyncProgress) error {
 	totalNumProposalsToFetch := 0
 	for _, v := range inventoryMap {
 		totalNumProposalsToFetch += len(v)
@@ -253,11 +412,11 @@ func (p *Politeia) fetchAllUnfetchedProposals(tokenInventory *www.TokenInventory
 	}
 
 	if done(p.ctx) {
-		return errors.New(ErrContextCanceled)
+		return newError(ErrContextCanceled)
 	}
 
 	for category, tokens := range inventoryMap {
-		err := p.fetchBatchProposals(category, tokens, broadcastNotification)
+		err := p.fetchBatchProposals(category, tokens, broadcastNotification, progress)
 		if err != nil {
 			return err
 		}
@@ -266,7 +425,7 @@ func (p *Politeia) fetchAllUnfetchedProposals(tokenInventory *www.TokenInventory
 	return nil
 }
 
-func (p *Politeia) fetchBatchProposals(category int32, tokens []string, broadcastNotification bool) error {
+func (p *Politeia) fetchBatchProposals(category int32, tokens []string, broadcastNotification bool, progress *politeiaSyncProgress) error {
 	for {
 		if len(tokens) == 0 {
 			break
@@ -274,10 +433,10 @@ func (p *Politeia) fetchBatchProposals(category int32, tokens []string, broadcas
 
 		p.mu.RLock()
 		if done(p.ctx) {
-			return errors.New(ErrContextCanceled)
+			return newError(ErrContextCanceled)
 		}
 
-		limit := int(p.client.policy.ProposalListPageSize)
+		limit := int(p.client.loadedPolicy().ProposalListPageSize)
 		if len(tokens) <= limit {
 			limit = len(tokens)
 		}
@@ -293,7 +452,7 @@ func (p *Politeia) fetchBatchProposals(category int32, tokens []string, broadcas
 		}
 
 		if done(p.ctx) {
-			return errors.New(ErrContextCanceled)
+			return newError(ErrContextCanceled)
 		}
 
 		votesSummaries, err := p.client.batchVoteSummary(tokenBatch)
@@ -302,7 +461,7 @@ func (p *Politeia) fetchBatchProposals(category int32, tokens []string, broadcas
 		}
 
 		if done(p.ctx) {
-			return errors.New(ErrContextCanceled)
+			return newError(ErrContextCanceled)
 		}
 
 		for i := range proposals {
@@ -313,6 +472,7 @@ func (p *Politeia) fetchBatchProposals(category int32, tokens []string, broadcas
 				proposals[i].PassPercentage = int32(voteSummary.PassPercentage)
 				proposals[i].EligibleTickets = int32(voteSummary.EligibleTickets)
 				proposals[i].QuorumPercentage = int32(voteSummary.QuorumPercentage)
+				proposals[i].VoteEndHeight = int32(voteSummary.EndHeight)
 				proposals[i].YesVotes, proposals[i].NoVotes = getVotesCount(voteSummary.Results)
 			}
 
@@ -329,6 +489,11 @@ func (p *Politeia) fetchBatchProposals(category int32, tokens []string, broadcas
 		}
 
 		log.Infof("Politeia sync: fetched %d proposals", limit)
+
+		if progress != nil {
+			progress.fetched += int32(limit)
+			p.publishSyncProgress(progress)
+		}
 	}
 
 	return nil
@@ -341,15 +506,9 @@ func (p *Politeia) FetchProposalDescription(politeiaHost, token string) (string,
 		return "", err
 	}
 
-	p.mu.Lock()
-	client := p.client
-	p.mu.Unlock()
-	if client == nil {
-		client = newPoliteiaClient(politeiaHost)
-		err := client.loadServerPolicy()
-		if err != nil {
-			return "", err
-		}
+	client, err := p.getClient(politeiaHost)
+	if err != nil {
+		return "", err
 	}
 
 	proposalDetailsReply, err := client.proposalDetails(token)
@@ -378,7 +537,7 @@ func (p *Politeia) FetchProposalDescription(politeiaHost, token string) (string,
 		}
 	}
 
-	return "", errors.New(ErrNotExist)
+	return "", newError(ErrNotExist)
 }
 
 func (p *Politeia) AddNotificationListener(notificationListener ProposalNotificationListener, uniqueIdentifier string) error {
@@ -386,7 +545,7 @@ func (p *Politeia) AddNotificationListener(notificationListener ProposalNotifica
 	defer p.notificationListenersMu.Unlock()
 
 	if _, ok := p.notificationListeners[uniqueIdentifier]; ok {
-		return errors.New(ErrListenerAlreadyExist)
+		return newError(ErrListenerAlreadyExist)
 	}
 
 	p.notificationListeners[uniqueIdentifier] = notificationListener
@@ -409,6 +568,15 @@ func (p *Politeia) publishSynced() {
 	}
 }
 
+func (p *Politeia) publishSyncProgress(progress *politeiaSyncProgress) {
+	p.notificationListenersMu.Lock()
+	defer p.notificationListenersMu.Unlock()
+
+	for _, notificationListener := range p.notificationListeners {
+		notificationListener.OnProposalsSyncProgress(progress.fetched, progress.total)
+	}
+}
+
 func (p *Politeia) publishNewProposal(proposal *Proposal) {
 	p.notificationListenersMu.Lock()
 	defer p.notificationListenersMu.Unlock()
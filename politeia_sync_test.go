@@ -0,0 +1,157 @@
+package dcrlibwallet
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type politeiaSyncTestListener struct {
+	mu       sync.Mutex
+	progress [][2]int32
+}
+
+func (l *politeiaSyncTestListener) OnProposalsSynced()                    {}
+func (l *politeiaSyncTestListener) OnNewProposal(*Proposal)               {}
+func (l *politeiaSyncTestListener) OnProposalVoteStarted(*Proposal)       {}
+func (l *politeiaSyncTestListener) OnProposalVoteFinished(*Proposal)      {}
+func (l *politeiaSyncTestListener) OnProposalVoteEnding(*Proposal, int32) {}
+func (l *politeiaSyncTestListener) OnProposalsSyncProgress(fetched, total int32) {
+	l.mu.Lock()
+	l.progress = append(l.progress, [2]int32{fetched, total})
+	l.mu.Unlock()
+}
+
+var _ = Describe("Politeia sync", func() {
+	Describe("retryDelay", func() {
+		It("doubles the delay with jitter up to the maximum", func() {
+			for attempt := 0; attempt < 20; attempt++ {
+				max := maxRetryDelay
+				if attempt < 7 {
+					max = minRetryDelay << uint(attempt)
+				}
+				for i := 0; i < 20; i++ {
+					delay := retryDelay(attempt)
+					Expect(delay).To(BeNumerically(">=", max/2))
+					Expect(delay).To(BeNumerically("<=", max))
+				}
+			}
+		})
+
+		It("stops waiting when sync is stopped", func() {
+			mw, cleanup := newTestMultiWallet()
+			defer cleanup()
+
+			var cancel context.CancelFunc
+			mw.Politeia.ctx, cancel = context.WithCancel(context.Background())
+			cancel()
+
+			start := time.Now()
+			Expect(mw.Politeia.waitBeforeRetry(5)).To(MatchError(ErrContextCanceled))
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		})
+	})
+
+	Describe("checkForUpdates", func() {
+		var mw *MultiWallet
+		var cleanup func()
+		var server *httptest.Server
+		var listener *politeiaSyncTestListener
+
+		var mu sync.Mutex
+		var etag string
+		var conditionalRequests []string
+		var inventoryRequests, batchRequests int
+
+		BeforeEach(func() {
+			mw, cleanup = newTestMultiWallet()
+
+			etag = `"inventory-1"`
+			conditionalRequests = nil
+			inventoryRequests, batchRequests = 0, 0
+
+			fakeServer := fakePoliteiaServer(false)
+			fakeServer.Close()
+			handler := fakeServer.Config.Handler
+			server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				switch r.URL.Path {
+				case "/api/v1/proposals/tokeninventory":
+					conditionalRequests = append(conditionalRequests, r.Header.Get("If-None-Match"))
+					if r.Header.Get("If-None-Match") == etag {
+						w.WriteHeader(http.StatusNotModified)
+						return
+					}
+					inventoryRequests++
+					w.Header().Set("ETag", etag)
+				case "/api/v1/proposals/batch":
+					batchRequests++
+				}
+				handler.ServeHTTP(w, r)
+			}))
+
+			client := fakePoliteiaClient(server)
+			Expect(client.loadServerPolicy()).To(Succeed())
+			mw.Politeia.client = client
+			mw.Politeia.ctx = context.Background()
+
+			listener = &politeiaSyncTestListener{}
+			Expect(mw.Politeia.AddNotificationListener(listener, "sync")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			server.Close()
+			cleanup()
+		})
+
+		It("only fetches the token inventory if it changed", func() {
+			By("Fetching new proposals")
+			Expect(mw.Politeia.checkForUpdates(server.URL)).To(Succeed())
+			proposals, err := mw.Politeia.GetProposalsRaw(ProposalCategoryActive, 0, 0, false)
+			Expect(err).To(BeNil())
+			Expect(proposals).To(HaveLen(1))
+			Expect(proposals[0].YesVotes).To(Equal(int32(7)))
+			Expect(mw.Politeia.lastSyncPoint().InventoryETag).To(Equal(`"inventory-1"`))
+			Expect(mw.Politeia.LastSyncTimestamp()).ToNot(BeZero())
+
+			mu.Lock()
+			Expect(conditionalRequests).To(Equal([]string{""}))
+			Expect(inventoryRequests).To(Equal(1))
+			Expect(batchRequests).To(Equal(1))
+			mu.Unlock()
+
+			By("Refreshing active proposals without fetching the unchanged inventory")
+			Expect(mw.Politeia.checkForUpdates(server.URL)).To(Succeed())
+			mu.Lock()
+			Expect(conditionalRequests).To(Equal([]string{"", `"inventory-1"`}))
+			Expect(inventoryRequests).To(Equal(1))
+			Expect(batchRequests).To(Equal(2))
+			etag = `"inventory-2"`
+			mu.Unlock()
+
+			By("Fetching the changed inventory")
+			Expect(mw.Politeia.checkForUpdates(server.URL)).To(Succeed())
+			mu.Lock()
+			Expect(inventoryRequests).To(Equal(2))
+			mu.Unlock()
+			Expect(mw.Politeia.lastSyncPoint().InventoryETag).To(Equal(`"inventory-2"`))
+
+			By("Ignoring the entity tag of another host")
+			Expect(mw.Politeia.checkForUpdates("https://localhost")).To(Succeed())
+			mu.Lock()
+			Expect(conditionalRequests[len(conditionalRequests)-1]).To(BeEmpty())
+			mu.Unlock()
+
+			listener.mu.Lock()
+			defer listener.mu.Unlock()
+			Expect(listener.progress).To(ContainElement([2]int32{1, 1}))
+		})
+	})
+})
@@ -0,0 +1,277 @@
+package dcrlibwallet
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/url"
+	"strings"
+
+	"github.com/decred/dcrd/wire"
+)
+
+const (
+	// PoliteiaPinnedKeysConfigKey maps politeia hosts to the base64 encoded
+	// SHA-256 hashes of the certificate public keys (SPKI) pinned for the host.
+	PoliteiaPinnedKeysConfigKey = "politeia_pinned_keys"
+
+	// PoliteiaTrustedCertsConfigKey holds the PEM encoded certificates
+	// trusted in addition to the system roots, e.g. for self-hosted politeia
+	// instances.
+	PoliteiaTrustedCertsConfigKey = "politeia_trusted_certs"
+
+	// PoliteiaBuiltInPinsConfigKey enables the keys pinned by default for
+	// the politeia hosts of the network, see SetBuiltInPinsEnabled.
+	PoliteiaBuiltInPinsConfigKey = "politeia_builtin_pins"
+)
+
+// builtInPoliteiaPins are the SPKI hashes pinned for the default politeia
+// hosts of each network when built-in pins are enabled. The hosts use Let's
+// Encrypt certificates, so the keys of the ISRG Root X1 and X2 CAs are pinned
+// rather than the leaf keys, which change on every certificate renewal.
+var builtInPoliteiaPins = map[wire.CurrencyNet]map[string][]string{
+	wire.MainNet: {
+		"proposals.decred.org": isrgRootPins,
+	},
+	wire.TestNet3: {
+		"test-proposals.decred.org": isrgRootPins,
+	},
+}
+
+var isrgRootPins = []string{
+	"C5+lpZ7tcVwmwQIMcRtPbsQtWLABXhQzejna0wHFr8M=", // ISRG Root X1
+	"diGVwiVYbubAI3RW4hB9xU8e/CH2GnkuvVFZE8zmgzI=", // ISRG Root X2
+}
+
+// CertificatePinningError is returned when a politeia server presents a
+// certificate chain that doesn't contain any of the public keys pinned for
+// the server host.
+type CertificatePinningError struct {
+	Host string
+
+	// PresentedKeys are the SPKI hashes of the certificates presented by
+	// the server.
+	PresentedKeys []string
+}
+
+func (e *CertificatePinningError) Error() string {
+	return ErrCertificatePinMismatch
+}
+
+// PinPublicKey pins the base64 encoded SHA-256 hash of the subject public key
+// info (SPKI) of a certificate for the politeia host. Once a key is pinned,
+// connections to the host are only trusted if the verified certificate chain
+// contains a pinned key. Several keys may be pinned for a host to allow key
+// rotation.
+func (p *Politeia) PinPublicKey(host, spkiHash string) error {
+	hash, err := base64.StdEncoding.DecodeString(spkiHash)
+	if err != nil || len(hash) != sha256.Size {
+		return newError(ErrInvalid)
+	}
+
+	hostname, err := politeiaHostname(host)
+	if err != nil {
+		return err
+	}
+
+	pins := p.pinnedPublicKeys()
+	for _, pin := range pins[hostname] {
+		if pin == spkiHash {
+			return nil
+		}
+	}
+	pins[hostname] = append(pins[hostname], spkiHash)
+	p.mwRef.SaveUserConfigValue(PoliteiaPinnedKeysConfigKey, pins)
+	p.resetClient()
+	return nil
+}
+
+// PinCertificate pins the public key of the PEM encoded certificate for the
+// politeia host. See PinPublicKey.
+func (p *Politeia) PinCertificate(host, certificate string) error {
+	cert, err := parsePEMCertificate(certificate)
+	if err != nil {
+		return err
+	}
+	return p.PinPublicKey(host, spkiHash(cert))
+}
+
+// ClearPins removes all keys pinned for the politeia host.
+func (p *Politeia) ClearPins(host string) error {
+	hostname, err := politeiaHostname(host)
+	if err != nil {
+		return err
+	}
+
+	pins := p.pinnedPublicKeys()
+	delete(pins, hostname)
+	p.mwRef.SaveUserConfigValue(PoliteiaPinnedKeysConfigKey, pins)
+	p.resetClient()
+	return nil
+}
+
+// SetBuiltInPinsEnabled enables or disables the keys pinned by default for
+// the politeia hosts of the network, in addition to the keys pinned with
+// PinPublicKey. Built-in pins are disabled by default since connections to
+// the default hosts fail once they switch to a CA that is not pinned.
+func (p *Politeia) SetBuiltInPinsEnabled(enabled bool) {
+	p.mwRef.SetBoolConfigValueForKey(PoliteiaBuiltInPinsConfigKey, enabled)
+	p.resetClient()
+}
+
+// BuiltInPinsEnabled returns true if the keys pinned by default for the
+// politeia hosts of the network are enforced.
+func (p *Politeia) BuiltInPinsEnabled() bool {
+	return p.mwRef.ReadBoolConfigValueForKey(PoliteiaBuiltInPinsConfigKey, false)
+}
+
+// AddTrustedCertificate adds the PEM encoded certificate to the certificates
+// trusted when connecting to politeia servers, in addition to the system
+// roots. This allows connecting to self-hosted politeia instances using a
+// private CA or a self-signed certificate.
+func (p *Politeia) AddTrustedCertificate(certificate string) error {
+	if _, err := parsePEMCertificate(certificate); err != nil {
+		return err
+	}
+
+	certificates := p.trustedCertificates()
+	for _, trusted := range certificates {
+		if trusted == certificate {
+			return nil
+		}
+	}
+	certificates = append(certificates, certificate)
+	p.mwRef.SaveUserConfigValue(PoliteiaTrustedCertsConfigKey, certificates)
+	p.resetClient()
+	return nil
+}
+
+// ClearTrustedCertificates removes all certificates added with
+// AddTrustedCertificate.
+func (p *Politeia) ClearTrustedCertificates() {
+	p.mwRef.DeleteUserConfigValueForKey(PoliteiaTrustedCertsConfigKey)
+	p.resetClient()
+}
+
+// resetClient drops the cached politeia clients so that the next requests use
+// the current trust settings. The client of a running sync is kept until the
+// sync stops.
+func (p *Politeia) resetClient() {
+	p.mu.Lock()
+	p.clients = make(map[string]*politeiaClient)
+	if p.cancelSync == nil {
+		p.client = nil
+	}
+	p.mu.Unlock()
+}
+
+func (p *Politeia) pinnedPublicKeys() map[string][]string {
+	pins := make(map[string][]string)
+	p.mwRef.ReadUserConfigValue(PoliteiaPinnedKeysConfigKey, &pins)
+	return pins
+}
+
+// hostPins returns the keys pinned for hostname, including the built-in pins
+// of the network if they are enabled.
+func (p *Politeia) hostPins(hostname string) []string {
+	pins := p.pinnedPublicKeys()[hostname]
+	if p.BuiltInPinsEnabled() {
+		pins = append(pins, builtInPoliteiaPins[p.mwRef.chainParams.Net][hostname]...)
+	}
+	return pins
+}
+
+func (p *Politeia) trustedCertificates() []string {
+	var certificates []string
+	p.mwRef.ReadUserConfigValue(PoliteiaTrustedCertsConfigKey, &certificates)
+	return certificates
+}
+
+// newClient creates a politeia client for host that verifies the server
+// certificate against the system roots and the trusted certificates, and
+// enforces the keys pinned for host, if any.
+func (p *Politeia) newClient(host string) (*politeiaClient, error) {
+	hostname, err := politeiaHostname(host)
+	if err != nil {
+		return nil, err
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		log.Warnf("Politeia: system certificates unavailable: %v", err)
+		roots = x509.NewCertPool()
+	}
+	for _, certificate := range p.trustedCertificates() {
+		roots.AppendCertsFromPEM([]byte(certificate))
+	}
+
+	tlsConfig := &tls.Config{
+		RootCAs:    roots,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if pins := p.hostPins(hostname); len(pins) > 0 {
+		tlsConfig.VerifyPeerCertificate = verifyPinnedPublicKeys(hostname, pins)
+	}
+
+	return newPoliteiaClient(host, tlsConfig), nil
+}
+
+// verifyPinnedPublicKeys returns a function that ensures that at least one of
+// the verified certificate chains contains one of the pinned keys.
+func verifyPinnedPublicKeys(host string, pins []string) func([][]byte, [][]*x509.Certificate) error {
+	return func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+		var presentedKeys []string
+		for _, chain := range verifiedChains {
+			for _, cert := range chain {
+				hash := spkiHash(cert)
+				for _, pin := range pins {
+					if hash == pin {
+						return nil
+					}
+				}
+				presentedKeys = append(presentedKeys, hash)
+			}
+		}
+
+		log.Errorf("Politeia: certificate of %s does not match pinned keys, presented keys: %s",
+			host, strings.Join(presentedKeys, ", "))
+		return &CertificatePinningError{
+			Host:          host,
+			PresentedKeys: presentedKeys,
+		}
+	}
+}
+
+func spkiHash(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func parsePEMCertificate(certificate string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certificate))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, newError(ErrInvalidCertificate)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		log.Errorf("invalid politeia certificate: %v", err)
+		return nil, newError(ErrInvalidCertificate)
+	}
+	return cert, nil
+}
+
+// politeiaHostname returns the hostname used to key the pins of host, which
+// may be a URL such as PoliteiaMainnetHost.
+func politeiaHostname(host string) (string, error) {
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	u, err := url.Parse(host)
+	if err != nil || u.Hostname() == "" {
+		return "", newError(ErrInvalidAddress)
+	}
+	return strings.ToLower(u.Hostname()), nil
+}
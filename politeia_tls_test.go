@@ -0,0 +1,104 @@
+package dcrlibwallet
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"net/http/httptest"
+
+	www "github.com/decred/politeia/politeiawww/api/www/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Politeia TLS", func() {
+	var mw *MultiWallet
+	var cleanup func()
+	var server, otherServer *httptest.Server
+
+	BeforeEach(func() {
+		mw, cleanup = newTestMultiWallet()
+
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(www.CsrfToken, "csrf")
+			Expect(json.NewEncoder(w).Encode(www.VersionReply{Version: 1})).To(Succeed())
+		})
+		server = newTestTLSServer(handler)
+		otherServer = newTestTLSServer(handler)
+	})
+
+	AfterEach(func() {
+		server.Close()
+		otherServer.Close()
+		cleanup()
+	})
+
+	fetchVersion := func() error {
+		client, err := mw.Politeia.newClient(server.URL)
+		ExpectWithOffset(1, err).To(BeNil())
+		_, err = client.version()
+		return err
+	}
+
+	It("verifies certificates against the trusted certificates", func() {
+		By("Rejecting unknown certificates")
+		err := fetchVersion()
+		Expect(err).ToNot(BeNil())
+		var pinningErr *CertificatePinningError
+		Expect(stderrors.As(err, &pinningErr)).To(BeFalse())
+
+		By("Accepting trusted certificates of unpinned hosts")
+		Expect(mw.Politeia.AddTrustedCertificate(certificatePEM(server))).To(Succeed())
+		Expect(fetchVersion()).To(Succeed())
+
+		mw.Politeia.ClearTrustedCertificates()
+		Expect(fetchVersion()).ToNot(Succeed())
+	})
+
+	It("enforces pinned keys", func() {
+		Expect(mw.Politeia.AddTrustedCertificate(certificatePEM(server))).To(Succeed())
+
+		By("Accepting a certificate with a pinned key")
+		Expect(mw.Politeia.PinCertificate(server.URL, certificatePEM(server))).To(Succeed())
+		Expect(fetchVersion()).To(Succeed())
+
+		By("Rejecting a certificate without a pinned key")
+		Expect(mw.Politeia.ClearPins(server.URL)).To(Succeed())
+		Expect(mw.Politeia.PinCertificate(server.URL, certificatePEM(otherServer))).To(Succeed())
+		err := fetchVersion()
+		Expect(err).To(MatchError(ErrCertificatePinMismatch))
+		var pinningErr *CertificatePinningError
+		Expect(stderrors.As(err, &pinningErr)).To(BeTrue())
+		Expect(pinningErr.Host).To(Equal("127.0.0.1"))
+		Expect(pinningErr.PresentedKeys).To(ConsistOf(spkiHash(server.Certificate())))
+
+		By("Not pinning other hosts")
+		Expect(mw.Politeia.ClearPins(server.URL)).To(Succeed())
+		Expect(mw.Politeia.PinCertificate("https://localhost", certificatePEM(otherServer))).To(Succeed())
+		Expect(fetchVersion()).To(Succeed())
+	})
+
+	It("pins the default hosts of the network only when enabled", func() {
+		hostname, err := politeiaHostname(PoliteiaTestnetHost)
+		Expect(err).To(BeNil())
+
+		Expect(mw.Politeia.BuiltInPinsEnabled()).To(BeFalse())
+		Expect(mw.Politeia.hostPins(hostname)).To(BeEmpty())
+
+		mw.Politeia.SetBuiltInPinsEnabled(true)
+		Expect(mw.Politeia.BuiltInPinsEnabled()).To(BeTrue())
+		Expect(mw.Politeia.hostPins(hostname)).To(Equal(isrgRootPins))
+
+		By("Not pinning the hosts of other networks")
+		mainnetHostname, err := politeiaHostname(PoliteiaMainnetHost)
+		Expect(err).To(BeNil())
+		Expect(mw.Politeia.hostPins(mainnetHostname)).To(BeEmpty())
+
+		By("Keeping the pins added by the user")
+		Expect(mw.Politeia.PinCertificate(hostname, certificatePEM(server))).To(Succeed())
+		Expect(mw.Politeia.hostPins(hostname)).To(HaveLen(len(isrgRootPins) + 1))
+
+		mw.Politeia.SetBuiltInPinsEnabled(false)
+		Expect(mw.Politeia.hostPins(hostname)).To(Equal([]string{spkiHash(server.Certificate())}))
+	})
+})
@@ -0,0 +1,209 @@
+package dcrlibwallet
+
+import (
+	"fmt"
+
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+)
+
+// GetProposalUserStateRaw returns the bookmark, read and reminder state of the
+// proposal identified by token.
+func (p *Politeia) GetProposalUserStateRaw(token string) (*ProposalUserState, error) {
+	state := &ProposalUserState{Token: token}
+	err := p.mwRef.db.One("Token", token, state)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, fmt.Errorf("error fetching proposal state: %s", err.Error())
+	}
+	return state, nil
+}
+
+// GetProposalUserState returns the result of GetProposalUserStateRaw as a
+// JSON string.
+func (p *Politeia) GetProposalUserState(token string) (string, error) {
+	return p.marshalResult(p.GetProposalUserStateRaw(token))
+}
+
+// SetProposalBookmarked stars or unstars the proposal identified by token.
+func (p *Politeia) SetProposalBookmarked(token string, bookmarked bool) error {
+	return p.updateProposalUserState(token, func(_ *Proposal, state *ProposalUserState) {
+		state.Bookmarked = bookmarked
+	})
+}
+
+// GetBookmarkedProposalsRaw returns the starred proposals, newest first.
+func (p *Politeia) GetBookmarkedProposalsRaw() ([]Proposal, error) {
+	var states []ProposalUserState
+	err := p.mwRef.db.Find("Bookmarked", true, &states)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, fmt.Errorf("error fetching bookmarked proposals: %s", err.Error())
+	}
+
+	tokens := make([]string, len(states))
+	for i := range states {
+		tokens[i] = states[i].Token
+	}
+
+	var proposals []Proposal
+	err = p.mwRef.db.Select(q.In("Token", tokens)).OrderBy("PublishedAt").Reverse().Find(&proposals)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, fmt.Errorf("error fetching bookmarked proposals: %s", err.Error())
+	}
+
+	return proposals, nil
+}
+
+// GetBookmarkedProposals returns the result of GetBookmarkedProposalsRaw as a
+// JSON string.
+func (p *Politeia) GetBookmarkedProposals() (string, error) {
+	return p.marshalResult(p.GetBookmarkedProposalsRaw())
+}
+
+// MarkProposalRead marks the current version of the proposal identified by
+// token as read. The proposal becomes unread again if it is edited.
+func (p *Politeia) MarkProposalRead(token string) error {
+	return p.updateProposalUserState(token, func(proposal *Proposal, state *ProposalUserState) {
+		state.ReadVersion = proposal.Version
+	})
+}
+
+// MarkProposalUnread marks the proposal identified by token as unread.
+func (p *Politeia) MarkProposalUnread(token string) error {
+	return p.updateProposalUserState(token, func(_ *Proposal, state *ProposalUserState) {
+		state.ReadVersion = ""
+	})
+}
+
+// IsProposalRead returns true if the latest version of the proposal
+// identified by token was marked as read.
+func (p *Politeia) IsProposalRead(token string) (bool, error) {
+	proposal, err := p.GetProposalRaw(token)
+	if err != nil {
+		return false, translateError(err)
+	}
+
+	state, err := p.GetProposalUserStateRaw(token)
+	if err != nil {
+		return false, err
+	}
+
+	return state.ReadVersion == proposal.Version, nil
+}
+
+// CountUnread returns the number of proposals in category whose latest
+// version was not read.
+func (p *Politeia) CountUnread(category int32) (int32, error) {
+	proposals, err := p.GetProposalsRaw(category, 0, 0, true)
+	if err != nil {
+		return 0, err
+	}
+
+	var states []ProposalUserState
+	err = p.mwRef.db.All(&states)
+	if err != nil && err != storm.ErrNotFound {
+		return 0, fmt.Errorf("error fetching proposal states: %s", err.Error())
+	}
+
+	readVersions := make(map[string]string, len(states))
+	for _, state := range states {
+		readVersions[state.Token] = state.ReadVersion
+	}
+
+	var unread int32
+	for _, proposal := range proposals {
+		if readVersions[proposal.Token] != proposal.Version {
+			unread++
+		}
+	}
+	return unread, nil
+}
+
+// SetVoteReminder requests a OnProposalVoteEnding notification when the vote
+// on the proposal identified by token ends in blocksBefore blocks or less.
+// A blocksBefore of 0 removes the reminder.
+func (p *Politeia) SetVoteReminder(token string, blocksBefore int32) error {
+	if blocksBefore < 0 {
+		return newError(ErrInvalid)
+	}
+
+	return p.updateProposalUserState(token, func(_ *Proposal, state *ProposalUserState) {
+		state.ReminderBlocks = blocksBefore
+		state.ReminderSent = false
+	})
+}
+
+func (p *Politeia) updateProposalUserState(token string, update func(*Proposal, *ProposalUserState)) error {
+	proposal, err := p.GetProposalRaw(token)
+	if err != nil {
+		return translateError(err)
+	}
+
+	state, err := p.GetProposalUserStateRaw(token)
+	if err != nil {
+		return err
+	}
+
+	update(proposal, state)
+
+	err = p.mwRef.db.Save(state)
+	if err != nil {
+		return fmt.Errorf("error saving proposal state: %s", err.Error())
+	}
+	return nil
+}
+
+// checkVoteReminders sends the reminders set with SetVoteReminder for the
+// votes ending within the requested number of blocks after blockHeight.
+func (p *Politeia) checkVoteReminders(blockHeight int32) {
+	// each wallet attaches the same block, send reminders once
+	p.voteRemindersMu.Lock()
+	defer p.voteRemindersMu.Unlock()
+
+	var states []ProposalUserState
+	err := p.mwRef.db.Select(
+		q.Gt("ReminderBlocks", 0),
+		q.Eq("ReminderSent", false),
+	).Find(&states)
+	if err != nil {
+		if err != storm.ErrNotFound {
+			log.Errorf("Error fetching proposal vote reminders: %v", err)
+		}
+		return
+	}
+
+	for i := range states {
+		proposal, err := p.GetProposalRaw(states[i].Token)
+		if err != nil {
+			log.Errorf("Error fetching proposal %s: %v", states[i].Token, err)
+			continue
+		}
+
+		// the end height is unknown until the vote starts
+		if proposal.VoteEndHeight == 0 || blockHeight >= proposal.VoteEndHeight {
+			continue
+		}
+
+		blocksLeft := proposal.VoteEndHeight - blockHeight
+		if blocksLeft > states[i].ReminderBlocks {
+			continue
+		}
+
+		states[i].ReminderSent = true
+		err = p.mwRef.db.Save(&states[i])
+		if err != nil {
+			log.Errorf("Error saving proposal state: %v", err)
+			continue
+		}
+
+		p.publishVoteEnding(proposal, blocksLeft)
+	}
+}
+
+func (p *Politeia) publishVoteEnding(proposal *Proposal, blocksLeft int32) {
+	p.notificationListenersMu.Lock()
+	defer p.notificationListenersMu.Unlock()
+
+	for _, notificationListener := range p.notificationListeners {
+		notificationListener.OnProposalVoteEnding(proposal, blocksLeft)
+	}
+}
@@ -0,0 +1,155 @@
+package dcrlibwallet
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// voteEndingListener records the OnProposalVoteEnding notifications.
+type voteEndingListener struct {
+	politeiaSyncTestListener
+	endings map[string][]int32
+}
+
+func (l *voteEndingListener) OnProposalVoteEnding(proposal *Proposal, blocksLeft int32) {
+	l.endings[proposal.Token] = append(l.endings[proposal.Token], blocksLeft)
+}
+
+var _ = Describe("Proposal user state", func() {
+	var mw *MultiWallet
+	var cleanup func()
+	var listener *voteEndingListener
+
+	BeforeEach(func() {
+		mw, cleanup = newTestMultiWallet()
+
+		listener = &voteEndingListener{endings: make(map[string][]int32)}
+		Expect(mw.Politeia.AddNotificationListener(listener, "user-state")).To(Succeed())
+
+		for _, proposal := range []*Proposal{
+			{Token: "active", Category: ProposalCategoryActive, Version: "1", PublishedAt: 1, VoteEndHeight: 1000},
+			{Token: "pre", Category: ProposalCategoryPre, Version: "1", PublishedAt: 2},
+			{Token: "other", Category: ProposalCategoryActive, Version: "2", PublishedAt: 3, VoteEndHeight: 2000},
+		} {
+			Expect(mw.Politeia.saveOrOverwiteProposal(proposal)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	updateProposal := func(token string, update func(*Proposal)) {
+		proposal, err := mw.Politeia.GetProposalRaw(token)
+		ExpectWithOffset(1, err).To(BeNil())
+		update(proposal)
+		ExpectWithOffset(1, mw.db.Update(proposal)).To(Succeed())
+	}
+
+	It("bookmarks proposals", func() {
+		Expect(mw.Politeia.SetProposalBookmarked("active", true)).To(Succeed())
+		Expect(mw.Politeia.SetProposalBookmarked("other", true)).To(Succeed())
+		Expect(mw.Politeia.SetProposalBookmarked("pre", false)).To(Succeed())
+
+		proposals, err := mw.Politeia.GetBookmarkedProposalsRaw()
+		Expect(err).To(BeNil())
+		Expect(proposals).To(HaveLen(2))
+		Expect(proposals[0].Token).To(Equal("other"))
+		Expect(proposals[1].Token).To(Equal("active"))
+
+		Expect(mw.Politeia.SetProposalBookmarked("other", false)).To(Succeed())
+		proposals, err = mw.Politeia.GetBookmarkedProposalsRaw()
+		Expect(err).To(BeNil())
+		Expect(proposals).To(HaveLen(1))
+
+		Expect(mw.Politeia.SetProposalBookmarked("unknown", true)).To(MatchError(ErrNotExist))
+	})
+
+	It("tracks the read state of proposal versions", func() {
+		unread, err := mw.Politeia.CountUnread(ProposalCategoryActive)
+		Expect(err).To(BeNil())
+		Expect(unread).To(Equal(int32(2)))
+
+		Expect(mw.Politeia.MarkProposalRead("active")).To(Succeed())
+		read, err := mw.Politeia.IsProposalRead("active")
+		Expect(err).To(BeNil())
+		Expect(read).To(BeTrue())
+		unread, err = mw.Politeia.CountUnread(ProposalCategoryActive)
+		Expect(err).To(BeNil())
+		Expect(unread).To(Equal(int32(1)))
+
+		By("Marking edited proposals unread")
+		updateProposal("active", func(proposal *Proposal) {
+			proposal.Version = "2"
+		})
+		read, err = mw.Politeia.IsProposalRead("active")
+		Expect(err).To(BeNil())
+		Expect(read).To(BeFalse())
+
+		Expect(mw.Politeia.MarkProposalRead("active")).To(Succeed())
+		Expect(mw.Politeia.MarkProposalUnread("active")).To(Succeed())
+		read, err = mw.Politeia.IsProposalRead("active")
+		Expect(err).To(BeNil())
+		Expect(read).To(BeFalse())
+	})
+
+	Describe("checkVoteReminders", func() {
+		It("reminds once when the vote ends within the requested blocks", func() {
+			Expect(mw.Politeia.SetVoteReminder("active", 100)).To(Succeed())
+
+			By("Not reminding before the requested blocks")
+			mw.Politeia.checkVoteReminders(899)
+			Expect(listener.endings).To(BeEmpty())
+
+			mw.Politeia.checkVoteReminders(900)
+			Expect(listener.endings).To(Equal(map[string][]int32{"active": {100}}))
+
+			By("Not reminding again for the next blocks")
+			mw.Politeia.checkVoteReminders(901)
+			mw.Politeia.checkVoteReminders(950)
+			Expect(listener.endings["active"]).To(HaveLen(1))
+
+			state, err := mw.Politeia.GetProposalUserStateRaw("active")
+			Expect(err).To(BeNil())
+			Expect(state.ReminderSent).To(BeTrue())
+
+			By("Reminding again after the reminder is set again")
+			Expect(mw.Politeia.SetVoteReminder("active", 60)).To(Succeed())
+			mw.Politeia.checkVoteReminders(950)
+			Expect(listener.endings["active"]).To(Equal([]int32{100, 50}))
+		})
+
+		It("reminds votes that are first seen within the requested blocks", func() {
+			Expect(mw.Politeia.SetVoteReminder("other", 500)).To(Succeed())
+			mw.Politeia.checkVoteReminders(1990)
+			Expect(listener.endings).To(Equal(map[string][]int32{"other": {10}}))
+		})
+
+		It("skips votes that have not started or have ended", func() {
+			Expect(mw.Politeia.SetVoteReminder("pre", 100)).To(Succeed())
+			Expect(mw.Politeia.SetVoteReminder("active", 100)).To(Succeed())
+
+			mw.Politeia.checkVoteReminders(1000)
+			mw.Politeia.checkVoteReminders(1500)
+			Expect(listener.endings).To(BeEmpty())
+
+			By("Reminding the vote once it started")
+			updateProposal("pre", func(proposal *Proposal) {
+				proposal.Category = ProposalCategoryActive
+				proposal.VoteEndHeight = 1550
+			})
+			mw.Politeia.checkVoteReminders(1500)
+			Expect(listener.endings).To(Equal(map[string][]int32{"pre": {50}}))
+		})
+
+		It("removes reminders", func() {
+			Expect(mw.Politeia.SetVoteReminder("active", 100)).To(Succeed())
+			Expect(mw.Politeia.SetVoteReminder("active", 0)).To(Succeed())
+			mw.Politeia.checkVoteReminders(950)
+			Expect(listener.endings).To(BeEmpty())
+
+			Expect(mw.Politeia.SetVoteReminder("active", -1)).To(MatchError(ErrInvalid))
+			Expect(mw.Politeia.SetVoteReminder("unknown", 10)).To(MatchError(ErrNotExist))
+		})
+	})
+})
@@ -0,0 +1,181 @@
+package dcrlibwallet
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"decred.org/dcrwallet/errors"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrutil/v3"
+	www "github.com/decred/politeia/politeiawww/api/www/v1"
+)
+
+// CastVotes votes voteOption (e.g. "yes" or "no") on the proposal identified
+// by token using every ticket of the wallet that is eligible to vote on the
+// proposal and has not voted yet. Each vote is signed with the key of the
+// largest commitment address of the ticket, as required by politeia, and
+// submitted to politeiawww. The votes accepted by the server are recorded on
+// the proposal, see Proposal.WalletVotes. ErrVoteNotStarted is returned if
+// voting on the proposal has not started or has already finished.
+func (p *Politeia) CastVotes(walletID int, token, voteOption, passphrase string) error {
+	wallet := p.mwRef.WalletWithID(walletID)
+	if wallet == nil {
+		return walletError(walletID, "CastVotes", newError(ErrNotExist))
+	} else if wallet.IsWatchingOnlyWallet() {
+		return walletError(walletID, "CastVotes", newError(ErrWalletIsWatchOnly))
+	}
+
+	proposal, err := p.GetProposalRaw(token)
+	if err != nil {
+		return walletError(walletID, "CastVotes", err)
+	}
+
+	client, err := p.getClient("")
+	if err != nil {
+		return walletError(walletID, "CastVotes", err)
+	}
+
+	// Only votes that have started and not finished yet can be cast. The
+	// vote status of the proposal record may be stale, so the current one
+	// is fetched from the server.
+	summaries, err := client.batchVoteSummary([]string{token})
+	if err != nil {
+		return walletError(walletID, "CastVotes", err)
+	}
+	if summary, ok := summaries[token]; !ok || summary.Status != www.PropVoteStatusStarted {
+		return walletError(walletID, "CastVotes", newError(ErrVoteNotStarted))
+	}
+
+	voteResults, err := client.voteResults(token)
+	if err != nil {
+		return walletError(walletID, "CastVotes", err)
+	}
+
+	var voteBits string
+	for _, option := range voteResults.StartVote.Vote.Options {
+		if option.Id == voteOption {
+			voteBits = strconv.FormatUint(option.Bits, 16)
+			break
+		}
+	}
+	if voteBits == "" {
+		return walletError(walletID, "CastVotes", newError(ErrInvalid))
+	}
+
+	eligibleTickets, err := p.eligibleWalletTickets(wallet, voteResults)
+	if err != nil {
+		return walletError(walletID, "CastVotes", err)
+	}
+	if len(eligibleTickets) == 0 {
+		return walletError(walletID, "CastVotes", newError(ErrNoEligibleTickets))
+	}
+
+	lock := make(chan time.Time, 1)
+	defer func() {
+		lock <- time.Time{}
+	}()
+
+	ctx := wallet.shutdownContext()
+	err = wallet.internal.Unlock(ctx, []byte(passphrase), lock)
+	if err != nil {
+		return walletError(walletID, "CastVotes", err)
+	}
+
+	votes := make([]www.CastVote, 0, len(eligibleTickets))
+	for _, ticket := range eligibleTickets {
+		ticketHash := ticket.hash.String()
+		msg := token + ticketHash + voteBits
+		signature, err := wallet.internal.SignMessage(ctx, msg, ticket.commitmentAddress)
+		if err != nil {
+			return walletError(walletID, "CastVotes", err)
+		}
+
+		votes = append(votes, www.CastVote{
+			Token:     token,
+			Ticket:    ticketHash,
+			VoteBit:   voteBits,
+			Signature: hex.EncodeToString(signature),
+		})
+	}
+
+	receipts, err := client.castVotes(votes)
+	if err != nil {
+		return walletError(walletID, "CastVotes", err)
+	}
+
+	now := time.Now().Unix()
+	var failedVotes int
+	for i, receipt := range receipts {
+		if i >= len(votes) {
+			break
+		}
+		if receipt.Error != "" {
+			log.Errorf("[%d] vote on proposal %s with ticket %s rejected: %s",
+				walletID, token, votes[i].Ticket, receipt.Error)
+			failedVotes++
+			continue
+		}
+
+		proposal.WalletVotes = append(proposal.WalletVotes, &ProposalWalletVote{
+			WalletID:   walletID,
+			Ticket:     votes[i].Ticket,
+			VoteOption: voteOption,
+			Receipt:    receipt.Signature,
+			CastAt:     now,
+		})
+	}
+
+	err = p.mwRef.db.Update(proposal)
+	if err != nil {
+		log.Errorf("[%d] Error saving votes on proposal %s: %v", walletID, token, err)
+		return walletError(walletID, "CastVotes", err)
+	}
+
+	if failedVotes > 0 {
+		err = errors.E(errors.Policy, fmt.Sprintf("%d of %d votes were rejected", failedVotes, len(votes)))
+		return walletError(walletID, "CastVotes", err)
+	}
+	return nil
+}
+
+type votingTicket struct {
+	hash              *chainhash.Hash
+	commitmentAddress dcrutil.Address
+}
+
+// eligibleWalletTickets returns the tickets of the wallet that are eligible
+// to vote on the proposal and have not voted yet.
+func (p *Politeia) eligibleWalletTickets(wallet *Wallet, voteResults *www.VoteResultsReply) ([]*votingTicket, error) {
+	castVotes := make(map[string]bool, len(voteResults.CastVotes))
+	for _, vote := range voteResults.CastVotes {
+		castVotes[vote.Ticket] = true
+	}
+
+	ticketHashes := make([]*chainhash.Hash, 0, len(voteResults.StartVoteReply.EligibleTickets))
+	for _, ticket := range voteResults.StartVoteReply.EligibleTickets {
+		if castVotes[ticket] {
+			continue
+		}
+		hash, err := chainhash.NewHashFromStr(ticket)
+		if err != nil {
+			return nil, err
+		}
+		ticketHashes = append(ticketHashes, hash)
+	}
+
+	hashes, addresses, err := wallet.internal.CommittedTickets(wallet.shutdownContext(), ticketHashes)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	tickets := make([]*votingTicket, len(hashes))
+	for i := range hashes {
+		tickets[i] = &votingTicket{
+			hash:              hashes[i],
+			commitmentAddress: addresses[i],
+		}
+	}
+	return tickets, nil
+}
@@ -0,0 +1,97 @@
+package dcrlibwallet
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+
+	www "github.com/decred/politeia/politeiawww/api/www/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CastVotes", func() {
+	var mw *MultiWallet
+	var cleanup func()
+	var wallet *Wallet
+	var server *httptest.Server
+	var voteStatus www.PropVoteStatusT
+	var voteResultsRequests int32
+
+	BeforeEach(func() {
+		mw, cleanup = newTestMultiWallet()
+		wallet = newTestWallet(mw, "voting")
+
+		voteStatus = www.PropVoteStatusStarted
+		atomic.StoreInt32(&voteResultsRequests, 0)
+
+		reply := func(w http.ResponseWriter, v interface{}) {
+			w.Header().Set(www.CsrfToken, "csrf")
+			Expect(json.NewEncoder(w).Encode(v)).To(Succeed())
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/v1/version", func(w http.ResponseWriter, r *http.Request) {
+			reply(w, www.VersionReply{Version: 1, Route: "/v1"})
+		})
+		mux.HandleFunc("/api/v1/policy", func(w http.ResponseWriter, r *http.Request) {
+			reply(w, www.PolicyReply{ProposalListPageSize: 20})
+		})
+		mux.HandleFunc("/api/v1/proposals/batchvotesummary", func(w http.ResponseWriter, r *http.Request) {
+			reply(w, www.BatchVoteSummaryReply{Summaries: map[string]www.VoteSummary{
+				fakeProposalToken: {Status: voteStatus},
+			}})
+		})
+		mux.HandleFunc("/api/v1/proposals/"+fakeProposalToken+"/votes", func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&voteResultsRequests, 1)
+			var results www.VoteResultsReply
+			results.StartVote.Vote.Options = []www.VoteOption{
+				{Id: "yes", Bits: 2},
+				{Id: "no", Bits: 1},
+			}
+			reply(w, results)
+		})
+		server = httptest.NewTLSServer(mux)
+
+		client := fakePoliteiaClient(server)
+		Expect(client.loadServerPolicy()).To(Succeed())
+		mw.Politeia.client = client
+
+		Expect(mw.Politeia.saveOrOverwiteProposal(&Proposal{Token: fakeProposalToken})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		server.Close()
+		cleanup()
+	})
+
+	It("rejects votes on proposals that are not being voted on", func() {
+		for _, status := range []www.PropVoteStatusT{www.PropVoteStatusNotAuthorized,
+			www.PropVoteStatusAuthorized, www.PropVoteStatusFinished} {
+
+			voteStatus = status
+			err := mw.Politeia.CastVotes(wallet.ID, fakeProposalToken, "yes", "passphrase")
+			Expect(err).To(MatchError(ErrVoteNotStarted))
+		}
+		Expect(atomic.LoadInt32(&voteResultsRequests)).To(BeZero())
+	})
+
+	It("rejects unknown proposals and vote options", func() {
+		err := mw.Politeia.CastVotes(wallet.ID, "unknown", "yes", "passphrase")
+		Expect(err).To(MatchError(ErrNotExist))
+
+		err = mw.Politeia.CastVotes(wallet.ID, fakeProposalToken, "abstain", "passphrase")
+		Expect(err).To(MatchError(ErrInvalid))
+	})
+
+	It("requires eligible tickets", func() {
+		err := mw.Politeia.CastVotes(wallet.ID, fakeProposalToken, "yes", "passphrase")
+		Expect(err).To(MatchError(ErrNoEligibleTickets))
+		Expect(atomic.LoadInt32(&voteResultsRequests)).To(Equal(int32(1)))
+	})
+
+	It("rejects missing wallets", func() {
+		err := mw.Politeia.CastVotes(wallet.ID+1, fakeProposalToken, "yes", "passphrase")
+		Expect(err).To(MatchError(ErrNotExist))
+	})
+})
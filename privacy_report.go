@@ -0,0 +1,146 @@
+package dcrlibwallet
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/planetdecred/dcrlibwallet/walletdata"
+)
+
+// PrivacyReportRaw analyses the transactions and balances of the wallet for
+// privacy issues: funds left unmixed, reused addresses, transactions that
+// merged mixed and unmixed inputs and change outputs linked to mixed funds.
+// The mixed and unmixed accounts are those set for the account mixer; all
+// funds are reported as unmixed if the account mixer is not set up.
+func (wallet *Wallet) PrivacyReportRaw() (*PrivacyReport, error) {
+	mixedAccount := wallet.MixedAccountNumber()
+	unmixedAccount := wallet.UnmixedAccountNumber()
+
+	report := &PrivacyReport{
+		WalletID:                wallet.ID,
+		ReusedAddresses:         []*ReusedAddress{},
+		MergedInputTransactions: []*MergedInputTransaction{},
+		LinkedChangeOutputs:     []*LinkedChangeOutput{},
+	}
+
+	accounts, err := wallet.GetAccountsRaw()
+	if err != nil {
+		return nil, translateError(err)
+	}
+	for _, account := range accounts.Acc {
+		switch {
+		case !wallet.AccountMixerConfigIsSet(), account.Number == unmixedAccount:
+			report.UnmixedBalance += account.TotalBalance
+		case account.Number == mixedAccount:
+			report.MixedBalance += account.TotalBalance
+		default:
+			report.OtherBalance += account.TotalBalance
+		}
+	}
+
+	// the report doesn't need fiat values, read the tx index directly
+	var transactions []Transaction
+	err = wallet.walletDataDB.Read(0, 0, walletdata.TxFilterAll, false, wallet.GetBestBlock(), &transactions)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	reusedAddresses := make(map[string]*ReusedAddress)
+	for _, tx := range transactions {
+		// stake transactions are excluded since they are expected to pay to
+		// the ticket commitment addresses, and mixed transactions always pay
+		// to new addresses
+		if tx.Type != TxTypeRegular {
+			continue
+		}
+
+		received := make(map[string]bool)
+		for _, output := range tx.Outputs {
+			if output.AccountNumber == -1 || output.Address == "" {
+				continue
+			}
+
+			address, ok := reusedAddresses[output.Address]
+			if !ok {
+				address = &ReusedAddress{
+					Address:       output.Address,
+					AccountNumber: output.AccountNumber,
+				}
+				reusedAddresses[output.Address] = address
+			}
+			address.TotalReceived += output.Amount
+
+			// an address paid more than once by a transaction is not reused
+			if !received[output.Address] {
+				received[output.Address] = true
+				address.TxHashes = append(address.TxHashes, tx.Hash)
+			}
+		}
+
+		if !wallet.AccountMixerConfigIsSet() {
+			continue
+		}
+
+		var mixedInputs, unmixedInputs int64
+		for _, input := range tx.Inputs {
+			switch input.AccountNumber {
+			case -1:
+			case mixedAccount:
+				mixedInputs += input.Amount
+			default:
+				unmixedInputs += input.Amount
+			}
+		}
+
+		if mixedInputs == 0 {
+			continue
+		}
+
+		if unmixedInputs > 0 {
+			report.MergedInputTransactions = append(report.MergedInputTransactions, &MergedInputTransaction{
+				Hash:          tx.Hash,
+				Timestamp:     tx.Timestamp,
+				MixedInputs:   mixedInputs,
+				UnmixedInputs: unmixedInputs,
+			})
+		}
+
+		for _, output := range tx.Outputs {
+			if output.AccountNumber == -1 || !output.Internal {
+				continue
+			}
+			report.LinkedChangeOutputs = append(report.LinkedChangeOutputs, &LinkedChangeOutput{
+				TxHash:        tx.Hash,
+				Index:         output.Index,
+				Address:       output.Address,
+				Amount:        output.Amount,
+				AccountNumber: output.AccountNumber,
+			})
+		}
+	}
+
+	for _, address := range reusedAddresses {
+		if len(address.TxHashes) > 1 {
+			report.ReusedAddresses = append(report.ReusedAddresses, address)
+		}
+	}
+	sort.Slice(report.ReusedAddresses, func(i, j int) bool {
+		return len(report.ReusedAddresses[i].TxHashes) > len(report.ReusedAddresses[j].TxHashes)
+	})
+
+	return report, nil
+}
+
+// PrivacyReport returns the result of PrivacyReportRaw as a JSON string.
+func (wallet *Wallet) PrivacyReport() (string, error) {
+	report, err := wallet.PrivacyReportRaw()
+	if err != nil {
+		return "", err
+	}
+
+	result, err := json.Marshal(report)
+	if err != nil {
+		return "", translateError(err)
+	}
+	return string(result), nil
+}
@@ -0,0 +1,133 @@
+package dcrlibwallet
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PrivacyReport", func() {
+	const (
+		unmixedAccount = 0
+		mixedAccount   = 1
+	)
+
+	var mw *MultiWallet
+	var cleanup func()
+	var wallet *Wallet
+
+	BeforeEach(func() {
+		mw, cleanup = newTestMultiWallet()
+		wallet = newTestWallet(mw, "privacy")
+
+		output := func(index int32, address string, amount int64, account int32, internal bool) *TxOutput {
+			return &TxOutput{Index: index, Address: address, Amount: amount, AccountNumber: account, Internal: internal}
+		}
+		input := func(amount int64, account int32) *TxInput {
+			return &TxInput{Amount: amount, AccountNumber: account}
+		}
+
+		for _, tx := range []*Transaction{
+			{
+				Hash: "received", Type: TxTypeRegular, Timestamp: 1,
+				Outputs: []*TxOutput{output(0, "reused", 100, unmixedAccount, false), output(1, "foreign", 50, -1, false)},
+			},
+			{
+				Hash: "received-twice", Type: TxTypeRegular, Timestamp: 2,
+				Outputs: []*TxOutput{
+					output(0, "reused", 200, unmixedAccount, false),
+					output(1, "reused", 300, unmixedAccount, false),
+					output(2, "once", 400, unmixedAccount, false),
+				},
+			},
+			{
+				Hash: "merged", Type: TxTypeRegular, Timestamp: 3,
+				Inputs: []*TxInput{input(3000, mixedAccount), input(1000, unmixedAccount), input(500, -1)},
+				Outputs: []*TxOutput{
+					output(0, "foreign", 2500, -1, false),
+					output(1, "change", 1400, unmixedAccount, true),
+				},
+			},
+			{
+				Hash: "mixed-spend", Type: TxTypeRegular, Timestamp: 4,
+				Inputs: []*TxInput{input(2000, mixedAccount)},
+				Outputs: []*TxOutput{
+					output(0, "foreign", 1500, -1, false),
+					output(1, "mixed-change", 490, mixedAccount, true),
+					output(2, "self", 5, mixedAccount, false),
+				},
+			},
+			{
+				Hash: "unmixed-spend", Type: TxTypeRegular, Timestamp: 5,
+				Inputs:  []*TxInput{input(2000, unmixedAccount)},
+				Outputs: []*TxOutput{output(0, "unmixed-change", 1990, unmixedAccount, true)},
+			},
+			{
+				Hash: "mix", Type: TxTypeMixed, Timestamp: 6,
+				Inputs:  []*TxInput{input(2000, unmixedAccount)},
+				Outputs: []*TxOutput{output(0, "reused", 1000, mixedAccount, false)},
+			},
+			{
+				Hash: "ticket", Type: TxTypeTicketPurchase, Timestamp: 7,
+				Outputs: []*TxOutput{output(0, "reused", 1000, unmixedAccount, false)},
+			},
+		} {
+			tx.WalletID = wallet.ID
+			tx.BlockHeight = 10
+			_, err := wallet.walletDataDB.SaveOrUpdate(&Transaction{}, tx)
+			Expect(err).To(BeNil())
+		}
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	It("reports reused addresses without the account mixer", func() {
+		report, err := wallet.PrivacyReportRaw()
+		Expect(err).To(BeNil())
+
+		Expect(report.WalletID).To(Equal(wallet.ID))
+		Expect(report.MixedBalance).To(BeZero())
+		Expect(report.UnmixedBalance).To(BeZero())
+		Expect(report.OtherBalance).To(BeZero())
+
+		Expect(report.ReusedAddresses).To(Equal([]*ReusedAddress{{
+			Address:       "reused",
+			AccountNumber: unmixedAccount,
+			TotalReceived: 600,
+			TxHashes:      []string{"received", "received-twice"},
+		}}))
+		Expect(report.MergedInputTransactions).To(BeEmpty())
+		Expect(report.LinkedChangeOutputs).To(BeEmpty())
+	})
+
+	It("reports merged inputs and linked change outputs", func() {
+		wallet.SetInt32ConfigValueForKey(AccountMixerMixedAccount, mixedAccount)
+		wallet.SetInt32ConfigValueForKey(AccountMixerUnmixedAccount, unmixedAccount)
+		wallet.SetBoolConfigValueForKey(AccountMixerConfigSet, true)
+
+		report, err := wallet.PrivacyReportRaw()
+		Expect(err).To(BeNil())
+
+		Expect(report.ReusedAddresses).To(HaveLen(1))
+		Expect(report.MergedInputTransactions).To(Equal([]*MergedInputTransaction{{
+			Hash:          "merged",
+			Timestamp:     3,
+			MixedInputs:   3000,
+			UnmixedInputs: 1000,
+		}}))
+		Expect(report.LinkedChangeOutputs).To(Equal([]*LinkedChangeOutput{
+			{TxHash: "merged", Index: 1, Address: "change", Amount: 1400, AccountNumber: unmixedAccount},
+			{TxHash: "mixed-spend", Index: 1, Address: "mixed-change", Amount: 490, AccountNumber: mixedAccount},
+		}))
+
+		By("Encoding the report as JSON")
+		result, err := wallet.PrivacyReport()
+		Expect(err).To(BeNil())
+		var decoded PrivacyReport
+		Expect(json.Unmarshal([]byte(result), &decoded)).To(Succeed())
+		Expect(&decoded).To(Equal(report))
+	})
+})
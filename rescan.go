@@ -5,7 +5,6 @@ import (
 	"math"
 	"time"
 
-	"decred.org/dcrwallet/errors"
 	w "decred.org/dcrwallet/wallet"
 )
 
@@ -17,16 +16,16 @@ func (mw *MultiWallet) RescanBlocksFromHeight(walletID int, startHeight int32) e
 
 	wallet := mw.WalletWithID(walletID)
 	if wallet == nil {
-		return errors.E(ErrNotExist)
+		return newError(ErrNotExist)
 	}
 
 	netBackend, err := wallet.internal.NetworkBackend()
 	if err != nil {
-		return errors.E(ErrNotConnected)
+		return newError(ErrNotConnected)
 	}
 
 	if mw.IsRescanning() || !mw.IsSynced() {
-		return errors.E(ErrInvalid)
+		return newError(ErrInvalid)
 	}
 
 	go func() {
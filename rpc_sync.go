@@ -0,0 +1,309 @@
+package dcrlibwallet
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"time"
+
+	"decred.org/dcrwallet/chain"
+	"decred.org/dcrwallet/errors"
+	"github.com/planetdecred/dcrlibwallet/utils"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	NetworkModeSPV int32 = 0
+	NetworkModeRPC int32 = 1
+)
+
+// SetSpvNetworkMode configures wallets to sync using the Decred p2p network.
+// It takes effect the next time sync is started.
+func (mw *MultiWallet) SetSpvNetworkMode() {
+	mw.SaveUserConfigValue(NetworkModeConfigKey, NetworkModeSPV)
+}
+
+// SetDcrdRPCNetworkMode configures wallets to sync from a trusted dcrd over an
+// authenticated websocket JSON-RPC connection. certificate is the PEM encoded
+// TLS certificate of the dcrd RPC server, only a server presenting exactly
+// this certificate will be trusted. It takes effect the next time sync is
+// started.
+//
+// The password is not saved, it is kept in memory until the MultiWallet is
+// shut down. Apps must supply it again with SetDcrdRPCPassword before
+// syncing in later sessions.
+func (mw *MultiWallet) SetDcrdRPCNetworkMode(host, user, pass, certificate string) error {
+	if host == "" || user == "" || pass == "" {
+		return newError(ErrInvalid)
+	}
+	if err := validatePinnedCertificate([]byte(certificate)); err != nil {
+		return err
+	}
+
+	if _, err := NormalizeAddress(host, utils.DcrdRPCPort(mw.chainParams)); err != nil {
+		return newError(ErrInvalidAddress)
+	}
+
+	mw.SaveUserConfigValue(DcrdRPCHostConfigKey, host)
+	mw.SaveUserConfigValue(DcrdRPCUserConfigKey, user)
+	mw.SaveUserConfigValue(DcrdRPCCertConfigKey, certificate)
+	mw.SaveUserConfigValue(NetworkModeConfigKey, NetworkModeRPC)
+	return mw.SetDcrdRPCPassword(pass)
+}
+
+// SetDcrdRPCPassword sets the password used to authenticate with the dcrd
+// RPC server configured with SetDcrdRPCNetworkMode. The password is only kept
+// in memory and must be set again after the MultiWallet is restarted.
+func (mw *MultiWallet) SetDcrdRPCPassword(pass string) error {
+	if pass == "" {
+		return newError(ErrInvalid)
+	}
+
+	mw.syncData.mu.Lock()
+	mw.syncData.dcrdRPCPass = pass
+	mw.syncData.mu.Unlock()
+
+	// remove the password saved by previous versions
+	if mw.ReadStringConfigValueForKey(DcrdRPCPassConfigKey) != "" {
+		mw.DeleteUserConfigValueForKey(DcrdRPCPassConfigKey)
+	}
+	return nil
+}
+
+// dcrdRPCPassword returns the password set with SetDcrdRPCPassword. A
+// password saved by previous versions is moved from the config database to
+// memory.
+func (mw *MultiWallet) dcrdRPCPassword() string {
+	mw.syncData.mu.RLock()
+	pass := mw.syncData.dcrdRPCPass
+	mw.syncData.mu.RUnlock()
+	if pass != "" {
+		return pass
+	}
+
+	savedPass := mw.ReadStringConfigValueForKey(DcrdRPCPassConfigKey)
+	if savedPass == "" || mw.SetDcrdRPCPassword(savedPass) != nil {
+		return ""
+	}
+	return savedPass
+}
+
+// NetworkMode returns the configured network mode, either NetworkModeSPV
+// or NetworkModeRPC.
+func (mw *MultiWallet) NetworkMode() int32 {
+	return mw.ReadInt32ConfigValueForKey(NetworkModeConfigKey, NetworkModeSPV)
+}
+
+// validatePinnedCertificate ensures that certificate holds exactly one valid
+// PEM encoded x509 certificate.
+func validatePinnedCertificate(certificate []byte) error {
+	block, rest := pem.Decode(certificate)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return newError(ErrInvalidCertificate)
+	}
+	if next, _ := pem.Decode(rest); next != nil {
+		return newError(ErrInvalidCertificate)
+	}
+	if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+		log.Errorf("invalid dcrd rpc certificate: %v", err)
+		return newError(ErrInvalidCertificate)
+	}
+	return nil
+}
+
+// pinnedTLSDialer returns a dial function that establishes TLS connections
+// with servers presenting exactly the PEM encoded certificate, which must be
+// valid, see validatePinnedCertificate. The certificate is trusted whatever
+// its issuer, host names and validity period, as with dcrd's self-signed
+// certificates.
+func pinnedTLSDialer(certificate []byte) func(ctx context.Context, network, address string) (net.Conn, error) {
+	block, _ := pem.Decode(certificate)
+	pinnedCert := block.Bytes
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConn := tls.Client(conn, &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			// the certificate is checked against the pinned certificate
+			// instead of the system roots.
+			InsecureSkipVerify: true,
+			VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+				if len(rawCerts) == 0 || !bytes.Equal(rawCerts[0], pinnedCert) {
+					log.Errorf("dcrd rpc server %s presented a certificate that does not match the pinned certificate", address)
+					return newError(ErrCertificatePinMismatch)
+				}
+				return nil
+			},
+		})
+
+		if deadline, ok := ctx.Deadline(); ok {
+			tlsConn.SetDeadline(deadline)
+		}
+		err = tlsConn.Handshake()
+		if err != nil {
+			conn.Close()
+			if IsErrorCode(err, ErrCertificatePinMismatch) {
+				return nil, newError(ErrCertificatePinMismatch)
+			}
+			return nil, err
+		}
+		tlsConn.SetDeadline(time.Time{})
+
+		return tlsConn, nil
+	}
+}
+
+// Sync starts syncing all wallets using the configured network mode.
+func (mw *MultiWallet) Sync() error {
+	if mw.NetworkMode() == NetworkModeRPC {
+		return mw.RpcSync()
+	}
+	return mw.SpvSync()
+}
+
+// RestartSync cancels the ongoing sync and restarts it using the configured
+// network mode.
+func (mw *MultiWallet) RestartSync() error {
+	mw.syncData.mu.Lock()
+	mw.syncData.restartSyncRequested = true
+	mw.syncData.mu.Unlock()
+
+	mw.CancelSync() // necessary to unset the network backend.
+	return mw.Sync()
+}
+
+// RpcSync syncs all wallets from the dcrd JSON-RPC server configured with
+// SetDcrdRPCNetworkMode. The same sync progress and tx and block
+// notifications as SpvSync are delivered to registered listeners.
+func (mw *MultiWallet) RpcSync() error {
+	// prevent an attempt to sync when the previous syncing has not been canceled
+	if mw.IsSyncing() || mw.IsSynced() {
+		return newError(ErrSyncAlreadyInProgress)
+	}
+
+	host := mw.ReadStringConfigValueForKey(DcrdRPCHostConfigKey)
+	certificate := mw.ReadStringConfigValueForKey(DcrdRPCCertConfigKey)
+	if host == "" {
+		return newError(ErrRPCNotConfigured)
+	}
+	if err := validatePinnedCertificate([]byte(certificate)); err != nil {
+		return err
+	}
+	pass := mw.dcrdRPCPassword()
+	if pass == "" {
+		return newError(ErrPassphraseRequired)
+	}
+
+	// TLS is established by the pinned dialer, the websocket connection is
+	// made over the TLS connection.
+	rpcOptions := &chain.RPCOptions{
+		Address:     host,
+		DefaultPort: utils.DcrdRPCPort(mw.chainParams),
+		User:        mw.ReadStringConfigValueForKey(DcrdRPCUserConfigKey),
+		Pass:        pass,
+		Dial:        pinnedTLSDialer([]byte(certificate)),
+		Insecure:    true,
+	}
+
+	syncableWallets := mw.syncableWallets()
+	if len(syncableWallets) == 0 {
+		return newError(ErrFailedPrecondition)
+	}
+
+	// init activeSyncData to be used to hold data used
+	// to calculate sync estimates only during sync
+	mw.initActiveSyncData()
+
+	syncers := make(map[int]*chain.Syncer, len(syncableWallets))
+	for id, wallet := range syncableWallets {
+		wallet.waitingForHeaders = true
+		wallet.syncing = true
+
+		syncer := chain.NewSyncer(wallet.internal, rpcOptions)
+		syncer.SetCallbacks(mw.rpcSyncCallbacks(id))
+		syncers[id] = syncer
+	}
+
+	run := func(ctx context.Context) error {
+		g, ctx := errgroup.WithContext(ctx)
+		for _, syncer := range syncers {
+			syncer := syncer
+			g.Go(func() error {
+				return syncer.Run(ctx)
+			})
+		}
+		err := g.Wait()
+		mw.handlePeerCountUpdate(0)
+
+		// chain.Syncer wraps the context error, unwrap it so that
+		// cancellation is reported the same way as for SPV sync.
+		if errors.Is(err, context.Canceled) {
+			return context.Canceled
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return context.DeadlineExceeded
+		}
+		return err
+	}
+
+	return mw.startSync(nil, run)
+}
+
+// rpcSyncCallbacks maps the progress callbacks of the dcrd JSON-RPC syncer of
+// a wallet to the callbacks used for SPV sync.
+func (mw *MultiWallet) rpcSyncCallbacks(walletID int) *chain.Callbacks {
+	return &chain.Callbacks{
+		Synced: func(synced bool) {
+			mw.synced(walletID, synced)
+		},
+		FetchMissingCFiltersStarted: func() {
+			// the syncer is connected to dcrd once it starts fetching cfilters.
+			mw.handlePeerCountUpdate(1)
+			mw.fetchCFiltersStarted(walletID)
+		},
+		FetchMissingCFiltersProgress: func(startCFiltersHeight, endCFiltersHeight int32) {
+			mw.fetchCFiltersProgress(walletID, startCFiltersHeight, endCFiltersHeight)
+		},
+		FetchMissingCFiltersFinished: func() {
+			mw.fetchCFiltersEnded(walletID)
+		},
+		FetchHeadersStarted: func() {
+			mw.fetchHeadersStarted(mw.estimatedMainChainTip())
+		},
+		FetchHeadersProgress: mw.fetchHeadersProgress,
+		FetchHeadersFinished: mw.fetchHeadersFinished,
+		DiscoverAddressesStarted: func() {
+			mw.discoverAddressesStarted(walletID)
+		},
+		DiscoverAddressesFinished: func() {
+			mw.discoverAddressesFinished(walletID)
+		},
+		RescanStarted: func() {
+			mw.rescanStarted(walletID)
+		},
+		RescanProgress: func(rescannedThrough int32) {
+			mw.rescanProgress(walletID, rescannedThrough)
+		},
+		RescanFinished: func() {
+			mw.rescanFinished(walletID)
+		},
+	}
+}
+
+// estimatedMainChainTip estimates the height of the main chain tip from the
+// timestamp of the lowest wallet tip.
+func (mw *MultiWallet) estimatedMainChainTip() int32 {
+	lowestBlock := mw.GetLowestBlock()
+	if lowestBlock == nil {
+		return 0
+	}
+	return lowestBlock.Height + mw.estimateBlockHeadersCountAfter(lowestBlock.Timestamp)
+}
@@ -0,0 +1,146 @@
+package dcrlibwallet
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// certificatePEM returns the PEM encoded certificate of the TLS server.
+func certificatePEM(server *httptest.Server) string {
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}
+	return string(pem.EncodeToMemory(block))
+}
+
+// slowCancelSyncListener records the sync starts and takes a while to handle
+// sync cancelations.
+type slowCancelSyncListener struct {
+	started chan bool
+}
+
+func (l *slowCancelSyncListener) OnSyncStarted(wasRestarted bool) {
+	select {
+	case l.started <- wasRestarted:
+	default:
+	}
+}
+
+func (l *slowCancelSyncListener) OnSyncCanceled(willRestart bool) {
+	time.Sleep(200 * time.Millisecond)
+}
+
+func (*slowCancelSyncListener) OnPeerConnectedOrDisconnected(int32)                        {}
+func (*slowCancelSyncListener) OnCFiltersFetchProgress(*CFiltersFetchProgressReport)       {}
+func (*slowCancelSyncListener) OnHeadersFetchProgress(*HeadersFetchProgressReport)         {}
+func (*slowCancelSyncListener) OnAddressDiscoveryProgress(*AddressDiscoveryProgressReport) {}
+func (*slowCancelSyncListener) OnHeadersRescanProgress(*HeadersRescanProgressReport)       {}
+func (*slowCancelSyncListener) OnSyncCompleted()                                           {}
+func (*slowCancelSyncListener) OnSyncEndedWithError(error)                                 {}
+func (*slowCancelSyncListener) Debug(*DebugInfo)                                           {}
+
+var _ = Describe("RpcSync", func() {
+	var mw *MultiWallet
+	var cleanup func()
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		mw, cleanup = newTestMultiWallet()
+		server = newTestTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		cleanup()
+	})
+
+	It("validates the network mode settings", func() {
+		cert := certificatePEM(server)
+		Expect(mw.SetDcrdRPCNetworkMode("", "user", "pass", cert)).To(MatchError(ErrInvalid))
+		Expect(mw.SetDcrdRPCNetworkMode("127.0.0.1", "user", "", cert)).To(MatchError(ErrInvalid))
+		Expect(mw.SetDcrdRPCNetworkMode("127.0.0.1", "user", "pass", "cert")).To(MatchError(ErrInvalidCertificate))
+		Expect(mw.SetDcrdRPCNetworkMode("127.0.0.1", "user", "pass", cert+cert)).To(MatchError(ErrInvalidCertificate))
+		Expect(mw.NetworkMode()).To(Equal(NetworkModeSPV))
+
+		Expect(mw.SetDcrdRPCNetworkMode("127.0.0.1", "user", "pass", cert)).To(BeNil())
+		Expect(mw.NetworkMode()).To(Equal(NetworkModeRPC))
+	})
+
+	It("does not save the password", func() {
+		Expect(mw.SetDcrdRPCNetworkMode("127.0.0.1", "user", "pass", certificatePEM(server))).To(BeNil())
+		Expect(mw.ReadStringConfigValueForKey(DcrdRPCPassConfigKey)).To(BeEmpty())
+		Expect(mw.dcrdRPCPassword()).To(Equal("pass"))
+
+		By("Requiring the password after a restart")
+		mw.syncData.mu.Lock()
+		mw.syncData.dcrdRPCPass = ""
+		mw.syncData.mu.Unlock()
+		Expect(mw.RpcSync()).To(MatchError(ErrPassphraseRequired))
+
+		By("Moving passwords saved by previous versions to memory")
+		mw.SaveUserConfigValue(DcrdRPCPassConfigKey, "saved")
+		Expect(mw.dcrdRPCPassword()).To(Equal("saved"))
+		Expect(mw.ReadStringConfigValueForKey(DcrdRPCPassConfigKey)).To(BeEmpty())
+	})
+
+	It("only connects to servers presenting the pinned certificate", func() {
+		address := server.Listener.Addr().String()
+
+		conn, err := pinnedTLSDialer([]byte(certificatePEM(server)))(context.Background(), "tcp", address)
+		Expect(err).To(BeNil())
+		conn.Close()
+
+		other := newTestTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+		defer other.Close()
+		_, err = pinnedTLSDialer([]byte(certificatePEM(other)))(context.Background(), "tcp", address)
+		Expect(err).To(MatchError(ErrCertificatePinMismatch))
+	})
+
+	It("restarts sync for the other wallets when a wallet is paused", func() {
+		paused := newTestWallet(mw, "paused")
+		other := newTestWallet(mw, "other")
+		Expect(mw.SetDcrdRPCNetworkMode(server.Listener.Addr().String(), "user", "pass", certificatePEM(server))).To(Succeed())
+
+		listener := &slowCancelSyncListener{started: make(chan bool, 1)}
+		Expect(mw.AddSyncProgressListener(listener, "pause")).To(Succeed())
+
+		// a sync that runs until it is canceled
+		mw.initActiveSyncData()
+		Expect(mw.startSync(nil, func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})).To(Succeed())
+		Expect(listener.started).To(Receive(BeFalse()))
+
+		Expect(mw.PauseWalletSync(paused.ID)).To(Succeed())
+		Expect(paused.IsSyncPaused()).To(BeTrue())
+		Expect(listener.started).To(Receive())
+
+		syncable := mw.syncableWallets()
+		Expect(syncable).To(HaveLen(1))
+		Expect(syncable).To(HaveKey(other.ID))
+	})
+
+	It("reports that peers are unavailable", func() {
+		_, err := mw.PeerInfoRaw()
+		Expect(err).To(MatchError(ErrNotConnected))
+
+		mw.initActiveSyncData()
+		mw.syncData.mu.Lock()
+		mw.syncData.syncing = true
+		mw.syncData.mu.Unlock()
+		defer func() {
+			mw.syncData.mu.Lock()
+			mw.syncData.syncing = false
+			mw.syncData.activeSyncData = nil
+			mw.syncData.mu.Unlock()
+		}()
+
+		_, err = mw.PeerInfoRaw()
+		Expect(err).To(MatchError(ErrUnavailable))
+	})
+})
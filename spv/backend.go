@@ -41,11 +41,15 @@ func (wb *WalletBackend) Blocks(ctx context.Context, blockHashes []*chainhash.Ha
 		if err := ctx.Err(); err != nil {
 			return nil, err
 		}
+		if err := wb.waitForBlockDownloads(ctx); err != nil {
+			return nil, err
+		}
 		rp, err := wb.pickRemote(pickAny)
 		if err != nil {
 			return nil, err
 		}
 		blocks, err := rp.Blocks(ctx, blockHashes)
+		wb.recordBandwidth(wb.WalletID, BandwidthUsage{Blocks: blocksSize(blocks)})
 		if err != nil {
 			continue
 		}
@@ -73,6 +77,7 @@ func (wb *WalletBackend) CFiltersV2(ctx context.Context, blockHashes []*chainhas
 			return nil, err
 		}
 		fs, err := rp.CFiltersV2(ctx, blockHashes)
+		wb.recordBandwidth(wb.WalletID, BandwidthUsage{CFilters: cfiltersSize(fs)})
 		if err != nil {
 			continue
 		}
@@ -91,6 +96,7 @@ func (wb *WalletBackend) Headers(ctx context.Context, blockLocators []*chainhash
 			return nil, err
 		}
 		hs, err := rp.Headers(ctx, blockLocators, hashStop)
+		wb.recordBandwidth(wb.WalletID, BandwidthUsage{Headers: headersSize(hs)})
 		if err != nil {
 			continue
 		}
@@ -188,7 +194,7 @@ func (wb *WalletBackend) PublishTransactions(ctx context.Context, txs ...*wire.M
 func (wb *WalletBackend) Rescan(ctx context.Context, blockHashes []chainhash.Hash, save func(*chainhash.Hash, []*wire.MsgTx) error) error {
 	const op errors.Op = "spv.Rescan"
 
-	w, ok := wb.wallets[wb.WalletID]
+	w, ok := wb.walletByID(wb.WalletID)
 	if !ok {
 		return errors.E(op, errors.Invalid)
 	}
@@ -266,7 +272,11 @@ FilterLoop:
 					}
 				}
 
+				if err := wb.waitForBlockDownloads(ctx); err != nil {
+					return err
+				}
 				blocks, err := rp.Blocks(ctx, fmatches)
+				wb.recordBandwidth(wb.WalletID, BandwidthUsage{Blocks: blocksSize(blocks)})
 				if err != nil {
 					rp = nil
 					continue PickPeer
@@ -0,0 +1,267 @@
+// Copyright (c) 2018-2021 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package spv
+
+import (
+	"context"
+	"sync/atomic"
+
+	"decred.org/dcrwallet/wallet"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/gcs/v2"
+	"github.com/decred/dcrd/wire"
+)
+
+// BandwidthUsage describes the number of bytes received from remote peers,
+// broken down by the kind of data that was fetched.
+type BandwidthUsage struct {
+	Headers      uint64
+	CFilters     uint64
+	Blocks       uint64
+	Transactions uint64
+}
+
+// Total returns the sum of all bytes received.
+func (u BandwidthUsage) Total() uint64 {
+	return u.Headers + u.CFilters + u.Blocks + u.Transactions
+}
+
+// bandwidthCounter records the bytes received for each kind of data using
+// atomics.  It must be allocated with new to ensure 64-bit alignment of the
+// counters on 32-bit platforms.
+type bandwidthCounter struct {
+	headers      uint64
+	cfilters     uint64
+	blocks       uint64
+	transactions uint64
+}
+
+func (c *bandwidthCounter) usage() BandwidthUsage {
+	return BandwidthUsage{
+		Headers:      atomic.LoadUint64(&c.headers),
+		CFilters:     atomic.LoadUint64(&c.cfilters),
+		Blocks:       atomic.LoadUint64(&c.blocks),
+		Transactions: atomic.LoadUint64(&c.transactions),
+	}
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter uint64
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	*w += countingWriter(len(b))
+	return len(b), nil
+}
+
+// messageSize returns the number of bytes of msg on the wire, including the
+// message header.
+func messageSize(msg wire.Message) uint64 {
+	var w countingWriter
+	if err := msg.BtcEncode(&w, wire.ProtocolVersion); err != nil {
+		return 0
+	}
+	return wire.MessageHeaderSize + uint64(w)
+}
+
+// headersSize returns the size of the headers message carrying headers.
+func headersSize(headers []*wire.BlockHeader) uint64 {
+	if len(headers) == 0 {
+		return 0
+	}
+	msg := &wire.MsgHeaders{Headers: headers}
+	return messageSize(msg)
+}
+
+// cfilterSize returns the size of the cfilterv2 message carrying filter and
+// proof.
+func cfilterSize(filter *gcs.FilterV2, proof []chainhash.Hash) uint64 {
+	if filter == nil {
+		return 0
+	}
+	// the block hash and proof index have the same size whatever their value
+	msg := wire.NewMsgCFilterV2(&chainhash.Hash{}, filter.Bytes(), 0, proof)
+	return messageSize(msg)
+}
+
+func cfiltersSize(filters []filterProof) uint64 {
+	var size uint64
+	for i := range filters {
+		size += cfilterSize(filters[i].Filter, filters[i].Proof)
+	}
+	return size
+}
+
+// blocksSize returns the size of the block messages carrying blocks.
+func blocksSize(blocks []*wire.MsgBlock) uint64 {
+	var size uint64
+	for _, b := range blocks {
+		if b != nil {
+			size += wire.MessageHeaderSize + uint64(b.SerializeSize())
+		}
+	}
+	return size
+}
+
+// txsSize returns the size of the tx messages carrying txs.
+func txsSize(txs []*wire.MsgTx) uint64 {
+	var size uint64
+	for _, tx := range txs {
+		if tx != nil {
+			size += wire.MessageHeaderSize + uint64(tx.SerializeSize())
+		}
+	}
+	return size
+}
+
+// Bandwidth returns the number of bytes received from peers by this syncer.
+func (s *Syncer) Bandwidth() BandwidthUsage {
+	return s.bandwidth.usage()
+}
+
+// WalletBandwidth returns the number of bytes received from peers by the
+// network backend of the specified wallet, e.g. during rescans.  These bytes
+// are also included in the totals returned by Bandwidth.
+func (s *Syncer) WalletBandwidth(walletID int) BandwidthUsage {
+	s.walletsMu.RLock()
+	c, ok := s.walletBandwidth[walletID]
+	s.walletsMu.RUnlock()
+
+	if ok {
+		return c.usage()
+	}
+	return BandwidthUsage{}
+}
+
+// recordBandwidth adds the provided usage to the syncer totals and, if
+// walletID identifies a synced wallet, to that wallet's counters.
+func (s *Syncer) recordBandwidth(walletID int, u BandwidthUsage) {
+	counters := []*bandwidthCounter{s.bandwidth}
+	s.walletsMu.RLock()
+	if c, ok := s.walletBandwidth[walletID]; ok {
+		counters = append(counters, c)
+	}
+	s.walletsMu.RUnlock()
+	for _, c := range counters {
+		atomic.AddUint64(&c.headers, u.Headers)
+		atomic.AddUint64(&c.cfilters, u.CFilters)
+		atomic.AddUint64(&c.blocks, u.Blocks)
+		atomic.AddUint64(&c.transactions, u.Transactions)
+	}
+}
+
+// SetDataSaver enables or disables the data saver mode.  While enabled and
+// the network is reported as metered, block downloads are paused once the
+// bytes of blocks received in this session reach blockBytesThreshold, and
+// transactions announced by peers are not fetched.
+func (s *Syncer) SetDataSaver(enabled bool, blockBytesThreshold uint64) {
+	s.dataSaverMu.Lock()
+	s.dataSaver = enabled
+	s.blockBytesThreshold = blockBytesThreshold
+	s.notifyDataSaverChanged()
+	s.dataSaverMu.Unlock()
+}
+
+// SetNetworkMetered is used by the host application to signal whether the
+// current network connection is metered.
+func (s *Syncer) SetNetworkMetered(metered bool) {
+	s.dataSaverMu.Lock()
+	s.networkMetered = metered
+	s.notifyDataSaverChanged()
+	s.dataSaverMu.Unlock()
+}
+
+// notifyDataSaverChanged wakes up all goroutines waiting in
+// waitForBlockDownloads.  This function requires s.dataSaverMu held.
+func (s *Syncer) notifyDataSaverChanged() {
+	close(s.dataSaverChanged)
+	s.dataSaverChanged = make(chan struct{})
+}
+
+// BlockDownloadsPaused returns whether block downloads are currently paused
+// by the data saver mode.
+func (s *Syncer) BlockDownloadsPaused() bool {
+	s.dataSaverMu.Lock()
+	defer s.dataSaverMu.Unlock()
+	return s.blockDownloadsPaused()
+}
+
+// This function requires s.dataSaverMu held.
+func (s *Syncer) blockDownloadsPaused() bool {
+	return s.dataSaver && s.networkMetered &&
+		atomic.LoadUint64(&s.bandwidth.blocks) >= s.blockBytesThreshold
+}
+
+// skipMempoolRelay returns whether transactions announced by peers should be
+// ignored to save data.
+func (s *Syncer) skipMempoolRelay() bool {
+	s.dataSaverMu.Lock()
+	defer s.dataSaverMu.Unlock()
+	return s.dataSaver && s.networkMetered
+}
+
+// waitForBlockDownloads blocks until block downloads are not paused by the
+// data saver mode or the context is cancelled.
+func (s *Syncer) waitForBlockDownloads(ctx context.Context) error {
+	logged := false
+	for {
+		s.dataSaverMu.Lock()
+		paused := s.blockDownloadsPaused()
+		changed := s.dataSaverChanged
+		s.dataSaverMu.Unlock()
+
+		if !paused {
+			if logged {
+				log.Info("Data saver: resuming block downloads")
+			}
+			return nil
+		}
+
+		if !logged {
+			log.Info("Data saver: block downloads paused until an unmetered network is available")
+			logged = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// meteredPeer wraps a wallet.Peer to record the bytes received through it.
+type meteredPeer struct {
+	wallet.Peer
+	s        *Syncer
+	walletID int
+}
+
+func (p *meteredPeer) Blocks(ctx context.Context, blockHashes []*chainhash.Hash) ([]*wire.MsgBlock, error) {
+	if err := p.s.waitForBlockDownloads(ctx); err != nil {
+		return nil, err
+	}
+	blocks, err := p.Peer.Blocks(ctx, blockHashes)
+	p.s.recordBandwidth(p.walletID, BandwidthUsage{Blocks: blocksSize(blocks)})
+	return blocks, err
+}
+
+func (p *meteredPeer) CFiltersV2(ctx context.Context, blockHashes []*chainhash.Hash) ([]filterProof, error) {
+	filters, err := p.Peer.CFiltersV2(ctx, blockHashes)
+	p.s.recordBandwidth(p.walletID, BandwidthUsage{CFilters: cfiltersSize(filters)})
+	return filters, err
+}
+
+func (p *meteredPeer) Headers(ctx context.Context, blockLocators []*chainhash.Hash, hashStop *chainhash.Hash) ([]*wire.BlockHeader, error) {
+	headers, err := p.Peer.Headers(ctx, blockLocators, hashStop)
+	p.s.recordBandwidth(p.walletID, BandwidthUsage{Headers: headersSize(headers)})
+	return headers, err
+}
+
+func (p *meteredPeer) String() string {
+	if stringer, ok := p.Peer.(interface{ String() string }); ok {
+		return stringer.String()
+	}
+	return "spv.meteredPeer"
+}
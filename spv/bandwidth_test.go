@@ -0,0 +1,124 @@
+package spv
+
+import (
+	"context"
+	"io/ioutil"
+	"time"
+
+	"decred.org/dcrwallet/wallet"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/gcs/v2"
+	"github.com/decred/dcrd/wire"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// wireSize returns the number of bytes written to send msg to a peer.
+func wireSize(msg wire.Message) uint64 {
+	n, err := wire.WriteMessageN(ioutil.Discard, msg, wire.ProtocolVersion, wire.TestNet3)
+	Expect(err).To(BeNil())
+	return uint64(n)
+}
+
+var _ = Describe("Bandwidth", func() {
+	Describe("message sizes", func() {
+		header := &wire.BlockHeader{Version: 1, Height: 10, Timestamp: time.Unix(1600000000, 0)}
+
+		tx := wire.NewMsgTx()
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, 100, []byte{1, 2, 3}))
+		tx.AddTxOut(wire.NewTxOut(100, []byte{4, 5, 6}))
+
+		It("counts headers messages", func() {
+			headers := []*wire.BlockHeader{header, header, header}
+			msg := wire.NewMsgHeaders()
+			for _, h := range headers {
+				Expect(msg.AddBlockHeader(h)).To(BeNil())
+			}
+			Expect(headersSize(headers)).To(Equal(wireSize(msg)))
+			Expect(headersSize(nil)).To(BeZero())
+		})
+
+		It("counts block and tx messages", func() {
+			block := &wire.MsgBlock{Header: *header}
+			Expect(block.AddTransaction(tx)).To(BeNil())
+
+			Expect(blocksSize([]*wire.MsgBlock{block, nil})).To(Equal(wireSize(block)))
+			Expect(txsSize([]*wire.MsgTx{tx, tx})).To(Equal(2 * wireSize(tx)))
+		})
+
+		It("counts cfilter messages", func() {
+			var key [gcs.KeySize]byte
+			filter, err := gcs.NewFilterV2(19, 784931, key, [][]byte{{1}, {2}, {3}})
+			Expect(err).To(BeNil())
+			proof := []chainhash.Hash{{1}, {2}}
+
+			msg := wire.NewMsgCFilterV2(&chainhash.Hash{9}, filter.Bytes(), 3, proof)
+			Expect(cfilterSize(filter, proof)).To(Equal(wireSize(msg)))
+			Expect(cfilterSize(nil, nil)).To(BeZero())
+
+			filters := []filterProof{{Filter: filter, Proof: proof}, {Filter: filter, Proof: proof}}
+			Expect(cfiltersSize(filters)).To(Equal(2 * wireSize(msg)))
+		})
+	})
+
+	Describe("Syncer", func() {
+		var s *Syncer
+
+		BeforeEach(func() {
+			s = NewSyncer(map[int]*wallet.Wallet{}, nil)
+			s.walletBandwidth[1] = new(bandwidthCounter)
+		})
+
+		It("records the bytes of the syncer and wallets", func() {
+			s.recordBandwidth(1, BandwidthUsage{Headers: 1, CFilters: 2})
+			s.recordBandwidth(syncerWalletID, BandwidthUsage{Blocks: 4, Transactions: 8})
+
+			Expect(s.Bandwidth()).To(Equal(BandwidthUsage{Headers: 1, CFilters: 2, Blocks: 4, Transactions: 8}))
+			Expect(s.Bandwidth().Total()).To(BeEquivalentTo(15))
+			Expect(s.WalletBandwidth(1)).To(Equal(BandwidthUsage{Headers: 1, CFilters: 2}))
+			Expect(s.WalletBandwidth(2)).To(Equal(BandwidthUsage{}))
+		})
+
+		It("pauses block downloads on metered networks above the threshold", func() {
+			s.SetDataSaver(true, 10)
+			s.recordBandwidth(1, BandwidthUsage{Blocks: 10})
+			Expect(s.BlockDownloadsPaused()).To(BeFalse())
+			Expect(s.skipMempoolRelay()).To(BeFalse())
+
+			s.SetNetworkMetered(true)
+			Expect(s.BlockDownloadsPaused()).To(BeTrue())
+			Expect(s.skipMempoolRelay()).To(BeTrue())
+
+			By("Not pausing below the threshold")
+			s.SetDataSaver(true, 11)
+			Expect(s.BlockDownloadsPaused()).To(BeFalse())
+			Expect(s.skipMempoolRelay()).To(BeTrue())
+
+			By("Not pausing when disabled")
+			s.SetDataSaver(false, 10)
+			Expect(s.BlockDownloadsPaused()).To(BeFalse())
+			Expect(s.skipMempoolRelay()).To(BeFalse())
+		})
+
+		It("resumes block downloads when the network is unmetered", func() {
+			s.SetDataSaver(true, 1)
+			s.SetNetworkMetered(true)
+			s.recordBandwidth(1, BandwidthUsage{Blocks: 1})
+
+			done := make(chan error, 1)
+			go func() {
+				done <- s.waitForBlockDownloads(context.Background())
+			}()
+			Consistently(done, 100*time.Millisecond).ShouldNot(Receive())
+
+			s.SetNetworkMetered(false)
+			Eventually(done).Should(Receive(BeNil()))
+
+			By("Returning when the context is canceled")
+			s.SetNetworkMetered(true)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			Expect(s.waitForBlockDownloads(ctx)).To(Equal(context.Canceled))
+		})
+	})
+})
@@ -0,0 +1,44 @@
+// Copyright (c) 2018-2021 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package spv
+
+import (
+	"decred.org/dcrwallet/errors"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/chaincfg/v3"
+	"github.com/decred/dcrd/wire"
+)
+
+// checkpointHash returns the hash of the hard-coded checkpoint of the network
+// at height, if there is one.
+func checkpointHash(params *chaincfg.Params, height int64) (*chainhash.Hash, bool) {
+	for i := range params.Checkpoints {
+		if params.Checkpoints[i].Height == height {
+			return params.Checkpoints[i].Hash, true
+		}
+	}
+	return nil, false
+}
+
+// validateCheckpoints ensures that none of the headers conflicts with the
+// hard-coded checkpoints of the network.  Peers serving a chain forking off
+// before the latest checkpoint are misbehaving.
+func validateCheckpoints(params *chaincfg.Params, headers []*wire.BlockHeader) error {
+	if params == nil || len(params.Checkpoints) == 0 {
+		return nil
+	}
+	for _, h := range headers {
+		checkpoint, ok := checkpointHash(params, int64(h.Height))
+		if !ok {
+			continue
+		}
+		if hash := h.BlockHash(); hash != *checkpoint {
+			return errors.E(errors.Protocol, errors.Errorf("block %v at "+
+				"height %d does not match checkpoint %v", &hash, h.Height,
+				checkpoint))
+		}
+	}
+	return nil
+}
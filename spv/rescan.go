@@ -55,7 +55,7 @@ func (s *Syncer) rescanCheckTransactions(matches *[]*wire.MsgTx, fadded *blockcf
 		for i, output := range tx.TxOut {
 			_, addrs, _, err := txscript.ExtractPkScriptAddrs(
 				output.Version, output.PkScript,
-				s.wallets[walletID].ChainParams(), true)
+				s.chainParams, true)
 			if err != nil {
 				continue
 			}
@@ -110,7 +110,7 @@ Txs:
 		}
 		for _, out := range tx.TxOut {
 			_, addrs, _, err := txscript.ExtractPkScriptAddrs(out.Version,
-				out.PkScript, s.wallets[walletID].ChainParams(), true)
+				out.PkScript, s.chainParams, true)
 			if err != nil {
 				continue
 			}
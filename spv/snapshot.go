@@ -0,0 +1,311 @@
+// Copyright (c) 2018-2021 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package spv
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+
+	"decred.org/dcrwallet/errors"
+	"decred.org/dcrwallet/validate"
+	"decred.org/dcrwallet/wallet"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/chaincfg/v3"
+	"github.com/decred/dcrd/crypto/blake256"
+	"github.com/decred/dcrd/gcs/v2"
+	"github.com/decred/dcrd/gcs/v2/blockcf2"
+	"github.com/decred/dcrd/wire"
+)
+
+// snapshotMagic identifies header snapshot files and their format version.
+var snapshotMagic = [8]byte{'D', 'C', 'R', 'H', 'D', 'R', 'S', '1'}
+
+// snapshotBatchSize is the number of snapshot blocks connected to the wallet
+// main chain at a time.
+const snapshotBatchSize = 2000
+
+// ExportHeaderSnapshot writes the main chain block headers and compact filters
+// recorded by w to out.  The snapshot can be imported by other wallets on the
+// same network with ImportHeaderSnapshot to skip fetching them from peers.
+//
+// The snapshot format is the 8 byte magic, the network as a little endian
+// uint32 and the number of blocks as a little endian uint32, followed by the
+// serialized header, the filter length as a little endian uint32 and the
+// filter bytes of each block after genesis in height order.
+func ExportHeaderSnapshot(ctx context.Context, w *wallet.Wallet, out io.Writer) (int32, error) {
+	const op errors.Op = "spv.ExportHeaderSnapshot"
+
+	_, tipHeight := w.MainChainTip(ctx)
+
+	bw := bufio.NewWriter(out)
+	var buf [4]byte
+	bw.Write(snapshotMagic[:])
+	binary.LittleEndian.PutUint32(buf[:], uint32(w.ChainParams().Net))
+	bw.Write(buf[:])
+	binary.LittleEndian.PutUint32(buf[:], uint32(tipHeight))
+	bw.Write(buf[:])
+
+	for height := int32(1); height <= tipHeight; height++ {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		info, err := w.BlockInfo(ctx, wallet.NewBlockIdentifierFromHeight(height))
+		if err != nil {
+			return 0, errors.E(op, err)
+		}
+		_, filter, err := w.CFilterV2(ctx, &info.Hash)
+		if err != nil {
+			return 0, errors.E(op, err)
+		}
+
+		filterBytes := filter.Bytes()
+		bw.Write(info.Header)
+		binary.LittleEndian.PutUint32(buf[:], uint32(len(filterBytes)))
+		bw.Write(buf[:])
+		if _, err := bw.Write(filterBytes); err != nil {
+			return 0, errors.E(op, errors.IO, err)
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return 0, errors.E(op, errors.IO, err)
+	}
+	return tipHeight, nil
+}
+
+// ImportHeaderSnapshot connects the block headers and compact filters of a
+// snapshot created with ExportHeaderSnapshot to the main chain of w.  Blocks
+// the wallet already has are skipped.  The number of blocks connected to the
+// wallet main chain is returned.
+//
+// The snapshot is verified in full before anything is connected, so r is read
+// twice.  The headers must link to each other, match the hard-coded
+// checkpoints of the network and have valid proof of work and stake
+// difficulties.  Filters of blocks after the DCP0005 activation are checked
+// against the commitment in their header.  Filters of earlier mainnet and
+// testnet blocks have no header commitment and are checked by hashing the
+// full pre-activation filter set like the wallet does, so snapshots of these
+// networks that end before the activation height are rejected.
+//
+// This must not be called while w is being synced.
+func ImportHeaderSnapshot(ctx context.Context, w *wallet.Wallet, r io.ReadSeeker) (int32, error) {
+	const op errors.Op = "spv.ImportHeaderSnapshot"
+
+	if err := verifySnapshot(ctx, w, r); err != nil {
+		return 0, errors.E(op, err)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, errors.E(op, errors.IO, err)
+	}
+
+	var imported int32
+	batch := make([]*wallet.BlockNode, 0, snapshotBatchSize)
+	var count int32
+	err := rangeSnapshot(ctx, w.ChainParams(), r, func(n int32, header *wire.BlockHeader,
+		hash *chainhash.Hash, filter *gcs.FilterV2) error {
+
+		count = n
+		if haveBlock, _, _ := w.BlockInMainChain(ctx, hash); !haveBlock {
+			batch = append(batch, wallet.NewBlockNode(header, hash, filter))
+		}
+		if len(batch) == snapshotBatchSize {
+			connected, err := connectSnapshotBatch(ctx, w, batch)
+			imported += connected
+			if err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+		return nil
+	})
+	if err != nil {
+		return imported, errors.E(op, err)
+	}
+
+	// Connect the blocks left over after the last full batch.
+	if len(batch) != 0 {
+		n, err := connectSnapshotBatch(ctx, w, batch)
+		imported += n
+		if err != nil {
+			return imported, errors.E(op, err)
+		}
+	}
+
+	log.Infof("Imported %d of %d block header(s) from header snapshot", imported, count)
+	return imported, nil
+}
+
+// verifySnapshot reads the snapshot from r and verifies its headers and
+// filters without connecting them to the main chain of w.
+func verifySnapshot(ctx context.Context, w *wallet.Wallet, r io.Reader) error {
+	params := w.ChainParams()
+	activeHeight, hasPreDCP0005 := dcp0005ActiveHeight(params.Net)
+	if !hasPreDCP0005 {
+		return rangeSnapshot(ctx, params, r, nil)
+	}
+
+	// Hash the pre-activation filter set the same way as
+	// wallet.ValidatePreDCP0005CFilters, starting with the genesis filter.
+	_, genesisFilter, err := w.CFilterV2(ctx, &params.GenesisHash)
+	if err != nil {
+		return err
+	}
+	hasher := blake256.New()
+	hasher.Write(genesisFilter.Bytes())
+
+	var count int32
+	err = rangeSnapshot(ctx, params, r, func(n int32, header *wire.BlockHeader,
+		_ *chainhash.Hash, filter *gcs.FilterV2) error {
+
+		count = n
+		if int32(header.Height) < activeHeight {
+			hasher.Write(filter.Bytes())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+	if count < activeHeight-1 {
+		return errors.E(errors.Invalid, errors.Errorf("header snapshot "+
+			"ends at height %d before the DCP0005 activation at height %d "+
+			"and its filters can not be verified", count, activeHeight))
+	}
+
+	var cfsethash chainhash.Hash
+	if err := cfsethash.SetBytes(hasher.Sum(nil)); err != nil {
+		return err
+	}
+	if err := validate.PreDCP0005CFilterHash(params.Net, &cfsethash); err != nil {
+		return errors.E(errors.Consensus, err)
+	}
+	return nil
+}
+
+// dcp0005ActiveHeight returns the DCP0005 activation height of networks with
+// filters that are not committed to in their block headers.  Other networks
+// commit to the filters of every block.
+func dcp0005ActiveHeight(net wire.CurrencyNet) (int32, bool) {
+	switch net {
+	case wire.MainNet:
+		return validate.DCP0005ActiveHeightMainNet, true
+	case wire.TestNet3:
+		return validate.DCP0005ActiveHeightTestNet3, true
+	default:
+		return 0, false
+	}
+}
+
+// rangeSnapshot reads the snapshot from r and calls f, if not nil, with the
+// header, hash and filter of each block in height order after checking that
+// the block connects to the previous one, matches the network checkpoints
+// and that its filter matches the header commitment.  The number of blocks in
+// the snapshot is passed along with each block.
+func rangeSnapshot(ctx context.Context, params *chaincfg.Params, r io.Reader,
+	f func(int32, *wire.BlockHeader, *chainhash.Hash, *gcs.FilterV2) error) error {
+
+	br := bufio.NewReader(r)
+	var magic [8]byte
+	var buf [4]byte
+	if _, err := io.ReadFull(br, magic[:]); err != nil || magic != snapshotMagic {
+		return errors.E(errors.Encoding, "not a header snapshot")
+	}
+	if _, err := io.ReadFull(br, buf[:]); err != nil {
+		return errors.E(errors.Encoding, err)
+	}
+	if wire.CurrencyNet(binary.LittleEndian.Uint32(buf[:])) != params.Net {
+		return errors.E(errors.Invalid, "header snapshot is for another network")
+	}
+	if _, err := io.ReadFull(br, buf[:]); err != nil {
+		return errors.E(errors.Encoding, err)
+	}
+	count := int32(binary.LittleEndian.Uint32(buf[:]))
+
+	prevHash := params.GenesisHash
+	for height := int32(1); height <= count; height++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		header := new(wire.BlockHeader)
+		if err := header.Deserialize(br); err != nil {
+			return errors.E(errors.Encoding, err)
+		}
+		if _, err := io.ReadFull(br, buf[:]); err != nil {
+			return errors.E(errors.Encoding, err)
+		}
+		filterLen := binary.LittleEndian.Uint32(buf[:])
+		if filterLen > wire.MaxCFilterDataSize {
+			return errors.E(errors.Encoding, "filter exceeds max size")
+		}
+		filterBytes := make([]byte, filterLen)
+		if _, err := io.ReadFull(br, filterBytes); err != nil {
+			return errors.E(errors.Encoding, err)
+		}
+
+		hash := header.BlockHash()
+		if int32(header.Height) != height || header.PrevBlock != prevHash {
+			return errors.E(errors.Invalid,
+				errors.Errorf("block %v does not connect to the snapshot chain", &hash))
+		}
+		if err := validateCheckpoints(params, []*wire.BlockHeader{header}); err != nil {
+			return err
+		}
+		prevHash = hash
+
+		filter, err := gcs.FromBytesV2(blockcf2.B, blockcf2.M, filterBytes)
+		if err != nil {
+			return errors.E(errors.Encoding, err)
+		}
+		// Header commitments v1 only commit to the filter, so the filter
+		// hash is the commitment root and the inclusion proof is empty.
+		err = validate.CFilterV2HeaderCommitment(params.Net, header, filter, 0, nil)
+		if err != nil {
+			return err
+		}
+
+		if f != nil {
+			if err := f(count, header, &hash, filter); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// connectSnapshotBatch connects a batch of snapshot blocks to the wallet main
+// chain if they create a better chain than the current one.
+func connectSnapshotBatch(ctx context.Context, w *wallet.Wallet, batch []*wallet.BlockNode) (int32, error) {
+	var forest wallet.SidechainForest
+	for _, n := range batch {
+		forest.AddBlockNode(n)
+	}
+
+	bestChain, err := w.EvaluateBestChain(ctx, &forest)
+	if err != nil {
+		return 0, err
+	}
+	if len(bestChain) == 0 {
+		return 0, nil
+	}
+
+	if _, err := w.ValidateHeaderChainDifficulties(ctx, bestChain, 0); err != nil {
+		return 0, err
+	}
+	if _, err := w.ChainSwitch(ctx, &forest, bestChain, nil); err != nil {
+		return 0, err
+	}
+
+	tip := bestChain[len(bestChain)-1]
+	log.Debugf("Connected %d snapshot block(s), new tip %v, height %d",
+		len(bestChain), tip.Hash, tip.Header.Height)
+	return int32(len(bestChain)), nil
+}
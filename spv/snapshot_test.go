@@ -0,0 +1,152 @@
+package spv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+
+	"decred.org/dcrwallet/errors"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/chaincfg/v3"
+	"github.com/decred/dcrd/gcs/v2"
+	"github.com/decred/dcrd/gcs/v2/blockcf2"
+	"github.com/decred/dcrd/wire"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// testSnapshot serializes headers and filters in the header snapshot format.
+func testSnapshot(net wire.CurrencyNet, headers []*wire.BlockHeader, filters []*gcs.FilterV2) []byte {
+	var b bytes.Buffer
+	var buf [4]byte
+	b.Write(snapshotMagic[:])
+	binary.LittleEndian.PutUint32(buf[:], uint32(net))
+	b.Write(buf[:])
+	binary.LittleEndian.PutUint32(buf[:], uint32(len(headers)))
+	b.Write(buf[:])
+	for i, header := range headers {
+		ExpectWithOffset(1, header.Serialize(&b)).To(Succeed())
+		filterBytes := filters[i].Bytes()
+		binary.LittleEndian.PutUint32(buf[:], uint32(len(filterBytes)))
+		b.Write(buf[:])
+		b.Write(filterBytes)
+	}
+	return b.Bytes()
+}
+
+// testSnapshotChain returns n headers after the genesis block of params that
+// commit to their filters.
+func testSnapshotChain(params *chaincfg.Params, n int) ([]*wire.BlockHeader, []*gcs.FilterV2) {
+	headers := make([]*wire.BlockHeader, 0, n)
+	filters := make([]*gcs.FilterV2, 0, n)
+	prevHash := params.GenesisHash
+	for height := 1; height <= n; height++ {
+		filter, err := gcs.NewFilterV2(blockcf2.B, blockcf2.M, [gcs.KeySize]byte{},
+			[][]byte{{byte(height)}})
+		ExpectWithOffset(1, err).To(BeNil())
+
+		header := &wire.BlockHeader{
+			PrevBlock: prevHash,
+			StakeRoot: filter.Hash(),
+			Height:    uint32(height),
+		}
+		prevHash = header.BlockHash()
+		headers = append(headers, header)
+		filters = append(filters, filter)
+	}
+	return headers, filters
+}
+
+var _ = Describe("Header snapshots", func() {
+	var params *chaincfg.Params
+	var ctx context.Context
+
+	BeforeEach(func() {
+		params = chaincfg.SimNetParams()
+		ctx = context.Background()
+	})
+
+	rangeBlocks := func(snapshot []byte) ([]chainhash.Hash, error) {
+		var hashes []chainhash.Hash
+		err := rangeSnapshot(ctx, params, bytes.NewReader(snapshot), func(count int32,
+			_ *wire.BlockHeader, hash *chainhash.Hash, _ *gcs.FilterV2) error {
+
+			hashes = append(hashes, *hash)
+			return nil
+		})
+		return hashes, err
+	}
+
+	It("reads blocks with filters matching the header commitments", func() {
+		headers, filters := testSnapshotChain(params, 3)
+		hashes, err := rangeBlocks(testSnapshot(params.Net, headers, filters))
+		Expect(err).To(BeNil())
+		Expect(hashes).To(Equal([]chainhash.Hash{headers[0].BlockHash(),
+			headers[1].BlockHash(), headers[2].BlockHash()}))
+	})
+
+	It("rejects filters that do not match the header commitments", func() {
+		headers, filters := testSnapshotChain(params, 3)
+		filters[2] = filters[1]
+
+		hashes, err := rangeBlocks(testSnapshot(params.Net, headers, filters))
+		Expect(errors.Is(err, errors.Consensus)).To(BeTrue())
+		Expect(hashes).To(HaveLen(2))
+	})
+
+	It("only checks header commitments after the DCP0005 activation", func() {
+		params = chaincfg.TestNet3Params()
+		headers, filters := testSnapshotChain(params, 2)
+		headers[1].StakeRoot = chainhash.Hash{}
+		headers[1].PrevBlock = headers[0].BlockHash()
+
+		hashes, err := rangeBlocks(testSnapshot(params.Net, headers, filters))
+		Expect(err).To(BeNil())
+		Expect(hashes).To(HaveLen(2))
+
+		height, ok := dcp0005ActiveHeight(params.Net)
+		Expect(ok).To(BeTrue())
+		Expect(height).To(BeNumerically(">", 2))
+		_, ok = dcp0005ActiveHeight(wire.SimNet)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("rejects headers that do not connect", func() {
+		headers, filters := testSnapshotChain(params, 3)
+		headers = []*wire.BlockHeader{headers[0], headers[2]}
+		filters = []*gcs.FilterV2{filters[0], filters[2]}
+
+		_, err := rangeBlocks(testSnapshot(params.Net, headers, filters))
+		Expect(errors.Is(err, errors.Invalid)).To(BeTrue())
+	})
+
+	It("rejects invalid and foreign snapshots", func() {
+		headers, filters := testSnapshotChain(params, 1)
+		snapshot := testSnapshot(params.Net, headers, filters)
+
+		_, err := rangeBlocks(snapshot[:len(snapshot)-1])
+		Expect(errors.Is(err, errors.Encoding)).To(BeTrue())
+
+		_, err = rangeBlocks([]byte("not a snapshot"))
+		Expect(errors.Is(err, errors.Encoding)).To(BeTrue())
+
+		_, err = rangeBlocks(testSnapshot(wire.TestNet3, headers, filters))
+		Expect(errors.Is(err, errors.Invalid)).To(BeTrue())
+	})
+
+	It("rejects headers that conflict with checkpoints", func() {
+		params = chaincfg.MainNetParams()
+		checkpoint := params.Checkpoints[0]
+
+		header := &wire.BlockHeader{Height: uint32(checkpoint.Height)}
+		err := validateCheckpoints(params, []*wire.BlockHeader{header})
+		Expect(errors.Is(err, errors.Protocol)).To(BeTrue())
+
+		header.Height++
+		Expect(validateCheckpoints(params, []*wire.BlockHeader{header})).To(Succeed())
+
+		hash, ok := checkpointHash(params, checkpoint.Height)
+		Expect(ok).To(BeTrue())
+		Expect(hash).To(Equal(checkpoint.Hash))
+	})
+})
@@ -0,0 +1,13 @@
+package spv_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSpv(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Spv Suite")
+}
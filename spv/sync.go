@@ -21,6 +21,7 @@ import (
 	"github.com/decred/dcrd/addrmgr"
 	"github.com/decred/dcrd/blockchain/stake/v3"
 	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/chaincfg/v3"
 	"github.com/decred/dcrd/gcs/v2/blockcf2"
 	"github.com/decred/dcrd/wire"
 	"golang.org/x/sync/errgroup"
@@ -38,10 +39,24 @@ type Syncer struct {
 	atomicCatchUpTryLock uint32          // CAS (entered=1) to perform discovery/rescan
 	atomicWalletsSynced  map[int]*uint32 // CAS (synced=1) when wallet syncing complete
 
-	wallets map[int]*wallet.Wallet
-	lp      *p2p.LocalPeer
+	// catchUpMu protects pendingCatchUp and the release of
+	// atomicCatchUpTryLock.  pendingCatchUp holds the wallets added while
+	// another catch up was running, which are caught up before the lock is
+	// released.
+	catchUpMu      sync.Mutex
+	pendingCatchUp map[int]struct{}
+
+	// Wallets may be added and removed while the syncer is running.
+	// walletsMu protects the wallets, atomicWalletsSynced, walletBandwidth,
+	// loadedFilters and walletQuit maps and runCtx.  walletQuit channels are
+	// closed when a wallet is removed to cancel operations of that wallet.
+	walletsMu   sync.RWMutex
+	wallets     map[int]*wallet.Wallet
+	walletQuit  map[int]chan struct{}
+	runCtx      context.Context
+	chainParams *chaincfg.Params
+	lp          *p2p.LocalPeer
 
-	// Protected by atomicCatchUpTryLock
 	loadedFilters map[int]bool
 
 	persistentPeers []string
@@ -78,8 +93,25 @@ type Syncer struct {
 	// Mempool for non-wallet-relevant transactions.
 	mempool     sync.Map // k=chainhash.Hash v=*wire.MsgTx
 	mempoolAdds chan *chainhash.Hash
+
+	// Bytes received from peers during this sync session, in total and for
+	// data fetched by each wallet's network backend.
+	bandwidth       *bandwidthCounter
+	walletBandwidth map[int]*bandwidthCounter
+
+	// Data saver mode.  dataSaverChanged is closed and replaced whenever any
+	// of the data saver settings change.
+	dataSaverMu         sync.Mutex
+	dataSaver           bool
+	networkMetered      bool
+	blockBytesThreshold uint64
+	dataSaverChanged    chan struct{}
 }
 
+// syncerWalletID is used when recording bandwidth for data that is fetched on
+// behalf of all wallets.
+const syncerWalletID = -1
+
 // Notifications struct to contain all of the upcoming callbacks that will
 // be used to update the rpc streams for syncing.
 type Notifications struct {
@@ -117,24 +149,36 @@ func NewSyncer(wallets map[int]*wallet.Wallet, lp *p2p.LocalPeer) *Syncer {
 	rescanFilter := make(map[int]*wallet.RescanFilter)
 	filterData := make(map[int]*blockcf2.Entries)
 	atomicWalletsSynced := make(map[int]*uint32, len(wallets))
+	walletBandwidth := make(map[int]*bandwidthCounter, len(wallets))
+	walletQuit := make(map[int]chan struct{}, len(wallets))
+	var chainParams *chaincfg.Params
 
-	for walletID := range wallets {
+	for walletID, w := range wallets {
 		rescanFilter[walletID] = wallet.NewRescanFilter(nil, nil)
 		filterData[walletID] = &blockcf2.Entries{}
 		atomicWalletsSynced[walletID] = new(uint32)
+		walletBandwidth[walletID] = new(bandwidthCounter)
+		walletQuit[walletID] = make(chan struct{})
+		chainParams = w.ChainParams()
 	}
 
 	return &Syncer{
 		atomicWalletsSynced: atomicWalletsSynced,
 		wallets:             wallets,
+		walletQuit:          walletQuit,
+		chainParams:         chainParams,
 		loadedFilters:       make(map[int]bool, len(wallets)),
 		connectingRemotes:   make(map[string]struct{}),
 		remotes:             make(map[string]*p2p.RemotePeer),
 		rescanFilter:        rescanFilter,
 		filterData:          filterData,
 		seenTxs:             lru.NewCache(2000),
+		pendingCatchUp:      make(map[int]struct{}),
 		lp:                  lp,
 		mempoolAdds:         make(chan *chainhash.Hash),
+		bandwidth:           new(bandwidthCounter),
+		walletBandwidth:     walletBandwidth,
+		dataSaverChanged:    make(chan struct{}),
 	}
 }
 
@@ -153,7 +197,7 @@ func (s *Syncer) SetNotifications(ntfns *Notifications) {
 // synced checks the atomic that controls wallet syncness and if previously
 // unsynced, updates to synced and notifies the callback, if set.
 func (s *Syncer) synced(walletID int) {
-	if atomic.CompareAndSwapUint32(s.atomicWalletsSynced[walletID], 0, 1) &&
+	if atomic.CompareAndSwapUint32(s.walletSyncedFlag(walletID), 0, 1) &&
 		s.notifications != nil &&
 		s.notifications.Synced != nil {
 		s.notifications.Synced(walletID, true)
@@ -163,8 +207,8 @@ func (s *Syncer) synced(walletID int) {
 // Synced returns whether this wallet is completely synced to the network.
 func (s *Syncer) Synced() bool {
 	synced := true
-	for walletID := range s.wallets {
-		synced = synced && atomic.LoadUint32(s.atomicWalletsSynced[walletID]) == 1
+	for walletID := range s.walletsSnapshot() {
+		synced = synced && atomic.LoadUint32(s.walletSyncedFlag(walletID)) == 1
 	}
 
 	return synced
@@ -201,7 +245,7 @@ func (s *Syncer) GetRemotePeers() map[string]*p2p.RemotePeer {
 // unsynced checks the atomic that controls wallet syncness and if previously
 // synced, updates to unsynced and notifies the callback, if set.
 func (s *Syncer) unsynced(walletID int) {
-	if atomic.CompareAndSwapUint32(s.atomicWalletsSynced[walletID], 1, 0) &&
+	if atomic.CompareAndSwapUint32(s.walletSyncedFlag(walletID), 1, 0) &&
 		s.notifications != nil &&
 		s.notifications.Synced != nil {
 		s.notifications.Synced(walletID, false)
@@ -318,7 +362,7 @@ func (s *Syncer) lowestChainTip(ctx context.Context) (chainhash.Hash, int32, *wa
 	var lowestTip int32 = -1
 	var lowestTipHash chainhash.Hash
 	var lowestTipWallet *wallet.Wallet
-	for _, w := range s.wallets {
+	for _, w := range s.walletsSnapshot() {
 		if hash, height := w.MainChainTip(ctx); height < lowestTip || lowestTip == -1 {
 			lowestTip = height
 			lowestTipHash = hash
@@ -333,7 +377,7 @@ func (s *Syncer) highestChainTip(ctx context.Context) (chainhash.Hash, int32, *w
 	var highestTip int32 = -1
 	var highestTipHash chainhash.Hash
 	var highestTipWallet *wallet.Wallet
-	for _, w := range s.wallets {
+	for _, w := range s.walletsSnapshot() {
 		if hash, height := w.MainChainTip(ctx); height > highestTip || highestTip == -1 {
 			highestTip = height
 			highestTipHash = hash
@@ -347,10 +391,11 @@ func (s *Syncer) highestChainTip(ctx context.Context) (chainhash.Hash, int32, *w
 // Run synchronizes the wallet, returning when synchronization fails or the
 // context is cancelled.
 func (s *Syncer) Run(ctx context.Context) error {
-	log.Infof("Syncing %d wallets", len(s.wallets))
+	wallets := s.walletsSnapshot()
+	log.Infof("Syncing %d wallets", len(wallets))
 
 	var highestTipHeight int32
-	for id, w := range s.wallets {
+	for id, w := range wallets {
 		tipHash, tipHeight := w.MainChainTip(ctx)
 		log.Infof("[%d] Headers synced through block %v height %d", id, &tipHash, tipHeight)
 
@@ -414,6 +459,10 @@ func (s *Syncer) Run(ctx context.Context) error {
 
 	g.Go(func() error { return s.handleMempool(ctx) })
 
+	// Hold walletsMu while setting the network backends so that wallets
+	// added from now on are synced as added to a running syncer.
+	s.walletsMu.Lock()
+	s.runCtx = ctx
 	for walletID, w := range s.wallets {
 		walletBackend := &WalletBackend{
 			Syncer:   s,
@@ -421,8 +470,17 @@ func (s *Syncer) Run(ctx context.Context) error {
 		}
 
 		w.SetNetworkBackend(walletBackend)
-		defer w.SetNetworkBackend(nil)
 	}
+	s.walletsMu.Unlock()
+
+	defer func() {
+		s.walletsMu.Lock()
+		s.runCtx = nil
+		for _, w := range s.wallets {
+			w.SetNetworkBackend(nil)
+		}
+		s.walletsMu.Unlock()
+	}()
 
 	// Wait until cancellation or a handler errors.
 	return g.Wait()
@@ -637,7 +695,7 @@ func (s *Syncer) getTransactionsByHashes(ctx context.Context, txHashes []*chainh
 	var notFound []*wire.InvVect
 	var foundTxs []*wire.MsgTx
 
-	for walletID, w := range s.wallets {
+	for walletID, w := range s.walletsSnapshot() {
 		walletFoundTxs, _, err := w.GetTransactionsByHashes(ctx, txHashes)
 		if err != nil && !errors.Is(err, errors.NotExist) {
 			return nil, nil, errors.Errorf("[%d] Failed to look up transactions for getdata reply to peer: %v", walletID, err)
@@ -811,7 +869,12 @@ func (s *Syncer) receiveInv(ctx context.Context) error {
 func (s *Syncer) handleBlockInvs(ctx context.Context, rp *p2p.RemotePeer, hashes []*chainhash.Hash) error {
 	const opf = "spv.handleBlockInvs(%v)"
 
+	if err := s.waitForBlockDownloads(ctx); err != nil {
+		return err
+	}
+
 	blocks, err := rp.Blocks(ctx, hashes)
+	s.recordBandwidth(syncerWalletID, BandwidthUsage{Blocks: blocksSize(blocks)})
 	if err != nil {
 		op := errors.Opf(opf, rp)
 		return errors.E(op, err)
@@ -835,7 +898,11 @@ func (s *Syncer) handleBlockInvs(ctx context.Context, rp *p2p.RemotePeer, hashes
 func (s *Syncer) handleTxInvs(ctx context.Context, rp *p2p.RemotePeer, hashes []*chainhash.Hash) {
 	const opf = "spv.handleTxInvs(%v)"
 
-	for _, wallet := range s.wallets {
+	if s.skipMempoolRelay() {
+		return
+	}
+
+	for _, wallet := range s.walletsSnapshot() {
 		rpt, err := wallet.RescanPoint(ctx)
 		if err != nil {
 			op := errors.Opf(opf, rp.RemoteAddr())
@@ -864,6 +931,7 @@ ProcessTx:
 	}
 
 	txs, err := rp.Transactions(ctx, unseen)
+	s.recordBandwidth(syncerWalletID, BandwidthUsage{Transactions: txsSize(txs)})
 	if errors.Is(err, errors.NotExist) {
 		err = nil
 		// Remove notfound txs.
@@ -892,7 +960,7 @@ ProcessTx:
 	}
 
 	// Save any relevant transaction.
-	for walletID, w := range s.wallets {
+	for walletID, w := range s.walletsSnapshot() {
 		relevant := s.filterRelevant(txs, walletID)
 		for _, tx := range relevant {
 
@@ -1004,7 +1072,11 @@ FilterLoop:
 		wg.Wait()
 
 		if len(fmatches) != 0 {
+			if err := s.waitForBlockDownloads(ctx); err != nil {
+				return nil, err
+			}
 			blocks, err := rp.Blocks(ctx, fmatches)
+			s.recordBandwidth(walletID, BandwidthUsage{Blocks: blocksSize(blocks)})
 			if err != nil {
 				return nil, err
 			}
@@ -1067,12 +1139,23 @@ func (s *Syncer) handleBlockAnnouncements(ctx context.Context, rp *p2p.RemotePee
 		return nil
 	}
 
+	s.walletsMu.RLock()
+	params := s.chainParams
+	s.walletsMu.RUnlock()
+	if err := validateCheckpoints(params, headers); err != nil {
+		return err
+	}
+
 	blockHashes := make([]*chainhash.Hash, 0, len(headers))
 	for _, h := range headers {
 		hash := h.BlockHash()
 		blockHashes = append(blockHashes, &hash)
 	}
 	filters, err := rp.CFiltersV2(ctx, blockHashes)
+	s.recordBandwidth(syncerWalletID, BandwidthUsage{
+		Headers:  headersSize(headers),
+		CFilters: cfiltersSize(filters),
+	})
 	if err != nil {
 		if ctx.Err() != nil {
 			return ctx.Err()
@@ -1080,7 +1163,7 @@ func (s *Syncer) handleBlockAnnouncements(ctx context.Context, rp *p2p.RemotePee
 		return err
 	}
 
-	for walletID, w := range s.wallets {
+	for walletID, w := range s.walletsSnapshot() {
 		newBlocks := make([]*wallet.BlockNode, 0, len(headers))
 		var bestChain []*wallet.BlockNode
 		var matchingTxs map[chainhash.Hash][]*wire.MsgTx
@@ -1198,6 +1281,9 @@ var hashStop chainhash.Hash
 func (s *Syncer) getHeaders(ctx context.Context, rp *p2p.RemotePeer) error {
 
 	_, _, lowestChainWallet := s.lowestChainTip(ctx)
+	if lowestChainWallet == nil {
+		return errors.E(errors.Invalid, "no wallets to sync")
+	}
 
 	var locators []*chainhash.Hash
 	var err error
@@ -1219,6 +1305,7 @@ func (s *Syncer) getHeaders(ctx context.Context, rp *p2p.RemotePeer) error {
 
 	for {
 		headers, err := rp.Headers(ctx, locators, &hashStop)
+		s.recordBandwidth(syncerWalletID, BandwidthUsage{Headers: headersSize(headers)})
 		if err != nil {
 			return err
 		}
@@ -1242,6 +1329,11 @@ func (s *Syncer) getHeaders(ctx context.Context, rp *p2p.RemotePeer) error {
 
 		lastHeight = int32(headers[len(headers)-1].Height)
 
+		err = validateCheckpoints(lowestChainWallet.ChainParams(), headers)
+		if err != nil {
+			return err
+		}
+
 		nodes := make([]*wallet.BlockNode, len(headers))
 		g, ctx := errgroup.WithContext(ctx)
 		for i := range headers {
@@ -1250,6 +1342,7 @@ func (s *Syncer) getHeaders(ctx context.Context, rp *p2p.RemotePeer) error {
 				header := headers[i]
 				hash := header.BlockHash()
 				filter, proofIndex, proof, err := rp.CFilterV2(ctx, &hash)
+				s.recordBandwidth(syncerWalletID, BandwidthUsage{CFilters: cfilterSize(filter, proof)})
 				if err != nil {
 					return err
 				}
@@ -1269,7 +1362,7 @@ func (s *Syncer) getHeaders(ctx context.Context, rp *p2p.RemotePeer) error {
 			return err
 		}
 
-		for walletID, w := range s.wallets {
+		for walletID, w := range s.walletsSnapshot() {
 			var added int
 			s.sidechainMu.Lock()
 			for _, n := range nodes {
@@ -1340,19 +1433,31 @@ func (s *Syncer) getHeaders(ctx context.Context, rp *p2p.RemotePeer) error {
 }
 
 func (s *Syncer) fetchMissingCFilters(ctx context.Context, rp *p2p.RemotePeer) error {
-	for walletID, w := range s.wallets {
-		s.fetchMissingCfiltersStart(walletID)
-		progress := make(chan wallet.MissingCFilterProgress, 1)
-		go w.FetchMissingCFiltersWithProgress(ctx, rp, progress)
+	for walletID, w := range s.walletsSnapshot() {
+		err := s.fetchWalletMissingCFilters(ctx, rp, walletID, w)
+		if err != nil && !s.walletRemoved(walletID) {
+			return err
+		}
+	}
+	return nil
+}
 
-		for p := range progress {
-			if p.Err != nil {
-				return p.Err
-			}
-			s.fetchMissingCfiltersProgress(walletID, p.BlockHeightStart, p.BlockHeightEnd)
+func (s *Syncer) fetchWalletMissingCFilters(ctx context.Context, rp *p2p.RemotePeer, walletID int, w *wallet.Wallet) error {
+	ctx, cancel := s.walletContext(ctx, walletID)
+	defer cancel()
+
+	s.fetchMissingCfiltersStart(walletID)
+	progress := make(chan wallet.MissingCFilterProgress, 1)
+	peer := &meteredPeer{Peer: rp, s: s, walletID: walletID}
+	go w.FetchMissingCFiltersWithProgress(ctx, peer, progress)
+
+	for p := range progress {
+		if p.Err != nil {
+			return p.Err
 		}
-		s.fetchMissingCfiltersFinished(walletID)
+		s.fetchMissingCfiltersProgress(walletID, p.BlockHeightStart, p.BlockHeightEnd)
 	}
+	s.fetchMissingCfiltersFinished(walletID)
 	return nil
 }
 
@@ -1379,78 +1484,22 @@ func (s *Syncer) startupSync(ctx context.Context, rp *p2p.RemotePeer) error {
 	s.fetchHeadersFinished()
 	log.Debugf("Finished fetching headers from %v", rp.RemoteAddr())
 
-	if atomic.CompareAndSwapUint32(&s.atomicCatchUpTryLock, 0, 1) {
-		for walletID, w := range s.wallets {
-			err = func() error {
-				rescanPoint, err := w.RescanPoint(ctx)
-				if err != nil {
-					return err
-				}
-				walletBackend := &WalletBackend{
-					Syncer:   s,
-					WalletID: walletID,
-				}
-				if rescanPoint == nil {
-					if !s.loadedFilters[walletID] {
-						err = w.LoadActiveDataFilters(ctx, walletBackend, true)
-						if err != nil {
-							return err
-						}
-						s.loadedFilters[walletID] = true
-					}
-
-					s.synced(walletID)
-
-					return nil
-				}
-				// RescanPoint is != nil so we are not synced to the peer and
-				// check to see if it was previously synced
-				s.unsynced(walletID)
-
-				s.discoverAddressesStart(walletID)
-				err = w.DiscoverActiveAddresses(ctx, rp, rescanPoint, !w.Locked(), w.GapLimit())
-				if err != nil {
-					return err
-				}
-
-				s.discoverAddressesFinished(walletID)
-
-				err = w.LoadActiveDataFilters(ctx, walletBackend, true)
-				if err != nil {
-					return err
-				}
-				s.loadedFilters[walletID] = true
-
-				s.rescanStart(walletID)
-
-				rescanBlock, err := w.BlockHeader(ctx, rescanPoint)
-				if err != nil {
-					return err
-				}
-				progress := make(chan wallet.RescanProgress, 1)
-				go w.RescanProgressFromHeight(ctx, walletBackend, int32(rescanBlock.Height), progress)
-
-				for p := range progress {
-					if p.Err != nil {
-						return p.Err
-					}
-					s.rescanProgress(walletID, p.ScannedThrough)
-				}
-				s.rescanFinished(walletID)
-
-				s.synced(walletID)
-
-				return nil
-			}()
+	if s.tryCatchUpLock() {
+		for walletID, w := range s.walletsSnapshot() {
+			err = s.catchUpWallet(ctx, rp, walletID, w)
+			if err != nil && s.walletRemoved(walletID) {
+				// The wallet was removed from the syncer during catch up.
+				err = nil
+			}
 		}
 
-		atomic.StoreUint32(&s.atomicCatchUpTryLock, 0)
+		s.releaseCatchUpLock(ctx, rp)
 		if err != nil {
 			return err
 		}
 	}
 
-	for _, w := range s.wallets {
+	for _, w := range s.walletsSnapshot() {
 		unminedTxs, err := w.UnminedTransactions(ctx)
 		if err != nil {
 			log.Errorf("Cannot load unmined transactions for resending: %v", err)
@@ -1469,6 +1518,75 @@ func (s *Syncer) startupSync(ctx context.Context, rp *p2p.RemotePeer) error {
 	return nil
 }
 
+// catchUpWallet performs address discovery and rescans the wallet from its
+// rescan point, if any, marking the wallet as synced once done.  It is
+// canceled if the wallet is removed from the syncer.
+func (s *Syncer) catchUpWallet(ctx context.Context, rp *p2p.RemotePeer, walletID int, w *wallet.Wallet) error {
+	ctx, cancel := s.walletContext(ctx, walletID)
+	defer cancel()
+
+	rescanPoint, err := w.RescanPoint(ctx)
+	if err != nil {
+		return err
+	}
+	walletBackend := &WalletBackend{
+		Syncer:   s,
+		WalletID: walletID,
+	}
+	if rescanPoint == nil {
+		if !s.filtersLoaded(walletID) {
+			err = w.LoadActiveDataFilters(ctx, walletBackend, true)
+			if err != nil {
+				return err
+			}
+			s.setFiltersLoaded(walletID)
+		}
+
+		s.synced(walletID)
+
+		return nil
+	}
+	// RescanPoint is != nil so we are not synced to the peer and
+	// check to see if it was previously synced
+	s.unsynced(walletID)
+
+	s.discoverAddressesStart(walletID)
+	peer := &meteredPeer{Peer: rp, s: s, walletID: walletID}
+	err = w.DiscoverActiveAddresses(ctx, peer, rescanPoint, !w.Locked(), w.GapLimit())
+	if err != nil {
+		return err
+	}
+
+	s.discoverAddressesFinished(walletID)
+
+	err = w.LoadActiveDataFilters(ctx, walletBackend, true)
+	if err != nil {
+		return err
+	}
+	s.setFiltersLoaded(walletID)
+
+	s.rescanStart(walletID)
+
+	rescanBlock, err := w.BlockHeader(ctx, rescanPoint)
+	if err != nil {
+		return err
+	}
+	progress := make(chan wallet.RescanProgress, 1)
+	go w.RescanProgressFromHeight(ctx, walletBackend, int32(rescanBlock.Height), progress)
+
+	for p := range progress {
+		if p.Err != nil {
+			return p.Err
+		}
+		s.rescanProgress(walletID, p.ScannedThrough)
+	}
+	s.rescanFinished(walletID)
+
+	s.synced(walletID)
+
+	return nil
+}
+
 // handleMempool handles eviction from the local mempool of non-wallet-backed
 // transactions. It MUST be run as a goroutine.
 func (s *Syncer) handleMempool(ctx context.Context) error {
@@ -0,0 +1,265 @@
+// Copyright (c) 2018-2021 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package spv
+
+import (
+	"context"
+	"sync/atomic"
+
+	"decred.org/dcrwallet/errors"
+	"decred.org/dcrwallet/p2p"
+	"decred.org/dcrwallet/wallet"
+	"github.com/decred/dcrd/gcs/v2/blockcf2"
+)
+
+// walletsSnapshot returns a copy of the wallets currently synced by the
+// syncer, safe to iterate while wallets are added or removed.
+func (s *Syncer) walletsSnapshot() map[int]*wallet.Wallet {
+	s.walletsMu.RLock()
+	defer s.walletsMu.RUnlock()
+
+	wallets := make(map[int]*wallet.Wallet, len(s.wallets))
+	for walletID, w := range s.wallets {
+		wallets[walletID] = w
+	}
+	return wallets
+}
+
+// walletByID returns the wallet with the provided ID if it is synced by the
+// syncer.
+func (s *Syncer) walletByID(walletID int) (*wallet.Wallet, bool) {
+	s.walletsMu.RLock()
+	defer s.walletsMu.RUnlock()
+
+	w, ok := s.wallets[walletID]
+	return w, ok
+}
+
+// walletSyncedFlag returns the atomic synced flag of the wallet.  The flag is
+// kept after the wallet is removed so that in-flight operations of a removed
+// wallet never dereference a nil pointer.
+func (s *Syncer) walletSyncedFlag(walletID int) *uint32 {
+	s.walletsMu.RLock()
+	defer s.walletsMu.RUnlock()
+
+	if flag, ok := s.atomicWalletsSynced[walletID]; ok {
+		return flag
+	}
+	return new(uint32)
+}
+
+func (s *Syncer) filtersLoaded(walletID int) bool {
+	s.walletsMu.RLock()
+	defer s.walletsMu.RUnlock()
+	return s.loadedFilters[walletID]
+}
+
+func (s *Syncer) setFiltersLoaded(walletID int) {
+	s.walletsMu.Lock()
+	s.loadedFilters[walletID] = true
+	s.walletsMu.Unlock()
+}
+
+// WalletIDs returns the IDs of the wallets synced by the syncer.
+func (s *Syncer) WalletIDs() []int {
+	s.walletsMu.RLock()
+	defer s.walletsMu.RUnlock()
+
+	walletIDs := make([]int, 0, len(s.wallets))
+	for walletID := range s.wallets {
+		walletIDs = append(walletIDs, walletID)
+	}
+	return walletIDs
+}
+
+// AddWallet adds a wallet to the syncer.  If the syncer is already running,
+// the wallet is brought up to date with the network using a connected peer
+// without interrupting the sync of other wallets.
+func (s *Syncer) AddWallet(walletID int, w *wallet.Wallet) error {
+	s.walletsMu.Lock()
+	if _, exists := s.wallets[walletID]; exists {
+		s.walletsMu.Unlock()
+		return errors.E(errors.Exist, "wallet is already synced")
+	}
+	s.wallets[walletID] = w
+	if s.chainParams == nil {
+		s.chainParams = w.ChainParams()
+	}
+	if flag, ok := s.atomicWalletsSynced[walletID]; ok {
+		atomic.StoreUint32(flag, 0)
+	} else {
+		s.atomicWalletsSynced[walletID] = new(uint32)
+	}
+	if _, ok := s.walletBandwidth[walletID]; !ok {
+		s.walletBandwidth[walletID] = new(bandwidthCounter)
+	}
+	delete(s.loadedFilters, walletID)
+	s.walletQuit[walletID] = make(chan struct{})
+	runCtx := s.runCtx
+	s.walletsMu.Unlock()
+
+	s.filterMu.Lock()
+	s.rescanFilter[walletID] = wallet.NewRescanFilter(nil, nil)
+	s.filterData[walletID] = &blockcf2.Entries{}
+	s.filterMu.Unlock()
+
+	// Headers are fetched using the locators of the wallet with the lowest
+	// tip, which may now be the added wallet.
+	s.locatorMu.Lock()
+	s.currentLocators = nil
+	s.locatorMu.Unlock()
+
+	if runCtx == nil {
+		// Not running yet, the wallet is synced when Run is called.
+		return nil
+	}
+
+	log.Infof("[%d] Wallet added to running sync", walletID)
+	w.SetNetworkBackend(&WalletBackend{Syncer: s, WalletID: walletID})
+	go func() {
+		ctx, cancel := s.walletContext(runCtx, walletID)
+		defer cancel()
+
+		err := s.startupSyncWallet(ctx, walletID, w)
+		if err != nil && ctx.Err() == nil {
+			log.Errorf("[%d] Failed to sync added wallet: %v", walletID, err)
+		}
+	}()
+	return nil
+}
+
+// RemoveWallet stops syncing the wallet, canceling any ongoing address
+// discovery or rescan of the wallet.  Other wallets keep syncing.
+func (s *Syncer) RemoveWallet(walletID int) error {
+	s.walletsMu.Lock()
+	w, exists := s.wallets[walletID]
+	if !exists {
+		s.walletsMu.Unlock()
+		return errors.E(errors.NotExist, "wallet is not synced")
+	}
+	delete(s.wallets, walletID)
+	delete(s.loadedFilters, walletID)
+	if quit, ok := s.walletQuit[walletID]; ok {
+		close(quit)
+		delete(s.walletQuit, walletID)
+	}
+	atomic.StoreUint32(s.atomicWalletsSynced[walletID], 0)
+	running := s.runCtx != nil
+	s.walletsMu.Unlock()
+
+	s.locatorMu.Lock()
+	s.currentLocators = nil
+	s.locatorMu.Unlock()
+
+	if running {
+		w.SetNetworkBackend(nil)
+	}
+	log.Infof("[%d] Wallet removed from sync", walletID)
+	return nil
+}
+
+// walletRemoved returns whether the wallet was removed from the syncer.
+func (s *Syncer) walletRemoved(walletID int) bool {
+	_, ok := s.walletByID(walletID)
+	return !ok
+}
+
+// walletContext returns a context that is canceled when either ctx is done or
+// the wallet is removed from the syncer.
+func (s *Syncer) walletContext(ctx context.Context, walletID int) (context.Context, context.CancelFunc) {
+	s.walletsMu.RLock()
+	quit, ok := s.walletQuit[walletID]
+	s.walletsMu.RUnlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	if !ok {
+		cancel()
+		return ctx, cancel
+	}
+
+	go func() {
+		select {
+		case <-quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// startupSyncWallet brings a wallet added to a running syncer up to date using
+// any connected peer.  If no peer is connected, the wallet is synced by
+// startupSync once a peer connects.  If another catch up is running, the
+// wallet is caught up by it.
+func (s *Syncer) startupSyncWallet(ctx context.Context, walletID int, w *wallet.Wallet) error {
+	rp, err := s.pickRemote(func(*p2p.RemotePeer) bool { return true })
+	if err != nil {
+		log.Debugf("[%d] No peers connected, wallet will be synced on next peer connection", walletID)
+		return nil
+	}
+
+	if err := s.fetchWalletMissingCFilters(ctx, rp, walletID, w); err != nil {
+		return err
+	}
+
+	if !s.tryCatchUpLockOrQueue(walletID) {
+		log.Debugf("[%d] Wallet queued for the running catch up", walletID)
+		return nil
+	}
+	defer s.releaseCatchUpLock(ctx, rp)
+
+	if err := s.getHeaders(ctx, rp); err != nil {
+		return err
+	}
+	return s.catchUpWallet(ctx, rp, walletID, w)
+}
+
+// tryCatchUpLock acquires atomicCatchUpTryLock if it isn't held.
+func (s *Syncer) tryCatchUpLock() bool {
+	s.catchUpMu.Lock()
+	defer s.catchUpMu.Unlock()
+	return atomic.CompareAndSwapUint32(&s.atomicCatchUpTryLock, 0, 1)
+}
+
+// tryCatchUpLockOrQueue acquires atomicCatchUpTryLock if it isn't held, else
+// the wallet is queued to be caught up before the lock is released.
+func (s *Syncer) tryCatchUpLockOrQueue(walletID int) bool {
+	s.catchUpMu.Lock()
+	defer s.catchUpMu.Unlock()
+
+	if atomic.CompareAndSwapUint32(&s.atomicCatchUpTryLock, 0, 1) {
+		return true
+	}
+	s.pendingCatchUp[walletID] = struct{}{}
+	return false
+}
+
+// releaseCatchUpLock catches up the wallets queued by tryCatchUpLockOrQueue
+// using rp and releases atomicCatchUpTryLock.  Wallets that fail to catch up
+// are caught up again on the next peer connection.
+func (s *Syncer) releaseCatchUpLock(ctx context.Context, rp *p2p.RemotePeer) {
+	for {
+		s.catchUpMu.Lock()
+		if len(s.pendingCatchUp) == 0 {
+			atomic.StoreUint32(&s.atomicCatchUpTryLock, 0)
+			s.catchUpMu.Unlock()
+			return
+		}
+		pending := s.pendingCatchUp
+		s.pendingCatchUp = make(map[int]struct{})
+		s.catchUpMu.Unlock()
+
+		for walletID := range pending {
+			w, ok := s.walletByID(walletID)
+			if !ok || atomic.LoadUint32(s.walletSyncedFlag(walletID)) == 1 {
+				continue
+			}
+			err := s.catchUpWallet(ctx, rp, walletID, w)
+			if err != nil && ctx.Err() == nil && !s.walletRemoved(walletID) {
+				log.Errorf("[%d] Failed to sync added wallet: %v", walletID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package spv
+
+import (
+	"context"
+
+	"decred.org/dcrwallet/wallet"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Wallets", func() {
+	var s *Syncer
+
+	BeforeEach(func() {
+		s = NewSyncer(map[int]*wallet.Wallet{}, nil)
+	})
+
+	It("queues wallets added during a running catch up", func() {
+		Expect(s.tryCatchUpLock()).To(BeTrue())
+		Expect(s.tryCatchUpLock()).To(BeFalse())
+
+		Expect(s.tryCatchUpLockOrQueue(1)).To(BeFalse())
+		Expect(s.tryCatchUpLockOrQueue(2)).To(BeFalse())
+		Expect(s.pendingCatchUp).To(HaveLen(2))
+
+		By("Catching up the queued wallets before releasing the lock")
+		// the queued wallets were removed, so they are skipped.
+		s.releaseCatchUpLock(context.Background(), nil)
+		Expect(s.pendingCatchUp).To(BeEmpty())
+
+		Expect(s.tryCatchUpLockOrQueue(3)).To(BeTrue())
+		Expect(s.pendingCatchUp).To(BeEmpty())
+		s.releaseCatchUpLock(context.Background(), nil)
+		Expect(s.tryCatchUpLock()).To(BeTrue())
+	})
+
+	It("adds and removes wallets before running", func() {
+		Expect(s.WalletIDs()).To(BeEmpty())
+		Expect(s.RemoveWallet(1)).ToNot(BeNil())
+		Expect(s.walletRemoved(1)).To(BeTrue())
+
+		ctx, cancel := s.walletContext(context.Background(), 1)
+		defer cancel()
+		Expect(ctx.Err()).To(Equal(context.Canceled))
+	})
+})
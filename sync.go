@@ -35,6 +35,21 @@ type syncData struct {
 	rescanning     bool
 	connectedPeers int32
 
+	// networkMetered is reported by the host app and applied to every
+	// new syncer for the data saver mode.
+	networkMetered       bool
+	lastSessionBandwidth *BandwidthUsage
+
+	// lowBattery is reported by the host app to pause account mixers.
+	lowBattery bool
+
+	// dcrdRPCPass is the dcrd RPC password set by the app for this session.
+	dcrdRPCPass string
+
+	// syncOnce is set if the current sync session was started with
+	// SpvSyncOnce.
+	syncOnce *syncOnceSession
+
 	*activeSyncData
 }
 
@@ -54,6 +69,10 @@ type activeSyncData struct {
 	rescanStartTime int64
 
 	totalInactiveSeconds int64
+
+	// resumedCheckpoint holds the progress of the previous, interrupted
+	// sync session if any.
+	resumedCheckpoint *syncCheckpoint
 }
 
 const (
@@ -99,6 +118,7 @@ func (mw *MultiWallet) initActiveSyncData() {
 		addressDiscoveryProgress: addressDiscoveryProgress,
 		headersRescanProgress:    headersRescanProgress,
 	}
+	mw.resumeFromSyncCheckpoint()
 	mw.syncData.mu.Unlock()
 }
 
@@ -111,7 +131,7 @@ func (mw *MultiWallet) IsSyncProgressListenerRegisteredFor(uniqueIdentifier stri
 
 func (mw *MultiWallet) AddSyncProgressListener(syncProgressListener SyncProgressListener, uniqueIdentifier string) error {
 	if mw.IsSyncProgressListenerRegisteredFor(uniqueIdentifier) {
-		return errors.New(ErrListenerAlreadyExist)
+		return newError(ErrListenerAlreadyExist)
 	}
 
 	mw.syncData.mu.Lock()
@@ -146,7 +166,7 @@ func (mw *MultiWallet) PublishLastSyncProgress(uniqueIdentifier string) error {
 
 	syncProgressListener, exists := mw.syncData.syncProgressListeners[uniqueIdentifier]
 	if !exists {
-		return errors.New(ErrInvalid)
+		return newError(ErrInvalid)
 	}
 
 	if mw.syncData.syncing && mw.syncData.activeSyncData != nil {
@@ -188,7 +208,7 @@ func (mw *MultiWallet) SyncInactiveForPeriod(totalInactiveSeconds int64) {
 func (mw *MultiWallet) SpvSync() error {
 	// prevent an attempt to sync when the previous syncing has not been canceled
 	if mw.IsSyncing() || mw.IsSynced() {
-		return errors.New(ErrSyncAlreadyInProgress)
+		return newError(ErrSyncAlreadyInProgress)
 	}
 
 	addr := &net.TCPAddr{IP: net.ParseIP("::1"), Port: 0}
@@ -209,16 +229,21 @@ func (mw *MultiWallet) SpvSync() error {
 		}
 
 		if len(validPeerAddresses) == 0 {
-			return errors.New(ErrInvalidPeers)
+			return newError(ErrInvalidPeers)
 		}
 	}
 
+	syncableWallets := mw.syncableWallets()
+	if len(syncableWallets) == 0 {
+		return newError(ErrFailedPrecondition)
+	}
+
 	// init activeSyncData to be used to hold data used
 	// to calculate sync estimates only during sync
 	mw.initActiveSyncData()
 
 	wallets := make(map[int]*w.Wallet)
-	for id, wallet := range mw.wallets {
+	for id, wallet := range syncableWallets {
 		wallets[id] = wallet.internal
 		wallet.waitingForHeaders = true
 		wallet.syncing = true
@@ -230,6 +255,13 @@ func (mw *MultiWallet) SpvSync() error {
 		syncer.SetPersistentPeers(validPeerAddresses)
 	}
 
+	return mw.startSync(syncer, syncer.Run)
+}
+
+// startSync marks sync as started and runs the sync function of the
+// configured network backend in a goroutine until it returns. syncer is nil
+// if the network backend isn't SPV.
+func (mw *MultiWallet) startSync(syncer *spv.Syncer, run func(ctx context.Context) error) error {
 	ctx, cancel := mw.contextWithShutdownCancel()
 
 	var restartSyncRequested bool
@@ -239,25 +271,28 @@ func (mw *MultiWallet) SpvSync() error {
 	mw.syncData.restartSyncRequested = false
 	mw.syncData.syncing = true
 	mw.syncData.cancelSync = cancel
-	mw.syncData.syncCanceled = make(chan struct{})
+	syncCanceled := make(chan struct{})
+	mw.syncData.syncCanceled = syncCanceled
 	mw.syncData.syncer = syncer
+	if syncer != nil {
+		mw.configureDataSaver(syncer)
+	}
 	mw.syncData.mu.Unlock()
 
 	for _, listener := range mw.syncProgressListeners() {
 		listener.OnSyncStarted(restartSyncRequested)
 	}
 
-	// syncer.Run uses a wait group to block the thread until the sync context
-	// expires or is canceled or some other error occurs such as
-	// losing connection to all persistent peers.
+	// run blocks the thread until the sync context expires or is canceled
+	// or some other error occurs such as losing connection to all
+	// persistent peers.
 	go func() {
-		syncError := syncer.Run(ctx)
+		syncError := run(ctx)
 		//sync has ended or errored
 		if syncError != nil {
 			if syncError == context.DeadlineExceeded {
-				mw.notifySyncError(errors.Errorf("SPV synchronization deadline exceeded: %v", syncError))
+				mw.notifySyncError(errors.Errorf("synchronization deadline exceeded: %v", syncError))
 			} else if syncError == context.Canceled {
-				close(mw.syncData.syncCanceled)
 				mw.notifySyncCanceled()
 			} else {
 				mw.notifySyncError(syncError)
@@ -266,6 +301,11 @@ func (mw *MultiWallet) SpvSync() error {
 
 		//reset sync variables
 		mw.resetSyncData()
+
+		// CancelSync returns once the sync data is reset so that sync can
+		// be restarted right away.
+		close(syncCanceled)
+		mw.finishSyncOnce(syncError)
 	}()
 	return nil
 }
@@ -282,30 +322,24 @@ func (mw *MultiWallet) RestartSpvSync() error {
 func (mw *MultiWallet) CancelSync() {
 	mw.syncData.mu.RLock()
 	cancelSync := mw.syncData.cancelSync
+	syncCanceled := mw.syncData.syncCanceled
 	mw.syncData.mu.RUnlock()
 
 	if cancelSync != nil {
 		log.Info("Canceling sync. May take a while for sync to fully cancel.")
 
-		// Stop running cspp mixers
-		for _, wallet := range mw.wallets {
-			if wallet.IsAccountMixerActive() {
-				log.Infof("[%d] Stopping cspp mixer", wallet.ID)
-				err := mw.StopAccountMixer(wallet.ID)
-				if err != nil {
-					log.Errorf("[%d] Error stopping cspp mixer: %v", wallet.ID, err)
-				}
-			}
-		}
+		// Suspend running cspp mixers, they are resumed once wallets
+		// are synced again.
+		mw.suspendAccountMixers()
 
 		// Cancel the context used for syncer.Run in spvSync().
 		// This may not immediately cause the sync process to terminate,
 		// but when it eventually terminates, syncer.Run will return `err == context.Canceled`.
 		cancelSync()
 
-		// When sync terminates and syncer.Run returns `err == context.Canceled`,
-		// we will get notified on this channel.
-		<-mw.syncData.syncCanceled
+		// When sync terminates and the sync data is reset, we will get
+		// notified on this channel.
+		<-syncCanceled
 
 		log.Info("Sync fully canceled.")
 	}
@@ -377,12 +411,24 @@ func (mw *MultiWallet) ConnectedPeers() int32 {
 	return mw.syncData.connectedPeers
 }
 
+// PeerInfoRaw returns the peers connected while syncing over SPV. Peers are
+// unavailable while syncing from dcrd over RPC.
 func (mw *MultiWallet) PeerInfoRaw() ([]PeerInfo, error) {
 	if !mw.IsConnectedToDecredNetwork() {
-		return nil, errors.New(ErrNotConnected)
+		return nil, newError(ErrNotConnected)
 	}
 
-	syncer := mw.syncData.syncer
+	mw.syncData.mu.RLock()
+	var syncer *spv.Syncer
+	if mw.syncData.activeSyncData != nil {
+		syncer = mw.syncData.syncer
+	}
+	mw.syncData.mu.RUnlock()
+
+	if syncer == nil {
+		// syncing from dcrd over RPC, there are no p2p peers.
+		return nil, newError(ErrUnavailable)
+	}
 
 	infos := make([]PeerInfo, 0, len(syncer.GetRemotePeers()))
 	for _, rp := range syncer.GetRemotePeers() {
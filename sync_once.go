@@ -0,0 +1,253 @@
+package dcrlibwallet
+
+import (
+	"context"
+	"time"
+
+	"github.com/asdine/storm"
+)
+
+const (
+	syncBucketName    = "sync"
+	syncCheckpointKey = "checkpoint"
+
+	// DefaultSyncOnceMempoolGracePeriod is the default number of seconds a
+	// sync once session stays connected after catching up to the chain tip,
+	// to resend unmined transactions and receive relevant mempool
+	// transactions, see SetSyncOnceMempoolGracePeriod.
+	DefaultSyncOnceMempoolGracePeriod int64 = 15
+)
+
+// syncOnceSession holds the state of a sync session started with
+// SyncOnce. reading/writing of properties of this struct are protected
+// by syncData.mu.
+type syncOnceSession struct {
+	listener SyncOnceListener
+
+	startTime         int64
+	startHeight       int32
+	startTransactions int32
+	caughtUp          bool
+}
+
+// syncCheckpoint records the progress of a sync session that ended before
+// all wallets were synced, so that progress reports of the next session
+// continue from where the previous one stopped.
+type syncCheckpoint struct {
+	SyncStage int32
+
+	CFiltersStartHeight    int32
+	CFiltersFetchTimeSpent int64
+
+	HeadersStartHeight    int32
+	HeadersFetchTimeSpent int64
+
+	TotalSyncProgress int32
+}
+
+// SyncOnce connects to the network using the configured network mode, syncs
+// all wallets to the chain tip, waits a short while for mempool transactions
+// and then stops syncing. listener is notified with a summary of the session
+// when sync stops, whether it caught up, was canceled or failed. This is
+// intended to be called from OS scheduled background tasks.
+func (mw *MultiWallet) SyncOnce(listener SyncOnceListener) error {
+	if mw.IsSyncing() || mw.IsSynced() {
+		return newError(ErrSyncAlreadyInProgress)
+	}
+
+	session := &syncOnceSession{
+		listener:          listener,
+		startTime:         time.Now().Unix(),
+		startTransactions: mw.countAllTransactions(),
+	}
+	if lowestBlock := mw.GetLowestBlock(); lowestBlock != nil {
+		session.startHeight = lowestBlock.Height
+	}
+
+	mw.syncData.mu.Lock()
+	mw.syncData.syncOnce = session
+	mw.syncData.mu.Unlock()
+
+	err := mw.Sync()
+	if err != nil {
+		mw.syncData.mu.Lock()
+		mw.syncData.syncOnce = nil
+		mw.syncData.mu.Unlock()
+	}
+	return err
+}
+
+// SetSyncOnceMempoolGracePeriod sets the number of seconds sync once sessions
+// stay connected after catching up to the chain tip. A negative value uses
+// DefaultSyncOnceMempoolGracePeriod.
+func (mw *MultiWallet) SetSyncOnceMempoolGracePeriod(seconds int64) {
+	if seconds < 0 {
+		seconds = DefaultSyncOnceMempoolGracePeriod
+	}
+	mw.SaveUserConfigValue(SyncOnceMempoolGracePeriodConfigKey, seconds)
+}
+
+// SyncOnceMempoolGracePeriod returns the number of seconds sync once sessions
+// stay connected after catching up to the chain tip.
+func (mw *MultiWallet) SyncOnceMempoolGracePeriod() int64 {
+	return mw.ReadLongConfigValueForKey(SyncOnceMempoolGracePeriodConfigKey, DefaultSyncOnceMempoolGracePeriod)
+}
+
+// IsSyncingOnce returns true if the current sync session was started with
+// SyncOnce.
+func (mw *MultiWallet) IsSyncingOnce() bool {
+	mw.syncData.mu.RLock()
+	defer mw.syncData.mu.RUnlock()
+	return mw.syncData.syncOnce != nil
+}
+
+// syncOnceCaughtUp is called after all wallets are synced and transactions
+// indexed. If the current session was started with SyncOnce, sync is
+// canceled after a grace period for mempool transactions.
+func (mw *MultiWallet) syncOnceCaughtUp() {
+	mw.syncData.mu.Lock()
+	session := mw.syncData.syncOnce
+	if session == nil || session.caughtUp {
+		mw.syncData.mu.Unlock()
+		return
+	}
+	session.caughtUp = true
+	mw.syncData.mu.Unlock()
+
+	gracePeriod := time.Duration(mw.SyncOnceMempoolGracePeriod()) * time.Second
+	log.Infof("Sync once: caught up, stopping sync in %v", gracePeriod)
+
+	go func() {
+		time.Sleep(gracePeriod)
+
+		// Sync may have been canceled or restarted in the meantime.
+		mw.syncData.mu.RLock()
+		sameSession := mw.syncData.syncOnce == session
+		mw.syncData.mu.RUnlock()
+
+		if sameSession {
+			mw.CancelSync()
+		}
+	}()
+}
+
+// finishSyncOnce notifies the sync once listener, if any, of the outcome of
+// the sync session that just ended.
+func (mw *MultiWallet) finishSyncOnce(syncError error) {
+	mw.syncData.mu.Lock()
+	session := mw.syncData.syncOnce
+	mw.syncData.syncOnce = nil
+	mw.syncData.mu.Unlock()
+
+	if session == nil {
+		return
+	}
+
+	summary := &SyncSummary{
+		CaughtUp:        session.caughtUp,
+		StartHeight:     session.startHeight,
+		NewTransactions: mw.countAllTransactions() - session.startTransactions,
+		DurationSeconds: time.Now().Unix() - session.startTime,
+		BytesDownloaded: mw.SessionBandwidthUsage().TotalBytes,
+	}
+	if lowestBlock := mw.GetLowestBlock(); lowestBlock != nil {
+		summary.EndHeight = lowestBlock.Height
+	}
+	if syncError != nil && !(session.caughtUp && syncError == context.Canceled) {
+		summary.Error = syncError.Error()
+	}
+
+	if session.listener != nil {
+		session.listener.OnSyncOnceFinished(summary)
+	}
+}
+
+func (mw *MultiWallet) countAllTransactions() int32 {
+	var count int32
+	for _, wallet := range mw.wallets {
+		if !wallet.WalletOpened() {
+			continue
+		}
+		walletTxCount, err := wallet.CountTransactions(TxFilterAll)
+		if err != nil {
+			log.Errorf("[%d] error counting transactions: %v", wallet.ID, err)
+			continue
+		}
+		count += int32(walletTxCount)
+	}
+	return count
+}
+
+// saveSyncCheckpoint records the progress of an incomplete sync session.
+// If all wallets were synced, the previous checkpoint is removed instead.
+// this function requires mw.syncData.mu to be held.
+func (mw *MultiWallet) saveSyncCheckpoint() {
+	if mw.syncData.synced || mw.syncData.activeSyncData == nil ||
+		mw.syncData.activeSyncData.syncStage == InvalidSyncStage {
+
+		err := mw.db.Delete(syncBucketName, syncCheckpointKey)
+		if err != nil && err != storm.ErrNotFound {
+			log.Errorf("error deleting sync checkpoint: %v", err)
+		}
+		return
+	}
+
+	now := time.Now().Unix()
+	active := mw.syncData.activeSyncData
+	checkpoint := &syncCheckpoint{
+		SyncStage:              active.syncStage,
+		CFiltersStartHeight:    -1,
+		CFiltersFetchTimeSpent: active.cfiltersFetchProgress.cfiltersFetchTimeSpent,
+		HeadersStartHeight:     -1,
+		HeadersFetchTimeSpent:  active.headersFetchProgress.headersFetchTimeSpent,
+	}
+
+	switch active.syncStage {
+	case CFiltersFetchSyncStage:
+		checkpoint.CFiltersStartHeight = active.cfiltersFetchProgress.startCFiltersHeight
+		checkpoint.CFiltersFetchTimeSpent = now - active.cfiltersFetchProgress.beginFetchCFiltersTimeStamp - active.totalInactiveSeconds
+		checkpoint.TotalSyncProgress = active.cfiltersFetchProgress.TotalSyncProgress
+	case HeadersFetchSyncStage:
+		checkpoint.HeadersStartHeight = active.headersFetchProgress.startHeaderHeight
+		checkpoint.HeadersFetchTimeSpent = now - active.headersFetchProgress.beginFetchTimeStamp - active.totalInactiveSeconds
+		checkpoint.TotalSyncProgress = active.headersFetchProgress.TotalSyncProgress
+	case AddressDiscoverySyncStage:
+		checkpoint.TotalSyncProgress = active.addressDiscoveryProgress.TotalSyncProgress
+	case HeadersRescanSyncStage:
+		checkpoint.TotalSyncProgress = active.headersRescanProgress.TotalSyncProgress
+	}
+
+	err := mw.db.Set(syncBucketName, syncCheckpointKey, checkpoint)
+	if err != nil {
+		log.Errorf("error saving sync checkpoint: %v", err)
+	}
+}
+
+// resumeFromSyncCheckpoint seeds the progress reports of a new sync session
+// with the progress recorded when the previous session was interrupted.
+// this function requires mw.syncData.mu to be held.
+func (mw *MultiWallet) resumeFromSyncCheckpoint() {
+	var checkpoint syncCheckpoint
+	err := mw.db.Get(syncBucketName, syncCheckpointKey, &checkpoint)
+	if err != nil {
+		if err != storm.ErrNotFound {
+			log.Errorf("error reading sync checkpoint: %v", err)
+		}
+		return
+	}
+
+	active := mw.syncData.activeSyncData
+	active.resumedCheckpoint = &checkpoint
+
+	active.cfiltersFetchProgress.TotalSyncProgress = checkpoint.TotalSyncProgress
+	active.headersFetchProgress.TotalSyncProgress = checkpoint.TotalSyncProgress
+	active.addressDiscoveryProgress.TotalSyncProgress = checkpoint.TotalSyncProgress
+	active.headersRescanProgress.TotalSyncProgress = checkpoint.TotalSyncProgress
+
+	if checkpoint.CFiltersStartHeight != -1 {
+		active.cfiltersFetchProgress.startCFiltersHeight = checkpoint.CFiltersStartHeight
+	}
+	if checkpoint.SyncStage > CFiltersFetchSyncStage && checkpoint.CFiltersFetchTimeSpent > 0 {
+		active.cfiltersFetchProgress.cfiltersFetchTimeSpent = checkpoint.CFiltersFetchTimeSpent
+	}
+}
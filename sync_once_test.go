@@ -0,0 +1,132 @@
+package dcrlibwallet
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type testSyncOnceListener struct {
+	summaries chan *SyncSummary
+}
+
+func (l *testSyncOnceListener) OnSyncOnceFinished(summary *SyncSummary) {
+	l.summaries <- summary
+}
+
+var _ = Describe("SyncOnce", func() {
+	var mw *MultiWallet
+	var cleanup func()
+
+	BeforeEach(func() {
+		mw, cleanup = newTestMultiWallet()
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	Describe("sync checkpoints", func() {
+		It("resumes cfilters fetch progress from the checkpoint", func() {
+			wallet := newTestWallet(mw, "checkpoint")
+
+			By("Saving the progress of an interrupted cfilters fetch")
+			mw.initActiveSyncData()
+			mw.syncData.mu.Lock()
+			mw.syncData.syncStage = CFiltersFetchSyncStage
+			mw.syncData.cfiltersFetchProgress.startCFiltersHeight = 100
+			mw.syncData.cfiltersFetchProgress.beginFetchCFiltersTimeStamp = time.Now().Unix() - 30
+			mw.syncData.cfiltersFetchProgress.TotalSyncProgress = 12
+			mw.saveSyncCheckpoint()
+			mw.syncData.mu.Unlock()
+
+			var checkpoint syncCheckpoint
+			Expect(mw.db.Get(syncBucketName, syncCheckpointKey, &checkpoint)).To(BeNil())
+			Expect(checkpoint.SyncStage).To(BeEquivalentTo(CFiltersFetchSyncStage))
+			Expect(checkpoint.CFiltersStartHeight).To(BeEquivalentTo(100))
+			Expect(checkpoint.CFiltersFetchTimeSpent).To(BeNumerically("~", 30, 1))
+			Expect(checkpoint.HeadersStartHeight).To(BeEquivalentTo(-1))
+
+			By("Starting a new session from the checkpoint")
+			mw.initActiveSyncData()
+			Expect(mw.syncData.resumedCheckpoint).ToNot(BeNil())
+			Expect(mw.syncData.cfiltersFetchProgress.startCFiltersHeight).To(BeEquivalentTo(100))
+			Expect(mw.syncData.cfiltersFetchProgress.TotalSyncProgress).To(BeEquivalentTo(12))
+
+			mw.fetchCFiltersStarted(wallet.ID)
+			Expect(time.Now().Unix() - mw.syncData.cfiltersFetchProgress.beginFetchCFiltersTimeStamp).To(BeNumerically("~", 30, 1))
+
+			By("Counting the cfilters fetched by the previous session")
+			mw.fetchCFiltersProgress(wallet.ID, 500, 600)
+			Expect(mw.syncData.cfiltersFetchProgress.totalFetchedCFiltersCount).To(BeEquivalentTo(500))
+			Expect(mw.syncData.cfiltersFetchProgress.CurrentCFilterHeight).To(BeEquivalentTo(500))
+
+			By("Removing the checkpoint once synced")
+			mw.syncData.mu.Lock()
+			mw.syncData.synced = true
+			mw.saveSyncCheckpoint()
+			mw.syncData.synced = false
+			mw.syncData.mu.Unlock()
+			mw.initActiveSyncData()
+			Expect(mw.syncData.resumedCheckpoint).To(BeNil())
+			Expect(mw.syncData.cfiltersFetchProgress.startCFiltersHeight).To(BeEquivalentTo(-1))
+		})
+	})
+
+	Describe("mempool grace period", func() {
+		It("defaults to DefaultSyncOnceMempoolGracePeriod", func() {
+			Expect(mw.SyncOnceMempoolGracePeriod()).To(Equal(DefaultSyncOnceMempoolGracePeriod))
+			mw.SetSyncOnceMempoolGracePeriod(1)
+			Expect(mw.SyncOnceMempoolGracePeriod()).To(BeEquivalentTo(1))
+			mw.SetSyncOnceMempoolGracePeriod(-1)
+			Expect(mw.SyncOnceMempoolGracePeriod()).To(Equal(DefaultSyncOnceMempoolGracePeriod))
+		})
+
+		It("stops sync once caught up and after the grace period", func() {
+			mw.SetSyncOnceMempoolGracePeriod(1)
+			listener := &testSyncOnceListener{summaries: make(chan *SyncSummary, 1)}
+
+			canceled := make(chan struct{})
+			mw.syncData.mu.Lock()
+			mw.syncData.syncOnce = &syncOnceSession{listener: listener, startTime: time.Now().Unix()}
+			mw.syncData.syncCanceled = make(chan struct{})
+			mw.syncData.cancelSync = func() {
+				mw.syncData.mu.Lock()
+				mw.syncData.cancelSync = nil
+				mw.syncData.mu.Unlock()
+				close(canceled)
+				mw.finishSyncOnce(context.Canceled)
+				mw.syncData.syncCanceled <- struct{}{}
+			}
+			mw.syncData.mu.Unlock()
+
+			caughtUp := time.Now()
+			mw.syncOnceCaughtUp()
+			Expect(mw.IsSyncingOnce()).To(BeTrue())
+			Eventually(canceled, 3*time.Second).Should(BeClosed())
+			Expect(time.Since(caughtUp)).To(BeNumerically(">=", time.Second))
+
+			var summary *SyncSummary
+			Eventually(listener.summaries).Should(Receive(&summary))
+			Expect(summary.CaughtUp).To(BeTrue())
+			Expect(summary.Error).To(BeEmpty())
+			Expect(mw.IsSyncingOnce()).To(BeFalse())
+		})
+
+		It("reports errors of sessions that did not catch up", func() {
+			listener := &testSyncOnceListener{summaries: make(chan *SyncSummary, 1)}
+			mw.syncData.mu.Lock()
+			mw.syncData.syncOnce = &syncOnceSession{listener: listener, startTime: time.Now().Unix()}
+			mw.syncData.mu.Unlock()
+
+			mw.finishSyncOnce(context.Canceled)
+
+			var summary *SyncSummary
+			Expect(listener.summaries).To(Receive(&summary))
+			Expect(summary.CaughtUp).To(BeFalse())
+			Expect(summary.Error).To(Equal(context.Canceled.Error()))
+		})
+	})
+})
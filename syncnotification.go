@@ -57,6 +57,10 @@ func (mw *MultiWallet) fetchCFiltersStarted(walletID int) {
 	mw.syncData.activeSyncData.syncStage = CFiltersFetchSyncStage
 	mw.syncData.activeSyncData.cfiltersFetchProgress.beginFetchCFiltersTimeStamp = time.Now().Unix()
 	mw.syncData.activeSyncData.cfiltersFetchProgress.totalFetchedCFiltersCount = 0
+	if checkpoint := mw.syncData.activeSyncData.resumedCheckpoint; checkpoint != nil && checkpoint.SyncStage == CFiltersFetchSyncStage {
+		// continue from the progress made by the previous sync session.
+		mw.syncData.activeSyncData.cfiltersFetchProgress.beginFetchCFiltersTimeStamp -= checkpoint.CFiltersFetchTimeSpent
+	}
 	showLogs := mw.syncData.showLogs
 	mw.syncData.mu.Unlock()
 
@@ -74,6 +78,11 @@ func (mw *MultiWallet) fetchCFiltersProgress(walletID int, startCFiltersHeight,
 		mw.syncData.activeSyncData.cfiltersFetchProgress.startCFiltersHeight = startCFiltersHeight
 	}
 
+	if mw.syncData.activeSyncData.cfiltersFetchProgress.totalFetchedCFiltersCount == 0 {
+		// account for cfilters fetched by a previous sync session, if resumed.
+		mw.syncData.activeSyncData.cfiltersFetchProgress.totalFetchedCFiltersCount = startCFiltersHeight - mw.syncData.activeSyncData.cfiltersFetchProgress.startCFiltersHeight
+	}
+
 	wallet := mw.WalletWithID(walletID)
 	mw.syncData.activeSyncData.cfiltersFetchProgress.totalFetchedCFiltersCount += endCFiltersHeight - startCFiltersHeight
 
@@ -114,6 +123,7 @@ func (mw *MultiWallet) fetchCFiltersProgress(walletID int, startCFiltersHeight,
 	mw.syncData.activeSyncData.cfiltersFetchProgress.CFiltersFetchProgress = roundUp(cfiltersFetchProgress * 100.0)
 	mw.syncData.activeSyncData.cfiltersFetchProgress.TotalSyncProgress = roundUp(totalSyncProgress * 100.0)
 	mw.syncData.activeSyncData.cfiltersFetchProgress.TotalTimeRemainingSeconds = totalTimeRemainingSeconds
+	mw.syncData.activeSyncData.cfiltersFetchProgress.BytesDownloaded = mw.sessionBytesDownloaded()
 
 	mw.syncData.mu.Unlock()
 
@@ -178,6 +188,12 @@ func (mw *MultiWallet) fetchHeadersStarted(peerInitialHeight int32) {
 	mw.syncData.activeSyncData.headersFetchProgress.startHeaderHeight = lowestBlockHeight
 	mw.syncData.headersFetchProgress.totalFetchedHeadersCount = 0
 	mw.syncData.activeSyncData.totalInactiveSeconds = 0
+	if checkpoint := mw.syncData.activeSyncData.resumedCheckpoint; checkpoint != nil && checkpoint.SyncStage == HeadersFetchSyncStage &&
+		checkpoint.HeadersStartHeight != -1 && checkpoint.HeadersStartHeight < lowestBlockHeight {
+		// continue from the progress made by the previous sync session.
+		mw.syncData.activeSyncData.headersFetchProgress.beginFetchTimeStamp -= checkpoint.HeadersFetchTimeSpent
+		mw.syncData.activeSyncData.headersFetchProgress.startHeaderHeight = checkpoint.HeadersStartHeight
+	}
 	mw.syncData.mu.Unlock()
 
 	if showLogs {
@@ -253,6 +269,7 @@ func (mw *MultiWallet) fetchHeadersProgress(lastFetchedHeaderHeight int32, lastF
 	mw.syncData.activeSyncData.headersFetchProgress.HeadersFetchProgress = roundUp(headersFetchProgress * 100.0)
 	mw.syncData.activeSyncData.headersFetchProgress.TotalSyncProgress = roundUp(totalSyncProgress * 100.0)
 	mw.syncData.activeSyncData.headersFetchProgress.TotalTimeRemainingSeconds = totalTimeRemainingSeconds
+	mw.syncData.activeSyncData.headersFetchProgress.BytesDownloaded = mw.sessionBytesDownloaded()
 
 	// unlock the mutex before issuing notification callbacks to prevent potential deadlock
 	// if any invoked callback takes a considerable amount of time to execute.
@@ -402,6 +419,7 @@ func (mw *MultiWallet) updateAddressDiscoveryProgress(totalHeadersFetchTime floa
 			mw.syncData.addressDiscoveryProgress.AddressDiscoveryProgress = int32(math.Round(discoveryProgress))
 			mw.syncData.addressDiscoveryProgress.TotalSyncProgress = totalProgressPercent
 			mw.syncData.addressDiscoveryProgress.TotalTimeRemainingSeconds = totalTimeRemainingSeconds
+			mw.syncData.addressDiscoveryProgress.BytesDownloaded = mw.sessionBytesDownloaded()
 			mw.syncData.mu.Unlock()
 
 			mw.publishAddressDiscoveryProgress()
@@ -521,6 +539,7 @@ func (mw *MultiWallet) rescanProgress(walletID int, rescannedThrough int32) {
 		mw.syncData.activeSyncData.headersRescanProgress.TotalTimeRemainingSeconds = totalTimeRemainingSeconds
 		mw.syncData.activeSyncData.headersRescanProgress.TotalSyncProgress = int32(math.Round(totalProgress))
 	}
+	mw.syncData.activeSyncData.headersRescanProgress.BytesDownloaded = mw.sessionBytesDownloaded()
 
 	mw.syncData.mu.Unlock()
 
@@ -614,6 +633,12 @@ func (mw *MultiWallet) resetSyncData() {
 	mw.stopUpdatingAddressDiscoveryProgress()
 
 	mw.syncData.mu.Lock()
+	mw.saveSyncCheckpoint()
+	var sessionBandwidth *BandwidthUsage
+	if mw.syncData.activeSyncData != nil {
+		sessionBandwidth = mw.sessionBandwidthUsage()
+		mw.syncData.lastSessionBandwidth = sessionBandwidth
+	}
 	mw.syncData.syncing = false
 	mw.syncData.synced = false
 	mw.syncData.cancelSync = nil
@@ -621,6 +646,10 @@ func (mw *MultiWallet) resetSyncData() {
 	mw.syncData.activeSyncData = nil
 	mw.syncData.mu.Unlock()
 
+	if sessionBandwidth != nil {
+		mw.saveSessionBandwidthUsage(sessionBandwidth)
+	}
+
 	for _, wallet := range mw.wallets {
 		wallet.waitingForHeaders = true
 		wallet.LockWallet() // lock wallet if previously unlocked to perform account discovery.
@@ -628,37 +657,12 @@ func (mw *MultiWallet) resetSyncData() {
 }
 
 func (mw *MultiWallet) synced(walletID int, synced bool) {
-
-	indexTransactions := func() {
-		// begin indexing transactions after sync is completed,
-		// syncProgressListeners.OnSynced() will be invoked after transactions are indexed
-		var txIndexing errgroup.Group
-		for _, wallet := range mw.wallets {
-			txIndexing.Go(wallet.IndexTransactions)
-		}
-
-		go func() {
-			err := txIndexing.Wait()
-			if err != nil {
-				log.Errorf("Tx Index Error: %v", err)
-			}
-
-			for _, syncProgressListener := range mw.syncProgressListeners() {
-				if synced {
-					syncProgressListener.OnSyncCompleted()
-				} else {
-					syncProgressListener.OnSyncCanceled(false)
-				}
-			}
-		}()
-	}
-
 	mw.syncData.mu.RLock()
 	allWalletsSynced := mw.syncData.synced
 	mw.syncData.mu.RUnlock()
 
 	if allWalletsSynced && synced {
-		indexTransactions()
+		mw.indexTransactionsAndNotifySynced(synced)
 		return
 	}
 
@@ -675,12 +679,46 @@ func (mw *MultiWallet) synced(walletID int, synced bool) {
 		}
 	}
 
-	if mw.OpenedWalletsCount() == mw.SyncedWalletsCount() {
+	if mw.allWalletsSynced() {
 		mw.syncData.mu.Lock()
 		mw.syncData.syncing = false
 		mw.syncData.synced = true
 		mw.syncData.mu.Unlock()
 
-		indexTransactions()
+		mw.indexTransactionsAndNotifySynced(synced)
+	}
+}
+
+func (mw *MultiWallet) indexTransactionsAndNotifySynced(synced bool) {
+	// begin indexing transactions after sync is completed,
+	// syncProgressListeners.OnSynced() will be invoked after transactions are indexed
+	var txIndexing errgroup.Group
+	for _, wallet := range mw.syncableWallets() {
+		txIndexing.Go(wallet.IndexTransactions)
 	}
+
+	go func() {
+		err := txIndexing.Wait()
+		if err != nil {
+			log.Errorf("Tx Index Error: %v", err)
+		}
+
+		for _, syncProgressListener := range mw.syncProgressListeners() {
+			if synced {
+				syncProgressListener.OnSyncCompleted()
+			} else {
+				syncProgressListener.OnSyncCanceled(false)
+			}
+		}
+
+		if synced {
+			mw.syncOnceCaughtUp()
+			mw.resumeAccountMixers()
+
+			for _, wallet := range mw.syncableWallets() {
+				mw.checkInvoicePayments(wallet)
+			}
+			mw.startTxFiatBackfill()
+		}
+	}()
 }
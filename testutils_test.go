@@ -0,0 +1,82 @@
+package dcrlibwallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+// newTestMultiWallet returns a testnet MultiWallet in a temporary directory
+// and a function that shuts it down and removes the directory.
+func newTestMultiWallet() (*MultiWallet, func()) {
+	return newTestMultiWalletWithDriver("")
+}
+
+// newTestMultiWalletWithDriver is like newTestMultiWallet but creates
+// wallets with the database driver.
+func newTestMultiWalletWithDriver(dbDriver string) (*MultiWallet, func()) {
+	rootDir, err := ioutil.TempDir("", "dcrlibwallet")
+	ExpectWithOffset(1, err).To(BeNil())
+
+	mw, err := NewMultiWallet(rootDir, dbDriver, "testnet3")
+	ExpectWithOffset(1, err).To(BeNil())
+	return mw, func() {
+		mw.Shutdown()
+		os.RemoveAll(rootDir)
+	}
+}
+
+// openTestMultiWallet returns the testnet MultiWallet in rootDir.
+func openTestMultiWallet(rootDir string) *MultiWallet {
+	mw, err := NewMultiWallet(rootDir, "", "testnet3")
+	ExpectWithOffset(1, err).To(BeNil())
+	return mw
+}
+
+// newTestWallet creates a wallet with the passphrase "passphrase" in mw.
+func newTestWallet(mw *MultiWallet, name string) *Wallet {
+	wallet, err := mw.CreateNewWallet(name, "passphrase", PassphraseTypePass)
+	ExpectWithOffset(1, err).To(BeNil())
+	return wallet
+}
+
+// newTestTLSServer starts a TLS server for 127.0.0.1 with a new self-signed
+// certificate. Servers started by httptest.NewTLSServer all share the same
+// certificate.
+func newTestTLSServer(handler http.Handler) *httptest.Server {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ExpectWithOffset(1, err).To(BeNil())
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{Organization: []string{"dcrlibwallet test"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	ExpectWithOffset(1, err).To(BeNil())
+
+	server := httptest.NewUnstartedServer(handler)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{certDER}, PrivateKey: key}},
+	}
+	server.StartTLS()
+	return server
+}
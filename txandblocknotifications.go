@@ -2,8 +2,6 @@ package dcrlibwallet
 
 import (
 	"encoding/json"
-
-	"decred.org/dcrwallet/errors"
 )
 
 func (mw *MultiWallet) listenForTransactions(walletID int) {
@@ -12,6 +10,10 @@ func (mw *MultiWallet) listenForTransactions(walletID int) {
 		wallet := mw.wallets[walletID]
 		n := wallet.internal.NtfnServer.TransactionNotifications()
 
+		mw.syncData.mu.RLock()
+		syncCanceled := mw.syncData.syncCanceled
+		mw.syncData.mu.RUnlock()
+
 		for {
 			select {
 			case v := <-n.C:
@@ -31,6 +33,10 @@ func (mw *MultiWallet) listenForTransactions(walletID int) {
 						return
 					}
 
+					if tempTransaction.Type == TxTypeMixed {
+						mw.linkMixTransaction(wallet, tempTransaction)
+					}
+
 					if !overwritten {
 						log.Infof("[%d] New Transaction %s", wallet.ID, tempTransaction.Hash)
 
@@ -57,6 +63,11 @@ func (mw *MultiWallet) listenForTransactions(walletID int) {
 							log.Errorf("[%d] Incoming block replace tx error :%v", wallet.ID, err)
 							return
 						}
+
+						if tempTransaction.Type == TxTypeMixed {
+							mw.linkMixTransaction(wallet, tempTransaction)
+						}
+
 						mw.publishTransactionConfirmed(wallet.ID, transaction.Hash.String(), int32(block.Header.Height))
 					}
 
@@ -65,9 +76,15 @@ func (mw *MultiWallet) listenForTransactions(walletID int) {
 
 				if len(v.AttachedBlocks) > 0 {
 					mw.checkWalletMixers()
+
+					// blocks attached while catching up don't warrant reminders
+					if mw.IsSynced() {
+						tipHeight := int32(v.AttachedBlocks[len(v.AttachedBlocks)-1].Header.Height)
+						mw.Politeia.checkVoteReminders(tipHeight)
+					}
 				}
 
-			case <-mw.syncData.syncCanceled:
+			case <-syncCanceled:
 				n.Done()
 			}
 		}
@@ -80,7 +97,7 @@ func (mw *MultiWallet) AddTxAndBlockNotificationListener(txAndBlockNotificationL
 
 	_, ok := mw.txAndBlockNotificationListeners[uniqueIdentifier]
 	if ok {
-		return errors.New(ErrListenerAlreadyExist)
+		return newError(ErrListenerAlreadyExist)
 	}
 
 	mw.txAndBlockNotificationListeners[uniqueIdentifier] = txAndBlockNotificationListener
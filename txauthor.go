@@ -34,7 +34,7 @@ type TxAuthor struct {
 func (mw *MultiWallet) NewUnsignedTx(walletID int, sourceAccountNumber int32) (*TxAuthor, error) {
 	sourceWallet := mw.WalletWithID(walletID)
 	if sourceWallet == nil {
-		return nil, fmt.Errorf(ErrWalletNotFound)
+		return nil, walletError(walletID, "NewUnsignedTx", newError(ErrWalletNotFound))
 	}
 
 	_, err := sourceWallet.GetAccount(sourceAccountNumber)
@@ -53,11 +53,11 @@ func (mw *MultiWallet) NewUnsignedTx(walletID int, sourceAccountNumber int32) (*
 func (tx *TxAuthor) AddSendDestination(address string, atomAmount int64, sendMax bool) error {
 	_, err := dcrutil.DecodeAddress(address, tx.sourceWallet.chainParams)
 	if err != nil {
-		return translateError(err)
+		return walletError(tx.sourceWallet.ID, "AddSendDestination", &Error{Code: ErrInvalidAddress, Err: err})
 	}
 
 	if err := tx.validateSendAmount(sendMax, atomAmount); err != nil {
-		return err
+		return walletError(tx.sourceWallet.ID, "AddSendDestination", err)
 	}
 
 	tx.destinations = append(tx.destinations, TransactionDestination{
@@ -72,11 +72,11 @@ func (tx *TxAuthor) AddSendDestination(address string, atomAmount int64, sendMax
 
 func (tx *TxAuthor) UpdateSendDestination(index int, address string, atomAmount int64, sendMax bool) error {
 	if err := tx.validateSendAmount(sendMax, atomAmount); err != nil {
-		return err
+		return walletError(tx.sourceWallet.ID, "UpdateSendDestination", err)
 	}
 
 	if len(tx.destinations) < index {
-		return errors.New(ErrIndexOutOfRange)
+		return walletError(tx.sourceWallet.ID, "UpdateSendDestination", newError(ErrIndexOutOfRange))
 	}
 
 	tx.destinations[index] = TransactionDestination{
@@ -126,7 +126,7 @@ func (tx *TxAuthor) TotalSendAmount() *Amount {
 func (tx *TxAuthor) EstimateFeeAndSize() (*TxFeeAndSize, error) {
 	unsignedTx, err := tx.unsignedTransaction()
 	if err != nil {
-		return nil, translateError(err)
+		return nil, walletError(tx.sourceWallet.ID, "EstimateFeeAndSize", err)
 	}
 
 	feeToSendTx := txrules.FeeForSerializeSize(txrules.DefaultRelayFeePerKb, unsignedTx.EstimatedSignedSerializeSize)
@@ -181,12 +181,13 @@ func (tx *TxAuthor) UseInputs(utxoKeys []string) error {
 		hashIndex := utxoKey[idx+1:]
 		index, err := strconv.Atoi(hashIndex)
 		if err != nil {
-			return fmt.Errorf("no valid utxo found for '%s' in the source account at index %d", utxoKey, index)
+			err = errors.E(errors.Invalid, fmt.Sprintf("no valid utxo found for '%s' in the source account at index %d", utxoKey, index))
+			return walletError(tx.sourceWallet.ID, "UseInputs", err)
 		}
 
 		txHash, err := chainhash.NewHashFromStr(hash)
 		if err != nil {
-			return err
+			return walletError(tx.sourceWallet.ID, "UseInputs", errors.E(errors.Invalid, err))
 		}
 
 		op := &wire.OutPoint{
@@ -195,7 +196,8 @@ func (tx *TxAuthor) UseInputs(utxoKeys []string) error {
 		}
 		outputInfo, err := tx.sourceWallet.internal.OutputInfo(tx.sourceWallet.shutdownContext(), op)
 		if err != nil {
-			return fmt.Errorf("no valid utxo found for '%s' in the source account", utxoKey)
+			err = errors.E(errors.NotExist, fmt.Sprintf("no valid utxo found for '%s' in the source account", utxoKey))
+			return walletError(tx.sourceWallet.ID, "UseInputs", err)
 		}
 
 		input := wire.NewTxIn(op, int64(outputInfo.Amount), nil)
@@ -217,12 +219,12 @@ func (tx *TxAuthor) Broadcast(privatePassphrase []byte) ([]byte, error) {
 	n, err := tx.sourceWallet.internal.NetworkBackend()
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, walletError(tx.sourceWallet.ID, "Broadcast", err)
 	}
 
 	unsignedTx, err := tx.unsignedTransaction()
 	if err != nil {
-		return nil, translateError(err)
+		return nil, walletError(tx.sourceWallet.ID, "Broadcast", err)
 	}
 
 	if unsignedTx.ChangeIndex >= 0 {
@@ -234,7 +236,7 @@ func (tx *TxAuthor) Broadcast(privatePassphrase []byte) ([]byte, error) {
 	err = unsignedTx.Tx.Serialize(&txBuf)
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, walletError(tx.sourceWallet.ID, "Broadcast", errors.E(errors.Encoding, err))
 	}
 
 	var msgTx wire.MsgTx
@@ -242,7 +244,7 @@ func (tx *TxAuthor) Broadcast(privatePassphrase []byte) ([]byte, error) {
 	if err != nil {
 		log.Error(err)
 		//Bytes do not represent a valid raw transaction
-		return nil, err
+		return nil, walletError(tx.sourceWallet.ID, "Broadcast", errors.E(errors.Encoding, err))
 	}
 
 	lock := make(chan time.Time, 1)
@@ -254,7 +256,7 @@ func (tx *TxAuthor) Broadcast(privatePassphrase []byte) ([]byte, error) {
 	err = tx.sourceWallet.internal.Unlock(ctx, privatePassphrase, lock)
 	if err != nil {
 		log.Error(err)
-		return nil, errors.New(ErrInvalidPassphrase)
+		return nil, walletError(tx.sourceWallet.ID, "Broadcast", newError(ErrInvalidPassphrase))
 	}
 
 	var additionalPkScripts map[wire.OutPoint][]byte
@@ -262,7 +264,7 @@ func (tx *TxAuthor) Broadcast(privatePassphrase []byte) ([]byte, error) {
 	invalidSigs, err := tx.sourceWallet.internal.SignTransaction(ctx, &msgTx, txscript.SigHashAll, additionalPkScripts, nil, nil)
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, walletError(tx.sourceWallet.ID, "Broadcast", err)
 	}
 
 	invalidInputIndexes := make([]uint32, len(invalidSigs))
@@ -275,19 +277,19 @@ func (tx *TxAuthor) Broadcast(privatePassphrase []byte) ([]byte, error) {
 	err = msgTx.Serialize(&serializedTransaction)
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, walletError(tx.sourceWallet.ID, "Broadcast", errors.E(errors.Encoding, err))
 	}
 
 	err = msgTx.Deserialize(bytes.NewReader(serializedTransaction.Bytes()))
 	if err != nil {
 		//Invalid tx
 		log.Error(err)
-		return nil, err
+		return nil, walletError(tx.sourceWallet.ID, "Broadcast", errors.E(errors.Encoding, err))
 	}
 
 	txHash, err := tx.sourceWallet.internal.PublishTransaction(ctx, &msgTx, n)
 	if err != nil {
-		return nil, translateError(err)
+		return nil, walletError(tx.sourceWallet.ID, "Broadcast", err)
 	}
 	return txHash[:], nil
 }
@@ -325,7 +327,7 @@ func (tx *TxAuthor) constructTransaction() (*txauthor.AuthoredTx, error) {
 
 		// check if multiple destinations are set to receive max amount
 		if destination.SendMax && changeSource != nil {
-			return nil, fmt.Errorf("cannot send max amount to multiple recipients")
+			return nil, errors.E(errors.Invalid, "cannot send max amount to multiple recipients")
 		}
 
 		if destination.SendMax {
@@ -336,13 +338,13 @@ func (tx *TxAuthor) constructTransaction() (*txauthor.AuthoredTx, error) {
 			changeSource, err = txhelper.MakeTxChangeSource(destination.Address, tx.sourceWallet.chainParams)
 			if err != nil {
 				log.Errorf("constructTransaction: error preparing change source: %v", err)
-				return nil, fmt.Errorf("max amount change source error: %v", err)
+				return nil, &Error{Code: ErrInvalidAddress, Err: err}
 			}
 		} else {
 			output, err := txhelper.MakeTxOutput(destination.Address, destination.AtomAmount, tx.sourceWallet.chainParams)
 			if err != nil {
 				log.Errorf("constructTransaction: error preparing tx output: %v", err)
-				return nil, fmt.Errorf("make tx output error: %v", err)
+				return nil, &Error{Code: ErrInvalidAddress, Err: err}
 			}
 
 			outputs = append(outputs, output)
@@ -0,0 +1,207 @@
+package dcrlibwallet
+
+import (
+	"context"
+	"strings"
+
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+)
+
+// TxFiatCurrencyConfigKey holds the currency in which the fiat value of
+// transactions is recorded, fiat values are not recorded if it is empty.
+const TxFiatCurrencyConfigKey = "tx_fiat_currency"
+
+// SetTransactionFiatCurrency sets the currency in which the fiat value of
+// transactions at the time they happened is recorded, see
+// Transaction.FiatAmount. Recording stops if currency is empty. The fiat
+// values of the saved transactions are looked up in the background.
+func (mw *MultiWallet) SetTransactionFiatCurrency(currency string) {
+	mw.SetStringConfigValueForKey(TxFiatCurrencyConfigKey, strings.ToUpper(currency))
+	if currency != "" {
+		mw.startTxFiatBackfill()
+	}
+}
+
+// TransactionFiatCurrency returns the currency in which the fiat value of
+// transactions is recorded, or an empty string if fiat values are not
+// recorded.
+func (mw *MultiWallet) TransactionFiatCurrency() string {
+	return mw.ReadStringConfigValueForKey(TxFiatCurrencyConfigKey)
+}
+
+func (wallet *Wallet) txFiatCurrency() string {
+	var currency string
+	if wallet.readUserConfigValue == nil {
+		return currency
+	}
+
+	wallet.readUserConfigValue(true, TxFiatCurrencyConfigKey, &currency)
+	return currency
+}
+
+// setTxFiatValues sets the fiat values of the tx at its timestamp in the
+// currency. Only saved rates are used unless fetch is true.
+func (wallet *Wallet) setTxFiatValues(tx *Transaction, currency string, fetch bool) error {
+	if currency == "" || wallet.exchangeRateAt == nil {
+		return newError(ErrInvalid)
+	}
+
+	rate, err := wallet.exchangeRateAt(currency, tx.Timestamp, fetch)
+	if err != nil {
+		return err
+	}
+
+	tx.FiatCurrency = currency
+	tx.FiatRate = rate.Rate
+	tx.FiatAmount = AmountCoin(tx.Amount) * rate.Rate
+	tx.FiatFee = AmountCoin(tx.Fee) * rate.Rate
+	if tx.Type == TxTypeVote {
+		tx.FiatVoteReward = AmountCoin(tx.VoteReward) * rate.Rate
+	}
+	return nil
+}
+
+// startTxFiatBackfill sets the missing fiat values of the transactions of all
+// wallets in the background, fetching the historical rates that aren't saved.
+// It is started after the wallets sync and when the currency is set. A
+// backfill started while one is running runs again once it ends, for the
+// transactions indexed meanwhile.
+func (mw *MultiWallet) startTxFiatBackfill() {
+	mw.txFiatBackfillMu.Lock()
+	defer mw.txFiatBackfillMu.Unlock()
+
+	if mw.txFiatBackfillRunning {
+		mw.txFiatBackfillAgain = true
+		return
+	}
+	mw.txFiatBackfillRunning = true
+
+	go func() {
+		ctx, cancel := mw.contextWithShutdownCancel()
+		defer cancel()
+
+		for {
+			mw.backfillTxFiatValues(ctx)
+
+			mw.txFiatBackfillMu.Lock()
+			if !mw.txFiatBackfillAgain || ctx.Err() != nil {
+				mw.txFiatBackfillRunning = false
+				mw.txFiatBackfillAgain = false
+				mw.txFiatBackfillMu.Unlock()
+				return
+			}
+			mw.txFiatBackfillAgain = false
+			mw.txFiatBackfillMu.Unlock()
+		}
+	}()
+}
+
+// isTxFiatBackfillRunning returns true while a backfill started by
+// startTxFiatBackfill runs.
+func (mw *MultiWallet) isTxFiatBackfillRunning() bool {
+	mw.txFiatBackfillMu.Lock()
+	defer mw.txFiatBackfillMu.Unlock()
+	return mw.txFiatBackfillRunning
+}
+
+func (mw *MultiWallet) backfillTxFiatValues(ctx context.Context) {
+	for _, wallet := range mw.AllWallets() {
+		// the currency may be changed by the app meanwhile
+		currency, transactions := mw.txsMissingFiatValues(wallet)
+		if currency == "" {
+			return
+		}
+
+		// rates are no longer fetched after a failed fetch so that an
+		// unreachable source isn't requested for every transaction. Hours
+		// the source has no rate for, e.g. before DCR was listed, are
+		// remembered and skipped.
+		fetch := true
+		for i := range transactions {
+			if ctx.Err() != nil {
+				return
+			}
+
+			tx := &transactions[i]
+			hourKey := savedExchangeRateKey(currency, tx.Timestamp)
+			if mw.isTxFiatRateMissing(hourKey) {
+				continue
+			}
+
+			err := wallet.setTxFiatValues(tx, currency, fetch)
+			if err != nil && fetch {
+				log.Debugf("[%d] No %s rate for tx %s: %v", wallet.ID, currency, tx.Hash, err)
+				if IsErrorCode(err, ErrNotExist) {
+					mw.setTxFiatRateMissing(hourKey)
+				} else {
+					fetch = false
+				}
+			}
+			if err != nil {
+				continue
+			}
+
+			mw.saveTxFiatValues(wallet, tx)
+		}
+	}
+}
+
+func (mw *MultiWallet) isTxFiatRateMissing(hourKey string) bool {
+	mw.txFiatBackfillMu.Lock()
+	defer mw.txFiatBackfillMu.Unlock()
+	return mw.txFiatMissingRates[hourKey]
+}
+
+func (mw *MultiWallet) setTxFiatRateMissing(hourKey string) {
+	mw.txFiatBackfillMu.Lock()
+	defer mw.txFiatBackfillMu.Unlock()
+	if mw.txFiatMissingRates == nil {
+		mw.txFiatMissingRates = make(map[string]bool)
+	}
+	mw.txFiatMissingRates[hourKey] = true
+}
+
+// txsMissingFiatValues returns the transaction fiat currency and the
+// transactions of the wallet without fiat values in that currency.
+func (mw *MultiWallet) txsMissingFiatValues(wallet *Wallet) (string, []Transaction) {
+	mw.restoreMu.RLock()
+	defer mw.restoreMu.RUnlock()
+
+	currency := mw.TransactionFiatCurrency()
+	if currency == "" || mw.WalletWithID(wallet.ID) != wallet {
+		return currency, nil
+	}
+
+	var transactions []Transaction
+	err := wallet.walletDataDB.Find(q.Not(q.Eq("FiatCurrency", currency)), &transactions)
+	if err != nil && err != storm.ErrNotFound {
+		log.Errorf("[%d] Error reading transactions without fiat values: %v", wallet.ID, err)
+	}
+	return currency, transactions
+}
+
+// saveTxFiatValues saves the fiat values of tx to the tx index, on top of the
+// changes made to the saved tx since it was read.
+func (mw *MultiWallet) saveTxFiatValues(wallet *Wallet, tx *Transaction) {
+	mw.restoreMu.RLock()
+	defer mw.restoreMu.RUnlock()
+
+	if mw.WalletWithID(wallet.ID) != wallet {
+		return
+	}
+
+	var saved Transaction
+	err := wallet.walletDataDB.FindOne("Hash", tx.Hash, &saved)
+	if err == nil {
+		saved.FiatCurrency = tx.FiatCurrency
+		saved.FiatRate = tx.FiatRate
+		saved.FiatAmount = tx.FiatAmount
+		saved.FiatFee = tx.FiatFee
+		saved.FiatVoteReward = tx.FiatVoteReward
+		_, err = wallet.walletDataDB.SaveOrUpdate(&Transaction{}, &saved)
+	}
+	if err != nil {
+		log.Errorf("[%d] Error saving fiat values of tx %s: %v", wallet.ID, tx.Hash, err)
+	}
+}
@@ -1,6 +1,8 @@
 package dcrlibwallet
 
 import (
+	"encoding/json"
+
 	w "decred.org/dcrwallet/wallet"
 	"github.com/decred/dcrd/chaincfg/chainhash"
 	"github.com/planetdecred/dcrlibwallet/walletdata"
@@ -92,3 +94,24 @@ func (wallet *Wallet) reindexTransactions() error {
 
 	return wallet.IndexTransactions()
 }
+
+// WalletDataMigrationStatusRaw returns the version of the wallet data
+// database and describes its last upgrade.
+func (wallet *Wallet) WalletDataMigrationStatusRaw() (*walletdata.MigrationStatus, error) {
+	return wallet.walletDataDB.MigrationStatus()
+}
+
+// WalletDataMigrationStatus returns the result of
+// WalletDataMigrationStatusRaw as a JSON string.
+func (wallet *Wallet) WalletDataMigrationStatus() (string, error) {
+	status, err := wallet.WalletDataMigrationStatusRaw()
+	if err != nil {
+		return "", err
+	}
+
+	result, err := json.Marshal(status)
+	if err != nil {
+		return "", translateError(err)
+	}
+	return string(result), nil
+}
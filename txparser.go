@@ -112,5 +112,11 @@ func (wallet *Wallet) decodeTransactionWithTxSummary(txSummary *w.TransactionSum
 		wallet.walletDataDB.SaveOrUpdate(&Transaction{}, ticketPurchaseTx)
 	}
 
+	// record fiat values from saved rates, missing values are looked up
+	// when transactions are read
+	if currency := wallet.txFiatCurrency(); currency != "" {
+		wallet.setTxFiatValues(decodedTx, currency, false)
+	}
+
 	return decodedTx, nil
 }
@@ -87,6 +87,101 @@ type PeerInfo struct {
 type AccountMixerNotificationListener interface {
 	OnAccountMixerStarted(walletID int)
 	OnAccountMixerEnded(walletID int)
+	OnAccountMixerRoundJoined(walletID int, round *MixerRound)
+	OnAccountMixerRoundCompleted(walletID int, round *MixerRound)
+	OnAccountMixerRoundFailed(walletID int, round *MixerRound)
+	OnAccountMixerOutputsMixed(walletID int, round *MixerRound)
+	OnAccountMixerPassphraseRequired(walletID int)
+}
+
+// MixerSession records what the account mixer did from the time it was
+// started until it ended.
+type MixerSession struct {
+	ID        int   `storm:"id,increment" json:"id"`
+	WalletID  int   `json:"walletID"`
+	StartedAt int64 `storm:"index" json:"started_at"`
+	EndedAt   int64 `json:"ended_at"`
+
+	RoundsJoined int32 `json:"rounds_joined"`
+	RoundsFailed int32 `json:"rounds_failed"`
+	OutputsMixed int32 `json:"outputs_mixed"`
+
+	// Denominations maps the mixed output values to the number of outputs
+	// mixed to that value.
+	Denominations map[int64]int32 `json:"denominations"`
+	TotalMixed    int64           `json:"total_mixed"`
+	FeesPaid      int64           `json:"fees_paid"`
+
+	// MixTransactions are the hashes of the TxTypeMixed transactions
+	// created during the session.
+	MixTransactions []string `json:"mix_transactions"`
+}
+
+// MixerRound is an attempt to mix an output of the unmixed account in a
+// CoinShuffle++ session.
+type MixerRound struct {
+	ID        int    `storm:"id,increment" json:"id"`
+	SessionID int    `storm:"index" json:"session_id"`
+	Outpoint  string `storm:"index" json:"outpoint"`
+	Amount    int64  `json:"amount"`
+	StartedAt int64  `json:"started_at"`
+	EndedAt   int64  `json:"ended_at"`
+
+	// Error is the reason the round failed, empty if it succeeded.
+	Error string `json:"error"`
+
+	// MixTxHash is the hash of the TxTypeMixed transaction created by the
+	// round, set once the transaction is seen by the wallet.
+	MixTxHash    string `storm:"index" json:"mix_tx_hash"`
+	Denomination int64  `json:"denomination"`
+	OutputsMixed int32  `json:"outputs_mixed"`
+	Fee          int64  `json:"fee"`
+}
+
+// PrivacyReport summarizes the privacy of the funds of a wallet.
+type PrivacyReport struct {
+	WalletID int `json:"walletID"`
+
+	// MixedBalance and UnmixedBalance are the total balances of the mixed
+	// and unmixed accounts set for the account mixer. OtherBalance is the
+	// total balance of the other accounts.
+	MixedBalance   int64 `json:"mixed_balance"`
+	UnmixedBalance int64 `json:"unmixed_balance"`
+	OtherBalance   int64 `json:"other_balance"`
+
+	// ReusedAddresses are the wallet addresses that received funds in more
+	// than one transaction.
+	ReusedAddresses []*ReusedAddress `json:"reused_addresses"`
+
+	// MergedInputTransactions are the transactions that spent mixed and
+	// unmixed outputs together, linking them.
+	MergedInputTransactions []*MergedInputTransaction `json:"merged_input_transactions"`
+
+	// LinkedChangeOutputs are the change outputs of transactions spending
+	// mixed outputs, which are linked to the mixed funds until remixed.
+	LinkedChangeOutputs []*LinkedChangeOutput `json:"linked_change_outputs"`
+}
+
+type ReusedAddress struct {
+	Address       string   `json:"address"`
+	AccountNumber int32    `json:"account_number"`
+	TotalReceived int64    `json:"total_received"`
+	TxHashes      []string `json:"tx_hashes"`
+}
+
+type MergedInputTransaction struct {
+	Hash          string `json:"hash"`
+	Timestamp     int64  `json:"timestamp"`
+	MixedInputs   int64  `json:"mixed_inputs"`
+	UnmixedInputs int64  `json:"unmixed_inputs"`
+}
+
+type LinkedChangeOutput struct {
+	TxHash        string `json:"tx_hash"`
+	Index         int32  `json:"index"`
+	Address       string `json:"address"`
+	Amount        int64  `json:"amount"`
+	AccountNumber int32  `json:"account_number"`
 }
 
 /** begin sync-related types */
@@ -104,9 +199,26 @@ type SyncProgressListener interface {
 	Debug(debugInfo *DebugInfo)
 }
 
+type SyncOnceListener interface {
+	OnSyncOnceFinished(summary *SyncSummary)
+}
+
+// SyncSummary describes the outcome of a sync session started with
+// MultiWallet.SyncOnce.
+type SyncSummary struct {
+	CaughtUp        bool   `json:"caughtUp"`
+	StartHeight     int32  `json:"startHeight"`
+	EndHeight       int32  `json:"endHeight"`
+	NewTransactions int32  `json:"newTransactions"`
+	DurationSeconds int64  `json:"durationSeconds"`
+	BytesDownloaded int64  `json:"bytesDownloaded"`
+	Error           string `json:"error"`
+}
+
 type GeneralSyncProgress struct {
 	TotalSyncProgress         int32 `json:"totalSyncProgress"`
 	TotalTimeRemainingSeconds int64 `json:"totalTimeRemainingSeconds"`
+	BytesDownloaded           int64 `json:"bytesDownloaded"`
 }
 
 type CFiltersFetchProgressReport struct {
@@ -156,6 +268,14 @@ type DebugInfo struct {
 	CurrentStageTimeRemaining int64
 }
 
+type BandwidthUsage struct {
+	HeadersBytes      int64 `json:"headersBytes"`
+	CFiltersBytes     int64 `json:"cfiltersBytes"`
+	BlocksBytes       int64 `json:"blocksBytes"`
+	TransactionsBytes int64 `json:"transactionsBytes"`
+	TotalBytes        int64 `json:"totalBytes"`
+}
+
 /** end sync-related types */
 
 /** begin tx-related types */
@@ -172,6 +292,25 @@ type BlocksRescanProgressListener interface {
 	OnBlocksRescanEnded(walletID int, err error)
 }
 
+// DatabaseMigrationProgressReport is sent to DatabaseMigrationProgressListener
+// while the wallet database is copied to the database of another driver and
+// while the copy is verified.
+type DatabaseMigrationProgressReport struct {
+	WalletID     int    `json:"walletID"`
+	TargetDriver string `json:"targetDriver"`
+	Stage        string `json:"stage"`
+	CopiedKeys   int64  `json:"copiedKeys"`
+	VerifiedKeys int64  `json:"verifiedKeys"`
+	TotalKeys    int64  `json:"totalKeys"`
+	Progress     int32  `json:"progress"`
+}
+
+type DatabaseMigrationProgressListener interface {
+	OnDatabaseMigrationStarted(walletID int)
+	OnDatabaseMigrationProgress(*DatabaseMigrationProgressReport)
+	OnDatabaseMigrationEnded(walletID int, err error)
+}
+
 // Transaction is used with storm for tx indexing operations.
 // For faster queries, the `Hash`, `Type` and `Direction` fields are indexed.
 type Transaction struct {
@@ -205,6 +344,14 @@ type Transaction struct {
 	VoteReward         int64  `json:"vote_reward"`
 	TicketSpentHash    string `storm:"unique" json:"ticket_spent_hash"`
 	DaysToVoteOrRevoke int32  `json:"days_to_vote_revoke"`
+
+	// Fiat values at Timestamp in FiatCurrency, set if a currency is set
+	// with SetTransactionFiatCurrency and a rate is available.
+	FiatCurrency   string  `json:"fiat_currency"`
+	FiatRate       float64 `json:"fiat_rate"`
+	FiatAmount     float64 `json:"fiat_amount"`
+	FiatFee        float64 `json:"fiat_fee"`
+	FiatVoteReward float64 `json:"fiat_vote_reward"`
 }
 
 type TxInput struct {
@@ -356,13 +503,84 @@ type Proposal struct {
 	EligibleTickets  int32  `json:"eligibletickets"`
 	QuorumPercentage int32  `json:"quorumpercentage"`
 	PassPercentage   int32  `json:"passpercentage"`
+	VoteEndHeight    int32  `json:"voteendheight"`
+
+	// WalletVotes are the votes cast on this proposal using tickets
+	// of the wallets in this multiwallet.
+	WalletVotes []*ProposalWalletVote `json:"walletvotes"`
+}
+
+// ProposalWalletVote is a vote cast on a proposal using a wallet ticket.
+type ProposalWalletVote struct {
+	WalletID   int    `json:"walletid"`
+	Ticket     string `json:"ticket"`
+	VoteOption string `json:"voteoption"`
+	Receipt    string `json:"receipt"`
+	CastAt     int64  `json:"castat"`
+}
+
+// ProposalUserState is the local state of a proposal set by the user.
+type ProposalUserState struct {
+	Token      string `json:"token" storm:"id"`
+	Bookmarked bool   `json:"bookmarked" storm:"index"`
+
+	// ReadVersion is the proposal version the user last read. A proposal
+	// is unread if it was edited since.
+	ReadVersion string `json:"readversion"`
+
+	// ReminderBlocks is the number of blocks before the end of the vote
+	// at which a reminder is sent, 0 if no reminder is set.
+	ReminderBlocks int32 `json:"reminderblocks"`
+	ReminderSent   bool  `json:"remindersent"`
+}
+
+// ProposalComment is a comment on a proposal cached for offline browsing.
+type ProposalComment struct {
+	ID          string `storm:"id"`
+	Token       string `json:"token" storm:"index"`
+	CommentID   string `json:"commentid"`
+	ParentID    string `json:"parentid"`
+	Comment     string `json:"comment"`
+	Timestamp   int64  `json:"timestamp"`
+	ResultVotes int64  `json:"resultvotes"`
+	Upvotes     int64  `json:"upvotes"`
+	Downvotes   int64  `json:"downvotes"`
+	Censored    bool   `json:"censored"`
+	UserID      string `json:"userid"`
+	Username    string `json:"username"`
+}
+
+// ProposalAttachment is a file attached to a version of a proposal, other
+// than the index file, cached for offline browsing. Payload is base64
+// encoded.
+type ProposalAttachment struct {
+	ID      string `storm:"id"`
+	Token   string `json:"token" storm:"index"`
+	Version string `json:"version"`
+	Name    string `json:"name"`
+	MIME    string `json:"mime"`
+	Digest  string `json:"digest"`
+	Payload string `json:"payload"`
+}
+
+// ProposalVersion is a version of a proposal, cached for offline browsing.
+type ProposalVersion struct {
+	ID          string   `storm:"id"`
+	Token       string   `json:"token" storm:"index"`
+	Version     string   `json:"version"`
+	Name        string   `json:"name"`
+	Timestamp   int64    `json:"timestamp"`
+	IndexFile   string   `json:"indexfile"`
+	Attachments []string `json:"attachments"`
 }
 
 type ProposalNotificationListener interface {
 	OnProposalsSynced()
+	OnProposalsSyncProgress(fetched, total int32)
 	OnNewProposal(proposal *Proposal)
 	OnProposalVoteStarted(proposal *Proposal)
 	OnProposalVoteFinished(proposal *Proposal)
+	OnProposalVoteEnding(proposal *Proposal, blocksLeft int32)
 }
 
 /** end politea proposal types */
@@ -445,3 +663,118 @@ type PendingFee struct {
 }
 
 /** end vspd-related types */
+
+// RootDirSize is the on-disk size in bytes of the multiwallet root directory,
+// broken down per database and per wallet.
+type RootDirSize struct {
+	Total     int64            `json:"total"`
+	WalletsDB int64            `json:"walletsDB"`
+	Logs      int64            `json:"logs"`
+	Other     int64            `json:"other"`
+	Wallets   []*WalletDirSize `json:"wallets"`
+}
+
+// WalletDirSize is the on-disk size in bytes of a wallet directory. For badger
+// wallet databases, WalletDBIndex and WalletDBValueLog are the sizes of the
+// LSM tree tables and of the value log files included in WalletDB.
+type WalletDirSize struct {
+	WalletID         int   `json:"walletID"`
+	Total            int64 `json:"total"`
+	WalletDB         int64 `json:"walletDB"`
+	WalletDBIndex    int64 `json:"walletDBIndex"`
+	WalletDBValueLog int64 `json:"walletDBValueLog"`
+	WalletDataDB     int64 `json:"walletDataDB"`
+	Other            int64 `json:"other"`
+}
+
+// ExchangeRate is the price of 1 DCR in a fiat currency at a unix timestamp,
+// as provided by a source. Fetched rates are saved for use as historical
+// rates, the last fetched rate of each hour is kept.
+type ExchangeRate struct {
+	Key       string  `storm:"id" json:"-"`
+	Currency  string  `json:"currency"`
+	Rate      float64 `json:"rate"`
+	Source    string  `json:"source"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+type ExchangeRateListener interface {
+	OnExchangeRateUpdated(rate *ExchangeRate)
+}
+
+// CostBasisReport holds the capital gains of the disposals of a wallet in a
+// fiat currency, see Wallet.CostBasisReportRaw. UnmatchedAtoms are disposed
+// atoms not covered by earlier acquisitions, they have no cost basis.
+// MissingRates are the hashes of transactions without an exchange rate, they
+// are valued at 0.
+type CostBasisReport struct {
+	WalletID           int                  `json:"walletID"`
+	Currency           string               `json:"currency"`
+	Method             string               `json:"method"`
+	Disposals          []*CostBasisDisposal `json:"disposals"`
+	TotalProceeds      float64              `json:"totalProceeds"`
+	TotalCostBasis     float64              `json:"totalCostBasis"`
+	TotalGain          float64              `json:"totalGain"`
+	RemainingAtoms     int64                `json:"remainingAtoms"`
+	RemainingCostBasis float64              `json:"remainingCostBasis"`
+	UnmatchedAtoms     int64                `json:"unmatchedAtoms"`
+	MissingRates       []string             `json:"missingRates"`
+}
+
+// CostBasisDisposal is a transaction disposing of coins. AcquiredAt is the
+// time the earliest of the disposed coins was acquired.
+type CostBasisDisposal struct {
+	Hash           string  `json:"hash"`
+	Timestamp      int64   `json:"timestamp"`
+	Atoms          int64   `json:"atoms"`
+	Proceeds       float64 `json:"proceeds"`
+	CostBasis      float64 `json:"costBasis"`
+	Gain           float64 `json:"gain"`
+	AcquiredAt     int64   `json:"acquiredAt"`
+	UnmatchedAtoms int64   `json:"unmatchedAtoms"`
+}
+
+// PaymentRequest is a payment requested with a decred: URI. Amount is in
+// atoms and Expiry is a unix timestamp, both are 0 if not requested.
+type PaymentRequest struct {
+	Address string `json:"address"`
+	Amount  int64  `json:"amount"`
+	Label   string `json:"label"`
+	Message string `json:"message"`
+	Expiry  int64  `json:"expiry"`
+}
+
+// Invoice is a payment of Amount atoms requested to Address, see
+// MultiWallet.CreateInvoice. Confirmations are those of the least confirmed
+// payment.
+type Invoice struct {
+	ID                    int               `storm:"id,increment" json:"id"`
+	WalletID              int               `storm:"index" json:"walletID"`
+	Account               int32             `json:"account"`
+	Address               string            `storm:"unique" json:"address"`
+	Amount                int64             `json:"amount"`
+	Label                 string            `json:"label"`
+	Message               string            `json:"message"`
+	URI                   string            `json:"uri"`
+	Status                int32             `storm:"index" json:"status"`
+	RequiredConfirmations int32             `json:"requiredConfirmations"`
+	Confirmations         int32             `json:"confirmations"`
+	AmountReceived        int64             `json:"amountReceived"`
+	Payments              []*InvoicePayment `json:"payments"`
+	CreatedAt             int64             `storm:"index" json:"createdAt"`
+	UpdatedAt             int64             `json:"updatedAt"`
+	Expiry                int64             `json:"expiry"`
+}
+
+// InvoicePayment is the amount paid to an invoice address by a transaction.
+// BlockHeight is -1 for unmined transactions.
+type InvoicePayment struct {
+	TxHash      string `json:"txHash"`
+	Amount      int64  `json:"amount"`
+	BlockHeight int32  `json:"blockHeight"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+type InvoiceNotificationListener interface {
+	OnInvoiceUpdated(invoice *Invoice)
+}
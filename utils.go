@@ -13,7 +13,6 @@ import (
 	"strings"
 	"time"
 
-	"decred.org/dcrwallet/errors"
 	"decred.org/dcrwallet/wallet"
 	"decred.org/dcrwallet/wallet/txrules"
 	"decred.org/dcrwallet/walletseed"
@@ -96,10 +95,10 @@ func (mw *MultiWallet) ValidateExtPubKey(extendedPubKey string) error {
 	_, err := hdkeychain.NewKeyFromString(extendedPubKey, mw.chainParams)
 	if err != nil {
 		if err == hdkeychain.ErrInvalidChild {
-			return errors.New(ErrUnusableSeed)
+			return newError(ErrUnusableSeed)
 		}
 
-		return errors.New(ErrInvalid)
+		return newError(ErrInvalid)
 	}
 
 	return nil
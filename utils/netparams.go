@@ -22,3 +22,15 @@ func ChainParams(netType string) (*chaincfg.Params, error) {
 		return nil, errors.New("invalid net type")
 	}
 }
+
+// DcrdRPCPort returns the default dcrd JSON-RPC server port for the network.
+func DcrdRPCPort(params *chaincfg.Params) string {
+	switch params.Net {
+	case mainnetParams.Net:
+		return "9109"
+	case testnetParams.Net:
+		return "19109"
+	default:
+		return ""
+	}
+}
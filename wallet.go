@@ -2,13 +2,12 @@ package dcrlibwallet
 
 import (
 	"context"
-	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"time"
 
-	"decred.org/dcrwallet/errors"
 	w "decred.org/dcrwallet/wallet"
 	"decred.org/dcrwallet/walletseed"
 	"github.com/decred/dcrd/chaincfg/v3"
@@ -36,9 +35,24 @@ type Wallet struct {
 	syncing           bool
 	waitingForHeaders bool
 
-	shuttingDown       chan bool
-	cancelFuncs        []context.CancelFunc
+	shuttingDown   chan bool
+	cancelFuncs    []context.CancelFunc
+	mixerSessionMu sync.Mutex
+
+	// mixerRoundsMu guards updates of saved mixer rounds, which are ended
+	// by the account mixer and linked to mix transactions by the tx index.
+	mixerRoundsMu sync.Mutex
+
+	// accountMixerMu guards the running account mixer and its cancel
+	// function.
+	accountMixerMu     sync.Mutex
 	cancelAccountMixer context.CancelFunc
+	accountMixer       *accountMixer
+
+	// migratingDatabase is set while MigrateWalletDatabase copies the
+	// wallet database, the wallet is excluded from sync meanwhile.
+	dbMigrationMu     sync.Mutex
+	migratingDatabase bool
 
 	// setUserConfigValue saves the provided key-value pair to a config database.
 	// This function is ideally assigned when the `wallet.prepare` method is
@@ -50,18 +64,23 @@ type Wallet struct {
 	// This function is ideally assigned when the `wallet.prepare` method is
 	// called from a MultiWallet instance.
 	readUserConfigValue configReadFn
+
+	// exchangeRateAt returns the exchange rate of a currency at a time, see
+	// MultiWallet.exchangeRateAt.
+	exchangeRateAt exchangeRateFn
 }
 
 // prepare gets a wallet ready for use by opening the transactions index database
 // and initializing the wallet loader which can be used subsequently to create,
 // load and unload the wallet.
 func (wallet *Wallet) prepare(rootDir string, chainParams *chaincfg.Params,
-	setUserConfigValueFn configSaveFn, readUserConfigValueFn configReadFn) (err error) {
+	setUserConfigValueFn configSaveFn, readUserConfigValueFn configReadFn, exchangeRateAtFn exchangeRateFn) (err error) {
 
 	wallet.chainParams = chainParams
 	wallet.dataDir = filepath.Join(rootDir, strconv.Itoa(wallet.ID))
 	wallet.setUserConfigValue = setUserConfigValueFn
 	wallet.readUserConfigValue = readUserConfigValueFn
+	wallet.exchangeRateAt = exchangeRateAtFn
 
 	// open database for indexing transactions for faster loading
 	walletDataDBPath := filepath.Join(wallet.dataDir, walletdata.DbName)
@@ -120,7 +139,7 @@ func (wallet *Wallet) Shutdown() {
 // wallets. Restored wallets would return an error.
 func (wallet *Wallet) WalletCreationTimeInMillis() (int64, error) {
 	if wallet.IsRestored {
-		return 0, errors.New(ErrWalletIsRestored)
+		return 0, newError(ErrWalletIsRestored)
 	}
 
 	return wallet.CreatedAt.UnixNano() / int64(time.Millisecond), nil
@@ -137,7 +156,7 @@ func (wallet *Wallet) WalletExists() (bool, error) {
 func (wallet *Wallet) createWallet(privatePassphrase, seedMnemonic string) error {
 	log.Info("Creating Wallet")
 	if len(seedMnemonic) == 0 {
-		return errors.New(ErrEmptySeed)
+		return newError(ErrEmptySeed)
 	}
 
 	pubPass := []byte(w.InsecurePubPassphrase)
@@ -189,7 +208,7 @@ func (wallet *Wallet) openWallet() error {
 	openedWallet, err := wallet.loader.OpenExistingWallet(wallet.shutdownContext(), pubPass)
 	if err != nil {
 		log.Error(err)
-		return translateError(err)
+		return walletError(wallet.ID, "openWallet", err)
 	}
 
 	wallet.internal = openedWallet
@@ -204,7 +223,7 @@ func (wallet *Wallet) WalletOpened() bool {
 func (wallet *Wallet) UnlockWallet(privPass []byte) error {
 	loadedWallet, ok := wallet.loader.LoadedWallet()
 	if !ok {
-		return fmt.Errorf("wallet has not been loaded")
+		return walletError(wallet.ID, "UnlockWallet", newError(ErrWalletNotLoaded))
 	}
 
 	defer func() {
@@ -216,7 +235,7 @@ func (wallet *Wallet) UnlockWallet(privPass []byte) error {
 	ctx, _ := wallet.shutdownContextWithCancel()
 	err := loadedWallet.Unlock(ctx, privPass, nil)
 	if err != nil {
-		return translateError(err)
+		return walletError(wallet.ID, "UnlockWallet", err)
 	}
 
 	return nil
@@ -262,7 +281,7 @@ func (wallet *Wallet) deleteWallet(privatePassphrase []byte) error {
 	}()
 
 	if _, loaded := wallet.loader.LoadedWallet(); !loaded {
-		return errors.New(ErrWalletNotLoaded)
+		return newError(ErrWalletNotLoaded)
 	}
 
 	if !wallet.IsWatchingOnlyWallet() {
@@ -282,7 +301,7 @@ func (wallet *Wallet) deleteWallet(privatePassphrase []byte) error {
 // DecryptSeed decrypts wallet.EncryptedSeed using privatePassphrase
 func (wallet *Wallet) DecryptSeed(privatePassphrase []byte) (string, error) {
 	if wallet.EncryptedSeed == nil {
-		return "", errors.New(ErrInvalid)
+		return "", newError(ErrInvalid)
 	}
 
 	return decryptWalletSeed(privatePassphrase, wallet.EncryptedSeed)
@@ -0,0 +1,199 @@
+package dcrlibwallet
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"decred.org/dcrwallet/errors"
+	"github.com/planetdecred/dcrlibwallet/walletdata"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// BackupArchiveVersion is the version of the archives written by
+	// BackupWallet. It is incremented whenever the archive layout changes.
+	BackupArchiveVersion = 1
+
+	backupManifestFileName = "manifest.json"
+	backupWalletDbFileName = "wallet.db"
+	backupConfigFileName   = "config.json"
+)
+
+// walletBackupManifest is the first file of a backup archive. It describes the
+// backed up wallet and the layout of the archive.
+type walletBackupManifest struct {
+	Version   int     `json:"version"`
+	Network   string  `json:"network"`
+	CreatedAt int64   `json:"createdat"`
+	Wallet    *Wallet `json:"wallet"`
+}
+
+// BackupWallet writes a tar archive of the wallet to writer. The archive holds
+// a manifest describing the wallet, a consistent copy of the wallet database
+// in the format of the wallet database driver, a copy of the wallet data
+// database and the wallet config entries. The wallet must be opened.
+func (mw *MultiWallet) BackupWallet(walletID int, writer io.Writer) error {
+	wallet := mw.WalletWithID(walletID)
+	if wallet == nil {
+		return newError(ErrNotExist)
+	}
+	if !wallet.WalletOpened() {
+		return newError(ErrWalletNotLoaded)
+	}
+
+	manifest, err := json.Marshal(&walletBackupManifest{
+		Version:   BackupArchiveVersion,
+		Network:   mw.chainParams.Name,
+		CreatedAt: time.Now().Unix(),
+		Wallet:    wallet,
+	})
+	if err != nil {
+		return errors.E(errors.Encoding, err)
+	}
+
+	config, err := mw.walletConfigEntries(walletID)
+	if err != nil {
+		return err
+	}
+
+	archive := tar.NewWriter(writer)
+
+	err = writeBackupFile(archive, backupManifestFileName, manifest)
+	if err != nil {
+		return err
+	}
+
+	err = mw.writeBackupCopy(archive, backupWalletDbFileName, wallet.loader.CopyDatabase)
+	if err != nil {
+		return translateError(err)
+	}
+
+	err = mw.writeBackupCopy(archive, walletdata.DbName, wallet.walletDataDB.Backup)
+	if err != nil {
+		return translateError(err)
+	}
+
+	err = writeBackupFile(archive, backupConfigFileName, config)
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// BackupWalletToFile writes the archive created by BackupWallet to the file
+// at filePath.
+func (mw *MultiWallet) BackupWalletToFile(walletID int, filePath string) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+
+	err = mw.BackupWallet(walletID, file)
+	if err != nil {
+		file.Close()
+		os.Remove(filePath)
+		return err
+	}
+
+	return file.Close()
+}
+
+// walletConfigEntries returns the JSON encoded config entries of the wallet,
+// keyed without the wallet ID prefix.
+func (mw *MultiWallet) walletConfigEntries(walletID int) ([]byte, error) {
+	prefix := WalletUniqueConfigKey(walletID, "")
+	entries := make(map[string]json.RawMessage)
+
+	err := mw.db.Bolt.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(userConfigBucketName))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			key := string(k)
+			if !strings.HasPrefix(key, prefix) {
+				return nil
+			}
+
+			// the key of wallet 1 is a prefix of the keys of wallet 10
+			key = strings.TrimPrefix(key, prefix)
+			if key == "" || strings.ContainsAny(key[:1], "0123456789") {
+				return nil
+			}
+
+			entries[key] = append(json.RawMessage(nil), v...)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return json.Marshal(entries)
+}
+
+// writeBackupCopy adds the copy written by copyTo to the archive. The copy
+// is buffered to a temporary file since the size of archived files must be
+// known before their content is written.
+func (mw *MultiWallet) writeBackupCopy(archive *tar.Writer, name string, copyTo func(io.Writer) error) error {
+	file, err := ioutil.TempFile(mw.rootDir, filepath.Base(name)+".backup")
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	err = copyTo(file)
+	if err != nil {
+		return err
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return errors.E(errors.IO, err)
+	}
+
+	err = archive.WriteHeader(backupFileHeader(name, size))
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+
+	_, err = io.Copy(archive, file)
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	return nil
+}
+
+func writeBackupFile(archive *tar.Writer, name string, data []byte) error {
+	err := archive.WriteHeader(backupFileHeader(name, int64(len(data))))
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+
+	_, err = archive.Write(data)
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	return nil
+}
+
+func backupFileHeader(name string, size int64) *tar.Header {
+	return &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    size,
+		ModTime: time.Now(),
+	}
+}
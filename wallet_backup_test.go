@@ -0,0 +1,109 @@
+package dcrlibwallet
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	w "decred.org/dcrwallet/wallet"
+	"github.com/asdine/storm"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/planetdecred/dcrlibwallet/walletdata"
+)
+
+var _ = Describe("BackupWallet", func() {
+	for _, dbDriver := range []string{DbDriverBdb, DbDriverBadger} {
+		dbDriver := dbDriver
+
+		It("writes a backup that restores with the "+dbDriver+" driver", func() {
+			mw, cleanup := newTestMultiWalletWithDriver(dbDriver)
+			defer cleanup()
+
+			wallet := newTestWallet(mw, "backup")
+			Expect(wallet.DbDriver).To(Equal(dbDriver))
+
+			_, err := wallet.NextAddress(0)
+			Expect(err).To(BeNil())
+			address, err := wallet.CurrentAddress(0)
+			Expect(err).To(BeNil())
+			_, err = wallet.walletDataDB.SaveOrUpdate(&Transaction{}, &Transaction{Hash: "tx", Timestamp: 1})
+			Expect(err).To(BeNil())
+			wallet.SetStringConfigValueForKey("label", "savings")
+
+			var backup bytes.Buffer
+			Expect(mw.BackupWallet(wallet.ID, &backup)).To(Succeed())
+
+			files := make(map[string][]byte)
+			var names []string
+			archive := tar.NewReader(&backup)
+			for {
+				header, err := archive.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).To(BeNil())
+				files[header.Name], err = ioutil.ReadAll(archive)
+				Expect(err).To(BeNil())
+				names = append(names, header.Name)
+			}
+			Expect(names).To(Equal([]string{backupManifestFileName, backupWalletDbFileName, walletdata.DbName, backupConfigFileName}))
+
+			By("Describing the wallet in the manifest")
+			var manifest walletBackupManifest
+			Expect(json.Unmarshal(files[backupManifestFileName], &manifest)).To(Succeed())
+			Expect(manifest.Version).To(Equal(BackupArchiveVersion))
+			Expect(manifest.Network).To(Equal(mw.chainParams.Name))
+			Expect(manifest.Wallet.ID).To(Equal(wallet.ID))
+			Expect(manifest.Wallet.DbDriver).To(Equal(dbDriver))
+
+			By("Including the wallet config entries")
+			var config map[string]string
+			Expect(json.Unmarshal(files[backupConfigFileName], &config)).To(Succeed())
+			Expect(config).To(HaveKeyWithValue("label", "savings"))
+
+			restoreDir, err := ioutil.TempDir("", "restore")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(restoreDir)
+
+			By("Restoring the wallet database")
+			loader := initWalletLoader(mw.chainParams, restoreDir, dbDriver)
+			Expect(loader.RestoreDatabase(bytes.NewReader(files[backupWalletDbFileName]))).To(Succeed())
+			restored, err := loader.OpenExistingWallet(context.Background(), []byte(w.InsecurePubPassphrase))
+			Expect(err).To(BeNil())
+			defer loader.UnloadWallet()
+
+			ctx := context.Background()
+			xpub, err := wallet.internal.AccountXpub(ctx, 0)
+			Expect(err).To(BeNil())
+			restoredXpub, err := restored.AccountXpub(ctx, 0)
+			Expect(err).To(BeNil())
+			Expect(restoredXpub.String()).To(Equal(xpub.String()))
+
+			restoredAddress, err := restored.CurrentAddress(0)
+			Expect(err).To(BeNil())
+			Expect(restoredAddress.String()).To(Equal(address))
+
+			By("Restoring the wallet data database")
+			dataPath := filepath.Join(restoreDir, walletdata.DbName)
+			Expect(ioutil.WriteFile(dataPath, files[walletdata.DbName], 0600)).To(Succeed())
+			db, err := storm.Open(dataPath)
+			Expect(err).To(BeNil())
+			defer db.Close()
+			var tx Transaction
+			Expect(db.One("Hash", "tx", &tx)).To(Succeed())
+		})
+	}
+
+	It("fails for missing wallets", func() {
+		mw, cleanup := newTestMultiWallet()
+		defer cleanup()
+
+		Expect(mw.BackupWallet(1, ioutil.Discard)).To(MatchError(ErrNotExist))
+	})
+})
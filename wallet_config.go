@@ -1,7 +1,6 @@
 package dcrlibwallet
 
 import (
-	"decred.org/dcrwallet/errors"
 	"github.com/asdine/storm"
 )
 
@@ -10,6 +9,8 @@ const (
 	AccountMixerMixedAccount   = "account_mixer_mixed_account"
 	AccountMixerUnmixedAccount = "account_mixer_unmixed_account"
 	AccountMixerMixTxChange    = "account_mixer_mix_tx_change"
+
+	WalletSyncPausedConfigKey = "wallet_sync_paused"
 )
 
 func (wallet *Wallet) SaveUserConfigValue(key string, value interface{}) {
@@ -27,7 +28,7 @@ func (wallet *Wallet) SaveUserConfigValue(key string, value interface{}) {
 func (wallet *Wallet) ReadUserConfigValue(key string, valueOut interface{}) error {
 	if wallet.setUserConfigValue == nil {
 		log.Errorf("call wallet.prepare before reading wallet config values")
-		return errors.New(ErrFailedPrecondition)
+		return newError(ErrFailedPrecondition)
 	}
 
 	err := wallet.readUserConfigValue(false, key, valueOut)
@@ -0,0 +1,163 @@
+package dcrlibwallet
+
+import (
+	"github.com/planetdecred/dcrlibwallet/spv"
+)
+
+// IsSyncPaused returns true if the wallet is excluded from sync.
+func (wallet *Wallet) IsSyncPaused() bool {
+	return wallet.ReadBoolConfigValueForKey(WalletSyncPausedConfigKey, false)
+}
+
+// PauseWalletSync excludes the wallet from sync. If sync is ongoing, the
+// wallet is removed from sync while other wallets keep syncing. The wallet
+// remains excluded from future syncs until ResumeWalletSync is called. The
+// wallet is not paused if it can't be removed from sync.
+func (mw *MultiWallet) PauseWalletSync(walletID int) error {
+	wallet := mw.WalletWithID(walletID)
+	if wallet == nil {
+		return walletError(walletID, "PauseWalletSync", newError(ErrNotExist))
+	}
+
+	if wallet.IsSyncPaused() {
+		return nil
+	}
+
+	restartSync, err := mw.removeWalletFromSync(wallet)
+	if err != nil {
+		return walletError(wallet.ID, "PauseWalletSync", err)
+	}
+	wallet.SetBoolConfigValueForKey(WalletSyncPausedConfigKey, true)
+
+	if restartSync && len(mw.syncableWallets()) > 0 {
+		return mw.Sync()
+	}
+	return nil
+}
+
+// ResumeWalletSync includes a previously paused wallet in sync. If sync is
+// ongoing, the wallet is added to it without restarting the sync of other
+// wallets.
+func (mw *MultiWallet) ResumeWalletSync(walletID int) error {
+	wallet := mw.WalletWithID(walletID)
+	if wallet == nil {
+		return walletError(walletID, "ResumeWalletSync", newError(ErrNotExist))
+	}
+
+	if !wallet.IsSyncPaused() {
+		return nil
+	}
+	wallet.SetBoolConfigValueForKey(WalletSyncPausedConfigKey, false)
+
+	return walletError(wallet.ID, "ResumeWalletSync", mw.addWalletToSync(wallet))
+}
+
+// syncableWallets returns the wallets that should be synced, i.e. opened
+// wallets that are not paused and whose database is not being migrated.
+func (mw *MultiWallet) syncableWallets() map[int]*Wallet {
+	wallets := make(map[int]*Wallet, len(mw.wallets))
+	for id, wallet := range mw.wallets {
+		if wallet.WalletOpened() && !wallet.IsSyncPaused() && !wallet.IsMigratingDatabase() {
+			wallets[id] = wallet
+		}
+	}
+	return wallets
+}
+
+// allWalletsSynced returns true if all opened wallets that are not paused
+// are synced.
+func (mw *MultiWallet) allWalletsSynced() bool {
+	for _, wallet := range mw.syncableWallets() {
+		if !wallet.synced {
+			return false
+		}
+	}
+	return true
+}
+
+// activeSpvSyncer returns the running SPV syncer, if any.
+func (mw *MultiWallet) activeSpvSyncer() *spv.Syncer {
+	mw.syncData.mu.RLock()
+	defer mw.syncData.mu.RUnlock()
+
+	if mw.syncData.activeSyncData == nil {
+		return nil
+	}
+	return mw.syncData.syncer
+}
+
+// addWalletToSync adds the wallet to the ongoing sync, if any. Over SPV, the
+// wallet is added to the running syncer, otherwise sync is restarted.
+func (mw *MultiWallet) addWalletToSync(wallet *Wallet) error {
+	if !mw.IsConnectedToDecredNetwork() || wallet.IsSyncPaused() || wallet.IsMigratingDatabase() {
+		return nil
+	}
+
+	syncer := mw.activeSpvSyncer()
+	if syncer == nil {
+		return mw.RestartSync()
+	}
+
+	wallet.waitingForHeaders = true
+	wallet.syncing = true
+	wallet.synced = false
+
+	mw.syncData.mu.Lock()
+	mw.syncData.synced = false
+	mw.syncData.syncing = true
+	mw.syncData.mu.Unlock()
+
+	return syncer.AddWallet(wallet.ID, wallet.internal)
+}
+
+// removeWalletFromSync removes the wallet from the ongoing sync, if any. Sync
+// is canceled if no other wallet is being synced over SPV. If sync isn't over
+// SPV, sync is canceled and true is returned to indicate that the caller
+// should restart sync once the wallet is excluded from it.
+func (mw *MultiWallet) removeWalletFromSync(wallet *Wallet) (restartSync bool, err error) {
+	if !mw.IsConnectedToDecredNetwork() {
+		return false, nil
+	}
+
+	syncer := mw.activeSpvSyncer()
+	if syncer == nil {
+		mw.CancelSync()
+		return true, nil
+	}
+
+	syncedWalletIDs := syncer.WalletIDs()
+	isSynced := false
+	for _, id := range syncedWalletIDs {
+		isSynced = isSynced || id == wallet.ID
+	}
+	if !isSynced {
+		return false, nil
+	}
+	if len(syncedWalletIDs) == 1 {
+		mw.CancelSync()
+		return false, nil
+	}
+
+	err = syncer.RemoveWallet(wallet.ID)
+	if err != nil {
+		return false, err
+	}
+
+	wallet.waitingForHeaders = false
+	wallet.syncing = false
+	wallet.synced = false
+
+	// The removed wallet may have been the last one still syncing.
+	mw.syncData.mu.Lock()
+	remainingSynced := !mw.syncData.synced && mw.allWalletsSynced()
+	if remainingSynced {
+		mw.syncData.syncing = false
+		mw.syncData.synced = true
+	}
+	mw.syncData.mu.Unlock()
+
+	if remainingSynced {
+		mw.indexTransactionsAndNotifySynced(true)
+	}
+	return false, nil
+}
@@ -0,0 +1,52 @@
+package dcrlibwallet
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WalletSync", func() {
+	var rootDir string
+	var mw *MultiWallet
+
+	BeforeEach(func() {
+		var err error
+		rootDir, err = ioutil.TempDir("", "dcrlibwallet")
+		Expect(err).To(BeNil())
+		mw = openTestMultiWallet(rootDir)
+	})
+
+	AfterEach(func() {
+		mw.Shutdown()
+		os.RemoveAll(rootDir)
+	})
+
+	It("only syncs opened wallets that are not paused", func() {
+		wallet := newTestWallet(mw, "sync")
+		Expect(mw.syncableWallets()).To(HaveKey(wallet.ID))
+
+		By("Skipping wallets that are not opened")
+		mw.Shutdown()
+		mw = openTestMultiWallet(rootDir)
+		Expect(mw.WalletWithID(wallet.ID).WalletOpened()).To(BeFalse())
+		Expect(mw.syncableWallets()).To(BeEmpty())
+		Expect(mw.SpvSync()).To(MatchError(ErrFailedPrecondition))
+
+		Expect(mw.OpenWallets(nil)).To(BeNil())
+		Expect(mw.syncableWallets()).To(HaveKey(wallet.ID))
+
+		By("Skipping paused wallets")
+		Expect(mw.PauseWalletSync(wallet.ID)).To(BeNil())
+		Expect(mw.WalletWithID(wallet.ID).IsSyncPaused()).To(BeTrue())
+		Expect(mw.syncableWallets()).To(BeEmpty())
+
+		Expect(mw.ResumeWalletSync(wallet.ID)).To(BeNil())
+		Expect(mw.WalletWithID(wallet.ID).IsSyncPaused()).To(BeFalse())
+		Expect(mw.syncableWallets()).To(HaveKey(wallet.ID))
+
+		Expect(mw.PauseWalletSync(wallet.ID + 1)).To(MatchError(ErrNotExist))
+	})
+})
@@ -2,6 +2,7 @@ package walletdata
 
 import (
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/asdine/storm"
@@ -16,8 +17,9 @@ const (
 	TxBucketName = "TxIndexInfo"
 	KeyDbVersion = "DbVersion"
 
-	// TxDbVersion is necessary to force re-indexing if changes are made to the structure of data being stored.
-	// Increment this version number if db structure changes such that client apps need to re-index.
+	// TxDbVersion is the version of the structure of the data being stored.
+	// Add a migration to `migrations` and increment this version number if the
+	// db structure changes.
 	TxDbVersion uint32 = 3
 )
 
@@ -28,17 +30,18 @@ type DB struct {
 }
 
 // Initialize opens the existing storm db at `dbPath`
-// and checks the database version for compatibility.
-// If there is a version mismatch or the db does not exist at `dbPath`,
-// a new db is created and the current db version number saved to the db.
+// and upgrades the database to `TxDbVersion` if it is older.
+// If the db does not exist at `dbPath`, a new db is created
+// and the current db version number saved to the db.
 func Initialize(dbPath string, chainParams *chaincfg.Params, txData, vspdData interface{}) (*DB, error) {
 	walletDataDB, err := openOrCreateDB(dbPath)
 	if err != nil {
 		return nil, err
 	}
 
-	walletDataDB, err = ensureTxDatabaseVersion(walletDataDB, dbPath, txData)
+	err = upgradeDatabase(walletDataDB, dbPath, txData, migrations)
 	if err != nil {
+		walletDataDB.Close()
 		return nil, err
 	}
 
@@ -61,6 +64,14 @@ func Initialize(dbPath string, chainParams *chaincfg.Params, txData, vspdData in
 	}, nil
 }
 
+// Backup writes a consistent copy of the wallet data database to w.
+func (db *DB) Backup(w io.Writer) error {
+	return db.walletDataDB.Bolt.View(func(tx *bolt.Tx) error {
+		_, err := tx.WriteTo(w)
+		return err
+	})
+}
+
 func openOrCreateDB(dbPath string) (*storm.DB, error) {
 	var isNewDbFile bool
 
@@ -94,28 +105,3 @@ func openOrCreateDB(dbPath string) (*storm.DB, error) {
 
 	return walletDataDB, nil
 }
-
-// ensureTxDatabaseVersion checks the version of the existing db against `TxDbVersion`.
-// If there's a difference, the current wallet data db file is deleted and a new one created.
-func ensureTxDatabaseVersion(walletDataDB *storm.DB, dbPath string, txData interface{}) (*storm.DB, error) {
-	var currentDbVersion uint32
-	err := walletDataDB.Get(TxBucketName, KeyDbVersion, &currentDbVersion)
-	if err != nil && err != storm.ErrNotFound {
-		// ignore key not found errors as earlier db versions did not set a version number in the db.
-		return nil, fmt.Errorf("error checking wallet data database version: %s", err.Error())
-	}
-
-	if currentDbVersion != TxDbVersion {
-		if err = walletDataDB.Drop(txData); err != nil {
-			return nil, fmt.Errorf("error deleting outdated wallet data database: %s", err.Error())
-		}
-
-		if err = walletDataDB.Set(TxBucketName, KeyDbVersion, TxDbVersion); err != nil {
-			return nil, fmt.Errorf("error updating tx db version: %s", err.Error())
-		}
-
-		return walletDataDB, walletDataDB.Set(TxBucketName, KeyEndBlock, 0) // reset tx index
-	}
-
-	return walletDataDB, nil
-}
@@ -0,0 +1,154 @@
+package walletdata
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/asdine/storm"
+	bolt "go.etcd.io/bbolt"
+)
+
+const KeyMigrationStatus = "MigrationStatus"
+
+// migration upgrades the database by one version. All the migrations of an
+// upgrade run in a single database transaction.
+type migration struct {
+	description string
+	upgrade     func(tx storm.Node, txData interface{}) error
+}
+
+// migrations upgrade the wallet data database, migrations[i] upgrades a
+// database at version i to version i+1. Databases created before versioning
+// have version 0.
+var migrations = []migration{
+	{
+		description: "reindex transactions indexed before db versioning",
+		upgrade:     dropIndexedTransactions,
+	},
+	{
+		description: "reindex transactions saved with the version 1 structure",
+		upgrade:     dropIndexedTransactions,
+	},
+	{
+		description: "reindex transactions saved with the version 2 structure",
+		upgrade:     dropIndexedTransactions,
+	},
+}
+
+// MigrationStatus describes the version of the database and the last upgrade
+// of the database, if any.
+type MigrationStatus struct {
+	Version       uint32 `json:"version"`
+	LatestVersion uint32 `json:"latestVersion"`
+
+	// UpgradedFrom and UpgradedAt are the version of the database before
+	// the last upgrade and the time of the upgrade. Migrations describes the
+	// migrations run. BackupPath is a copy of the database made before the
+	// upgrade.
+	UpgradedFrom uint32   `json:"upgradedFrom"`
+	UpgradedAt   int64    `json:"upgradedAt"`
+	Migrations   []string `json:"migrations"`
+	BackupPath   string   `json:"backupPath"`
+}
+
+// MigrationStatus returns the version of the database and describes its last
+// upgrade.
+func (db *DB) MigrationStatus() (*MigrationStatus, error) {
+	status := new(MigrationStatus)
+	err := db.walletDataDB.Get(TxBucketName, KeyMigrationStatus, status)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, fmt.Errorf("error reading wallet data migration status: %s", err.Error())
+	}
+
+	status.Version, err = databaseVersion(db.walletDataDB)
+	if err != nil {
+		return nil, err
+	}
+	status.LatestVersion = TxDbVersion
+	return status, nil
+}
+
+func databaseVersion(node storm.Node) (uint32, error) {
+	var version uint32
+	err := node.Get(TxBucketName, KeyDbVersion, &version)
+	if err != nil && err != storm.ErrNotFound {
+		// ignore key not found errors as earlier db versions did not set a version number in the db.
+		return 0, fmt.Errorf("error checking wallet data database version: %s", err.Error())
+	}
+	return version, nil
+}
+
+// upgradeDatabase runs the migrations needed to bring the database to the
+// version reached by the last migration, after copying the database next to
+// `dbPath`. The migrations run in a single transaction, the database is left
+// unchanged if any of them fails.
+//
+// Databases from a newer version of the library are reset since their data
+// can't be read reliably.
+func upgradeDatabase(walletDataDB *storm.DB, dbPath string, txData interface{}, migrations []migration) error {
+	version, err := databaseVersion(walletDataDB)
+	if err != nil {
+		return err
+	}
+
+	latestVersion := uint32(len(migrations))
+	if version == latestVersion {
+		return nil
+	}
+
+	backupPath := fmt.Sprintf("%s.v%d.bak", dbPath, version)
+	err = walletDataDB.Bolt.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(backupPath, 0600)
+	})
+	if err != nil {
+		return fmt.Errorf("error backing up wallet data database: %s", err.Error())
+	}
+
+	tx, err := walletDataDB.Begin(true)
+	if err != nil {
+		return fmt.Errorf("error upgrading wallet data database: %s", err.Error())
+	}
+	defer tx.Rollback()
+
+	status := &MigrationStatus{
+		UpgradedFrom: version,
+		UpgradedAt:   time.Now().Unix(),
+		BackupPath:   backupPath,
+	}
+
+	if version > latestVersion {
+		status.Migrations = append(status.Migrations, "reset database of newer version")
+		err = dropIndexedTransactions(tx, txData)
+		if err != nil {
+			return fmt.Errorf("error deleting outdated wallet data database: %s", err.Error())
+		}
+	}
+
+	for v := version; v < latestVersion; v++ {
+		status.Migrations = append(status.Migrations, migrations[v].description)
+		err = migrations[v].upgrade(tx, txData)
+		if err != nil {
+			return fmt.Errorf("error upgrading wallet data database to version %d: %s", v+1, err.Error())
+		}
+	}
+
+	if err = tx.Set(TxBucketName, KeyDbVersion, latestVersion); err != nil {
+		return fmt.Errorf("error updating tx db version: %s", err.Error())
+	}
+	if err = tx.Set(TxBucketName, KeyMigrationStatus, status); err != nil {
+		return fmt.Errorf("error saving wallet data migration status: %s", err.Error())
+	}
+
+	return tx.Commit()
+}
+
+// dropIndexedTransactions deletes the indexed transactions and resets the tx
+// index so that transactions are indexed again.
+func dropIndexedTransactions(tx storm.Node, txData interface{}) error {
+	err := tx.Drop(txData)
+	if err != nil && err != bolt.ErrBucketNotFound {
+		return err
+	}
+
+	return tx.Set(TxBucketName, KeyEndBlock, 0) // reset tx index
+}
@@ -0,0 +1,195 @@
+package walletdata
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/asdine/storm"
+	"github.com/decred/dcrd/chaincfg/v3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type testTransaction struct {
+	ID        int    `storm:"id,increment"`
+	Hash      string `storm:"unique"`
+	Timestamp int64
+}
+
+type testVspdTicket struct {
+	ID   int    `storm:"id,increment"`
+	Hash string `storm:"unique"`
+}
+
+var _ = Describe("Migrations", func() {
+	var dir, dbPath string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "walletdata")
+		Expect(err).To(BeNil())
+		dbPath = filepath.Join(dir, DbName)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	// createDB creates a database at version, without a version number if
+	// version is 0, holding a transaction and a vspd ticket.
+	createDB := func(version uint32) {
+		db, err := storm.Open(dbPath)
+		Expect(err).To(BeNil())
+		defer db.Close()
+
+		if version > 0 {
+			Expect(db.Set(TxBucketName, KeyDbVersion, version)).To(BeNil())
+		}
+		Expect(db.Set(TxBucketName, KeyEndBlock, int32(100))).To(BeNil())
+		Expect(db.Save(&testTransaction{Hash: "tx", Timestamp: 1})).To(BeNil())
+		Expect(db.Save(&testVspdTicket{Hash: "ticket"})).To(BeNil())
+	}
+
+	initialize := func() *DB {
+		db, err := Initialize(dbPath, chaincfg.TestNet3Params(), &testTransaction{}, &testVspdTicket{})
+		Expect(err).To(BeNil())
+		return db
+	}
+
+	countRecords := func(db *DB) (txs, tickets int) {
+		txs, err := db.walletDataDB.Count(&testTransaction{})
+		Expect(err).To(BeNil())
+		tickets, err = db.walletDataDB.Count(&testVspdTicket{})
+		Expect(err).To(BeNil())
+		return txs, tickets
+	}
+
+	It("has a migration for each version", func() {
+		Expect(migrations).To(HaveLen(int(TxDbVersion)))
+	})
+
+	It("creates new databases at the latest version", func() {
+		db := initialize()
+		defer db.Close()
+
+		status, err := db.MigrationStatus()
+		Expect(err).To(BeNil())
+		Expect(status.Version).To(Equal(TxDbVersion))
+		Expect(status.LatestVersion).To(Equal(TxDbVersion))
+		Expect(status.UpgradedAt).To(BeZero())
+		Expect(status.Migrations).To(BeEmpty())
+	})
+
+	It("leaves databases at the latest version unchanged", func() {
+		createDB(TxDbVersion)
+
+		db := initialize()
+		defer db.Close()
+
+		txs, tickets := countRecords(db)
+		Expect(txs).To(Equal(1))
+		Expect(tickets).To(Equal(1))
+
+		endBlock, err := db.LastIndexPoint()
+		Expect(err).To(BeNil())
+		Expect(endBlock).To(Equal(int32(100)))
+
+		_, err = os.Stat(dbPath + ".v3.bak")
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	for version := uint32(0); version < TxDbVersion; version++ {
+		version := version
+
+		It("upgrades databases from each older version", func() {
+			createDB(version)
+
+			db := initialize()
+			defer db.Close()
+
+			By("Running each migration from the database version")
+			status, err := db.MigrationStatus()
+			Expect(err).To(BeNil())
+			Expect(status.Version).To(Equal(TxDbVersion))
+			Expect(status.UpgradedFrom).To(Equal(version))
+			Expect(status.UpgradedAt).ToNot(BeZero())
+			Expect(status.Migrations).To(HaveLen(int(TxDbVersion - version)))
+			for i, description := range status.Migrations {
+				Expect(description).To(Equal(migrations[int(version)+i].description))
+			}
+
+			By("Dropping the indexed transactions and keeping the vspd tickets")
+			txs, tickets := countRecords(db)
+			Expect(txs).To(BeZero())
+			Expect(tickets).To(Equal(1))
+
+			endBlock, err := db.LastIndexPoint()
+			Expect(err).To(BeNil())
+			Expect(endBlock).To(BeZero())
+
+			By("Backing up the database before the upgrade")
+			backup, err := storm.Open(status.BackupPath)
+			Expect(err).To(BeNil())
+			defer backup.Close()
+
+			backupVersion, err := databaseVersion(backup)
+			Expect(err).To(BeNil())
+			Expect(backupVersion).To(Equal(version))
+
+			backupTxs, err := backup.Count(&testTransaction{})
+			Expect(err).To(BeNil())
+			Expect(backupTxs).To(Equal(1))
+		})
+	}
+
+	It("resets databases of a newer version", func() {
+		createDB(TxDbVersion + 1)
+
+		db := initialize()
+		defer db.Close()
+
+		status, err := db.MigrationStatus()
+		Expect(err).To(BeNil())
+		Expect(status.Version).To(Equal(TxDbVersion))
+		Expect(status.UpgradedFrom).To(Equal(TxDbVersion + 1))
+
+		txs, tickets := countRecords(db)
+		Expect(txs).To(BeZero())
+		Expect(tickets).To(Equal(1))
+	})
+
+	It("leaves the database unchanged if a migration fails", func() {
+		createDB(1)
+
+		db, err := storm.Open(dbPath)
+		Expect(err).To(BeNil())
+		defer db.Close()
+
+		failingMigrations := []migration{
+			migrations[0],
+			migrations[1],
+			{
+				description: "failing migration",
+				upgrade: func(storm.Node, interface{}) error {
+					return errors.New("migration failed")
+				},
+			},
+		}
+		err = upgradeDatabase(db, dbPath, &testTransaction{}, failingMigrations)
+		Expect(err).ToNot(BeNil())
+
+		version, err := databaseVersion(db)
+		Expect(err).To(BeNil())
+		Expect(version).To(Equal(uint32(1)))
+
+		txs, err := db.Count(&testTransaction{})
+		Expect(err).To(BeNil())
+		Expect(txs).To(Equal(1))
+
+		var endBlock int32
+		Expect(db.Get(TxBucketName, KeyEndBlock, &endBlock)).To(BeNil())
+		Expect(endBlock).To(Equal(int32(100)))
+	})
+})
@@ -51,6 +51,12 @@ func (db *DB) SaveOrUpdateVspdRecord(emptyTxPointer, record interface{}) (update
 	return
 }
 
+// Save saves a record to the database, replacing the saved record with the
+// same ID if any.
+func (db *DB) Save(record interface{}) error {
+	return db.walletDataDB.Save(record)
+}
+
 func (db *DB) LastIndexPoint() (int32, error) {
 	var endBlockHeight int32
 	err := db.walletDataDB.Get(TxBucketName, KeyEndBlock, &endBlockHeight)